@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,6 +17,7 @@ import (
 	"my-go-app/internal/infrastructure/database"
 	"my-go-app/pkg/config" // ✅ ИСПОЛЬЗУЕМ config пакет
 	"my-go-app/pkg/middleware"
+	"my-go-app/pkg/secretbox"
 )
 
 func main() {
@@ -37,11 +43,56 @@ func main() {
 	}
 
 	streamRepo := database.NewStreamRepository(db)
-	streamService := services.NewStreamService(streamRepo)
+	presetRepo := database.NewPresetRepository(db)
+	recordingRepo := database.NewRecordingRepository(db)
+	destinationRepo := database.NewDestinationRepository(db)
+	eventRepo := database.NewEventRepository(db)
+	scheduleRepo := database.NewScheduleRepository(db)
+	scheduleRunRepo := database.NewScheduleRunRepository(db)
+	switch cfg.SecurityConfig.SecretsKey {
+	case "":
+		log.Fatal("❌ SECRETS_KEY is not set: refusing to start without a key for ingest secrets")
+	case config.LegacyDefaultSecretsKey:
+		log.Println("🚨 SECRETS_KEY is the publicly known default value: ingest secrets in the database are effectively unencrypted, set a random key")
+	}
+	secrets, err := secretbox.New(cfg.SecurityConfig.SecretsKey)
+	if err != nil {
+		log.Fatal("Failed to initialize secrets encryption:", err)
+	}
+	if cfg.SecurityConfig.APIToken == "" {
+		log.Println("⚠️ API_TOKEN is not set: ingest secrets will not be returned by the API")
+	}
+
+	streamService := services.NewStreamService(streamRepo, presetRepo, destinationRepo, secrets)
+	presetService := services.NewPresetService(presetRepo, streamRepo)
+	recordingService := services.NewRecordingService(recordingRepo, streamRepo)
+	destinationService := services.NewDestinationService(destinationRepo, streamRepo)
+	eventService := services.NewEventService(eventRepo, streamRepo)
+	scheduleService := services.NewScheduleService(scheduleRepo, scheduleRunRepo, streamRepo)
 
-	streamHandler := handlers.NewStreamHandler(streamService)
+	if err := presetService.EnsureDefaultPreset(context.Background()); err != nil {
+		log.Printf("⚠️ Failed to create default preset: %v", err)
+	}
+
+	streamHandler := handlers.NewStreamHandler(streamService, destinationService, eventService, scheduleService, cfg.SecurityConfig.APIToken)
+	presetHandler := handlers.NewPresetHandler(presetService)
+	recordingHandler := handlers.NewRecordingHandler(recordingService, cfg.SecurityConfig.APIToken)
 	healthHandler := handlers.NewHealthHandler(db)
-	internalHandler := handlers.NewInternalHandler(streamService) // ✅ НОВЫЙ HANDLER
+	internalHandler := handlers.NewInternalHandler(streamService, eventService) // ✅ НОВЫЙ HANDLER
+
+	// Планировщик безопасен при нескольких репликах: слот выполняет та, что первой запишет его в базу
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	schedulerDone := make(chan struct{})
+	if cfg.SchedulerConfig.Enabled {
+		scheduler := services.NewScheduler(scheduleRepo, scheduleRunRepo, streamRepo, streamHandler.RunScheduledAction,
+			cfg.SchedulerConfig.Interval, cfg.SchedulerConfig.MaxLateness)
+		go func() {
+			defer close(schedulerDone)
+			scheduler.Run(schedulerCtx)
+		}()
+	} else {
+		close(schedulerDone)
+	}
 
 	timeoutShort := middleware.TimeoutMiddleware(5 * time.Second)
 	timeoutMedium := middleware.TimeoutMiddleware(15 * time.Second)
@@ -49,16 +100,74 @@ func main() {
 
 	http.Handle("/api/tasks", timeoutLong(http.HandlerFunc(streamHandler.HandleStreams)))
 	http.Handle("/api/tasks/", timeoutMedium(http.HandlerFunc(streamHandler.HandleStreamByID)))
-	http.Handle("/api/streams/", timeoutLong(http.HandlerFunc(streamHandler.HandleStreamControl)))
+	streamControl := timeoutLong(http.HandlerFunc(streamHandler.HandleStreamControl))
+	// tailCtx закрывается при остановке сервера: иначе Shutdown ждал бы открытые
+	// потоки логов до ShutdownTimeout
+	tailCtx, stopTails := context.WithCancel(context.Background())
+	defer stopTails()
+	http.Handle("/api/streams/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Поток событий логов (SSE) живет дольше любого таймаута, но не дольше сервера
+		if strings.HasSuffix(r.URL.Path, "/logs/tail") {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			stop := context.AfterFunc(tailCtx, cancel)
+			defer stop()
+			streamHandler.HandleStreamControl(w, r.WithContext(ctx))
+			return
+		}
+		streamControl.ServeHTTP(w, r)
+	}))
 	http.Handle("/api/health", timeoutShort(http.HandlerFunc(healthHandler.HandleHealth)))
+	http.Handle("/api/presets", timeoutMedium(http.HandlerFunc(presetHandler.HandlePresets)))
+	http.Handle("/api/presets/", timeoutMedium(http.HandlerFunc(presetHandler.HandlePresetByName)))
+	http.Handle("/api/recordings", timeoutMedium(http.HandlerFunc(recordingHandler.HandleRecordings)))
+	http.Handle("/api/recordings/", timeoutMedium(http.HandlerFunc(recordingHandler.HandleRecordingByID)))
 
 	// ✅ НОВЫЙ ENDPOINT для внутренних обновлений
 	http.Handle("/api/internal/stream-status", timeoutShort(http.HandlerFunc(internalHandler.HandleStreamStatusUpdate)))
+	http.Handle("/api/internal/stream-media", timeoutShort(http.HandlerFunc(internalHandler.HandleStreamMediaUpdate)))
+	http.Handle("/api/internal/recordings", timeoutShort(http.HandlerFunc(recordingHandler.HandleRecordingWebhook)))
+	http.Handle("/api/internal/stream-events", timeoutShort(http.HandlerFunc(internalHandler.HandleStreamEvent)))
 	// ✅ НОВЫЙ ENDPOINT: Proxy для streaming service
 	http.Handle("/api/streaming-proxy/", timeoutMedium(http.HandlerFunc(streamHandler.HandleStreamingServiceProxy)))
 
 	http.Handle("/", http.FileServer(http.Dir("./static/")))
 
+	srv := &http.Server{Addr: cfg.ServerConfig.Port}
+	srv.RegisterOnShutdown(stopTails)
+	serverErr := make(chan error, 1)
+	go func() { serverErr <- srv.ListenAndServe() }()
 	log.Printf("🚀 Server starting on %s", cfg.ServerConfig.Port)
-	log.Fatal(http.ListenAndServe(cfg.ServerConfig.Port, nil))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case sig := <-signals:
+		log.Printf("🛑 Received %s, shutting down (timeout %s)", sig, cfg.ServerConfig.ShutdownTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ServerConfig.ShutdownTimeout)
+	defer cancel()
+
+	// Планировщик не берет новые слоты, начатое действие доводится до конца
+	stopScheduler()
+
+	// Новые соединения не принимаются, текущие запросы (в том числе вебхуки
+	// streaming service) завершаются до срока
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ Not all requests finished before shutdown timeout: %v", err)
+		srv.Close()
+	}
+	select {
+	case <-schedulerDone:
+	case <-ctx.Done():
+		log.Printf("⚠️ Scheduler did not finish before shutdown timeout")
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	log.Println("✅ Server stopped")
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Коды ошибок запуска, по которым основное приложение отличает отказ
+// из-за нехватки ресурсов от ошибки в параметрах или в ffmpeg
+const (
+	ErrCodeCapacityExceeded = "capacity_exceeded"
+	ErrCodeShuttingDown     = "shutting_down"
+)
+
+// capacityRejections - сколько запусков отклонено проверкой емкости
+var capacityRejections atomic.Int64
+
+// CapacityStats - лимиты и остаток емкости сервиса для /health.
+// Remaining* равны -1, если лимит не задан.
+type CapacityStats struct {
+	Accepting bool `json:"accepting"` // сервис принимает новые потоки
+
+	MaxStreams       int `json:"max_streams"`
+	Streams          int `json:"streams"`
+	RemainingStreams int `json:"remaining_streams"`
+
+	MaxTranscodeStreams       int `json:"max_transcode_streams"`
+	TranscodeStreams          int `json:"transcode_streams"`
+	RemainingTranscodeStreams int `json:"remaining_transcode_streams"`
+
+	MinFreeDiskBytes int64            `json:"min_free_disk_bytes"`
+	FreeDiskBytes    map[string]int64 `json:"free_disk_bytes,omitempty"` // по каталогам HLS и записей
+
+	Rejections int64 `json:"rejections"`
+}
+
+// capacityUsage считает потоки вместе с допущенными, но еще не зарегистрированными.
+// Вызывается под manager.mutex.
+func capacityUsage() (streams, transcode int) {
+	for _, stream := range manager.streams {
+		streams++
+		if stream.Mode == ModeTranscode {
+			transcode++
+		}
+	}
+	for _, isTranscode := range manager.admitting {
+		streams++
+		if isTranscode {
+			transcode++
+		}
+	}
+	return streams, transcode
+}
+
+// admitStream проверяет лимиты перед запуском и резервирует место за потоком.
+// Резерв снимается release, после того как поток добавлен в manager.streams
+// или запуск не удался. При отказе возвращается готовый ответ API.
+func admitStream(streamID string, options StreamOptions) (release func(), rejected *StreamResponse) {
+	transcode := options.Mode == ModeTranscode
+
+	// Диск проверяем до блокировки: statfs может быть медленным на сетевых томах
+	paths := []string{serviceConfig.HLSRoot}
+	if options.Record {
+		paths = append(paths, serviceConfig.RecordingsPath)
+	}
+	for _, path := range paths {
+		if free, ok := diskFreeBytes(path); ok && free < serviceConfig.MinFreeDiskBytes {
+			return nil, rejectStart(streamID,
+				fmt.Sprintf("Недостаточно места на диске (%s)", path),
+				fmt.Sprintf("free disk space on %s is %d MB, minimum is %d MB", path, free>>20, serviceConfig.MinFreeDiskBytes>>20))
+		}
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	// Проверяем, не существует ли уже поток
+	_, exists := manager.streams[streamID]
+	if _, starting := manager.admitting[streamID]; exists || starting {
+		return nil, &StreamResponse{
+			Message: "Поток уже запущен",
+			Error:   "Stream already running",
+		}
+	}
+
+	streams, transcodeStreams := capacityUsage()
+	if serviceConfig.MaxStreams > 0 && streams >= serviceConfig.MaxStreams {
+		return nil, rejectStart(streamID,
+			"Достигнут лимит одновременных потоков",
+			fmt.Sprintf("max concurrent streams reached (%d)", serviceConfig.MaxStreams))
+	}
+	if transcode && serviceConfig.MaxTranscodeStreams > 0 && transcodeStreams >= serviceConfig.MaxTranscodeStreams {
+		return nil, rejectStart(streamID,
+			"Достигнут лимит потоков с транскодированием",
+			fmt.Sprintf("max transcode streams reached (%d)", serviceConfig.MaxTranscodeStreams))
+	}
+
+	manager.admitting[streamID] = transcode
+	return func() {
+		manager.mutex.Lock()
+		delete(manager.admitting, streamID)
+		manager.mutex.Unlock()
+	}, nil
+}
+
+func rejectStart(streamID, message, reason string) *StreamResponse {
+	capacityRejections.Add(1)
+	log.Printf("🚫 Запуск потока %s отклонен: %s", streamID, reason)
+	return &StreamResponse{
+		Message: message,
+		Error:   reason,
+		Code:    ErrCodeCapacityExceeded,
+	}
+}
+
+// capacityStats возвращает лимиты, занятость и свободное место для /health
+func capacityStats() CapacityStats {
+	manager.mutex.RLock()
+	streams, transcode := capacityUsage()
+	manager.mutex.RUnlock()
+
+	stats := CapacityStats{
+		Accepting:                 !shuttingDown.Load(),
+		MaxStreams:                serviceConfig.MaxStreams,
+		Streams:                   streams,
+		RemainingStreams:          remaining(serviceConfig.MaxStreams, streams),
+		MaxTranscodeStreams:       serviceConfig.MaxTranscodeStreams,
+		TranscodeStreams:          transcode,
+		RemainingTranscodeStreams: remaining(serviceConfig.MaxTranscodeStreams, transcode),
+		MinFreeDiskBytes:          serviceConfig.MinFreeDiskBytes,
+		FreeDiskBytes:             make(map[string]int64),
+		Rejections:                capacityRejections.Load(),
+	}
+	// Транскодирование ограничено и общим лимитом потоков
+	if stats.RemainingStreams >= 0 && (stats.RemainingTranscodeStreams < 0 || stats.RemainingStreams < stats.RemainingTranscodeStreams) {
+		stats.RemainingTranscodeStreams = stats.RemainingStreams
+	}
+
+	for _, path := range []string{serviceConfig.HLSRoot, serviceConfig.RecordingsPath} {
+		if free, ok := diskFreeBytes(path); ok {
+			stats.FreeDiskBytes[path] = free
+			if free < serviceConfig.MinFreeDiskBytes && path == serviceConfig.HLSRoot {
+				stats.RemainingStreams, stats.RemainingTranscodeStreams = 0, 0
+			}
+		}
+	}
+	if !stats.Accepting {
+		stats.RemainingStreams, stats.RemainingTranscodeStreams = 0, 0
+	}
+	return stats
+}
+
+func remaining(limit, used int) int {
+	if limit <= 0 {
+		return -1
+	}
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func pidFilePath(streamID string) string {
+	return filepath.Join(serviceConfig.RunDir, streamID+".pid")
+}
+
+// processCmdline читает командную строку процесса из /proc
+func processCmdline(pid int) []string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+}
+
+// ingestOutputs - выходы ffmpeg потока (см. ffmpegArgs): плейлист перепаковки,
+// шаблон плейлистов ступеней транскодирования и DASH-манифест CMAF
+func ingestOutputs(hlsPath string) []string {
+	return []string{
+		filepath.Join(hlsPath, mediaPlaylistName),
+		filepath.Join(hlsPath, "%v", mediaPlaylistName),
+		filepath.Join(hlsPath, dashManifestName),
+	}
+}
+
+// isIngestProcess проверяет, что командная строка принадлежит ffmpeg,
+// пишущему HLS указанного потока. Сравнивается точный путь выхода, а не каталог:
+// снимки кадров и ретрансляции читают файлы потока через -i и не подходят.
+func isIngestProcess(cmdline []string, rec StreamRecord) bool {
+	if len(cmdline) == 0 || !strings.Contains(filepath.Base(cmdline[0]), "ffmpeg") || rec.HLSPath == "" {
+		return false
+	}
+
+	outputs := ingestOutputs(rec.HLSPath)
+	for i := 1; i < len(cmdline); i++ {
+		if cmdline[i-1] == "-i" {
+			continue
+		}
+		for _, output := range outputs {
+			if cmdline[i] == output {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findIngestProcess ищет работающий ffmpeg потока: сначала по PID-файлу,
+// затем перебором /proc с сопоставлением командной строки
+func findIngestProcess(rec StreamRecord) int {
+	if pid := readPIDFile(pidFilePath(rec.StreamID)); pid > 0 {
+		if processAlive(pid) && isIngestProcess(processCmdline(pid), rec) {
+			return pid
+		}
+		log.Printf("⚠️ PID-файл потока %s указывает на чужой или завершенный процесс %d", rec.StreamID, pid)
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		if isIngestProcess(processCmdline(pid), rec) && processAlive(pid) {
+			return pid
+		}
+	}
+	return 0
+}
+
+// ingestSecretsFromArgs дополняет параметры из журнала секретами ingest из командной
+// строки ffmpeg (первый -i, см. ingestInputArgs): паролем SRT listener или URL pull-источника
+func ingestSecretsFromArgs(options StreamOptions, cmdline []string) StreamOptions {
+	input := ""
+	for i := 1; i < len(cmdline); i++ {
+		if cmdline[i-1] == "-i" {
+			input = cmdline[i]
+			break
+		}
+	}
+
+	if options.Protocol == ProtocolPull {
+		options.SourceURL = input
+		return options
+	}
+	if u, err := url.Parse(input); err == nil && u.Scheme == "srt" {
+		query := u.Query()
+		options.SRTPassphrase = query.Get("passphrase")
+		if keyLength, err := strconv.Atoi(query.Get("pbkeylen")); err == nil {
+			options.SRTKeyLength = keyLength
+		}
+	}
+	return options
+}
+
+// canAdopt - следующий экземпляр сервиса сможет подключиться к ffmpeg потока
+func canAdopt(protocol string, lowLatency bool) bool {
+	// Усыновление возможно только для ffmpeg-конвейера
+	if serviceConfig.Pipeline != "" && serviceConfig.Pipeline != "ffmpeg" {
+		return false
+	}
+	// RTMP ffmpeg читает из сокета RTMPGate, закрывшегося вместе с прежним сервисом
+	if protocol == ProtocolRTMP {
+		return false
+	}
+	// LL-HLS ffmpeg пишет в stdout, который закрылся вместе с прежним сервисом
+	return !lowLatency
+}
+
+// adoptStream подключается к ffmpeg, оставшемуся от предыдущего экземпляра сервиса,
+// не прерывая публикацию. Возвращает false, если подходящего процесса нет.
+func adoptStream(rec StreamRecord) bool {
+	if !canAdopt(rec.Options.Protocol, rec.Options.LowLatency) {
+		return false
+	}
+
+	pid := findIngestProcess(rec)
+	if pid == 0 {
+		return false
+	}
+	// Журнал секретов не хранит, а супервизору они нужны для перезапуска ffmpeg:
+	// берем их из командной строки работающего процесса, а не из основного приложения
+	if rec.SecretsOmitted {
+		rec.Options = ingestSecretsFromArgs(rec.Options, processCmdline(pid))
+	}
+
+	protocol := rec.Options.Protocol
+	if protocol == "" {
+		protocol = ProtocolSRT
+	}
+	port := rec.SRTPort
+	if protocol == ProtocolRTMP {
+		port = rec.RTMPPort
+	}
+	ports := manager.portsFor(protocol)
+
+	// Порт занят самим ffmpeg, поэтому резервируем его без проверки bind
+	if ports != nil {
+		if err := ports.Reserve(rec.StreamID, port); err != nil {
+			log.Printf("⚠️ Не удалось зарезервировать порт %d для потока %s: %v", port, rec.StreamID, err)
+			return false
+		}
+	}
+
+	logFile := rec.LogFile
+	if logFile == "" {
+		logFile = streamLogFile(rec.StreamID)
+	}
+	// Подхваченный ffmpeg продолжает сессию, записанную в журнале
+	logSession := rec.LogSession
+	if logSession == "" {
+		logSession = newLogSession(rec.StartTime)
+	}
+
+	streamID := rec.StreamID
+	progress := newProgressTracker(rec.HLSPath, rec.Options.Packaging, rec.Options.Renditions)
+	adCues := NewAdCues(streamID, rec.HLSPath, rec.Options.AdCues, rec.Options.Renditions)
+	spec := PipelineSpec{
+		StreamID:   streamID,
+		Protocol:   protocol,
+		IngestPort: port,
+		Passphrase: rec.Options.SRTPassphrase,
+		KeyLength:  rec.Options.SRTKeyLength,
+		SourceURL:  rec.Options.SourceURL,
+		HLSPath:    rec.HLSPath,
+		LogFile:    logFile,
+		Mode:       rec.Options.Mode,
+		Renditions: rec.Options.Renditions,
+		Packaging:  rec.Options.Packaging,
+		DVRWindow:  time.Duration(rec.Options.DVRWindowSeconds) * time.Second,
+		Record:     rec.Options.Record,
+		Progress:   progress,
+
+		Subtitles:      rec.Options.Captions != nil && len(rec.Options.Captions.Languages) > 0,
+		ClosedCaptions: rec.Options.Captions != nil && len(rec.Options.Captions.ClosedCaptions) > 0,
+
+		AdCues: adCues != nil,
+	}
+	// Усыновленный ffmpeg пишет метки SCTE-35 в закрытый pipe; pipe нового
+	// процесса появится при его перезапуске
+	if adCues != nil && rec.Options.AdCues.SCTE35Passthrough {
+		spec.SCTE35 = adCues
+	}
+	pipeline := NewFFmpegPipeline(spec)
+
+	stream := &StreamInstance{
+		StreamID:   streamID,
+		Status:     "starting",
+		StartTime:  rec.StartTime,
+		Pipeline:   pipeline,
+		LogFile:    logFile,
+		LogSession: logSession,
+		HLSPath:    rec.HLSPath,
+		SRTPort:    rec.SRTPort,
+		RTMPPort:   rec.RTMPPort,
+		ServerIP:   getServerIP(),
+		Protocol:   protocol,
+		RTMPApp:    rec.Options.RTMPApp,
+		RTMPKey:    rec.Options.RTMPKey,
+		Mode:       rec.Options.Mode,
+		Preset:     rec.Options.Preset,
+		Renditions: rec.Options.Renditions,
+		Packaging:  rec.Options.Packaging,
+		Adopted:    true,
+		Progress:   progress,
+
+		DVRWindowSeconds: rec.Options.DVRWindowSeconds,
+		DVR: DVRStats{
+			WindowSeconds:  rec.Options.DVRWindowSeconds,
+			DiskLimitBytes: serviceConfig.DVRMaxDiskBytes,
+		},
+		Record: rec.Options.Record,
+
+		InactivityTimeoutSeconds: inactivityTimeoutSeconds(rec.Options.InactivityTimeoutSeconds),
+
+		LogRotatedAt: time.Now(),
+
+		SRTPassphrase: rec.Options.SRTPassphrase,
+		SRTKeyLength:  rec.Options.SRTKeyLength,
+		SourceURL:     rec.Options.SourceURL,
+
+		Forwarders: make(map[string]*Forwarder),
+		probeWake:  make(chan struct{}, 1),
+	}
+	stream.Captions = NewCaptionTracks(streamID, rec.HLSPath, rec.Options.Captions, rec.Options.Mode, rec.Options.Renditions, rec.StartTime)
+	stream.AdCues = adCues
+	if protocol == ProtocolPull {
+		stream.Upstream = &UpstreamState{
+			State:      UpstreamConnecting,
+			SourceURL:  redactSourceURL(rec.Options.SourceURL),
+			LastChange: time.Now(),
+		}
+	}
+	if rec.Options.Record {
+		stream.Recorder = NewRecorder(streamID, rec.HLSPath, rec.Options.Renditions)
+	}
+	if stream.Mode == "" {
+		stream.Mode = ModeRepackOnly
+	}
+	if stream.Packaging == "" {
+		stream.Packaging = PackagingTS
+	}
+	if stream.StartTime.IsZero() {
+		stream.StartTime = time.Now()
+	}
+
+	manager.mutex.Lock()
+	if _, exists := manager.streams[streamID]; exists {
+		manager.mutex.Unlock()
+		return true
+	}
+	manager.streams[streamID] = stream
+	manager.mutex.Unlock()
+
+	if err := pipeline.Adopt(context.Background(), pid); err != nil {
+		log.Printf("⚠️ Не удалось подключиться к ffmpeg потока %s: %v", streamID, err)
+		manager.mutex.Lock()
+		delete(manager.streams, streamID)
+		manager.mutex.Unlock()
+		ports.Release(streamID)
+		return false
+	}
+	go watchPipelineEvents(streamID, pipeline)
+
+	// Статус running выставит монитор по первым новым сегментам,
+	// поэтому основное приложение не получает ложный переход в starting
+	hlsWatcher.Watch(streamID, stream, rec.HLSPath, time.Duration(stream.InactivityTimeoutSeconds)*time.Second)
+	go monitorDVRDisk(streamID, stream)
+	if stream.Recorder != nil {
+		go runRecorder(streamID, stream)
+	}
+	go runThumbnailer(streamID, stream)
+	go runMediaProber(streamID, stream)
+	syncForwarders(stream, rec.Options.Destinations)
+
+	log.Printf("🔗 Поток %s усыновлен: ffmpeg PID %d, порт %d", streamID, pid, port)
+	return true
+}
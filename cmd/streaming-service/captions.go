@@ -0,0 +1,566 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"my-go-app/pkg/hls"
+	"my-go-app/pkg/middleware"
+)
+
+const (
+	// subtitlesDir - каталог сегментов WebVTT внутри HLS-каталога потока: subs/{язык}/
+	subtitlesDir = "subs"
+
+	subtitlesGroupID      = "subs"
+	closedCaptionsGroupID = "cc"
+
+	// captionsMasterBandwidth - BANDWIDTH единственного варианта в master.m3u8 перепаковки:
+	// битрейт энкодера заранее неизвестен, а выбирать плееру все равно не из чего
+	captionsMasterBandwidth = 6000000
+
+	defaultCueDuration = 3 * time.Second
+	maxCueDuration     = time.Minute
+	maxCueTextLength   = 1000
+	maxCuesPerRequest  = 500
+	maxCuesPerTrack    = 5000
+	maxSubtitleTracks  = 8
+)
+
+// CaptionsOptions - текстовые дорожки потока
+type CaptionsOptions struct {
+	Languages      []string `json:"languages,omitempty"`       // дорожки WebVTT для фраз из API, первая - по умолчанию
+	ClosedCaptions []string `json:"closed_captions,omitempty"` // CEA-608/708 в ingest: CC1-CC4, SERVICE1-SERVICE63
+}
+
+var (
+	// captionLanguagePattern - код языка BCP 47: ru, en, pt-BR
+	captionLanguagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+	// closedCaptionPattern - INSTREAM-ID: каналы CEA-608 или сервисы CEA-708
+	closedCaptionPattern = regexp.MustCompile(`^(CC[1-4]|SERVICE([1-9]|[1-5][0-9]|6[0-3]))$`)
+)
+
+// Validate проверяет языки и каналы субтитров
+func (o *CaptionsOptions) Validate() error {
+	if len(o.Languages) > maxSubtitleTracks {
+		return fmt.Errorf("at most %d subtitle languages are supported", maxSubtitleTracks)
+	}
+	seen := make(map[string]bool)
+	for _, lang := range o.Languages {
+		if !captionLanguagePattern.MatchString(lang) {
+			return fmt.Errorf("invalid subtitle language: %q", lang)
+		}
+		if seen[lang] {
+			return fmt.Errorf("duplicate subtitle language: %s", lang)
+		}
+		seen[lang] = true
+	}
+	for _, id := range o.ClosedCaptions {
+		if !closedCaptionPattern.MatchString(id) {
+			return fmt.Errorf("invalid closed caption channel: %q (expected CC1-CC4 or SERVICE1-SERVICE63)", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("duplicate closed caption channel: %s", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// Empty - дорожек нет, субтитры выключены
+func (o *CaptionsOptions) Empty() bool {
+	return o == nil || (len(o.Languages) == 0 && len(o.ClosedCaptions) == 0)
+}
+
+// CaptionCue - фраза субтитров на шкале реального времени
+type CaptionCue struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Text  string    `json:"text"`
+}
+
+// CaptionTracks нарезает фразы из API на сегменты WebVTT и ведет плейлисты
+// субтитров параллельно медиа-плейлисту. Сегмент субтитров повторяет номер,
+// длительность и EXT-X-PROGRAM-DATE-TIME медиасегмента, а X-TIMESTAMP-MAP
+// связывает его с PTS медиасегмента, поэтому фразы совпадают с видео.
+// Фразы хранятся в памяти и не переживают рестарт сервиса.
+type CaptionTracks struct {
+	streamID  string
+	hlsPath   string
+	reference string // медиа-плейлист, с сегментами которого выравниваются субтитры
+	options   CaptionsOptions
+	// origin - начало шкалы LOCAL в X-TIMESTAMP-MAP; время фраз отсчитывается от него
+	origin time.Time
+
+	mu       sync.Mutex
+	cues     map[string][]CaptionCue // по языку, по возрастанию начала
+	pts      map[string]uint64       // URI медиасегмента -> первый PTS
+	written  map[string]string       // путь файла -> записанное содержимое
+	warnedAt time.Time
+}
+
+// NewCaptionTracks готовит дорожки потока; nil, если субтитры выключены
+func NewCaptionTracks(streamID, hlsPath string, options *CaptionsOptions, mode string, renditions []Rendition, startTime time.Time) *CaptionTracks {
+	if options.Empty() {
+		return nil
+	}
+
+	reference := mediaPlaylistName
+	if mode == ModeTranscode && len(renditions) > 0 {
+		reference = filepath.Join(renditions[0].Name, mediaPlaylistName)
+		for _, r := range renditions {
+			if !r.AudioOnly {
+				reference = filepath.Join(r.Name, mediaPlaylistName)
+				break
+			}
+		}
+	}
+
+	t := &CaptionTracks{
+		streamID:  streamID,
+		hlsPath:   hlsPath,
+		reference: reference,
+		options:   *options,
+		origin:    startTime.Truncate(time.Hour).Add(-time.Hour),
+		cues:      make(map[string][]CaptionCue),
+		pts:       make(map[string]uint64),
+		written:   make(map[string]string),
+	}
+	for _, lang := range options.Languages {
+		if err := os.MkdirAll(filepath.Join(hlsPath, subtitlesDir, lang), 0o755); err != nil {
+			log.Printf("⚠️ Не удалось создать каталог субтитров %s потока %s: %v", lang, streamID, err)
+		}
+	}
+	return t
+}
+
+// subtitlePlaylistURI - плейлист дорожки относительно master.m3u8
+func subtitlePlaylistURI(lang string) string {
+	return subtitlesDir + "/" + lang + "/" + mediaPlaylistName
+}
+
+// AddCues добавляет фразы в дорожку языка lang (пустой - первая дорожка)
+func (t *CaptionTracks) AddCues(lang string, cues []CaptionCue) (string, error) {
+	if len(t.options.Languages) == 0 {
+		return "", errors.New("stream has no WebVTT subtitle tracks")
+	}
+	if lang == "" {
+		lang = t.options.Languages[0]
+	}
+	known := false
+	for _, l := range t.options.Languages {
+		known = known || l == lang
+	}
+	if !known {
+		return "", fmt.Errorf("unknown subtitle language: %s", lang)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	track := append(t.cues[lang], cues...)
+	sort.SliceStable(track, func(i, j int) bool { return track[i].Start.Before(track[j].Start) })
+	if extra := len(track) - maxCuesPerTrack; extra > 0 {
+		track = append([]CaptionCue(nil), track[extra:]...)
+	}
+	t.cues[lang] = track
+	return lang, nil
+}
+
+// captionSegment - медиасегмент, к которому привязывается сегмент субтитров
+type captionSegment struct {
+	hls.Segment
+	pts uint64
+}
+
+// Update выравнивает сегменты субтитров по текущему медиа-плейлисту и
+// дописывает дорожки в master.m3u8; вызывается HLSWatcher при записи плейлистов
+func (t *CaptionTracks) Update() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.ensureMaster()
+	if len(t.options.Languages) == 0 {
+		return
+	}
+
+	playlist, err := hls.ParseFile(filepath.Join(t.hlsPath, t.reference))
+	if err != nil || playlist.Media == nil || len(playlist.Media.Segments) == 0 {
+		return
+	}
+	media := playlist.Media
+
+	segments := make([]captionSegment, 0, len(media.Segments))
+	current := make(map[string]bool, len(media.Segments))
+	for _, seg := range media.Segments {
+		current[seg.URI] = true
+		if seg.ProgramDateTime == nil {
+			t.warn("в медиа-плейлисте нет EXT-X-PROGRAM-DATE-TIME")
+			return
+		}
+		pts, cached := t.pts[seg.URI]
+		if !cached {
+			pts, err = hls.FirstPTSFile(filepath.Join(t.hlsPath, filepath.Dir(t.reference), seg.URI))
+			if err != nil {
+				// Сегменты до нечитаемого в плейлист субтитров не попадут:
+				// номера сегментов в нем должны идти подряд
+				segments = segments[:0]
+				continue
+			}
+			t.pts[seg.URI] = pts
+		}
+		segments = append(segments, captionSegment{Segment: seg, pts: pts})
+	}
+	for uri := range t.pts {
+		if !current[uri] {
+			delete(t.pts, uri)
+		}
+	}
+	if len(segments) == 0 {
+		return
+	}
+
+	windowStart := *segments[0].ProgramDateTime
+	for _, lang := range t.options.Languages {
+		t.cues[lang] = dropCuesBefore(t.cues[lang], windowStart)
+		if err := t.writeTrack(lang, media, segments); err != nil {
+			t.warn(fmt.Sprintf("дорожка %s: %v", lang, err))
+		}
+	}
+}
+
+// writeTrack пишет сегменты WebVTT и плейлист одной дорожки
+func (t *CaptionTracks) writeTrack(lang string, media *hls.MediaPlaylist, segments []captionSegment) error {
+	dir := filepath.Join(t.hlsPath, subtitlesDir, lang)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&playlist, "#EXT-X-TARGETDURATION:%d\n", media.TargetDuration)
+	fmt.Fprintf(&playlist, "#EXT-X-MEDIA-SEQUENCE:%d\n", segments[0].Sequence)
+	if media.DiscontinuitySequence > 0 {
+		fmt.Fprintf(&playlist, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", media.DiscontinuitySequence)
+	}
+
+	keep := make(map[string]bool, len(segments))
+	for _, seg := range segments {
+		start := *seg.ProgramDateTime
+		end := start.Add(time.Duration(seg.Duration * float64(time.Second)))
+
+		var cues []hls.Cue
+		for _, cue := range t.cues[lang] {
+			if cue.Start.Before(end) && cue.End.After(start) {
+				cues = append(cues, hls.Cue{Start: cue.Start.Sub(t.origin), End: cue.End.Sub(t.origin), Text: cue.Text})
+			}
+		}
+
+		name := fmt.Sprintf("seg_%d.vtt", seg.Sequence)
+		path := filepath.Join(dir, name)
+		keep[path] = true
+		content := hls.WebVTTSegment(seg.pts, start.Sub(t.origin), cues)
+		if previous, known := t.written[path]; !known || previous != content {
+			// Сегмент прошлого запуска сервиса без новых фраз не перезаписывается:
+			// фразы, попавшие в него до рестарта, в памяти не сохранились
+			_, statErr := os.Stat(path)
+			if known || statErr != nil || len(cues) > 0 {
+				if err := writeFileAtomic(path, content); err != nil {
+					return err
+				}
+			}
+			t.written[path] = content
+		}
+
+		if seg.Discontinuity {
+			playlist.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&playlist, "#EXT-X-PROGRAM-DATE-TIME:%s\n", start.UTC().Format("2006-01-02T15:04:05.000Z"))
+		fmt.Fprintf(&playlist, "#EXTINF:%.3f,\n%s\n", seg.Duration, name)
+	}
+
+	// Сегменты, вышедшие из окна, удаляются вместе с медиасегментами
+	prefix := dir + string(filepath.Separator)
+	for path := range t.written {
+		if strings.HasPrefix(path, prefix) && !keep[path] {
+			os.Remove(path)
+			delete(t.written, path)
+		}
+	}
+
+	return writeFileAtomic(filepath.Join(dir, mediaPlaylistName), playlist.String())
+}
+
+// ensureMaster добавляет группы SUBTITLES и CLOSED-CAPTIONS в master.m3u8.
+// Перепаковка пишет master сама, master лестницы transcode пишет ffmpeg
+// при каждом запуске, поэтому он дополняется после каждой перезаписи.
+func (t *CaptionTracks) ensureMaster() {
+	path := filepath.Join(t.hlsPath, masterPlaylistName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && t.reference == mediaPlaylistName {
+		data = []byte(fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s\n",
+			captionsMasterBandwidth, mediaPlaylistName))
+	} else if err != nil {
+		return
+	}
+
+	playlist, err := hls.Parse(strings.NewReader(string(data)))
+	if err != nil || playlist.Master == nil {
+		return
+	}
+	for _, r := range playlist.Master.Renditions {
+		if r.GroupID == subtitlesGroupID || r.GroupID == closedCaptionsGroupID {
+			return // дорожки уже добавлены
+		}
+	}
+
+	if err := writeFileAtomic(path, t.injectTracks(string(data))); err != nil {
+		t.warn(fmt.Sprintf("не удалось обновить %s: %v", masterPlaylistName, err))
+	}
+}
+
+// injectTracks вставляет EXT-X-MEDIA дорожек перед первым вариантом
+// и ссылается на их группы из каждого EXT-X-STREAM-INF
+func (t *CaptionTracks) injectTracks(master string) string {
+	var media strings.Builder
+	for i, lang := range t.options.Languages {
+		isDefault := "NO"
+		if i == 0 {
+			isDefault = "YES"
+		}
+		fmt.Fprintf(&media, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"%s\",NAME=\"%s\",LANGUAGE=\"%s\",DEFAULT=%s,AUTOSELECT=YES,URI=\"%s\"\n",
+			subtitlesGroupID, lang, lang, isDefault, subtitlePlaylistURI(lang))
+	}
+	for i, id := range t.options.ClosedCaptions {
+		isDefault := "NO"
+		if i == 0 {
+			isDefault = "YES"
+		}
+		fmt.Fprintf(&media, "#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID=\"%s\",NAME=\"%s\",INSTREAM-ID=\"%s\",DEFAULT=%s,AUTOSELECT=YES\n",
+			closedCaptionsGroupID, id, id, isDefault)
+	}
+
+	var attrs string
+	if len(t.options.Languages) > 0 {
+		attrs += fmt.Sprintf(",SUBTITLES=\"%s\"", subtitlesGroupID)
+	}
+	if len(t.options.ClosedCaptions) > 0 {
+		attrs += fmt.Sprintf(",CLOSED-CAPTIONS=\"%s\"", closedCaptionsGroupID)
+	}
+
+	var out strings.Builder
+	inserted := false
+	for _, line := range strings.Split(strings.TrimRight(master, "\n"), "\n") {
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			if !inserted {
+				out.WriteString(media.String())
+				inserted = true
+			}
+			line += attrs
+		}
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// Info - дорожки субтитров для API
+func (t *CaptionTracks) Info(cdnDomain string) map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	subtitles := make([]map[string]interface{}, 0, len(t.options.Languages))
+	for i, lang := range t.options.Languages {
+		subtitles = append(subtitles, map[string]interface{}{
+			"language":     lang,
+			"default":      i == 0,
+			"cues":         len(t.cues[lang]),
+			"playlist_url": fmt.Sprintf("https://%s/hls/%s/%s", cdnDomain, t.streamID, subtitlePlaylistURI(lang)),
+		})
+	}
+	closedCaptions := t.options.ClosedCaptions
+	if closedCaptions == nil {
+		closedCaptions = []string{}
+	}
+	return map[string]interface{}{
+		"subtitles":       subtitles,
+		"closed_captions": closedCaptions,
+	}
+}
+
+// warn пишет в лог не чаще раза в минуту: Update вызывается на каждый сегмент
+func (t *CaptionTracks) warn(message string) {
+	if time.Since(t.warnedAt) < time.Minute {
+		return
+	}
+	t.warnedAt = time.Now()
+	log.Printf("⚠️ Субтитры потока %s: %s", t.streamID, message)
+}
+
+// dropCuesBefore убирает фразы, закончившиеся до начала окна плейлиста
+func dropCuesBefore(cues []CaptionCue, windowStart time.Time) []CaptionCue {
+	kept := cues[:0]
+	for _, cue := range cues {
+		if cue.End.After(windowStart) {
+			kept = append(kept, cue)
+		}
+	}
+	return kept
+}
+
+// writeFileAtomic пишет файл через временный и rename, чтобы плеер не прочитал его наполовину
+func writeFileAtomic(path, content string) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// CaptionCueRequest - фраза в запросе API. Без start фраза начинается сейчас,
+// без end длится duration_seconds (по умолчанию 3 секунды).
+type CaptionCueRequest struct {
+	Text            string     `json:"text"`
+	Start           *time.Time `json:"start,omitempty"`
+	End             *time.Time `json:"end,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds,omitempty"`
+}
+
+// CaptionsRequest - тело POST /api/streams/{id}/captions
+type CaptionsRequest struct {
+	Language string              `json:"language,omitempty"`
+	Cues     []CaptionCueRequest `json:"cues"`
+}
+
+// parseCaptionCues проверяет фразы запроса и переводит их на шкалу реального времени
+func parseCaptionCues(requests []CaptionCueRequest, now time.Time) ([]CaptionCue, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("cues are required")
+	}
+	if len(requests) > maxCuesPerRequest {
+		return nil, fmt.Errorf("at most %d cues per request", maxCuesPerRequest)
+	}
+
+	cues := make([]CaptionCue, 0, len(requests))
+	for i, req := range requests {
+		text := strings.TrimSpace(req.Text)
+		if text == "" {
+			return nil, fmt.Errorf("cue %d: text is required", i)
+		}
+		if len([]rune(text)) > maxCueTextLength {
+			return nil, fmt.Errorf("cue %d: text is longer than %d characters", i, maxCueTextLength)
+		}
+
+		start := now
+		if req.Start != nil {
+			start = *req.Start
+		}
+		var end time.Time
+		switch {
+		case req.End != nil:
+			end = *req.End
+		case req.DurationSeconds > 0:
+			end = start.Add(time.Duration(req.DurationSeconds * float64(time.Second)))
+		case req.DurationSeconds < 0:
+			return nil, fmt.Errorf("cue %d: duration_seconds must be positive", i)
+		default:
+			end = start.Add(defaultCueDuration)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("cue %d: end must be after start", i)
+		}
+		if end.Sub(start) > maxCueDuration {
+			return nil, fmt.Errorf("cue %d: cue is longer than %s", i, maxCueDuration)
+		}
+		cues = append(cues, CaptionCue{Start: start, End: end, Text: text})
+	}
+	return cues, nil
+}
+
+// handleStreamCaptions: GET /api/streams/{id}/captions - дорожки потока,
+// POST - фразы для дорожки WebVTT. Нужен токен API: фразы попадают в эфир.
+func handleStreamCaptions(w http.ResponseWriter, r *http.Request, streamID string, stream *StreamInstance) {
+	if !middleware.IsAuthorized(r, serviceConfig.APIToken) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Требуется токен API",
+			StreamID: streamID,
+			Error:    "unauthorized",
+		})
+		return
+	}
+
+	tracks := stream.Captions
+	if tracks == nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "У потока нет текстовых дорожек",
+			StreamID: streamID,
+			Error:    "captions are not enabled for this stream",
+		})
+		return
+	}
+
+	cdnDomain := os.Getenv("CDN_DOMAIN")
+	if cdnDomain == "" {
+		cdnDomain = getServerIP()
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Текстовые дорожки потока",
+			StreamID: streamID,
+			Data:     tracks.Info(cdnDomain),
+		})
+
+	case http.MethodPost:
+		var req CaptionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message: "Неверный формат запроса",
+				Error:   err.Error(),
+			})
+			return
+		}
+		cues, err := parseCaptionCues(req.Cues, time.Now())
+		if err == nil {
+			req.Language, err = tracks.AddCues(req.Language, cues)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message:  "Некорректные фразы субтитров",
+				StreamID: streamID,
+				Error:    err.Error(),
+			})
+			return
+		}
+
+		// Сегменты живого окна переписываются сразу, не дожидаясь следующего сегмента
+		go tracks.Update()
+
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Фразы добавлены",
+			StreamID: streamID,
+			Data: map[string]interface{}{
+				"language": req.Language,
+				"accepted": len(cues),
+			},
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
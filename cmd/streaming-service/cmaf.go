@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PackagingTS   = "ts"   // HLS с MPEG-TS сегментами (по умолчанию)
+	PackagingCMAF = "cmaf" // fMP4 сегменты, общие для HLS и DASH
+
+	dashManifestName = "manifest.mpd"
+)
+
+// cmafOutputArgs - вывод через DASH-муксер ffmpeg: он пишет fMP4 (CMAF) сегменты,
+// manifest.mpd и, с -hls_playlist, master.m3u8 с media_N.m3u8 на те же файлы
+func cmafOutputArgs(spec PipelineSpec) []string {
+	args := []string{
+		"-f", "dash",
+		"-seg_duration", fmt.Sprint(hlsSegmentSeconds),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-window_size", fmt.Sprint(dvrListSize(spec.DVRWindow, hlsSegmentSeconds*time.Second)),
+		"-extra_window_size", "2",
+		"-remove_at_exit", "0",
+		"-hls_playlist", "1",
+		"-hls_master_name", masterPlaylistName,
+		"-init_seg_name", "init_$RepresentationID$.m4s",
+		"-media_seg_name", "chunk_$RepresentationID$_$Number%05d$.m4s", // см. dashChunkName
+	}
+
+	// Видео всех ступеней в одном adaptation set, чтобы DASH-плеер переключал качество
+	if spec.Mode == ModeTranscode && hasVideoRendition(spec.Renditions) {
+		args = append(args, "-adaptation_sets", "id=0,streams=v id=1,streams=a")
+	}
+
+	return append(args, filepath.Join(spec.HLSPath, dashManifestName))
+}
+
+// cmafVariantPlaylist - HLS-плейлист ступени лестницы в CMAF: DASH-муксер
+// нумерует их по индексу выходного потока (видео и аудио каждой ступени подряд)
+func cmafVariantPlaylist(renditions []Rendition, name string) string {
+	idx := 0
+	for _, r := range renditions {
+		if r.Name == name {
+			return fmt.Sprintf("media_%d.m3u8", idx)
+		}
+		if r.AudioOnly {
+			idx++
+		} else {
+			idx += 2
+		}
+	}
+	return ""
+}
+
+func hasVideoRendition(renditions []Rendition) bool {
+	for _, r := range renditions {
+		if !r.AudioOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// isSegmentFile - медиасегмент HLS/DASH (MPEG-TS или fMP4)
+func isSegmentFile(name string) bool {
+	return strings.HasSuffix(name, ".ts") || strings.HasSuffix(name, ".m4s")
+}
+
+// isInitSegment - init-сегмент CMAF, общий для всех медиасегментов ступени
+func isInitSegment(name string) bool {
+	return strings.HasPrefix(name, "init_") && strings.HasSuffix(name, ".m4s")
+}
+
+// dashChunkName - имя медиасегмента по шаблону -media_seg_name
+func dashChunkName(representationID string, number uint64) string {
+	return fmt.Sprintf("chunk_%s_%05d.m4s", representationID, number)
+}
+
+var (
+	dashRepresentationRe = regexp.MustCompile(`(?s)<Representation\b[^>]*?\bid="([^"]+)".*?</Representation>`)
+	dashStartNumberRe    = regexp.MustCompile(`\bstartNumber="(\d+)"`)
+	dashTimelineRe       = regexp.MustCompile(`(?s)<SegmentTimeline>(.*?)[ \t]*</SegmentTimeline>`)
+	dashTimelineEntryRe  = regexp.MustCompile(`(?m)^([ \t]*)<S\b([^>]*?)/>`)
+	dashTimelineAttrRe   = regexp.MustCompile(`\b([tdr])="(-?\d+)"`)
+)
+
+// maxDASHTimelineSegments ограничивает разворачивание SegmentTimeline (окно DVR в сегментах с запасом)
+const maxDASHTimelineSegments = 100000
+
+// trimDASHManifest убирает из SegmentTimeline каждого Representation начальные сегменты,
+// имена файлов которых drop отмечает удаленными, и сдвигает startNumber - так же, как
+// hls.TrimLeadingSegments обрезает HLS-плейлисты. Последний сегмент не удаляется.
+// Возвращает манифест и имена сегментов, на которые он ссылается; ok=false, если
+// SegmentTimeline хотя бы одного Representation разобрать не удалось.
+func trimDASHManifest(manifest string, drop func(name string) bool) (trimmed string, referenced []string, ok bool) {
+	ok = true
+	found := false
+	trimmed = dashRepresentationRe.ReplaceAllStringFunc(manifest, func(rep string) string {
+		found = true
+		id := dashRepresentationRe.FindStringSubmatch(rep)[1]
+		rep, first, count := trimDASHRepresentation(rep, func(number uint64) bool {
+			return drop(dashChunkName(id, number))
+		})
+		if count == 0 {
+			ok = false
+		}
+		for i := uint64(0); i < count; i++ {
+			referenced = append(referenced, dashChunkName(id, first+i))
+		}
+		return rep
+	})
+	return trimmed, referenced, ok && found
+}
+
+type dashTimelineSegment struct {
+	t, d uint64
+}
+
+// trimDASHRepresentation обрезает SegmentTimeline одного Representation и возвращает
+// его вместе с номером первого оставшегося сегмента и их числом
+func trimDASHRepresentation(rep string, drop func(number uint64) bool) (string, uint64, uint64) {
+	start := dashStartNumberRe.FindStringSubmatchIndex(rep)
+	timeline := dashTimelineRe.FindStringSubmatchIndex(rep)
+	if start == nil || timeline == nil || start[3] > timeline[2] {
+		return rep, 0, 0
+	}
+	startNumber, err := strconv.ParseUint(rep[start[2]:start[3]], 10, 64)
+	if err != nil {
+		return rep, 0, 0
+	}
+
+	var segments []dashTimelineSegment
+	var next uint64
+	indent := ""
+	for i, entry := range dashTimelineEntryRe.FindAllStringSubmatch(rep[timeline[2]:timeline[3]], -1) {
+		if i == 0 {
+			indent = entry[1]
+		}
+		attrs := make(map[string]int64)
+		for _, attr := range dashTimelineAttrRe.FindAllStringSubmatch(entry[2], -1) {
+			attrs[attr[1]], _ = strconv.ParseInt(attr[2], 10, 64)
+		}
+		d, r := attrs["d"], attrs["r"]
+		if d <= 0 || r < 0 || len(segments)+int(r) >= maxDASHTimelineSegments {
+			return rep, 0, 0 // r=-1 (повтор до конца периода) ffmpeg не пишет
+		}
+		t := next
+		if v, ok := attrs["t"]; ok && v >= 0 {
+			t = uint64(v)
+		}
+		for j := int64(0); j <= r; j++ {
+			segments = append(segments, dashTimelineSegment{t: t, d: uint64(d)})
+			t += uint64(d)
+		}
+		next = t
+	}
+
+	n := 0
+	for n < len(segments)-1 && drop(startNumber+uint64(n)) {
+		n++
+	}
+	first, count := startNumber+uint64(n), uint64(len(segments)-n)
+	if n == 0 {
+		return rep, first, count
+	}
+
+	var body strings.Builder
+	body.WriteString("\n")
+	kept := segments[n:]
+	for i := 0; i < len(kept); {
+		j := i
+		for j+1 < len(kept) && kept[j+1].d == kept[i].d && kept[j+1].t == kept[j].t+kept[j].d {
+			j++
+		}
+		body.WriteString(indent + "<S ")
+		if i == 0 || kept[i].t != kept[i-1].t+kept[i-1].d {
+			fmt.Fprintf(&body, "t=\"%d\" ", kept[i].t)
+		}
+		fmt.Fprintf(&body, "d=\"%d\" ", kept[i].d)
+		if j > i {
+			fmt.Fprintf(&body, "r=\"%d\" ", j-i)
+		}
+		body.WriteString("/>\n")
+		i = j + 1
+	}
+
+	trimmed := rep[:start[2]] + strconv.FormatUint(first, 10) + rep[start[3]:timeline[2]] + body.String() + rep[timeline[3]:]
+	return trimmed, first, count
+}
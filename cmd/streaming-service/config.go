@@ -0,0 +1,123 @@
+package main
+
+import (
+	"time"
+
+	"my-go-app/pkg/config"
+)
+
+// ServiceConfig содержит настройки streaming service, читаемые из переменных окружения
+type ServiceConfig struct {
+	Pipeline        string // ffmpeg или fake (синтетические сегменты без ffmpeg)
+	FFmpegPath      string
+	RestartPolicy   RestartPolicy
+	StopTimeout     time.Duration // сколько ждать ffmpeg после SIGTERM перед SIGKILL
+	SRTPortMin      int
+	SRTPortMax      int
+	RTMPPortMin     int
+	RTMPPortMax     int
+	PullReadTimeout time.Duration // сколько ждать данных от источника pull-потока до переподключения
+	HLSRoot         string        // каталог HLS, в нем по подкаталогу на поток
+	StateFile       string        // локальный журнал состояния потоков
+	StateRetention  time.Duration // сколько журнал хранит записи остановленных потоков
+	RunDir          string        // PID-файлы ffmpeg для повторного подключения после рестарта
+	APIToken        string        // токен, с которым API возвращает секреты ingest
+
+	RestoreRetryInterval time.Duration // пауза между запросами секретов восстанавливаемого потока
+
+	FakeSegmentDuration time.Duration // длительность сегмента fake-конвейера
+
+	LLHLSPartTarget    time.Duration // длительность частичного сегмента LL-HLS
+	LLHLSSegmentTarget time.Duration // минимальная длительность полного сегмента LL-HLS
+
+	DVRMaxDiskBytes      int64         // лимит диска под сегменты одного потока (0 - без лимита)
+	DVRDiskCheckInterval time.Duration // период проверки занятости диска
+
+	RecordingsPath string // каталог VOD-архивов записанных сессий
+
+	ThumbnailInterval time.Duration // период снимков потока (0 - выключено)
+	ThumbnailHistory  int           // сколько последних снимков хранить
+	ThumbnailHeight   int           // высота снимка, ширина - по пропорциям
+
+	FFprobePath   string
+	ProbeInterval time.Duration // период проверки параметров ingest через ffprobe (0 - выключено)
+
+	StatsHistory int // сколько последних блоков ffmpeg -progress хранить (~2 в секунду)
+
+	InactivityTimeout time.Duration // порог неактивности HLS для потоков без собственного
+
+	LogDir            string        // логи ffmpeg потоков и ретрансляций
+	LogMaxBytes       int64         // ротация лога по размеру (0 - выключена)
+	LogMaxAge         time.Duration // ротация лога по возрасту (0 - выключена)
+	LogRotateInterval time.Duration // период проверки логов для ротации
+	LogSessions       int           // сколько последних сессий потока хранить в логах
+
+	ShutdownMode    string        // stop или handoff: что делать с потоками по SIGTERM
+	ShutdownTimeout time.Duration // общий срок остановки: запросы, потоки, уведомления
+
+	MaxStreams          int   // лимит одновременных потоков (0 - без лимита)
+	MaxTranscodeStreams int   // лимит потоков в режиме transcode (0 - без лимита)
+	MinFreeDiskBytes    int64 // минимум свободного места под HLS и записи для запуска (0 - не проверять)
+}
+
+var serviceConfig *ServiceConfig
+
+func loadServiceConfig() *ServiceConfig {
+	return &ServiceConfig{
+		Pipeline:   config.GetEnv("PIPELINE", "ffmpeg"),
+		FFmpegPath: config.GetEnv("FFMPEG_PATH", "ffmpeg"),
+		RestartPolicy: RestartPolicy{
+			Multiplier:  config.GetEnvFloat("FFMPEG_RESTART_MULTIPLIER", 2),
+			MaxBackoff:  config.GetEnvDuration("FFMPEG_RESTART_MAX_BACKOFF", 30*time.Second),
+			MaxRestarts: config.GetEnvInt("FFMPEG_RESTART_MAX", 0),
+			ResetAfter:  config.GetEnvDuration("FFMPEG_RESTART_RESET_AFTER", time.Minute),
+		},
+		StopTimeout:     config.GetEnvDuration("FFMPEG_STOP_TIMEOUT", 5*time.Second),
+		SRTPortMin:      config.GetEnvInt("SRT_PORT_MIN", 10000),
+		SRTPortMax:      config.GetEnvInt("SRT_PORT_MAX", 10100),
+		RTMPPortMin:     config.GetEnvInt("RTMP_PORT_MIN", 11000),
+		RTMPPortMax:     config.GetEnvInt("RTMP_PORT_MAX", 11100),
+		PullReadTimeout: config.GetEnvDuration("PULL_READ_TIMEOUT", 10*time.Second),
+		HLSRoot:         config.GetEnv("HLS_ROOT", "/app/hls"),
+		StateFile:       config.GetEnv("STATE_FILE", "/app/state/streams.json"),
+		StateRetention:  config.GetEnvDuration("STATE_RETENTION", 7*24*time.Hour),
+		RunDir:          config.GetEnv("RUN_DIR", "/app/run"),
+		APIToken:        config.GetEnv("API_TOKEN", ""),
+
+		RestoreRetryInterval: config.GetEnvDuration("RESTORE_RETRY_INTERVAL", 30*time.Second),
+
+		FakeSegmentDuration: config.GetEnvDuration("FAKE_SEGMENT_DURATION", 2*time.Second),
+
+		LLHLSPartTarget:    config.GetEnvDuration("LLHLS_PART_TARGET", 500*time.Millisecond),
+		LLHLSSegmentTarget: config.GetEnvDuration("LLHLS_SEGMENT_TARGET", 2*time.Second),
+
+		DVRMaxDiskBytes:      int64(config.GetEnvInt("DVR_MAX_DISK_MB", 4096)) << 20,
+		DVRDiskCheckInterval: config.GetEnvDuration("DVR_DISK_CHECK_INTERVAL", 30*time.Second),
+
+		RecordingsPath: config.GetEnv("RECORDINGS_PATH", "/app/recordings"),
+
+		ThumbnailInterval: config.GetEnvDuration("THUMBNAIL_INTERVAL", 10*time.Second),
+		ThumbnailHistory:  config.GetEnvInt("THUMBNAIL_HISTORY", 6),
+		ThumbnailHeight:   config.GetEnvInt("THUMBNAIL_HEIGHT", 360),
+
+		FFprobePath:   config.GetEnv("FFPROBE_PATH", "ffprobe"),
+		ProbeInterval: config.GetEnvDuration("PROBE_INTERVAL", 30*time.Second),
+
+		StatsHistory: config.GetEnvInt("STATS_HISTORY", 120),
+
+		InactivityTimeout: config.GetEnvDuration("HLS_INACTIVITY_TIMEOUT", 10*time.Second),
+
+		LogDir:            config.GetEnv("LOG_DIR", "/app/logs"),
+		LogMaxBytes:       int64(config.GetEnvInt("LOG_MAX_SIZE_MB", 50)) << 20,
+		LogMaxAge:         config.GetEnvDuration("LOG_MAX_AGE", 24*time.Hour),
+		LogRotateInterval: config.GetEnvDuration("LOG_ROTATE_INTERVAL", 30*time.Second),
+		LogSessions:       config.GetEnvInt("LOG_SESSIONS", 5),
+
+		ShutdownMode:    config.GetEnv("SHUTDOWN_MODE", ShutdownStop),
+		ShutdownTimeout: config.GetEnvDuration("SHUTDOWN_TIMEOUT", 25*time.Second),
+
+		MaxStreams:          config.GetEnvInt("MAX_STREAMS", 0),
+		MaxTranscodeStreams: config.GetEnvInt("MAX_TRANSCODE_STREAMS", 0),
+		MinFreeDiskBytes:    int64(config.GetEnvInt("MIN_FREE_DISK_MB", 1024)) << 20,
+	}
+}
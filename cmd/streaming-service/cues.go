@@ -0,0 +1,585 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"my-go-app/pkg/hls"
+	"my-go-app/pkg/middleware"
+)
+
+const (
+	// scte35FD - дескриптор, в который ffmpeg пишет секции SCTE-35 (-f data pipe:4)
+	scte35FD = progressFD + 1
+
+	minAdBreakDuration = time.Second
+	maxAdBreakDuration = time.Hour
+	maxAdBreakHistory  = 50
+
+	// adBreakEndTolerance - насколько раньше заявленного конца паузы может начаться
+	// сегмент возврата: границы сегментов не совпадают с концом паузы точно
+	adBreakEndTolerance = 250 * time.Millisecond
+
+	// maxSCTE35Buffer - предел буфера секций SCTE-35 (секция не длиннее 4 КБ)
+	maxSCTE35Buffer = 64 * 1024
+
+	AdBreakSourceAPI    = "api"
+	AdBreakSourceSCTE35 = "scte35"
+)
+
+var (
+	errAdBreakActive = errors.New("ad break already in progress")
+	errNoSegments    = errors.New("stream has no segments yet")
+)
+
+// AdCuesOptions - рекламные паузы потока, только для ts без LL-HLS
+type AdCuesOptions struct {
+	SCTE35Passthrough bool `json:"scte35_passthrough,omitempty"` // метки SCTE-35 из первого потока данных SRT ingest
+}
+
+// AdBreak - рекламная пауза потока. Пауза начинается с первого сегмента после
+// запроса и заканчивается на первой границе сегмента после заявленной
+// длительности или после метки возврата из ingest.
+type AdBreak struct {
+	ID              string     `json:"id"`
+	Source          string     `json:"source"` // api или scte35
+	EventID         uint32     `json:"event_id"`
+	RequestedAt     time.Time  `json:"requested_at"`
+	DurationSeconds float64    `json:"duration_seconds,omitempty"` // 0 - до метки возврата
+	OutSequence     *uint64    `json:"out_sequence,omitempty"`
+	Start           *time.Time `json:"start,omitempty"`
+	InSequence      *uint64    `json:"in_sequence,omitempty"`
+	End             *time.Time `json:"end,omitempty"`
+
+	afterSequence uint64  // пауза начинается со следующего сегмента
+	endAfter      *uint64 // метка возврата: пауза заканчивается со следующего сегмента
+	scte35Out     []byte
+	scte35In      []byte
+}
+
+func (b *AdBreak) anchored() bool { return b.OutSequence != nil }
+func (b *AdBreak) ended() bool    { return b.InSequence != nil }
+
+// AdCues размечает медиа-плейлисты потока рекламными паузами из API и SCTE-35 ingest.
+// ffmpeg переписывает плейлист на каждом сегменте, поэтому разметка повторяется
+// после каждой записи (HLSWatcher). Паузы хранятся в памяти и не переживают рестарт сервиса.
+type AdCues struct {
+	streamID    string
+	hlsPath     string
+	playlists   []string // медиа-плейлисты относительно hlsPath, первый - опорный
+	passthrough bool
+
+	mu           sync.Mutex
+	breaks       []*AdBreak
+	nextEventID  uint32
+	lastSequence uint64
+	buffer       []byte // недочитанные секции SCTE-35
+	warnedAt     time.Time
+}
+
+// NewAdCues готовит разметку пауз потока; nil, если паузы выключены
+func NewAdCues(streamID, hlsPath string, options *AdCuesOptions, renditions []Rendition) *AdCues {
+	if options == nil {
+		return nil
+	}
+	return &AdCues{
+		streamID:    streamID,
+		hlsPath:     hlsPath,
+		playlists:   mediaPlaylistPaths(hlsPath, PackagingTS, renditions),
+		passthrough: options.SCTE35Passthrough,
+		// splice_event_id уникален в пределах сессии и не повторяется после рестарта сервиса
+		nextEventID: uint32(time.Now().Unix()),
+	}
+}
+
+// Insert ставит паузу в очередь: она начнется с первого сегмента, которого еще нет
+// в плейлисте. Для паузы из API splice_insert формируется здесь.
+func (c *AdCues) Insert(source string, eventID uint32, duration time.Duration, scte35Out []byte) (AdBreak, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if active := c.activeLocked(); active != nil {
+		return AdBreak{}, errAdBreakActive
+	}
+	playlist, err := c.referenceLocked()
+	if err != nil {
+		return AdBreak{}, err
+	}
+	if len(playlist.Segments) == 0 {
+		return AdBreak{}, errNoSegments
+	}
+
+	if source == AdBreakSourceAPI {
+		eventID = c.nextEventID
+		c.nextEventID++
+	}
+	if scte35Out == nil {
+		scte35Out = hls.SpliceInsert(eventID, true, duration)
+	}
+	b := &AdBreak{
+		ID:              fmt.Sprintf("%s-%d", source, eventID),
+		Source:          source,
+		EventID:         eventID,
+		RequestedAt:     time.Now(),
+		DurationSeconds: duration.Seconds(),
+		afterSequence:   playlist.LastSequence(),
+		scte35Out:       scte35Out,
+	}
+	c.lastSequence = b.afterSequence
+	c.breaks = append(c.breaks, b)
+	if len(c.breaks) > maxAdBreakHistory {
+		c.breaks = c.breaks[len(c.breaks)-maxAdBreakHistory:]
+	}
+
+	log.Printf("📢 Рекламная пауза %s потока %s (%s, %s) начнется после сегмента %d",
+		b.ID, c.streamID, source, formatAdBreakDuration(duration), b.afterSequence)
+	return *b, nil
+}
+
+// end завершает паузу по метке возврата: пауза закончится со следующего сегмента
+func (c *AdCues) end(eventID uint32, scte35In []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	active := c.activeLocked()
+	if active == nil {
+		return
+	}
+	if active.EventID != eventID && active.Source != AdBreakSourceSCTE35 {
+		return
+	}
+	playlist, err := c.referenceLocked()
+	if err != nil {
+		return
+	}
+	last := playlist.LastSequence()
+	active.endAfter = &last
+	active.scte35In = scte35In
+	log.Printf("📢 Возврат из рекламной паузы %s потока %s после сегмента %d", active.ID, c.streamID, last)
+}
+
+// cancel отменяет паузу, которая еще не попала в плейлист
+func (c *AdCues) cancel(eventID uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, b := range c.breaks {
+		if b.EventID == eventID && !b.anchored() {
+			c.breaks = append(c.breaks[:i], c.breaks[i+1:]...)
+			log.Printf("📢 Рекламная пауза %s потока %s отменена", b.ID, c.streamID)
+			return
+		}
+	}
+}
+
+// activeLocked - пауза, которая ждет начала или еще не закончилась
+func (c *AdCues) activeLocked() *AdBreak {
+	for _, b := range c.breaks {
+		if !b.ended() {
+			return b
+		}
+	}
+	return nil
+}
+
+func (c *AdCues) referenceLocked() (*hls.MediaPlaylist, error) {
+	parsed, err := hls.ParseFile(filepath.Join(c.hlsPath, c.playlists[0]))
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Media == nil {
+		return nil, errors.New("reference playlist is not a media playlist")
+	}
+	// EXT-X-PROGRAM-DATE-TIME может стоять не у каждого сегмента: время
+	// остальных отсчитывается от предыдущего
+	segments := parsed.Media.Segments
+	for i := 1; i < len(segments); i++ {
+		if segments[i].ProgramDateTime == nil && segments[i-1].ProgramDateTime != nil {
+			start := segments[i-1].ProgramDateTime.Add(time.Duration(segments[i-1].Duration * float64(time.Second)))
+			segments[i].ProgramDateTime = &start
+		}
+	}
+	return parsed.Media, nil
+}
+
+// Update привязывает паузы к сегментам опорного плейлиста и размечает
+// ими все медиа-плейлисты потока; вызывается после каждой записи плейлиста
+func (c *AdCues) Update() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.breaks) == 0 {
+		return
+	}
+	playlist, err := c.referenceLocked()
+	if err != nil {
+		return
+	}
+
+	// Без append_list перезапущенный ffmpeg начинает нумерацию заново:
+	// номера сегментов прежних пауз больше ничего не значат
+	if last := playlist.LastSequence(); last < c.lastSequence {
+		log.Printf("⚠️ Нумерация сегментов потока %s сброшена, рекламные паузы сняты", c.streamID)
+		c.breaks = nil
+		c.lastSequence = last
+		return
+	}
+	c.lastSequence = playlist.LastSequence()
+
+	var events []StreamEventRequest
+	for _, b := range c.breaks {
+		if !b.anchored() {
+			seg := firstSegmentAfter(playlist, b.afterSequence)
+			if seg == nil {
+				continue
+			}
+			if seg.ProgramDateTime == nil {
+				c.warnLocked("в плейлисте нет EXT-X-PROGRAM-DATE-TIME")
+				continue
+			}
+			seq, start := seg.Sequence, *seg.ProgramDateTime
+			b.OutSequence, b.Start = &seq, &start
+			log.Printf("📢 Рекламная пауза %s потока %s началась с сегмента %d", b.ID, c.streamID, seq)
+			events = append(events, adBreakEvent(c.streamID, "cue_out", b, start, b.DurationSeconds, b.scte35Out))
+		}
+		if b.ended() {
+			continue
+		}
+
+		if b.endAfter == nil && time.Since(*b.Start) > maxAdBreakDuration {
+			// Метка возврата из ingest потерялась: пауза не может длиться бесконечно
+			last := playlist.LastSequence()
+			b.endAfter = &last
+		}
+		seg := adBreakEndSegment(playlist, b)
+		if seg == nil || seg.ProgramDateTime == nil {
+			continue
+		}
+		seq, end := seg.Sequence, *seg.ProgramDateTime
+		b.InSequence, b.End = &seq, &end
+		if b.scte35In == nil {
+			b.scte35In = hls.SpliceInsert(b.EventID, false, 0)
+		}
+		log.Printf("📢 Рекламная пауза %s потока %s закончилась на сегменте %d (%s)",
+			b.ID, c.streamID, seq, formatAdBreakDuration(end.Sub(*b.Start)))
+		events = append(events, adBreakEvent(c.streamID, "cue_in", b, end, end.Sub(*b.Start).Seconds(), b.scte35In))
+	}
+
+	c.tagPlaylistsLocked(playlist.MediaSequence)
+
+	for _, event := range events {
+		event := event
+		sendWebhook(func() { webhooks.StreamEvent(event) })
+	}
+}
+
+// firstSegmentAfter - первый сегмент плейлиста с номером больше after
+func firstSegmentAfter(playlist *hls.MediaPlaylist, after uint64) *hls.Segment {
+	for i := range playlist.Segments {
+		if playlist.Segments[i].Sequence > after {
+			return &playlist.Segments[i]
+		}
+	}
+	return nil
+}
+
+// adBreakEndSegment - первый сегмент после паузы или nil, если он еще не записан
+func adBreakEndSegment(playlist *hls.MediaPlaylist, b *AdBreak) *hls.Segment {
+	if b.endAfter != nil {
+		return firstSegmentAfter(playlist, max(*b.endAfter, *b.OutSequence))
+	}
+	if b.DurationSeconds <= 0 {
+		return nil
+	}
+	planned := time.Duration(b.DurationSeconds * float64(time.Second))
+	for i := range playlist.Segments {
+		seg := &playlist.Segments[i]
+		if seg.Sequence > *b.OutSequence && seg.ProgramDateTime != nil &&
+			seg.ProgramDateTime.Sub(*b.Start) >= planned-adBreakEndTolerance {
+			return seg
+		}
+	}
+	return nil
+}
+
+// tagPlaylistsLocked переписывает медиа-плейлисты с разметкой пауз.
+// Плейлист переписывается, только если разметка изменилась и ffmpeg
+// не успел записать новую версию, пока она готовилась.
+func (c *AdCues) tagPlaylistsLocked(mediaSequence uint64) {
+	breaks := make([]hls.AdBreak, 0, len(c.breaks))
+	for _, b := range c.breaks {
+		if !b.anchored() || (b.ended() && *b.InSequence < mediaSequence) {
+			continue
+		}
+		hb := hls.AdBreak{
+			ID:          b.ID,
+			Start:       *b.Start,
+			Planned:     time.Duration(b.DurationSeconds * float64(time.Second)),
+			OutSequence: *b.OutSequence,
+			SCTE35Out:   b.scte35Out,
+			SCTE35In:    b.scte35In,
+		}
+		if b.ended() {
+			hb.InSequence, hb.End = *b.InSequence, *b.End
+		}
+		breaks = append(breaks, hb)
+	}
+
+	for _, name := range c.playlists {
+		path := filepath.Join(c.hlsPath, name)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		tagged, err := hls.TagAdBreaks(string(content), breaks)
+		if err != nil || tagged == string(content) {
+			continue
+		}
+		if current, err := os.ReadFile(path); err != nil || !bytes.Equal(current, content) {
+			continue // ffmpeg уже записал новую версию, разметка повторится по ее событию
+		}
+		// Свой временный файл: playlist.m3u8.tmp может писать ffmpeg
+		tmpPath := path + ".ads.tmp"
+		if err := os.WriteFile(tmpPath, []byte(tagged), 0o644); err != nil {
+			c.warnLocked(err.Error())
+			continue
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			c.warnLocked(err.Error())
+		}
+	}
+}
+
+// warnLocked пишет предупреждение не чаще раза в минуту
+func (c *AdCues) warnLocked(message string) {
+	if time.Since(c.warnedAt) < time.Minute {
+		return
+	}
+	c.warnedAt = time.Now()
+	log.Printf("⚠️ Рекламные паузы потока %s: %s", c.streamID, message)
+}
+
+// Write принимает вывод ffmpeg -f data: секции SCTE-35 подряд, без разделителей
+func (c *AdCues) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	c.buffer = append(c.buffer, p...)
+	var sections [][]byte
+	for len(c.buffer) > 0 {
+		// Пакеты другого потока данных пропускаются до следующего table_id SCTE-35
+		if i := bytes.IndexByte(c.buffer, 0xFC); i != 0 {
+			if i < 0 {
+				i = len(c.buffer)
+			}
+			c.buffer = c.buffer[i:]
+			continue
+		}
+		length := hls.SectionLength(c.buffer)
+		if length == 0 || length > len(c.buffer) {
+			break
+		}
+		sections = append(sections, append([]byte(nil), c.buffer[:length]...))
+		c.buffer = c.buffer[length:]
+	}
+	if len(c.buffer) > maxSCTE35Buffer {
+		c.buffer = nil
+	}
+	c.mu.Unlock()
+
+	for _, section := range sections {
+		c.handleSCTE35(section)
+	}
+	return len(p), nil
+}
+
+// handleSCTE35 переносит метку из ingest в плейлисты
+func (c *AdCues) handleSCTE35(section []byte) {
+	info, err := hls.ParseSCTE35(section)
+	if errors.Is(err, hls.ErrNotSplice) {
+		return
+	}
+	if err != nil {
+		c.mu.Lock()
+		c.warnLocked(err.Error())
+		c.mu.Unlock()
+		return
+	}
+
+	switch {
+	case info.Cancel:
+		c.cancel(info.EventID)
+	case info.OutOfNetwork:
+		_, err := c.Insert(AdBreakSourceSCTE35, info.EventID, info.Duration, section)
+		// Энкодеры повторяют splice_insert несколько раз до начала паузы
+		if err != nil && !errors.Is(err, errAdBreakActive) {
+			log.Printf("⚠️ Метка SCTE-35 потока %s пропущена: %v", c.streamID, err)
+		}
+	default:
+		c.end(info.EventID, section)
+	}
+}
+
+// Info - паузы потока для API
+func (c *AdCues) Info() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	breaks := make([]AdBreak, 0, len(c.breaks))
+	for _, b := range c.breaks {
+		breaks = append(breaks, *b)
+	}
+	return map[string]interface{}{
+		"scte35_passthrough": c.passthrough,
+		"breaks":             breaks,
+	}
+}
+
+func formatAdBreakDuration(d time.Duration) string {
+	if d <= 0 {
+		return "до метки возврата"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// StreamEventRequest - событие потока для основного приложения
+type StreamEventRequest struct {
+	StreamID        string    `json:"stream_id"`
+	Type            string    `json:"type"` // cue_out, cue_in
+	Source          string    `json:"source"`
+	CueID           string    `json:"cue_id"`
+	Time            time.Time `json:"time"`
+	DurationSeconds float64   `json:"duration_seconds,omitempty"` // cue_out - заявленная, cue_in - фактическая
+	SCTE35          string    `json:"scte35,omitempty"`           // splice_info_section в base64
+}
+
+func adBreakEvent(streamID, eventType string, b *AdBreak, at time.Time, duration float64, scte35 []byte) StreamEventRequest {
+	return StreamEventRequest{
+		StreamID:        streamID,
+		Type:            eventType,
+		Source:          b.Source,
+		CueID:           b.ID,
+		Time:            at,
+		DurationSeconds: duration,
+		SCTE35:          base64.StdEncoding.EncodeToString(scte35),
+	}
+}
+
+// StreamEvent записывает событие в историю потока в основном приложении
+func (mainAppWebhooks) StreamEvent(event StreamEventRequest) {
+	mainAppURL := os.Getenv("MAIN_APP_URL")
+	if mainAppURL == "" {
+		mainAppURL = "http://go-app:8080"
+	}
+
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("❌ Failed to marshal stream event: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	maxRetries := 3
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		resp, err := client.Post(mainAppURL+"/api/internal/stream-events", "application/json", bytes.NewBuffer(jsonData))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		log.Printf("❌ Stream event webhook attempt %d failed: %v", attempt, err)
+		if attempt < maxRetries {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+	}
+}
+
+// AdBreakRequest - тело POST /api/streams/{id}/cues
+type AdBreakRequest struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// handleStreamCues: GET /api/streams/{id}/cues - рекламные паузы потока,
+// POST - новая пауза с ближайшей границы сегмента. Нужен токен API: пауза попадает в эфир.
+func handleStreamCues(w http.ResponseWriter, r *http.Request, streamID string, stream *StreamInstance) {
+	if !middleware.IsAuthorized(r, serviceConfig.APIToken) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Требуется токен API",
+			StreamID: streamID,
+			Error:    "unauthorized",
+		})
+		return
+	}
+
+	cues := stream.AdCues
+	if cues == nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Рекламные паузы для потока не включены",
+			StreamID: streamID,
+			Error:    "ad cues are not enabled for this stream",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Рекламные паузы потока",
+			StreamID: streamID,
+			Data:     cues.Info(),
+		})
+
+	case http.MethodPost:
+		var req AdBreakRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message: "Неверный формат запроса",
+				Error:   err.Error(),
+			})
+			return
+		}
+		duration := time.Duration(req.DurationSeconds * float64(time.Second))
+		if duration < minAdBreakDuration || duration > maxAdBreakDuration {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message:  "Некорректная длительность паузы",
+				StreamID: streamID,
+				Error:    fmt.Sprintf("duration_seconds must be between %g and %g", minAdBreakDuration.Seconds(), maxAdBreakDuration.Seconds()),
+			})
+			return
+		}
+
+		b, err := cues.Insert(AdBreakSourceAPI, 0, duration, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message:  "Не удалось поставить рекламную паузу",
+				StreamID: streamID,
+				Error:    err.Error(),
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Рекламная пауза начнется с ближайшей границы сегмента",
+			StreamID: streamID,
+			Data:     b,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
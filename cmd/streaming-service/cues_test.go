@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"my-go-app/pkg/hls"
+)
+
+const cuesTestPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:00.000Z
+#EXTINF:2.000,
+segment_10.ts
+#EXTINF:2.000,
+segment_11.ts
+`
+
+func newTestAdCues(t *testing.T) *AdCues {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, mediaPlaylistName), []byte(cuesTestPlaylist), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewAdCues("cues-test", dir, &AdCuesOptions{SCTE35Passthrough: true}, nil)
+}
+
+func (c *AdCues) testBreaks() []AdBreak {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	breaks := make([]AdBreak, 0, len(c.breaks))
+	for _, b := range c.breaks {
+		breaks = append(breaks, *b)
+	}
+	return breaks
+}
+
+func TestAdCuesWrite(t *testing.T) {
+	out := hls.SpliceInsert(77, true, 30*time.Second)
+	in := hls.SpliceInsert(77, false, 0)
+
+	// section_length=7 с верным CRC: секция короче заголовка splice_info_section
+	short := []byte{0xFC, 0x30, 0x07, 0, 0, 0}
+	short = binary.BigEndian.AppendUint32(short, crc32MPEGForTest(short))
+	short = append(short, make([]byte, 7)...)
+
+	tests := []struct {
+		name       string
+		writes     [][]byte
+		wantBreaks int
+		wantEnded  bool
+	}{
+		{name: "whole section", writes: [][]byte{out}, wantBreaks: 1},
+		{name: "section split across writes", writes: [][]byte{out[:5], out[5:12], out[12:]}, wantBreaks: 1},
+		{name: "garbage before section", writes: [][]byte{{0x00, 0x47, 0x11}, out}, wantBreaks: 1},
+		{name: "repeated cue-out", writes: [][]byte{out, out, out}, wantBreaks: 1},
+		{name: "cue-out and cue-in in one write", writes: [][]byte{append(append([]byte(nil), out...), in...)}, wantBreaks: 1, wantEnded: true},
+		{name: "declared length shorter than header", writes: [][]byte{short}},
+		{name: "header only", writes: [][]byte{{0xFC, 0x30, 0x00}}},
+		{name: "incomplete section", writes: [][]byte{out[:len(out)-1]}},
+		{name: "corrupted crc", writes: [][]byte{append(append([]byte(nil), out[:len(out)-1]...), out[len(out)-1]^0xFF)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cues := newTestAdCues(t)
+			for _, p := range tt.writes {
+				n, err := cues.Write(p)
+				if err != nil || n != len(p) {
+					t.Fatalf("Write() = %d, %v", n, err)
+				}
+			}
+
+			breaks := cues.testBreaks()
+			if len(breaks) != tt.wantBreaks {
+				t.Fatalf("got %d ad breaks, want %d", len(breaks), tt.wantBreaks)
+			}
+			if tt.wantBreaks == 0 {
+				return
+			}
+			b := breaks[0]
+			if b.Source != AdBreakSourceSCTE35 || b.EventID != 77 || b.DurationSeconds != 30 || b.afterSequence != 11 {
+				t.Fatalf("unexpected ad break %+v", b)
+			}
+			if ended := b.endAfter != nil; ended != tt.wantEnded {
+				t.Fatalf("cue-in received = %v, want %v", ended, tt.wantEnded)
+			}
+		})
+	}
+}
+
+func TestAdCuesWriteBufferLimit(t *testing.T) {
+	cues := newTestAdCues(t)
+	// Заголовок заявляет секцию длиннее данных: буфер растет, пока не превысит предел
+	header := []byte{0xFC, 0x3F, 0xFF}
+	cues.Write(header)
+	cues.Write(make([]byte, maxSCTE35Buffer))
+
+	cues.mu.Lock()
+	buffered := len(cues.buffer)
+	cues.mu.Unlock()
+	if buffered != 0 {
+		t.Fatalf("buffer holds %d bytes after overflow, want 0", buffered)
+	}
+}
+
+func FuzzAdCuesWrite(f *testing.F) {
+	f.Add(hls.SpliceInsert(1, true, time.Second), 4)
+	f.Add(append(hls.SpliceInsert(1, true, 0), hls.SpliceInsert(1, false, 0)...), 1)
+	f.Add([]byte{0xFC, 0x30, 0x07, 0, 0, 0, 0, 0, 0, 0}, 3)
+
+	f.Fuzz(func(t *testing.T, data []byte, chunk int) {
+		if chunk <= 0 {
+			chunk = len(data) + 1
+		}
+		cues := newTestAdCues(t)
+		for len(data) > 0 {
+			n := min(chunk, len(data))
+			cues.Write(data[:n])
+			data = data[n:]
+		}
+	})
+}
+
+// crc32MPEGForTest - CRC-32/MPEG-2, как в pkg/hls
+func crc32MPEGForTest(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"my-go-app/pkg/hls"
+)
+
+// minPlaylistSegments - окно живого плейлиста без DVR (6 x 4 секунды)
+const minPlaylistSegments = 6
+
+// DVRStats - занятость диска сегментами потока
+type DVRStats struct {
+	WindowSeconds    int       `json:"window_seconds"`
+	DiskBytes        int64     `json:"disk_bytes"`
+	DiskLimitBytes   int64     `json:"disk_limit_bytes"`
+	Segments         int       `json:"segments"`
+	AvailableSeconds int       `json:"available_seconds"` // фактическая глубина перемотки по файлам на диске
+	Capped           bool      `json:"capped"`            // старые сегменты удалялись из-за лимита диска
+	PrunedSegments   int       `json:"pruned_segments"`
+	CheckedAt        time.Time `json:"checked_at"`
+}
+
+// dvrListSize - сколько сегментов держать в плейлисте, чтобы покрыть окно DVR
+func dvrListSize(window, segment time.Duration) int {
+	if window <= 0 || segment <= 0 {
+		return minPlaylistSegments
+	}
+	size := int(math.Ceil(float64(window) / float64(segment)))
+	if size < minPlaylistSegments {
+		return minPlaylistSegments
+	}
+	return size
+}
+
+type segmentFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// listSegmentFiles собирает сегменты потока (включая каталоги вариантов), от старых к новым
+func listSegmentFiles(hlsPath string) []segmentFile {
+	var files []segmentFile
+	filepath.WalkDir(hlsPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isSegmentFile(d.Name()) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files = append(files, segmentFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	return files
+}
+
+// enforceDVRDiskCap укладывает сегменты потока в лимит диска, сокращая окно DVR:
+// самые старые сегменты сверх лимита сначала убираются из плейлистов (packager
+// для LL-HLS сжимает окно сам), и только потом удаляются их файлы, чтобы плееры
+// не получали 404 на сегменты из плейлиста. Возвращает актуальную статистику.
+func enforceDVRDiskCap(hlsPath string, playlists []string, packager *LLHLSPackager, window time.Duration, limit int64, prev DVRStats) DVRStats {
+	files := listSegmentFiles(hlsPath)
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+
+	stats := DVRStats{
+		WindowSeconds:  int(window / time.Second),
+		DiskLimitBytes: limit,
+		Capped:         prev.Capped,
+		PrunedSegments: prev.PrunedSegments,
+		CheckedAt:      time.Now(),
+	}
+
+	if limit > 0 && total > limit {
+		// init-сегменты CMAF нужны всем медиасегментам и не удаляются
+		prune := make(map[string]bool)
+		excess := total - limit
+		for _, f := range files {
+			if excess <= 0 {
+				break
+			}
+			if isInitSegment(filepath.Base(f.path)) {
+				continue
+			}
+			prune[f.path] = true
+			excess -= f.size
+		}
+
+		var removed int
+		if packager != nil {
+			removed = packager.Prune(prune)
+		} else {
+			removed = pruneDVRSegments(hlsPath, playlists, prune)
+		}
+		if removed > 0 {
+			stats.Capped = true
+			stats.PrunedSegments += removed
+			files = listSegmentFiles(hlsPath)
+			total = 0
+			for _, f := range files {
+				total += f.size
+			}
+		}
+	}
+
+	stats.DiskBytes = total
+	stats.Segments = len(files)
+	if len(files) > 0 {
+		stats.AvailableSeconds = int(files[len(files)-1].modTime.Sub(files[0].modTime).Seconds()) + hlsSegmentSeconds
+	}
+	return stats
+}
+
+// pruneDVRSegments убирает сегменты prune из плейлистов и удаляет файлы, на которые
+// плейлисты больше не ссылаются. Возвращает число удаленных файлов.
+func pruneDVRSegments(hlsPath string, playlists []string, prune map[string]bool) int {
+	referenced, ok := trimDeletedSegments(hlsPath, playlists, func(path string) bool {
+		return prune[path] || missingFile(path)
+	})
+	if !ok {
+		// Не зная, на что ссылаются плейлисты, файлы не удаляем
+		return 0
+	}
+
+	removed := 0
+	for path := range prune {
+		// Сегмент остался в плейлисте, если ffmpeg переписал его после обрезки:
+		// он будет удален при следующей проверке
+		if referenced[path] {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+
+	// ffmpeg мог записать плейлист со старыми сегментами между обрезкой и удалением
+	if removed > 0 {
+		trimDeletedSegments(hlsPath, playlists, missingFile)
+	}
+	return removed
+}
+
+// trimDeletedSegments убирает из начала плейлистов потока сегменты, отмеченные gone.
+// ffmpeg пишет плейлист из своего окна и после удаления по лимиту DVR снова
+// перечисляет удаленные сегменты, поэтому обрезка повторяется после каждой
+// записи плейлиста (см. HLSWatcher). Возвращает пути сегментов, на которые
+// плейлисты ссылаются после обрезки; ok=false, если какой-то плейлист не разобран.
+func trimDeletedSegments(hlsPath string, playlists []string, gone func(path string) bool) (referenced map[string]bool, ok bool) {
+	referenced = make(map[string]bool)
+	ok = true
+	for _, name := range playlists {
+		path := filepath.Join(hlsPath, name)
+		dir := filepath.Dir(path)
+		drop := func(uri string) bool { return gone(filepath.Join(dir, uri)) }
+
+		err := rewritePlaylistFile(path, func(content string) (string, error) {
+			var refs []string
+			if name == dashManifestName {
+				var parsed bool
+				content, refs, parsed = trimDASHManifest(content, drop)
+				if !parsed {
+					return "", fmt.Errorf("unsupported DASH manifest layout")
+				}
+			} else {
+				trimmed, _, err := hls.TrimLeadingSegments(content, drop)
+				if err != nil {
+					return "", err
+				}
+				parsed, err := hls.Parse(strings.NewReader(trimmed))
+				if err != nil || parsed.Media == nil {
+					return "", fmt.Errorf("not a media playlist")
+				}
+				for _, seg := range parsed.Media.Segments {
+					refs = append(refs, seg.URI)
+				}
+				content = trimmed
+			}
+			for _, ref := range refs {
+				referenced[filepath.Join(dir, ref)] = true
+			}
+			return content, nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			ok = false
+		}
+	}
+	return referenced, ok
+}
+
+// rewritePlaylistFile применяет transform к плейлисту и атомарно записывает результат,
+// если он изменился и ffmpeg не успел записать новую версию, пока он готовился
+func rewritePlaylistFile(path string, transform func(string) (string, error)) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	updated, err := transform(string(content))
+	if err != nil || updated == string(content) {
+		return err
+	}
+	if current, err := os.ReadFile(path); err != nil || !bytes.Equal(current, content) {
+		return err // новая версия будет обрезана по ее событию
+	}
+
+	// Свой временный файл: ffmpeg и разметка пауз пишут через свои
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".dvr-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(updated); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func missingFile(path string) bool {
+	_, err := os.Stat(path)
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// dvrPlaylists - плейлисты, которые обрезаются вместе с удалением сегментов по лимиту DVR
+func dvrPlaylists(stream *StreamInstance) []string {
+	playlists := mediaPlaylistPaths(stream.HLSPath, stream.Packaging, stream.Renditions)
+	if stream.Packaging == PackagingCMAF {
+		playlists = append(playlists, dashManifestName)
+	}
+	return playlists
+}
+
+// trimPrunedSegments повторяет обрезку после записи плейлиста ffmpeg. Удалять
+// сегменты может только проверка лимита диска DVR, без лимита делать нечего.
+func trimPrunedSegments(stream *StreamInstance) {
+	if serviceConfig.DVRMaxDiskBytes <= 0 || stream.LLHLS != nil || stream.Recorder != nil {
+		return
+	}
+	trimDeletedSegments(stream.HLSPath, dvrPlaylists(stream), missingFile)
+}
+
+// monitorDVRDisk периодически проверяет размер сегментов потока и применяет лимит диска
+func monitorDVRDisk(streamID string, instance *StreamInstance) {
+	ticker := time.NewTicker(serviceConfig.DVRDiskCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		manager.mutex.RLock()
+		stream, exists := manager.streams[streamID]
+		var prev DVRStats
+		if exists && stream == instance {
+			prev = stream.DVR
+		}
+		manager.mutex.RUnlock()
+
+		if !exists || stream != instance {
+			return
+		}
+
+		// Сегменты записываемой сессии не удаляются по лимиту DVR
+		limit := serviceConfig.DVRMaxDiskBytes
+		if stream.Recorder != nil {
+			limit = 0
+		}
+
+		stats := enforceDVRDiskCap(stream.HLSPath, dvrPlaylists(stream), stream.LLHLS, time.Duration(stream.DVRWindowSeconds)*time.Second, limit, prev)
+		if pruned := stats.PrunedSegments - prev.PrunedSegments; pruned > 0 {
+			log.Printf("💾 Поток %s превысил лимит DVR (%d байт): окно сокращено, удалено старых сегментов: %d", streamID, serviceConfig.DVRMaxDiskBytes, pruned)
+		}
+
+		manager.mutex.Lock()
+		stream.DVR = stats
+		manager.mutex.Unlock()
+	}
+}
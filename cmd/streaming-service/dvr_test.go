@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"my-go-app/pkg/hls"
+)
+
+// writeDVRTestSegment пишет сегмент в 100 байт; время изменения растет вместе с номером
+func writeDVRTestSegment(t *testing.T, dir string, seq int) {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("segment_%03d.ts", seq))
+	if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-time.Hour).Add(time.Duration(seq) * 4 * time.Second)
+	os.Chtimes(path, modTime, modTime)
+}
+
+// writeDVRTestPlaylist пишет плейлист окна count сегментов, как ffmpeg
+func writeDVRTestPlaylist(t *testing.T, dir string, first, count int) {
+	t.Helper()
+	var playlist strings.Builder
+	fmt.Fprintf(&playlist, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	for seq := first; seq < first+count; seq++ {
+		fmt.Fprintf(&playlist, "#EXTINF:4.000,\nsegment_%03d.ts\n", seq)
+	}
+	if err := os.WriteFile(filepath.Join(dir, mediaPlaylistName), []byte(playlist.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertPlaylistSegmentsExist проверяет, что плейлист ссылается только на существующие файлы
+func assertPlaylistSegmentsExist(t *testing.T, dir string) *hls.MediaPlaylist {
+	t.Helper()
+	parsed, err := hls.ParseFile(filepath.Join(dir, mediaPlaylistName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seg := range parsed.Media.Segments {
+		if missingFile(filepath.Join(dir, seg.URI)) {
+			t.Fatalf("playlist references deleted segment %s", seg.URI)
+		}
+	}
+	return parsed.Media
+}
+
+func TestEnforceDVRDiskCapShrinksPlaylist(t *testing.T) {
+	dir := t.TempDir()
+	for seq := 0; seq < 6; seq++ {
+		writeDVRTestSegment(t, dir, seq)
+	}
+	writeDVRTestPlaylist(t, dir, 0, 6)
+
+	stats := enforceDVRDiskCap(dir, []string{mediaPlaylistName}, nil, time.Hour, 350, DVRStats{})
+	if !stats.Capped || stats.PrunedSegments != 3 || stats.Segments != 3 || stats.DiskBytes != 300 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	media := assertPlaylistSegmentsExist(t, dir)
+	if media.MediaSequence != 3 || len(media.Segments) != 3 {
+		t.Fatalf("playlist starts at %d with %d segments, want 3 and 3", media.MediaSequence, len(media.Segments))
+	}
+
+	// ffmpeg переписывает плейлист из своего окна вместе с удаленными сегментами
+	writeDVRTestSegment(t, dir, 6)
+	writeDVRTestPlaylist(t, dir, 1, 6)
+	if _, ok := trimDeletedSegments(dir, []string{mediaPlaylistName}, missingFile); !ok {
+		t.Fatal("trimDeletedSegments() could not parse playlist")
+	}
+	media = assertPlaylistSegmentsExist(t, dir)
+	if media.MediaSequence != 3 || len(media.Segments) != 4 {
+		t.Fatalf("playlist starts at %d with %d segments after ffmpeg rewrite, want 3 and 4", media.MediaSequence, len(media.Segments))
+	}
+
+	// Без превышения лимита ничего не удаляется
+	stats = enforceDVRDiskCap(dir, []string{mediaPlaylistName}, nil, time.Hour, 1000, stats)
+	if stats.PrunedSegments != 3 || stats.Segments != 4 {
+		t.Fatalf("unexpected stats without excess %+v", stats)
+	}
+}
+
+func TestEnforceDVRDiskCapKeepsFilesOfUnparsedPlaylist(t *testing.T) {
+	dir := t.TempDir()
+	for seq := 0; seq < 3; seq++ {
+		writeDVRTestSegment(t, dir, seq)
+	}
+	os.WriteFile(filepath.Join(dir, mediaPlaylistName), []byte("#EXTM3U\n#EXTINF:broken,\nsegment_000.ts\n"), 0644)
+
+	stats := enforceDVRDiskCap(dir, []string{mediaPlaylistName}, nil, time.Hour, 100, DVRStats{})
+	if stats.PrunedSegments != 0 || stats.Segments != 3 {
+		t.Fatalf("segments deleted without a parsed playlist: %+v", stats)
+	}
+}
+
+const dvrTestManifest = `<?xml version="1.0" encoding="utf-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="dynamic">
+	<Period id="0" start="PT0.0S">
+		<AdaptationSet id="0" contentType="video" segmentAlignment="true">
+			<Representation id="0" mimeType="video/mp4" codecs="avc1.64001f" bandwidth="2000000" width="1280" height="720">
+				<SegmentTemplate timescale="12800" initialization="init_$RepresentationID$.m4s" media="chunk_$RepresentationID$_$Number%05d$.m4s" startNumber="1">
+					<SegmentTimeline>
+						<S t="0" d="51200" r="2" />
+						<S d="25600" />
+						<S d="51200" />
+					</SegmentTimeline>
+				</SegmentTemplate>
+			</Representation>
+		</AdaptationSet>
+		<AdaptationSet id="1" contentType="audio" segmentAlignment="true">
+			<Representation id="1" mimeType="audio/mp4" codecs="mp4a.40.2" bandwidth="128000">
+				<SegmentTemplate timescale="48000" initialization="init_$RepresentationID$.m4s" media="chunk_$RepresentationID$_$Number%05d$.m4s" startNumber="1">
+					<SegmentTimeline>
+						<S t="0" d="192000" r="4" />
+					</SegmentTimeline>
+				</SegmentTemplate>
+			</Representation>
+		</AdaptationSet>
+	</Period>
+</MPD>
+`
+
+func TestTrimDASHManifest(t *testing.T) {
+	gone := map[string]bool{
+		"chunk_0_00001.m4s": true, "chunk_0_00002.m4s": true, "chunk_0_00003.m4s": true,
+		"chunk_1_00001.m4s": true, "chunk_1_00003.m4s": true,
+	}
+	trimmed, referenced, ok := trimDASHManifest(dvrTestManifest, func(name string) bool { return gone[name] })
+	if !ok {
+		t.Fatal("trimDASHManifest() could not parse manifest")
+	}
+
+	video := "startNumber=\"4\">\n\t\t\t\t\t<SegmentTimeline>\n" +
+		"\t\t\t\t\t\t<S t=\"153600\" d=\"25600\" />\n" +
+		"\t\t\t\t\t\t<S d=\"51200\" />\n" +
+		"\t\t\t\t\t</SegmentTimeline>"
+	audio := "startNumber=\"2\">\n\t\t\t\t\t<SegmentTimeline>\n" +
+		"\t\t\t\t\t\t<S t=\"192000\" d=\"192000\" r=\"3\" />\n" +
+		"\t\t\t\t\t</SegmentTimeline>"
+	if !strings.Contains(trimmed, video) || !strings.Contains(trimmed, audio) {
+		t.Fatalf("unexpected manifest:\n%s", trimmed)
+	}
+
+	want := []string{"chunk_0_00004.m4s", "chunk_0_00005.m4s", "chunk_1_00002.m4s", "chunk_1_00003.m4s", "chunk_1_00004.m4s", "chunk_1_00005.m4s"}
+	if fmt.Sprint(referenced) != fmt.Sprint(want) {
+		t.Fatalf("referenced = %v, want %v", referenced, want)
+	}
+
+	// Повторная обрезка уже обрезанного манифеста ничего не меняет
+	again, _, _ := trimDASHManifest(trimmed, func(name string) bool { return gone[name] })
+	if again != trimmed {
+		t.Fatalf("second trim changed manifest:\n%s", again)
+	}
+
+	if _, _, ok := trimDASHManifest("<MPD></MPD>", func(string) bool { return true }); ok {
+		t.Fatal("manifest without representations parsed as ok")
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"my-go-app/pkg/middleware"
+)
+
+// Состояния ретрансляции во внешнюю точку
+const (
+	ForwarderWaiting    = "waiting"    // HLS потока еще не появился
+	ForwarderRunning    = "running"    // ffmpeg отправляет поток
+	ForwarderRestarting = "restarting" // ffmpeg завершился, супервизор ждет перезапуска
+	ForwarderFailed     = "failed"     // исчерпан лимит перезапусков
+)
+
+// MaxDestinations - предел точек ретрансляции на поток: каждая - отдельный ffmpeg
+const MaxDestinations = 10
+
+// destinationIDPattern - идентификатор точки попадает в имена лог- и PID-файлов
+var destinationIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// DestinationSpec - внешняя точка, куда ретранслируется поток (rtmp, rtmps или srt)
+type DestinationSpec struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+}
+
+// ForwarderStatus - состояние ретрансляции для API
+type ForwarderStatus struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name,omitempty"`
+	URL          string     `json:"url"`
+	State        string     `json:"state"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	RestartCount int        `json:"restart_count"`
+	LastExitCode *int       `json:"last_exit_code,omitempty"`
+	LastExitTime *time.Time `json:"last_exit_time,omitempty"`
+	PID          int        `json:"pid,omitempty"`
+	Adopted      bool       `json:"adopted,omitempty"`
+}
+
+// validateDestinations проверяет точки ретрансляции из параметров запуска
+func validateDestinations(destinations []DestinationSpec) error {
+	if len(destinations) > MaxDestinations {
+		return fmt.Errorf("at most %d destinations are allowed", MaxDestinations)
+	}
+	seen := make(map[string]bool, len(destinations))
+	for _, dest := range destinations {
+		if !destinationIDPattern.MatchString(dest.ID) {
+			return errors.New("destination id must match [A-Za-z0-9_-]{1,64}")
+		}
+		if seen[dest.ID] {
+			return fmt.Errorf("duplicate destination id %s", dest.ID)
+		}
+		seen[dest.ID] = true
+
+		u, err := url.Parse(dest.URL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("destination %s: url must be an absolute URL", dest.ID)
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "rtmp", "rtmps", "srt":
+		default:
+			return fmt.Errorf("destination %s: url scheme must be rtmp, rtmps or srt", dest.ID)
+		}
+	}
+	return nil
+}
+
+// redactDestinationURL скрывает ключ публикации RTMP и параметры SRT (streamid, passphrase)
+func redactDestinationURL(raw string) string {
+	redacted := redactSourceURL(raw)
+	u, err := url.Parse(redacted)
+	if err != nil {
+		return ""
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme == "rtmp" || scheme == "rtmps") && strings.Count(strings.Trim(u.Path, "/"), "/") >= 1 {
+		return u.Scheme + "://" + u.Host + filepath.Dir(u.Path) + "/{stream_key}"
+	}
+	return redacted
+}
+
+// forwarderArgs - ffmpeg без перекодирования читает HLS потока с живого края
+// и отправляет первую видео- и аудиодорожку в точку ретрансляции.
+// Вход задан через file:, чтобы isIngestProcess не принял ретранслятор за ffmpeg потока.
+func forwarderArgs(playlist, target string) []string {
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "warning",
+		"-live_start_index", "-1",
+		"-re",
+		"-i", "file:" + playlist,
+		"-map", "0:v:0?",
+		"-map", "0:a:0?",
+		"-c", "copy",
+	}
+	if u, err := url.Parse(target); err == nil && strings.EqualFold(u.Scheme, "srt") {
+		return append(args, "-f", "mpegts", target)
+	}
+	return append(args, "-f", "flv", target)
+}
+
+func forwarderPIDFile(streamID, destID string) string {
+	return filepath.Join(serviceConfig.RunDir, fmt.Sprintf("%s.fwd-%s.pid", streamID, destID))
+}
+
+func forwarderLogFile(streamID, destID string) string {
+	return filepath.Join(serviceConfig.LogDir, fmt.Sprintf("%s.fwd-%s.log", streamID, destID))
+}
+
+// Forwarder ретранслирует поток в одну внешнюю точку. ffmpeg запускается,
+// когда появляется плейлист потока, и перезапускается супервизором по RestartPolicy.
+type Forwarder struct {
+	streamID string
+	dest     DestinationSpec
+	playlist string
+
+	mu     sync.Mutex
+	status ForwarderStatus
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewForwarder(streamID, playlist string, dest DestinationSpec) *Forwarder {
+	return &Forwarder{
+		streamID: streamID,
+		dest:     dest,
+		playlist: playlist,
+		status: ForwarderStatus{
+			ID:    dest.ID,
+			Name:  dest.Name,
+			URL:   redactDestinationURL(dest.URL),
+			State: ForwarderWaiting,
+		},
+	}
+}
+
+func (f *Forwarder) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	f.done = make(chan struct{})
+	go f.run(ctx)
+}
+
+// Stop останавливает ffmpeg ретрансляции и ждет завершения супервизора
+func (f *Forwarder) Stop() {
+	if f.cancel == nil {
+		return
+	}
+	f.cancel()
+	<-f.done
+}
+
+// Status возвращает копию состояния; полный URL - только для авторизованных вызовов
+func (f *Forwarder) Status(withSecrets bool) ForwarderStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := f.status
+	if withSecrets {
+		status.URL = f.dest.URL
+	}
+	return status
+}
+
+func (f *Forwarder) run(ctx context.Context) {
+	defer close(f.done)
+
+	pidFile := forwarderPIDFile(f.streamID, f.dest.ID)
+	args := forwarderArgs(f.playlist, f.dest.URL)
+
+	// ffmpeg ретрансляции пережил рестарт сервиса: с теми же аргументами
+	// подключаемся к нему, с другими (точку изменили) - завершаем
+	adoptPID := 0
+	if pid := readPIDFile(pidFile); pid > 0 && processAlive(pid) {
+		cmdline := processCmdline(pid)
+		if len(cmdline) > 1 && strings.Contains(filepath.Base(cmdline[0]), "ffmpeg") {
+			if slices.Equal(cmdline[1:], args) {
+				adoptPID = pid
+			} else {
+				log.Printf("🧹 Завершение устаревшей ретрансляции %s потока %s (PID %d)", f.dest.ID, f.streamID, pid)
+				terminateProcess(pid, serviceConfig.StopTimeout)
+			}
+		}
+	}
+
+	if adoptPID == 0 && !f.waitForPlaylist(ctx) {
+		return
+	}
+
+	// Fake-конвейер не пишет настоящий медиапоток - ретрансляция только имитируется
+	if serviceConfig.Pipeline == "fake" {
+		f.apply(PipelineEvent{Type: EventProcessStarted})
+		<-ctx.Done()
+		return
+	}
+
+	logFlags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if adoptPID > 0 {
+		logFlags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	logFile, err := os.OpenFile(forwarderLogFile(f.streamID, f.dest.ID), logFlags, 0o644)
+	if err != nil {
+		log.Printf("❌ Не удалось открыть лог ретрансляции %s потока %s: %v", f.dest.ID, f.streamID, err)
+		return
+	}
+	defer logFile.Close()
+
+	supervisor := NewSupervisor(f.streamID, serviceConfig.FFmpegPath, args,
+		logFile, serviceConfig.RestartPolicy, serviceConfig.StopTimeout)
+	supervisor.PIDFile = pidFile
+	supervisor.OnEvent = f.apply
+
+	if adoptPID > 0 {
+		f.mu.Lock()
+		f.status.Adopted = true
+		f.mu.Unlock()
+		err = supervisor.Adopt(ctx, adoptPID)
+	} else {
+		err = supervisor.Start(ctx)
+	}
+	if err != nil {
+		log.Printf("❌ Не удалось запустить ретрансляцию %s потока %s: %v", f.dest.ID, f.streamID, err)
+		return
+	}
+	log.Printf("📡 Ретрансляция %s потока %s запущена (%s)", f.dest.ID, f.streamID, redactDestinationURL(f.dest.URL))
+	<-supervisor.Done()
+}
+
+// waitForPlaylist ждет первый плейлист потока: до него ffmpeg ретрансляции сразу завершился бы
+func (f *Forwarder) waitForPlaylist(ctx context.Context) bool {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		if _, err := os.Stat(f.playlist); err == nil {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// apply переносит событие супервизора в состояние ретрансляции
+func (f *Forwarder) apply(event PipelineEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.status.RestartCount = event.Status.RestartCount
+	f.status.LastExitCode = event.Status.LastExitCode
+	f.status.LastExitTime = event.Status.LastExitTime
+	f.status.PID = event.Status.PID
+
+	switch event.Type {
+	case EventProcessStarted:
+		now := time.Now()
+		f.status.State = ForwarderRunning
+		f.status.StartedAt = &now
+	case EventProcessExited:
+		f.status.State = ForwarderRestarting
+		f.status.StartedAt = nil
+		if event.Status.LastExitCode != nil {
+			log.Printf("⚠️ Ретрансляция %s потока %s завершилась с кодом %d", f.dest.ID, f.streamID, *event.Status.LastExitCode)
+		}
+	case EventPipelineFailed:
+		f.status.State = ForwarderFailed
+		log.Printf("❌ Ретрансляция %s потока %s исчерпала лимит перезапусков", f.dest.ID, f.streamID)
+	}
+}
+
+// syncForwarders приводит ретрансляции потока к списку destinations:
+// новые точки запускаются, удаленные и измененные - останавливаются
+func syncForwarders(stream *StreamInstance, destinations []DestinationSpec) {
+	playlist := filepath.Join(stream.HLSPath, stream.PlaylistName())
+	wanted := make(map[string]DestinationSpec, len(destinations))
+	for _, dest := range destinations {
+		wanted[dest.ID] = dest
+	}
+
+	var stale, started []*Forwarder
+
+	manager.mutex.Lock()
+	// nil - поток уже останавливается, новые ретрансляции не нужны
+	if stream.Forwarders == nil {
+		manager.mutex.Unlock()
+		return
+	}
+	for id, fwd := range stream.Forwarders {
+		if dest, ok := wanted[id]; !ok || dest.URL != fwd.dest.URL {
+			stale = append(stale, fwd)
+			delete(stream.Forwarders, id)
+		} else {
+			// Имя можно менять без перезапуска ffmpeg
+			fwd.mu.Lock()
+			fwd.status.Name = dest.Name
+			fwd.mu.Unlock()
+		}
+	}
+	for _, dest := range destinations {
+		if _, ok := stream.Forwarders[dest.ID]; !ok {
+			fwd := NewForwarder(stream.StreamID, playlist, dest)
+			stream.Forwarders[dest.ID] = fwd
+			started = append(started, fwd)
+		}
+	}
+	stream.Destinations = destinations
+	manager.mutex.Unlock()
+
+	// Старая ретрансляция в ту же точку должна завершиться до запуска новой
+	stopForwarderList(stale)
+	for _, fwd := range started {
+		fwd.Start()
+	}
+}
+
+// stopForwarders останавливает все ретрансляции потока
+func stopForwarders(stream *StreamInstance) {
+	manager.mutex.Lock()
+	forwarders := make([]*Forwarder, 0, len(stream.Forwarders))
+	for _, fwd := range stream.Forwarders {
+		forwarders = append(forwarders, fwd)
+	}
+	stream.Forwarders = nil
+	manager.mutex.Unlock()
+
+	stopForwarderList(forwarders)
+}
+
+func stopForwarderList(forwarders []*Forwarder) {
+	var wg sync.WaitGroup
+	for _, fwd := range forwarders {
+		wg.Add(1)
+		go func(fwd *Forwarder) {
+			defer wg.Done()
+			fwd.Stop()
+		}(fwd)
+	}
+	wg.Wait()
+}
+
+// forwardersInfo - состояние ретрансляций в порядке точек из параметров запуска.
+// Вызывается под manager.mutex.
+func forwardersInfo(stream *StreamInstance, withSecrets bool) []ForwarderStatus {
+	statuses := make([]ForwarderStatus, 0, len(stream.Destinations))
+	for _, dest := range stream.Destinations {
+		if fwd, ok := stream.Forwarders[dest.ID]; ok {
+			statuses = append(statuses, fwd.Status(withSecrets))
+		}
+	}
+	return statuses
+}
+
+func readPIDFile(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// handleStreamDestinations: GET /api/streams/{stream_id}/destinations - состояние ретрансляций,
+// PUT /api/streams/{stream_id}/destinations - новый список точек для работающего потока
+func handleStreamDestinations(w http.ResponseWriter, r *http.Request, stream *StreamInstance) {
+	authorized := middleware.IsAuthorized(r, serviceConfig.APIToken)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Destinations []DestinationSpec `json:"destinations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message: "Неверный формат данных",
+				Error:   err.Error(),
+			})
+			return
+		}
+		if err := validateDestinations(req.Destinations); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message: "Некорректные точки ретрансляции",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		// Поток мог быть остановлен, пока разбирался запрос
+		manager.mutex.RLock()
+		current := manager.streams[stream.StreamID] == stream
+		manager.mutex.RUnlock()
+		if !current {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message: "Поток не найден",
+				Error:   "Stream not found",
+			})
+			return
+		}
+
+		syncForwarders(stream, req.Destinations)
+
+		// Восстановленный после рестарта поток запускает ретрансляции по журналу
+		if rec, ok := manager.state.Get(stream.StreamID); ok {
+			rec.Options.Destinations = req.Destinations
+			if err := manager.state.Put(rec); err != nil {
+				log.Printf("⚠️ Не удалось записать журнал состояния для потока %s: %v", stream.StreamID, err)
+			}
+		}
+		log.Printf("📡 Точки ретрансляции потока %s обновлены: %d", stream.StreamID, len(req.Destinations))
+	default:
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	manager.mutex.RLock()
+	statuses := forwardersInfo(stream, authorized)
+	manager.mutex.RUnlock()
+
+	json.NewEncoder(w).Encode(StreamResponse{
+		Message:  "Ретрансляции потока",
+		StreamID: stream.StreamID,
+		Status:   stream.Status,
+		Data:     statuses,
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"my-go-app/pkg/hls"
+)
+
+// mediaPlaylistPaths - медиа-плейлисты потока относительно hlsPath:
+// варианты transcode, представления CMAF или единственный playlist.m3u8
+func mediaPlaylistPaths(hlsPath, packaging string, renditions []Rendition) []string {
+	switch {
+	case packaging == PackagingCMAF:
+		matches, _ := filepath.Glob(filepath.Join(hlsPath, "media_*.m3u8"))
+		names := make([]string, 0, len(matches))
+		for _, match := range matches {
+			names = append(names, filepath.Base(match))
+		}
+		return names
+	case len(renditions) > 0:
+		names := make([]string, 0, len(renditions))
+		for _, r := range renditions {
+			names = append(names, filepath.Join(r.Name, mediaPlaylistName))
+		}
+		return names
+	default:
+		return []string{mediaPlaylistName}
+	}
+}
+
+// HLSHealthChecker разбирает медиа-плейлисты потока при каждом их обновлении
+// (события HLSWatcher) и хранит hls.Monitor для каждого из них
+type HLSHealthChecker struct {
+	streamID string
+	hlsPath  string
+	monitors map[string]*hls.Monitor
+	last     map[string]hls.Analysis
+}
+
+func NewHLSHealthChecker(streamID, hlsPath string) *HLSHealthChecker {
+	return &HLSHealthChecker{
+		streamID: streamID,
+		hlsPath:  hlsPath,
+		monitors: make(map[string]*hls.Monitor),
+		last:     make(map[string]hls.Analysis),
+	}
+}
+
+// Check проверяет плейлисты. ok=false - ни один плейлист еще не удалось
+// разобрать (ffmpeg не успел его записать), и решение об активности
+// остается за появлением новых сегментов.
+func (c *HLSHealthChecker) Check(names []string, now time.Time) (health map[string]hls.Analysis, advanced, ok bool) {
+	health = make(map[string]hls.Analysis, len(names))
+	for _, name := range names {
+		path := filepath.Join(c.hlsPath, name)
+		playlist, err := hls.ParseFile(path)
+		if err != nil || playlist.Media == nil {
+			continue
+		}
+
+		mon, exists := c.monitors[name]
+		if !exists {
+			mon = hls.NewMonitor()
+			c.monitors[name] = mon
+		}
+		analysis := mon.Observe(playlist.Media, filepath.Dir(path), now)
+		c.logNewIssues(name, analysis)
+		c.last[name] = analysis
+		health[name] = analysis
+
+		ok = true
+		advanced = advanced || analysis.Advanced
+	}
+	return health, advanced, ok
+}
+
+// logNewIssues пишет в лог проблемы, которых не было на прошлой проверке.
+// Сброс нумерации фиксируется только в момент сброса, поэтому логируется всегда.
+func (c *HLSHealthChecker) logNewIssues(name string, analysis hls.Analysis) {
+	seen := make(map[string]bool)
+	for _, issue := range c.last[name].Issues {
+		seen[issue.Code] = true
+	}
+	logged := make(map[string]bool)
+	for _, issue := range analysis.Issues {
+		if logged[issue.Code] || (seen[issue.Code] && issue.Code != hls.IssueSequenceReset) {
+			continue
+		}
+		logged[issue.Code] = true
+		log.Printf("⚠️ Плейлист %s потока %s: %s (%s)", name, c.streamID, issue.Message, issue.Code)
+	}
+}
+
+// hlsHealthInfo - анализ плейлистов для API; вызывается под manager.mutex
+func hlsHealthInfo(stream *StreamInstance) map[string]interface{} {
+	names := make([]string, 0, len(stream.HLSHealth))
+	for name := range stream.HLSHealth {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	healthy := true
+	playlists := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		analysis := stream.HLSHealth[name]
+		if len(analysis.Issues) > 0 {
+			healthy = false
+		}
+		playlists = append(playlists, map[string]interface{}{
+			"playlist": name,
+			"analysis": analysis,
+		})
+	}
+	return map[string]interface{}{
+		"healthy":   healthy && len(names) > 0,
+		"playlists": playlists,
+	}
+}
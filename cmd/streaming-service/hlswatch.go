@@ -0,0 +1,416 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"my-go-app/pkg/hls"
+)
+
+// fsEventHandler получает путь записанного файла или созданного каталога
+type fsEventHandler func(path string, isDir bool)
+
+// fsNotifier - источник событий файловой системы для HLSWatcher:
+// inotify на Linux, опрос каталогов в остальных случаях
+type fsNotifier interface {
+	Add(dir string) error
+	Remove(dir string)
+	Backend() string
+}
+
+// HLSWatcher - общий для всех потоков наблюдатель за HLS-каталогами.
+// Запись плейлиста сразу разбирается и при продвижении media sequence
+// переводит поток в running; таймер неактивности потока переводит его
+// обратно в starting, если новых сегментов нет дольше порога потока.
+type HLSWatcher struct {
+	notifier fsNotifier
+
+	mu      sync.Mutex
+	streams map[string]*watchedStream // по ID потока
+	dirs    map[string]*watchedStream // каталог потока или варианта -> поток
+}
+
+// watchedStream - состояние наблюдения за одним потоком
+type watchedStream struct {
+	streamID      string
+	stream        *StreamInstance
+	hlsPath       string
+	inactiveAfter time.Duration
+	dirs          []string
+
+	mu      sync.Mutex
+	checker *HLSHealthChecker
+	parsed  bool // плейлисты разбираются - активность определяется по ним, а не по сегментам
+	timer   *time.Timer
+	stopped bool
+}
+
+// Допустимый порог неактивности потока, секунды
+const (
+	MinInactivityTimeoutSeconds = 5
+	MaxInactivityTimeoutSeconds = 600
+)
+
+var hlsWatcher *HLSWatcher
+
+// inactivityTimeoutSeconds - порог потока или HLS_INACTIVITY_TIMEOUT, если он не задан
+func inactivityTimeoutSeconds(seconds int) int {
+	if seconds > 0 {
+		return seconds
+	}
+	return max(int(serviceConfig.InactivityTimeout/time.Second), 1)
+}
+
+func NewHLSWatcher() *HLSWatcher {
+	w := &HLSWatcher{
+		streams: make(map[string]*watchedStream),
+		dirs:    make(map[string]*watchedStream),
+	}
+	notifier, err := newFSNotifier(w.handleEvent)
+	if err != nil {
+		log.Printf("⚠️ inotify недоступен (%v), HLS-каталоги будут опрашиваться", err)
+		notifier = newPollNotifier(w.handleEvent, 2*time.Second)
+	}
+	w.notifier = notifier
+	log.Printf("👀 Наблюдение за HLS: %s", notifier.Backend())
+	return w
+}
+
+// Watch начинает наблюдение за потоком; повторный вызов заменяет прежнее наблюдение
+func (w *HLSWatcher) Watch(streamID string, stream *StreamInstance, hlsPath string, inactiveAfter time.Duration) {
+	w.Unwatch(streamID)
+
+	ws := &watchedStream{
+		streamID:      streamID,
+		stream:        stream,
+		hlsPath:       filepath.Clean(hlsPath),
+		inactiveAfter: inactiveAfter,
+		checker:       NewHLSHealthChecker(streamID, hlsPath),
+	}
+	ws.timer = time.AfterFunc(inactiveAfter, ws.onInactive)
+
+	w.mu.Lock()
+	w.streams[streamID] = ws
+	w.addDirLocked(ws, ws.hlsPath)
+	// Каталоги вариантов transcode могут уже существовать (подхваченный ffmpeg)
+	if entries, err := os.ReadDir(ws.hlsPath); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() && entry.Name() != thumbnailsDir && entry.Name() != subtitlesDir {
+				w.addDirLocked(ws, filepath.Join(ws.hlsPath, entry.Name()))
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	log.Printf("📁 Наблюдение за HLS потока %s, порог неактивности %s", streamID, inactiveAfter)
+
+	// Плейлисты, записанные до начала наблюдения, событий уже не дадут
+	go ws.onPlaylist()
+}
+
+// Unwatch прекращает наблюдение за потоком
+func (w *HLSWatcher) Unwatch(streamID string) {
+	w.mu.Lock()
+	ws, exists := w.streams[streamID]
+	if exists {
+		delete(w.streams, streamID)
+		for _, dir := range ws.dirs {
+			delete(w.dirs, dir)
+			w.notifier.Remove(dir)
+		}
+	}
+	w.mu.Unlock()
+
+	if !exists {
+		return
+	}
+	ws.mu.Lock()
+	ws.stopped = true
+	ws.timer.Stop()
+	ws.mu.Unlock()
+}
+
+// Stats - сведения о наблюдателе для health check
+func (w *HLSWatcher) Stats() map[string]interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return map[string]interface{}{
+		"backend":      w.notifier.Backend(),
+		"streams":      len(w.streams),
+		"watched_dirs": len(w.dirs),
+	}
+}
+
+func (w *HLSWatcher) addDirLocked(ws *watchedStream, dir string) {
+	if _, exists := w.dirs[dir]; exists {
+		return
+	}
+	if err := w.notifier.Add(dir); err != nil {
+		log.Printf("⚠️ Не удалось наблюдать за каталогом %s потока %s: %v", dir, ws.streamID, err)
+		return
+	}
+	w.dirs[dir] = ws
+	ws.dirs = append(ws.dirs, dir)
+}
+
+// handleEvent распределяет событие файловой системы по потокам
+func (w *HLSWatcher) handleEvent(path string, isDir bool) {
+	dir, name := filepath.Split(path)
+	dir = filepath.Clean(dir)
+
+	w.mu.Lock()
+	ws := w.dirs[dir]
+	// Каталоги вариантов transcode создаются внутри каталога потока
+	if ws != nil && isDir && dir == ws.hlsPath && name != thumbnailsDir && name != subtitlesDir {
+		w.addDirLocked(ws, path)
+	}
+	w.mu.Unlock()
+
+	if ws == nil || isDir {
+		return
+	}
+	switch {
+	case strings.HasSuffix(name, ".m3u8"):
+		ws.onPlaylist()
+	case name == dashManifestName:
+		trimPrunedSegments(ws.stream)
+	case isSegmentFile(name):
+		ws.onSegment()
+	}
+}
+
+// onPlaylist разбирает медиа-плейлисты потока после их записи
+func (ws *watchedStream) onPlaylist() {
+	// Сегменты, удаленные по лимиту DVR, убираются из новой версии плейлиста
+	// до проверки и разметки, иначе они попадут в отчет как missing_segment
+	trimPrunedSegments(ws.stream)
+
+	ws.mu.Lock()
+	if ws.stopped {
+		ws.mu.Unlock()
+		return
+	}
+	health, advanced, parsed := ws.checker.Check(
+		mediaPlaylistPaths(ws.hlsPath, ws.stream.Packaging, ws.stream.Renditions), time.Now())
+	if parsed {
+		ws.parsed = true
+	}
+	if advanced {
+		ws.timer.Reset(ws.inactiveAfter)
+	}
+	ws.mu.Unlock()
+
+	if parsed {
+		storeHLSHealth(ws.streamID, ws.stream, health)
+	}
+	if advanced {
+		markHLSActive(ws.streamID, ws.stream)
+	}
+	if ws.stream.Captions != nil {
+		ws.stream.Captions.Update()
+	}
+	if ws.stream.AdCues != nil {
+		ws.stream.AdCues.Update()
+	}
+}
+
+// onSegment учитывает новый сегмент, пока плейлисты не удается разобрать
+func (ws *watchedStream) onSegment() {
+	ws.mu.Lock()
+	if ws.stopped || ws.parsed {
+		ws.mu.Unlock()
+		return
+	}
+	ws.timer.Reset(ws.inactiveAfter)
+	ws.mu.Unlock()
+
+	markHLSActive(ws.streamID, ws.stream)
+}
+
+// onInactive срабатывает, если новых сегментов нет дольше порога потока.
+// Плейлисты перечитываются: событие могло потеряться при переполнении очереди inotify.
+func (ws *watchedStream) onInactive() {
+	ws.mu.Lock()
+	if ws.stopped {
+		ws.mu.Unlock()
+		return
+	}
+	health, advanced, parsed := ws.checker.Check(
+		mediaPlaylistPaths(ws.hlsPath, ws.stream.Packaging, ws.stream.Renditions), time.Now())
+	if advanced {
+		ws.timer.Reset(ws.inactiveAfter)
+	}
+	ws.mu.Unlock()
+
+	if parsed {
+		storeHLSHealth(ws.streamID, ws.stream, health)
+	}
+	if advanced {
+		markHLSActive(ws.streamID, ws.stream)
+		return
+	}
+	markHLSInactive(ws.streamID, ws.stream, ws.inactiveAfter)
+}
+
+// storeHLSHealth сохраняет анализ плейлистов для API
+func storeHLSHealth(streamID string, stream *StreamInstance, health map[string]hls.Analysis) {
+	manager.mutex.Lock()
+	if manager.streams[streamID] == stream {
+		stream.HLSHealth = health
+	}
+	manager.mutex.Unlock()
+}
+
+// markHLSActive переводит поток в running по новым сегментам
+func markHLSActive(streamID string, stream *StreamInstance) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.streams[streamID] != stream {
+		return
+	}
+
+	// Логика перехода starting -> running
+	if stream.Status == "starting" {
+		now := time.Now()
+		stream.StreamStart = &now
+		stream.Status = "running"
+		log.Printf("🎬 Новые HLS сегменты для потока %s, статус: running", streamID)
+		sendWebhook(func() { webhooks.StreamStatus(streamID, "running") })
+		requestMediaProbe(stream) // после переподключения энкодер мог сменить параметры
+	}
+
+	// Новые сегменты после запуска ffmpeg означают, что источник отдает данные;
+	// в reconnecting сегменты могут быть записаны еще до обрыва
+	if stream.Upstream != nil &&
+		(stream.Upstream.State == UpstreamConnecting || stream.Upstream.State == UpstreamStalled) {
+		setUpstreamState(stream, UpstreamConnected, "")
+	}
+}
+
+// markHLSInactive переводит поток из running в starting после порога неактивности
+func markHLSInactive(streamID string, stream *StreamInstance, inactiveAfter time.Duration) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.streams[streamID] != stream || stream.Status != "running" {
+		return
+	}
+
+	stream.Status = "starting"
+	stream.StreamStart = nil
+	stream.Thumbnail.Stale = true // снимки перестают обновляться до возврата эфира
+	if stream.Upstream != nil && stream.Upstream.State == UpstreamConnected {
+		setUpstreamState(stream, UpstreamStalled, "")
+	}
+	log.Printf("⏹️  Нет новых HLS сегментов потока %s дольше %s, статус: starting", streamID, inactiveAfter)
+	sendWebhook(func() { webhooks.StreamStatus(streamID, "starting") })
+}
+
+// pollNotifier - запасной источник событий: сравнивает время изменения
+// файлов наблюдаемых каталогов с прошлым опросом
+type pollNotifier struct {
+	handler  fsEventHandler
+	interval time.Duration
+
+	mu   sync.Mutex
+	dirs map[string]map[string]time.Time // каталог -> файл -> время изменения
+}
+
+func newPollNotifier(handler fsEventHandler, interval time.Duration) *pollNotifier {
+	n := &pollNotifier{
+		handler:  handler,
+		interval: interval,
+		dirs:     make(map[string]map[string]time.Time),
+	}
+	go n.run()
+	return n
+}
+
+func (n *pollNotifier) Backend() string { return "poll" }
+
+func (n *pollNotifier) Add(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.dirs[dir] = make(map[string]time.Time)
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *pollNotifier) Remove(dir string) {
+	n.mu.Lock()
+	delete(n.dirs, dir)
+	n.mu.Unlock()
+}
+
+func (n *pollNotifier) run() {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n.mu.Lock()
+		dirs := make([]string, 0, len(n.dirs))
+		for dir := range n.dirs {
+			dirs = append(dirs, dir)
+		}
+		n.mu.Unlock()
+
+		for _, dir := range dirs {
+			n.poll(dir)
+		}
+	}
+}
+
+func (n *pollNotifier) poll(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type change struct {
+		path  string
+		isDir bool
+	}
+	var changes []change
+
+	n.mu.Lock()
+	seen, exists := n.dirs[dir]
+	if !exists {
+		n.mu.Unlock()
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		prev, known := seen[entry.Name()]
+		if entry.IsDir() {
+			if !known {
+				changes = append(changes, change{filepath.Join(dir, entry.Name()), true})
+			}
+		} else if !known || info.ModTime().After(prev) {
+			changes = append(changes, change{filepath.Join(dir, entry.Name()), false})
+		}
+		seen[entry.Name()] = info.ModTime()
+	}
+	n.mu.Unlock()
+
+	// Плейлисты - в конце, чтобы их разбор видел уже учтенные сегменты
+	for _, c := range changes {
+		if !strings.HasSuffix(c.path, ".m3u8") {
+			n.handler(c.path, c.isDir)
+		}
+	}
+	for _, c := range changes {
+		if strings.HasSuffix(c.path, ".m3u8") {
+			n.handler(c.path, c.isDir)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+//go:build linux
+
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask: запись сегмента завершается close, плейлист ffmpeg
+// записывает во временный файл и переименовывает; создание каталога
+// нужно для каталогов вариантов transcode
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE
+
+// inotifyNotifier - один дескриптор inotify на все каталоги всех потоков
+type inotifyNotifier struct {
+	fd      int
+	handler fsEventHandler
+
+	mu      sync.Mutex
+	watches map[int32]string // дескриптор наблюдения -> каталог
+	dirs    map[string]int32
+}
+
+func newFSNotifier(handler fsEventHandler) (fsNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	n := &inotifyNotifier{
+		fd:      fd,
+		handler: handler,
+		watches: make(map[int32]string),
+		dirs:    make(map[string]int32),
+	}
+	go n.readEvents()
+	return n, nil
+}
+
+func (n *inotifyNotifier) Backend() string { return "inotify" }
+
+func (n *inotifyNotifier) Add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.watches[int32(wd)] = dir
+	n.dirs[dir] = int32(wd)
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *inotifyNotifier) Remove(dir string) {
+	n.mu.Lock()
+	wd, exists := n.dirs[dir]
+	if exists {
+		delete(n.dirs, dir)
+		delete(n.watches, wd)
+	}
+	n.mu.Unlock()
+
+	if exists {
+		syscall.InotifyRmWatch(n.fd, uint32(wd))
+	}
+}
+
+func (n *inotifyNotifier) readEvents() {
+	buf := make([]byte, 64*1024)
+	for {
+		count, err := syscall.Read(n.fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || count <= 0 {
+			log.Printf("❌ Чтение событий inotify прекращено: %v", err)
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			if nameEnd > count {
+				break
+			}
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+			offset = nameEnd
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				// Потерянные события восполнит перечитывание плейлистов по таймеру неактивности
+				log.Printf("⚠️ Очередь inotify переполнена, часть событий HLS потеряна")
+				continue
+			}
+
+			n.mu.Lock()
+			dir, known := n.watches[event.Wd]
+			if event.Mask&syscall.IN_IGNORED != 0 && known {
+				// Каталог удален вместе с потоком
+				delete(n.watches, event.Wd)
+				if n.dirs[dir] == event.Wd {
+					delete(n.dirs, dir)
+				}
+			}
+			n.mu.Unlock()
+
+			if !known || name == "" {
+				continue
+			}
+			isDir := event.Mask&syscall.IN_ISDIR != 0
+			if event.Mask&syscall.IN_CREATE != 0 && !isDir {
+				continue // файл еще пишется, ждем IN_CLOSE_WRITE
+			}
+			n.handler(filepath.Join(dir, name), isDir)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// newFSNotifier: inotify есть только на Linux, HLSWatcher переходит на опрос
+func newFSNotifier(handler fsEventHandler) (fsNotifier, error) {
+	return nil, errors.New("inotify is only supported on linux")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+)
+
+const (
+	ProtocolSRT  = "srt"  // SRT listener на UDP-порту потока (по умолчанию)
+	ProtocolRTMP = "rtmp" // RTMP listener на TCP-порту потока с приложением и ключом
+	ProtocolPull = "pull" // ffmpeg сам подключается к внешнему источнику (SourceURL)
+
+	defaultRTMPApp = "live"
+)
+
+var rtmpNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// srtPassphrasePattern - пароль SRT: 10-79 символов, без символов, требующих экранирования в URL
+var srtPassphrasePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{10,79}$`)
+
+func validSRTKeyLength(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+// srtEncryptionParams - параметры шифрования для SRT URL (пусто, если пароля нет)
+func srtEncryptionParams(passphrase string, keyLength int) string {
+	if passphrase == "" {
+		return ""
+	}
+	return fmt.Sprintf("&passphrase=%s&pbkeylen=%d", passphrase, keyLength)
+}
+
+// ingestInputArgs - вход ffmpeg для выбранного протокола. RTMP-порт слушает не ffmpeg,
+// а RTMPGate: RTMP-сервер ffmpeg (-listen 1) принимает публикацию с любым ключом.
+// ffmpeg читает из сокета шлюза FLV только той публикации, что прошла проверку.
+func ingestInputArgs(spec PipelineSpec) []string {
+	if spec.Protocol == ProtocolPull {
+		return pullInputArgs(spec)
+	}
+	if spec.Protocol == ProtocolRTMP {
+		return []string{
+			"-f", "flv",
+			"-i", "unix:" + spec.RTMPSocket,
+		}
+	}
+
+	// С паролем listener отклоняет подключения без шифрования или с другим паролем
+	return []string{
+		"-f", "mpegts",
+		"-timeout", "10000000",
+		"-i", fmt.Sprintf("srt://0.0.0.0:%d?mode=listener&transtype=live&streamid=%s&latency=2000000&rcvbuf=100000000&sndbuf=100000000%s",
+			spec.IngestPort, spec.StreamID, srtEncryptionParams(spec.Passphrase, spec.KeyLength)),
+	}
+}
+
+// IngestURL - адрес для энкодера в зависимости от протокола потока.
+// Секреты (ключ RTMP, пароль SRT) включаются только при withSecrets.
+func (s *StreamInstance) IngestURL(serverIP string, withSecrets bool) string {
+	if s.Protocol == ProtocolPull {
+		// Публиковать в pull-поток нечего: ffmpeg сам забирает источник
+		return ""
+	}
+	if s.Protocol == ProtocolRTMP {
+		key := "{stream_key}"
+		if withSecrets {
+			key = s.RTMPKey
+		}
+		return fmt.Sprintf("rtmp://%s:%d/%s/%s", serverIP, s.RTMPPort, s.RTMPApp, key)
+	}
+
+	url := fmt.Sprintf("srt://%s:%d?mode=caller&transtype=live&streamid=%s", serverIP, s.SRTPort, s.StreamID)
+	if withSecrets {
+		url += srtEncryptionParams(s.SRTPassphrase, s.SRTKeyLength)
+	}
+	return url
+}
+
+// withIngestSecrets подставляет в ответ запуска адреса ingest с секретами
+func withIngestSecrets(streamID string, data interface{}) interface{} {
+	resp, ok := data.(StreamInstanceResponse)
+	if !ok {
+		return data
+	}
+
+	manager.mutex.RLock()
+	stream, exists := manager.streams[streamID]
+	manager.mutex.RUnlock()
+	if !exists {
+		return data
+	}
+
+	resp.IngestURL = stream.IngestURL(resp.ServerIP, true)
+	if stream.Protocol != ProtocolRTMP {
+		resp.SRTURL = resp.IngestURL
+	}
+	return resp
+}
+
+// portsFor - пул портов протокола: UDP для SRT, TCP для RTMP, nil для pull
+func (m *StreamManager) portsFor(protocol string) *PortAllocator {
+	switch protocol {
+	case ProtocolPull:
+		return nil
+	case ProtocolRTMP:
+		return m.rtmpPorts
+	}
+	return m.ports
+}
+
+// NewRTMPPortAllocator - пул TCP-портов для RTMP listener'ов
+func NewRTMPPortAllocator(min, max int) (*PortAllocator, error) {
+	allocator, err := NewPortAllocator(min, max)
+	if err != nil {
+		return nil, err
+	}
+	allocator.probe = isTCPPortBindable
+	return allocator, nil
+}
+
+func isTCPPortBindable(port int) bool {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
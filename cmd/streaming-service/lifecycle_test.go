@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recordingWebhooks запоминает уведомления вместо отправки в основное приложение
+type recordingWebhooks struct {
+	statuses chan string
+}
+
+func (r *recordingWebhooks) StreamStatus(streamID, status string) { r.statuses <- status }
+func (r *recordingWebhooks) StreamEvent(StreamEventRequest)       {}
+func (r *recordingWebhooks) StreamMedia(string, MediaInfo)        {}
+func (r *recordingWebhooks) RecordingCreated(RecordingInfo)       {}
+
+// expect ждет следующий статус из уведомлений
+func (r *recordingWebhooks) expect(t *testing.T, want string, timeout time.Duration) {
+	t.Helper()
+	select {
+	case got := <-r.statuses:
+		if got != want {
+			t.Fatalf("webhook status = %q, want %q", got, want)
+		}
+	case <-time.After(timeout):
+		t.Fatalf("no %q webhook within %s", want, timeout)
+	}
+}
+
+// useRecordingWebhooks перехватывает уведомления основному приложению до конца теста
+func useRecordingWebhooks(t *testing.T) *recordingWebhooks {
+	t.Helper()
+	recorded := &recordingWebhooks{statuses: make(chan string, 16)}
+	previous := webhooks
+	webhooks = recorded
+	t.Cleanup(func() {
+		// Уведомления доставляются в фоне: ждем их, прежде чем вернуть получателя
+		for pendingWebhooks.Load() > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		webhooks = previous
+	})
+	return recorded
+}
+
+func TestStreamLifecycle(t *testing.T) {
+	recorded := useRecordingWebhooks(t)
+
+	resp := startStream("s1", StreamOptions{})
+	if resp.Error != "" || resp.Status != "starting" {
+		t.Fatalf("startStream() = %+v", resp)
+	}
+	t.Cleanup(func() { stopStream("s1") })
+	recorded.expect(t, "starting", time.Second)
+
+	// Первые сегменты переводят поток в running
+	recorded.expect(t, "running", 3*time.Second)
+
+	manager.mutex.RLock()
+	stream := manager.streams["s1"]
+	status := stream.Status
+	manager.mutex.RUnlock()
+	if status != "running" {
+		t.Fatalf("stream status = %q, want running", status)
+	}
+	if want := filepath.Join(serviceConfig.HLSRoot, "s1"); stream.HLSPath != want {
+		t.Fatalf("HLS path = %s, want %s", stream.HLSPath, want)
+	}
+	if entries, err := os.ReadDir(stream.HLSPath); err != nil || len(entries) == 0 {
+		t.Fatalf("no HLS output under HLS root: %v", err)
+	}
+	fake := stream.Pipeline.(*FakePipeline)
+
+	// Энкодер отключился: после порога неактивности поток возвращается в starting
+	fake.Pause()
+	recorded.expect(t, "starting", 4*time.Second)
+
+	// Энкодер вернулся: новые сегменты снова дают running
+	fake.Resume()
+	recorded.expect(t, "running", 3*time.Second)
+
+	if resp := stopStream("s1"); resp.Status != "stopped" {
+		t.Fatalf("stopStream() = %+v", resp)
+	}
+	recorded.expect(t, "stopped", time.Second)
+	if rec, ok := manager.state.Get("s1"); !ok || rec.DesiredState != DesiredStopped {
+		t.Fatalf("state record = %+v, %v", rec, ok)
+	}
+}
+
+func TestDeleteStreamForgetsStateAndPorts(t *testing.T) {
+	useRecordingWebhooks(t)
+
+	resp := startStream("del1", StreamOptions{})
+	if resp.Error != "" {
+		t.Fatalf("startStream() = %+v", resp)
+	}
+	t.Cleanup(func() { stopStream("del1") })
+
+	if resp := deleteStream("del1"); resp.Error != "" || resp.Status != "deleted" {
+		t.Fatalf("deleteStream() = %+v", resp)
+	}
+	manager.mutex.RLock()
+	_, running := manager.streams["del1"]
+	manager.mutex.RUnlock()
+	if running {
+		t.Fatal("deleted stream is still running")
+	}
+	if rec, ok := manager.state.Get("del1"); ok {
+		t.Fatalf("state record of deleted stream = %+v", rec)
+	}
+	manager.ports.mu.Lock()
+	port, sticky := manager.ports.sticky["del1"]
+	manager.ports.mu.Unlock()
+	if sticky {
+		t.Fatalf("port %d is still pinned to deleted stream", port)
+	}
+}
+
+func TestRestartStreamSkipsStoppedWebhook(t *testing.T) {
+	recorded := useRecordingWebhooks(t)
+
+	if resp := startStream("rs1", StreamOptions{}); resp.Error != "" {
+		t.Fatalf("startStream() = %+v", resp)
+	}
+	t.Cleanup(func() { stopStream("rs1") })
+	recorded.expect(t, "starting", time.Second)
+	recorded.expect(t, "running", 3*time.Second)
+
+	manager.mutex.RLock()
+	previous := manager.streams["rs1"]
+	manager.mutex.RUnlock()
+
+	if resp := restartStream("rs1", StreamOptions{}); resp.Error != "" || resp.Status != "starting" {
+		t.Fatalf("restartStream() = %+v", resp)
+	}
+	// Основное приложение видит только starting перезапущенного потока, без stopped
+	recorded.expect(t, "starting", time.Second)
+	recorded.expect(t, "running", 3*time.Second)
+
+	manager.mutex.RLock()
+	current := manager.streams["rs1"]
+	manager.mutex.RUnlock()
+	if current == nil || current == previous {
+		t.Fatal("stream was not replaced by restart")
+	}
+	if rec, ok := manager.state.Get("rs1"); !ok || rec.DesiredState != DesiredRunning {
+		t.Fatalf("state record = %+v, %v", rec, ok)
+	}
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	ptsClockRate = 90000
+
+	llPartsWindow = 3 // для скольких последних сегментов перечисляются части
+)
+
+var errLLHLSBadRequest = errors.New("requested media sequence is too far ahead")
+
+type llPart struct {
+	index       int
+	duration    float64
+	independent bool
+}
+
+type llSegment struct {
+	seq           int
+	duration      float64
+	parts         []llPart
+	discontinuity bool
+	complete      bool
+}
+
+// LLHLSPackager принимает MPEG-TS от ffmpeg (stdout) и сам режет его на
+// частичные сегменты LL-HLS: ffmpeg-муксер HLS не умеет EXT-X-PART.
+// Границы сегментов - ключевые кадры (random_access_indicator), границы
+// частей - по PTS видео. Плейлист отдается Go-обработчиком с поддержкой
+// блокирующих запросов (_HLS_msn/_HLS_part) и дублируется на диск для nginx.
+type LLHLSPackager struct {
+	streamID      string
+	dir           string
+	partTarget    float64
+	segmentTarget float64
+	window        int // сегментов в плейлисте (живое окно или DVR)
+
+	mu      sync.Mutex
+	updated chan struct{} // закрывается и заменяется при каждой новой части
+
+	segments []*llSegment // окно, последний элемент - текущий сегмент
+	nextSeq  int
+
+	pending  []byte // неполный TS-пакет с прошлой записи
+	patPMT   []byte // последние PAT и PMT для начала каждой части
+	pmtPID   int
+	videoPID int
+	partBuf  bytes.Buffer
+
+	partStartPTS  int64
+	segStartPTS   int64
+	lastPTS       int64
+	lastFrameGap  int64
+	started       bool
+	discontinuity bool
+}
+
+func NewLLHLSPackager(streamID, dir string, partTarget, segmentTarget, dvrWindow time.Duration) *LLHLSPackager {
+	return &LLHLSPackager{
+		window:        dvrListSize(dvrWindow, segmentTarget),
+		streamID:      streamID,
+		dir:           dir,
+		partTarget:    partTarget.Seconds(),
+		segmentTarget: segmentTarget.Seconds(),
+		updated:       make(chan struct{}),
+		pmtPID:        -1,
+		videoPID:      -1,
+	}
+}
+
+// Write принимает произвольные куски MPEG-TS и разбирает их по пакетам
+func (p *LLHLSPackager) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf := append(p.pending, data...)
+	for len(buf) >= tsPacketSize {
+		// Ресинхронизация после перезапуска ffmpeg или мусора в потоке
+		if buf[0] != tsSyncByte {
+			idx := bytes.IndexByte(buf, tsSyncByte)
+			if idx < 0 {
+				buf = buf[:0]
+				break
+			}
+			buf = buf[idx:]
+			continue
+		}
+		p.handlePacket(buf[:tsPacketSize])
+		buf = buf[tsPacketSize:]
+	}
+	p.pending = append(p.pending[:0], buf...)
+	return len(data), nil
+}
+
+func (p *LLHLSPackager) handlePacket(pkt []byte) {
+	pid := int(pkt[1]&0x1f)<<8 | int(pkt[2])
+	pusi := pkt[1]&0x40 != 0
+	afc := (pkt[3] >> 4) & 0x3
+
+	payload := pkt[4:]
+	randomAccess := false
+	if afc == 2 || afc == 3 {
+		afLen := int(pkt[4])
+		if afLen > 0 && len(pkt) > 5 {
+			randomAccess = pkt[5]&0x40 != 0
+		}
+		if 5+afLen > len(pkt) {
+			return
+		}
+		payload = pkt[5+afLen:]
+	}
+	if afc == 2 {
+		payload = nil
+	}
+
+	switch {
+	case pid == 0 && pusi:
+		p.patPMT = append(p.patPMT[:0], pkt...)
+		p.pmtPID = parsePATForPMT(payload)
+		return
+	case pid == p.pmtPID && pusi:
+		if len(p.patPMT) >= tsPacketSize {
+			p.patPMT = append(p.patPMT[:tsPacketSize], pkt...)
+		}
+		return
+	}
+
+	if pusi && len(payload) >= 14 && payload[0] == 0 && payload[1] == 0 && payload[2] == 1 {
+		streamType := payload[3]
+		isVideo := streamType >= 0xe0 && streamType <= 0xef
+		isAudio := streamType >= 0xc0 && streamType <= 0xdf
+		if isVideo && p.videoPID < 0 {
+			p.videoPID = pid
+		}
+
+		// Часы задает видео; поток без видео режется по аудио
+		timing := (isVideo && pid == p.videoPID) || (isAudio && p.videoPID < 0)
+		if pts, ok := parsePESPTS(payload); ok && timing {
+			p.onTimingPES(pts, randomAccess || !isVideo)
+		}
+	}
+
+	if p.started {
+		p.partBuf.Write(pkt)
+	}
+}
+
+// onTimingPES решает, начинается ли с этого кадра новая часть или сегмент
+func (p *LLHLSPackager) onTimingPES(pts int64, keyframe bool) {
+	if !p.started {
+		if !keyframe {
+			return
+		}
+		p.started = true
+		p.segStartPTS, p.partStartPTS, p.lastPTS = pts, pts, pts
+		p.openSegment()
+		p.openPart(true)
+		return
+	}
+
+	// Скачок времени (перезапуск ffmpeg, смена энкодера) - разрыв
+	if pts < p.lastPTS-ptsClockRate || pts > p.lastPTS+10*ptsClockRate {
+		p.closePart(p.lastPTS + p.lastFrameGap)
+		p.closeSegment()
+		p.discontinuity = true
+		p.started = false
+		p.lastFrameGap = 0
+		p.onTimingPES(pts, keyframe)
+		return
+	}
+
+	if gap := pts - p.lastPTS; gap > 0 {
+		p.lastFrameGap = gap
+	}
+	p.lastPTS = pts
+
+	segElapsed := float64(pts-p.segStartPTS) / ptsClockRate
+	partWithFrame := float64(pts-p.partStartPTS+p.lastFrameGap) / ptsClockRate
+
+	switch {
+	case keyframe && segElapsed >= p.segmentTarget:
+		p.closePart(pts)
+		p.closeSegment()
+		p.segStartPTS = pts
+		p.openSegment()
+		p.openPart(true)
+	case partWithFrame > p.partTarget && pts > p.partStartPTS:
+		// Часть закрывается до кадра, с которым она превысила бы PART-TARGET
+		p.closePart(pts)
+		p.openPart(keyframe)
+	}
+}
+
+func (p *LLHLSPackager) current() *llSegment {
+	if len(p.segments) == 0 {
+		return nil
+	}
+	return p.segments[len(p.segments)-1]
+}
+
+func (p *LLHLSPackager) openSegment() {
+	seg := &llSegment{seq: p.nextSeq, discontinuity: p.discontinuity}
+	p.nextSeq++
+	p.discontinuity = false
+	p.segments = append(p.segments, seg)
+	os.Remove(filepath.Join(p.dir, llSegmentName(seg.seq)))
+}
+
+func (p *LLHLSPackager) openPart(independent bool) {
+	seg := p.current()
+	seg.parts = append(seg.parts, llPart{index: len(seg.parts), independent: independent})
+	p.partBuf.Reset()
+	// Каждая часть начинается с PAT/PMT, чтобы плеер мог стартовать с нее
+	p.partBuf.Write(p.patPMT)
+}
+
+// closePart записывает готовую часть, дописывает ее в файл сегмента и будит ожидающих
+func (p *LLHLSPackager) closePart(endPTS int64) {
+	seg := p.current()
+	if seg == nil || seg.complete || len(seg.parts) == 0 {
+		return
+	}
+	part := &seg.parts[len(seg.parts)-1]
+	if part.duration > 0 {
+		return
+	}
+
+	part.duration = math.Max(float64(endPTS-p.partStartPTS)/ptsClockRate, 0.001)
+	seg.duration += part.duration
+	p.partStartPTS = endPTS
+
+	data := p.partBuf.Bytes()
+	if err := os.WriteFile(filepath.Join(p.dir, llPartName(seg.seq, part.index)), data, 0o644); err != nil {
+		log.Printf("⚠️ LL-HLS: ошибка записи части потока %s: %v", p.streamID, err)
+	}
+	if f, err := os.OpenFile(filepath.Join(p.dir, llSegmentName(seg.seq)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err == nil {
+		f.Write(data)
+		f.Close()
+	}
+	p.partBuf.Reset()
+
+	p.publishLocked()
+}
+
+func (p *LLHLSPackager) closeSegment() {
+	seg := p.current()
+	if seg == nil || seg.complete {
+		return
+	}
+	// Незакрытая пустая часть не публикуется
+	if n := len(seg.parts); n > 0 && seg.parts[n-1].duration == 0 {
+		seg.parts = seg.parts[:n-1]
+	}
+	if len(seg.parts) == 0 {
+		p.segments = p.segments[:len(p.segments)-1]
+		return
+	}
+	seg.complete = true
+
+	// Окно плейлиста: файлы вышедших сегментов удаляются с запасом в один сегмент
+	for len(p.segments) > p.window+1 {
+		old := p.segments[0]
+		p.segments = p.segments[1:]
+		p.removeSegmentFiles(old)
+	}
+	p.publishLocked()
+}
+
+func (p *LLHLSPackager) removeSegmentFiles(seg *llSegment) {
+	os.Remove(filepath.Join(p.dir, llSegmentName(seg.seq)))
+	for _, part := range seg.parts {
+		os.Remove(filepath.Join(p.dir, llPartName(seg.seq, part.index)))
+	}
+}
+
+// Prune сжимает окно по лимиту диска DVR: убирает из плейлиста старые завершенные
+// сегменты, файлы которых (сам сегмент или его части) отмечены в gone, и удаляет их.
+// Возвращает число удаленных сегментов.
+func (p *LLHLSPackager) Prune(gone map[string]bool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pruned := 0
+	for len(p.segments) > 1 && p.segments[0].complete && p.segmentGoneLocked(p.segments[0], gone) {
+		old := p.segments[0]
+		p.segments = p.segments[1:]
+		p.removeSegmentFiles(old)
+		pruned++
+	}
+	if pruned > 0 {
+		p.publishLocked()
+	}
+	return pruned
+}
+
+func (p *LLHLSPackager) segmentGoneLocked(seg *llSegment, gone map[string]bool) bool {
+	if gone[filepath.Join(p.dir, llSegmentName(seg.seq))] {
+		return true
+	}
+	for _, part := range seg.parts {
+		if gone[filepath.Join(p.dir, llPartName(seg.seq, part.index))] {
+			return true
+		}
+	}
+	return false
+}
+
+// publishLocked обновляет плейлист на диске и будит блокирующие запросы
+func (p *LLHLSPackager) publishLocked() {
+	playlist := p.renderLocked()
+	path := filepath.Join(p.dir, mediaPlaylistName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, playlist, 0o644); err == nil {
+		os.Rename(tmp, path)
+	}
+
+	close(p.updated)
+	p.updated = make(chan struct{})
+}
+
+// Playlist возвращает текущий плейлист. Если msn >= 0, запрос блокируется до
+// появления сегмента msn (или его части part, если part >= 0) либо отмены ctx.
+func (p *LLHLSPackager) Playlist(ctx context.Context, msn, part int) ([]byte, error) {
+	for {
+		p.mu.Lock()
+		if msn < 0 || p.hasLocked(msn, part) {
+			playlist := p.renderLocked()
+			p.mu.Unlock()
+			return playlist, nil
+		}
+		// По спецификации запрос дальше чем на два сегмента вперед - ошибка клиента
+		if msn > p.nextSeq+1 {
+			p.mu.Unlock()
+			return nil, errLLHLSBadRequest
+		}
+		updated := p.updated
+		p.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// WaitForFile ждет публикации части или сегмента, объявленного в preload hint
+func (p *LLHLSPackager) WaitForFile(ctx context.Context, name string) bool {
+	path := filepath.Join(p.dir, name)
+	for {
+		p.mu.Lock()
+		_, err := os.Stat(path)
+		published := err == nil && !p.isOpenLocked(name)
+		updated := p.updated
+		p.mu.Unlock()
+		if published {
+			return true
+		}
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// isOpenLocked - файл текущего незавершенного сегмента еще дописывается
+func (p *LLHLSPackager) isOpenLocked(name string) bool {
+	seg := p.current()
+	return seg != nil && !seg.complete && name == llSegmentName(seg.seq)
+}
+
+func (p *LLHLSPackager) hasLocked(msn, part int) bool {
+	for _, seg := range p.segments {
+		if seg.seq != msn {
+			continue
+		}
+		if seg.complete {
+			return true
+		}
+		if part < 0 {
+			return false
+		}
+		published := 0
+		for _, pt := range seg.parts {
+			if pt.duration > 0 {
+				published++
+			}
+		}
+		return published > part
+	}
+	// Сегменты, ушедшие из окна, уже доступны
+	return len(p.segments) > 0 && msn < p.segments[0].seq
+}
+
+func (p *LLHLSPackager) renderLocked() []byte {
+	var b strings.Builder
+
+	targetDuration := int(math.Ceil(p.segmentTarget))
+	for _, seg := range p.segments {
+		if seg.complete && int(math.Ceil(seg.duration)) > targetDuration {
+			targetDuration = int(math.Ceil(seg.duration))
+		}
+	}
+
+	firstSeq := 0
+	visible := p.segments
+	if len(visible) > p.window {
+		visible = visible[len(visible)-p.window:]
+	}
+	if len(visible) > 0 {
+		firstSeq = visible[0].seq
+	}
+
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:9\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*p.partTarget)
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", p.partTarget)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", firstSeq)
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+
+	for i, seg := range visible {
+		if seg.discontinuity && i > 0 {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		if len(visible)-i <= llPartsWindow {
+			for _, part := range seg.parts {
+				if part.duration == 0 {
+					continue
+				}
+				fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"%s\"", part.duration, llPartName(seg.seq, part.index))
+				if part.independent {
+					b.WriteString(",INDEPENDENT=YES")
+				}
+				b.WriteString("\n")
+			}
+		}
+		if seg.complete {
+			fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", seg.duration, llSegmentName(seg.seq))
+		}
+	}
+
+	if seg := p.current(); seg != nil && !seg.complete {
+		nextPart := 0
+		for _, part := range seg.parts {
+			if part.duration > 0 {
+				nextPart = part.index + 1
+			}
+		}
+		fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%s\"\n", llPartName(seg.seq, nextPart))
+	}
+
+	return []byte(b.String())
+}
+
+// Info - параметры LL-HLS для API
+func (p *LLHLSPackager) Info() map[string]interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return map[string]interface{}{
+		"part_target":    p.partTarget,
+		"segment_target": p.segmentTarget,
+		"part_hold_back": 3 * p.partTarget,
+		"next_sequence":  p.nextSeq,
+	}
+}
+
+// handleLLHLS отдает LL-HLS: /api/llhls/{id}/playlist.m3u8[?_HLS_msn=N&_HLS_part=M]
+// и /api/llhls/{id}/{segment}.ts. Запрос плейлиста с _HLS_msn блокируется до
+// появления нужной части, запрос части из preload hint - до ее публикации.
+func handleLLHLS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/llhls/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "Ожидается /api/llhls/{id}/{file}", http.StatusBadRequest)
+		return
+	}
+	streamID, name := parts[0], parts[1]
+
+	manager.mutex.RLock()
+	stream, exists := manager.streams[streamID]
+	manager.mutex.RUnlock()
+
+	if !exists || stream.LLHLS == nil {
+		http.Error(w, "LL-HLS поток не найден", http.StatusNotFound)
+		return
+	}
+	packager := stream.LLHLS
+
+	// По спецификации сервер отвечает не дольше трех целевых длительностей
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(3*packager.segmentTarget*float64(time.Second)))
+	defer cancel()
+
+	if name == mediaPlaylistName {
+		msn, part := -1, -1
+		query := r.URL.Query()
+		if v := query.Get("_HLS_msn"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Некорректный _HLS_msn", http.StatusBadRequest)
+				return
+			}
+			msn = n
+		}
+		if v := query.Get("_HLS_part"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || msn < 0 {
+				http.Error(w, "Некорректный _HLS_part", http.StatusBadRequest)
+				return
+			}
+			part = n
+		}
+
+		playlist, err := packager.Playlist(ctx, msn, part)
+		switch {
+		case errors.Is(err, errLLHLSBadRequest):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, "Часть сегмента не готова", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		if msn >= 0 {
+			// Ответ на блокирующий запрос однозначно определяется параметрами
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(math.Ceil(packager.segmentTarget))*6))
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		w.Write(playlist)
+		return
+	}
+
+	if !strings.HasPrefix(name, "ll_segment_") || !strings.HasSuffix(name, ".ts") {
+		http.Error(w, "Файл не найден", http.StatusNotFound)
+		return
+	}
+	if !packager.WaitForFile(ctx, name) {
+		http.Error(w, "Файл не найден", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Cache-Control", "max-age=60")
+	http.ServeFile(w, r, filepath.Join(packager.dir, name))
+}
+
+func llSegmentName(seq int) string {
+	return fmt.Sprintf("ll_segment_%d.ts", seq)
+}
+
+func llPartName(seq, part int) string {
+	return fmt.Sprintf("ll_segment_%d.%d.ts", seq, part)
+}
+
+// parsePATForPMT возвращает PID первой программы из PAT
+func parsePATForPMT(payload []byte) int {
+	if len(payload) < 1 {
+		return -1
+	}
+	pointer := int(payload[0])
+	section := payload[1:]
+	if pointer >= len(section) {
+		return -1
+	}
+	section = section[pointer:]
+	if len(section) < 8 || section[0] != 0x00 {
+		return -1
+	}
+	sectionLength := int(section[1]&0x0f)<<8 | int(section[2])
+	end := 3 + sectionLength - 4 // без CRC32
+	if end > len(section) {
+		end = len(section)
+	}
+	for i := 8; i+4 <= end; i += 4 {
+		program := int(section[i])<<8 | int(section[i+1])
+		if program != 0 {
+			return int(section[i+2]&0x1f)<<8 | int(section[i+3])
+		}
+	}
+	return -1
+}
+
+// parsePESPTS извлекает PTS из заголовка PES
+func parsePESPTS(pes []byte) (int64, bool) {
+	if len(pes) < 14 || pes[7]&0x80 == 0 {
+		return 0, false
+	}
+	b := pes[9:14]
+	pts := int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+	return pts, true
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-go-app/pkg/middleware"
+)
+
+// Лог ffmpeg потока пишется в {LOG_DIR}/{stream_id}.log. При ротации и в конце
+// сессии (запуск - остановка потока) файл переносится в архивную часть
+// {stream_id}.{session}.{part}.log, где session - время запуска в UTC.
+const (
+	logSessionLayout = "20060102T150405Z"
+	currentLogName   = "current"
+
+	logTailPollInterval = 500 * time.Millisecond
+	logTailKeepalive    = 15 * time.Second
+	logTailMaxLines     = 1000
+)
+
+// LogFileInfo - файл лога в ответе API
+type LogFileInfo struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// LogSessionInfo - сессия потока и ее части лога, от старой к новой
+type LogSessionInfo struct {
+	Session string        `json:"session"`
+	Current bool          `json:"current"`
+	Files   []LogFileInfo `json:"files"`
+}
+
+// streamLogFile - текущий лог ffmpeg потока
+func streamLogFile(streamID string) string {
+	return filepath.Join(serviceConfig.LogDir, streamID+".log")
+}
+
+func newLogSession(now time.Time) string {
+	return now.UTC().Format(logSessionLayout)
+}
+
+// archivedLogName - имя архивной части лога сессии
+func archivedLogName(streamID, session string, part int) string {
+	return fmt.Sprintf("%s.%s.%03d.log", streamID, session, part)
+}
+
+// parseArchivedLogName разбирает имя архивной части; ok=false для чужих файлов
+// (в том числе логов ретрансляций {stream_id}.fwd-{id}.log)
+func parseArchivedLogName(streamID, name string) (session string, part int, ok bool) {
+	rest, found := strings.CutPrefix(name, streamID+".")
+	if !found {
+		return "", 0, false
+	}
+	rest, found = strings.CutSuffix(rest, ".log")
+	if !found {
+		return "", 0, false
+	}
+	session, partStr, found := strings.Cut(rest, ".")
+	if !found {
+		return "", 0, false
+	}
+	if _, err := time.Parse(logSessionLayout, session); err != nil {
+		return "", 0, false
+	}
+	part, err := strconv.Atoi(partStr)
+	if err != nil || part < 1 {
+		return "", 0, false
+	}
+	return session, part, true
+}
+
+// lastLogPart - номер последней архивной части сессии, 0 - частей нет
+func lastLogPart(streamID, session string) int {
+	last := 0
+	entries, _ := os.ReadDir(serviceConfig.LogDir)
+	for _, entry := range entries {
+		if s, part, ok := parseArchivedLogName(streamID, entry.Name()); ok && s == session && part > last {
+			last = part
+		}
+	}
+	return last
+}
+
+// nextLogPart - путь следующей архивной части сессии
+func nextLogPart(streamID, session string) string {
+	return filepath.Join(serviceConfig.LogDir, archivedLogName(streamID, session, lastLogPart(streamID, session)+1))
+}
+
+// archiveStreamLog переносит текущий лог в архив сессии. Вызывается, когда ffmpeg
+// в лог уже не пишет: после остановки потока или перед новым запуском (лог,
+// оставшийся после сбоя сервиса). Без известной сессии она берется по времени файла.
+func archiveStreamLog(streamID, session string) {
+	path := streamLogFile(streamID)
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if info.Size() == 0 {
+		os.Remove(path)
+		return
+	}
+	if session == "" {
+		session = newLogSession(info.ModTime())
+	}
+	if err := os.Rename(path, nextLogPart(streamID, session)); err != nil {
+		log.Printf("⚠️ Не удалось перенести лог потока %s в архив: %v", streamID, err)
+	}
+}
+
+// rotateStreamLog копирует текущий лог в архивную часть и обрезает его.
+// ffmpeg держит файл открытым (в том числе после рестарта сервиса), поэтому
+// переименование не подходит; файл открыт с O_APPEND, и после обрезки запись
+// продолжается с начала. Строки, записанные между копированием и обрезкой, теряются.
+func rotateStreamLog(streamID, session string) error {
+	path := streamLogFile(streamID)
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(nextLogPart(streamID, session))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Truncate(path, 0)
+}
+
+// listLogSessions - сессии потока от новой к старой. current - сессия работающего потока.
+func listLogSessions(streamID, current string) []LogSessionInfo {
+	bySession := make(map[string]*LogSessionInfo)
+	session := func(id string) *LogSessionInfo {
+		if s, ok := bySession[id]; ok {
+			return s
+		}
+		s := &LogSessionInfo{Session: id, Current: id == current, Files: []LogFileInfo{}}
+		bySession[id] = s
+		return s
+	}
+
+	type archived struct {
+		part int
+		info LogFileInfo
+	}
+	parts := make(map[string][]archived)
+	entries, _ := os.ReadDir(serviceConfig.LogDir)
+	for _, entry := range entries {
+		id, part, ok := parseArchivedLogName(streamID, entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		session(id)
+		parts[id] = append(parts[id], archived{part, LogFileInfo{Name: entry.Name(), Size: info.Size(), Modified: info.ModTime()}})
+	}
+	for id, files := range parts {
+		sort.Slice(files, func(i, j int) bool { return files[i].part < files[j].part })
+		for _, f := range files {
+			bySession[id].Files = append(bySession[id].Files, f.info)
+		}
+	}
+
+	if current != "" {
+		s := session(current)
+		if info, err := os.Stat(streamLogFile(streamID)); err == nil {
+			s.Files = append(s.Files, LogFileInfo{Name: currentLogName, Size: info.Size(), Modified: info.ModTime()})
+		}
+	}
+
+	sessions := make([]LogSessionInfo, 0, len(bySession))
+	for _, s := range bySession {
+		sessions = append(sessions, *s)
+	}
+	// Имена сессий - время в фиксированном формате, строковое сравнение хронологично
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Session > sessions[j].Session })
+	return sessions
+}
+
+// pruneLogSessions оставляет keep последних сессий потока (включая current)
+func pruneLogSessions(streamID, current string, keep int) {
+	if keep < 1 {
+		keep = 1
+	}
+	sessions := listLogSessions(streamID, current)
+	if len(sessions) <= keep {
+		return
+	}
+	for _, s := range sessions[keep:] {
+		if s.Current {
+			continue
+		}
+		for _, f := range s.Files {
+			os.Remove(filepath.Join(serviceConfig.LogDir, f.Name))
+		}
+		log.Printf("🧹 Удален лог сессии %s потока %s", s.Session, streamID)
+	}
+}
+
+// startLogSession архивирует оставшийся лог прошлой сессии, удаляет лишние
+// сессии и возвращает идентификатор новой
+func startLogSession(streamID, previous string) string {
+	archiveStreamLog(streamID, previous)
+	session := newLogSession(time.Now())
+	pruneLogSessions(streamID, session, serviceConfig.LogSessions)
+	return session
+}
+
+// runLogRotation - общий для всех потоков цикл ротации логов по размеру и возрасту
+func runLogRotation() {
+	if serviceConfig.LogMaxBytes <= 0 && serviceConfig.LogMaxAge <= 0 {
+		return
+	}
+	ticker := time.NewTicker(serviceConfig.LogRotateInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		type candidate struct {
+			streamID  string
+			stream    *StreamInstance
+			session   string
+			rotatedAt time.Time
+		}
+		var candidates []candidate
+		manager.mutex.RLock()
+		for id, stream := range manager.streams {
+			if stream.LogSession != "" {
+				candidates = append(candidates, candidate{id, stream, stream.LogSession, stream.LogRotatedAt})
+			}
+		}
+		manager.mutex.RUnlock()
+
+		now := time.Now()
+		for _, c := range candidates {
+			info, err := os.Stat(streamLogFile(c.streamID))
+			if err != nil || info.Size() == 0 {
+				continue
+			}
+			bySize := serviceConfig.LogMaxBytes > 0 && info.Size() >= serviceConfig.LogMaxBytes
+			byAge := serviceConfig.LogMaxAge > 0 && now.Sub(c.rotatedAt) >= serviceConfig.LogMaxAge
+			if !bySize && !byAge {
+				continue
+			}
+
+			c.stream.logMu.Lock()
+			err = rotateStreamLog(c.streamID, c.session)
+			if err == nil {
+				c.stream.logGeneration++
+			}
+			c.stream.logMu.Unlock()
+			if err != nil {
+				log.Printf("⚠️ Не удалось ротировать лог потока %s: %v", c.streamID, err)
+				continue
+			}
+			log.Printf("🔄 Лог потока %s ротирован (%d байт)", c.streamID, info.Size())
+
+			manager.mutex.Lock()
+			if manager.streams[c.streamID] == c.stream {
+				c.stream.LogRotatedAt = now
+			}
+			manager.mutex.Unlock()
+		}
+	}
+}
+
+// handleStreamLogs обрабатывает логи ffmpeg потока. Логи содержат адреса
+// ingest с ключами, поэтому доступны только с токеном API.
+//
+//	GET /api/streams/{stream_id}/logs         - сессии и их файлы
+//	GET /api/streams/{stream_id}/logs/tail    - текущий лог в реальном времени (SSE)
+//	GET /api/streams/{stream_id}/logs/{name}  - файл лога, поддерживает Range;
+//	                                            current - текущий лог работающего потока
+//
+// Логи остановленного потока остаются доступными, пока их сессии не удалены.
+func handleStreamLogs(w http.ResponseWriter, r *http.Request, streamID, name string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	if !middleware.IsAuthorized(r, serviceConfig.APIToken) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Требуется токен API",
+			StreamID: streamID,
+			Error:    "unauthorized",
+		})
+		return
+	}
+
+	manager.mutex.RLock()
+	stream, running := manager.streams[streamID]
+	current := ""
+	if running {
+		current = stream.LogSession
+	}
+	manager.mutex.RUnlock()
+
+	switch name {
+	case "":
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Логи потока",
+			StreamID: streamID,
+			Data:     listLogSessions(streamID, current),
+		})
+		return
+	case "tail":
+		if !running {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+		tailStreamLog(w, r, streamID, stream)
+		return
+	}
+
+	path := ""
+	if name == currentLogName {
+		if running {
+			path = streamLogFile(streamID)
+		}
+	} else if _, _, ok := parseArchivedLogName(streamID, name); ok {
+		path = filepath.Join(serviceConfig.LogDir, name)
+	}
+	f, err := os.Open(path)
+	if path == "" || err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Лог не найден",
+			StreamID: streamID,
+			Error:    "log not found: " + name,
+		})
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// tailStreamLog отдает текущий лог как Server-Sent Events: сначала последние
+// lines строк (по умолчанию 100), затем новые строки по мере записи. id события -
+// смещение в файле после строки, поэтому переподключение с Last-Event-ID
+// продолжает с того же места. После ротации приходит событие rotated,
+// после остановки потока - end. Ротация определяется по поколению лога потока,
+// а не по размеру: за время между опросами новый файл может дорасти до прежнего.
+func tailStreamLog(w http.ResponseWriter, r *http.Request, streamID string, stream *StreamInstance) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	path := streamLogFile(streamID)
+	offset := int64(-1)
+	if lastID, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil && lastID >= 0 {
+		offset = lastID
+	}
+	if offset < 0 {
+		lines := 100
+		if n, err := strconv.Atoi(r.URL.Query().Get("lines")); err == nil && n >= 0 {
+			lines = min(n, logTailMaxLines)
+		}
+		offset = tailOffset(path, lines)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx не буферизует поток событий
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(logTailPollInterval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+
+	stream.logMu.Lock()
+	generation := stream.logGeneration
+	stream.logMu.Unlock()
+
+	for {
+		manager.mutex.RLock()
+		active := manager.streams[streamID] == stream
+		manager.mutex.RUnlock()
+
+		// Под logMu файл не обрезается посреди чтения; строки копятся в буфере,
+		// чтобы медленный клиент не задерживал ротацию
+		var events bytes.Buffer
+		sent := false
+		stream.logMu.Lock()
+		if rotations := stream.logGeneration - generation; rotations > 0 {
+			// Строки, записанные после прошлого чтения, ушли в архивные части этих ротаций
+			last := lastLogPart(streamID, stream.LogSession)
+			for part := last - rotations + 1; part <= last; part++ {
+				if part > 0 {
+					sendLogLines(&events, filepath.Join(serviceConfig.LogDir, archivedLogName(streamID, stream.LogSession, part)), offset)
+				}
+				offset = 0
+			}
+			generation = stream.logGeneration
+			fmt.Fprintf(&events, "event: rotated\ndata: %s\n\n", streamID)
+			sent = true
+		}
+		linesSent, next, truncated := sendLogLines(&events, path, offset)
+		stream.logMu.Unlock()
+		if truncated {
+			// Last-Event-ID указывает за конец файла: ротация была до переподключения
+			fmt.Fprintf(&events, "event: rotated\ndata: %s\n\n", streamID)
+		}
+		events.WriteTo(w)
+		sent = sent || linesSent || truncated
+		offset = next
+		if !active {
+			fmt.Fprintf(w, "event: end\ndata: %s\n\n", streamID)
+			flusher.Flush()
+			return
+		}
+		if sent {
+			lastWrite = time.Now()
+		} else if time.Since(lastWrite) >= logTailKeepalive {
+			fmt.Fprint(w, ": keepalive\n\n")
+			lastWrite = time.Now()
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-shutdownCh:
+			// Сервис останавливается: клиент переподключится к следующему экземпляру
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendLogLines отправляет законченные строки лога после offset и возвращает
+// новое смещение. Файл короче offset (truncated) читается с начала.
+func sendLogLines(w io.Writer, path string, offset int64) (sent bool, next int64, truncated bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, offset, false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, offset, false
+	}
+	if info.Size() < offset {
+		offset, truncated = 0, true
+	}
+	if info.Size() == offset {
+		return false, offset, truncated
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return false, offset, truncated
+	}
+
+	reader := bufio.NewReaderSize(io.LimitReader(f, info.Size()-offset), 64*1024)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Незаконченная строка дождется перевода строки
+			break
+		}
+		offset += int64(len(line))
+		// ffmpeg обновляет строку статуса через \r - в событии это отдельные строки
+		for _, part := range strings.Split(strings.TrimRight(line, "\r\n"), "\r") {
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", offset, part)
+		}
+		sent = true
+	}
+	return sent, offset, truncated
+}
+
+// tailOffset - смещение, с которого в файле начинаются последние lines строк
+func tailOffset(path string, lines int) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	size := info.Size()
+	if lines == 0 {
+		return size
+	}
+
+	const chunk = 8 * 1024
+	buf := make([]byte, chunk)
+	pos := size
+	newlines := 0
+	for pos > 0 {
+		n := int64(chunk)
+		if pos < n {
+			n = pos
+		}
+		pos -= n
+		if _, err := f.ReadAt(buf[:n], pos); err != nil && err != io.EOF {
+			return 0
+		}
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] != '\n' {
+				continue
+			}
+			// Перевод строки в самом конце файла завершает последнюю строку
+			if pos+i == size-1 {
+				continue
+			}
+			newlines++
+			if newlines == lines {
+				return pos + i + 1
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendLog(t *testing.T, path, lines string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(lines); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTailStreamLogDetectsRotationAfterRegrowth: новый файл после ротации успевает
+// стать длиннее прочитанного, но tail все равно дочитывает архивную часть и
+// читает новый файл с начала
+func TestTailStreamLogDetectsRotationAfterRegrowth(t *testing.T) {
+	const streamID = "tail1"
+	path := streamLogFile(streamID)
+	appendLog(t, path, "a\nb\n")
+	stream := &StreamInstance{StreamID: streamID, LogSession: newLogSession(time.Now())}
+	manager.mutex.Lock()
+	manager.streams[streamID] = stream
+	manager.mutex.Unlock()
+	t.Cleanup(func() {
+		manager.mutex.Lock()
+		delete(manager.streams, streamID)
+		manager.mutex.Unlock()
+		os.Remove(path)
+		os.Remove(nextLogPart(streamID, stream.LogSession))
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tailStreamLog(w, r, streamID, stream)
+	}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string, 64)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data: ") || strings.HasPrefix(line, "event: ") {
+				lines <- line
+			}
+		}
+		close(lines)
+	}()
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-lines:
+				if got != w {
+					t.Fatalf("tail sent %q, want %q", got, w)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatalf("tail did not send %q", w)
+			}
+		}
+	}
+	expect("data: a", "data: b")
+
+	// Между опросами: непрочитанная строка, ротация и новые строки длиннее прочитанного
+	stream.logMu.Lock()
+	appendLog(t, path, "x\n")
+	if err := rotateStreamLog(streamID, stream.LogSession); err != nil {
+		stream.logMu.Unlock()
+		t.Fatal(err)
+	}
+	stream.logGeneration++
+	appendLog(t, path, "c\nd\ne\nf\n")
+	stream.logMu.Unlock()
+
+	expect("data: x", "event: rotated", "data: "+streamID, "data: c", "data: d", "data: e", "data: f")
+
+	manager.mutex.Lock()
+	delete(manager.streams, streamID)
+	manager.mutex.Unlock()
+	expect("event: end", "data: "+streamID)
+}
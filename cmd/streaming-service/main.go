@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 
@@ -12,16 +14,63 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"my-go-app/pkg/hls"
+	"my-go-app/pkg/middleware"
 )
 
 type StreamRequest struct {
-	StreamID string `json:"stream_id"`
-	Action   string `json:"action"` // start, stop, status
+	StreamID string         `json:"stream_id"`
+	Action   string         `json:"action"` // start, stop, restart, delete
+	Options  *StreamOptions `json:"options,omitempty"`
+}
+
+const (
+	ModeRepackOnly = "repack_only"
+	ModeTranscode  = "transcode"
+)
+
+// StreamOptions - параметры запуска потока, передаваемые основным приложением
+type StreamOptions struct {
+	Mode       string      `json:"mode,omitempty"` // repack_only, transcode
+	Preset     string      `json:"preset,omitempty"`
+	Renditions []Rendition `json:"renditions,omitempty"`
+	LowLatency bool        `json:"low_latency,omitempty"` // LL-HLS, только для repack_only
+	Packaging  string      `json:"packaging,omitempty"`   // ts (по умолчанию) или cmaf (HLS + DASH)
+
+	DVRWindowSeconds int  `json:"dvr_window_seconds,omitempty"` // глубина перемотки, 0 - без DVR
+	Record           bool `json:"record,omitempty"`             // сохранять сессию в VOD-архив
+
+	InactivityTimeoutSeconds int `json:"inactivity_timeout_seconds,omitempty"` // без новых сегментов дольше - статус starting; 0 - HLS_INACTIVITY_TIMEOUT
+
+	Protocol string `json:"protocol,omitempty"` // srt (по умолчанию) или rtmp
+	RTMPApp  string `json:"rtmp_app,omitempty"` // приложение RTMP, по умолчанию live
+	RTMPKey  string `json:"rtmp_key,omitempty"` // ключ публикации RTMP
+
+	SRTPassphrase string `json:"srt_passphrase,omitempty"` // пароль шифрования SRT (10-79 символов)
+	SRTKeyLength  int    `json:"srt_key_length,omitempty"` // pbkeylen: 16, 24 или 32
+
+	SourceURL string `json:"source_url,omitempty"` // источник для protocol=pull
+
+	Destinations []DestinationSpec `json:"destinations,omitempty"` // точки ретрансляции (simulcast)
+
+	Captions *CaptionsOptions `json:"captions,omitempty"` // дорожки WebVTT и CEA-608/708, только для ts без LL-HLS
+
+	AdCues *AdCuesOptions `json:"ad_cues,omitempty"` // рекламные паузы, только для ts без LL-HLS
+}
+
+// Rendition - ступень ABR-лестницы (битрейты в кбит/с)
+type Rendition struct {
+	Name         string `json:"name"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	VideoBitrate int    `json:"video_bitrate,omitempty"`
+	AudioBitrate int    `json:"audio_bitrate"`
+	AudioOnly    bool   `json:"audio_only,omitempty"`
 }
 
 type StreamResponse struct {
@@ -30,24 +79,86 @@ type StreamResponse struct {
 	Status   string      `json:"status,omitempty"`
 	Data     interface{} `json:"data,omitempty"`
 	Error    string      `json:"error,omitempty"`
+	Code     string      `json:"code,omitempty"` // capacity_exceeded, shutting_down - запуск можно повторить позже
 }
 
 type StreamInstance struct {
-	StreamID    string     `json:"stream_id"`
-	Status      string     `json:"status"` // starting, running, stopped, error
-	StartTime   time.Time  `json:"start_time"`
-	StreamStart *time.Time `json:"stream_start,omitempty"` // время начала потока
-	Process     *exec.Cmd  `json:"-"`
-	LogFile     string     `json:"log_file"`
-	HLSPath     string     `json:"hls_path"`
-	SRTPort     int        `json:"srt_port"`
-	ServerIP    string     `json:"server_ip"`
+	StreamID      string      `json:"stream_id"`
+	Status        string      `json:"status"` // starting, running, stopped, error
+	StartTime     time.Time   `json:"start_time"`
+	StreamStart   *time.Time  `json:"stream_start,omitempty"` // время начала потока
+	Pipeline      Pipeline    `json:"-"`
+	LogFile       string      `json:"log_file"`
+	LogSession    string      `json:"log_session,omitempty"`
+	LogRotatedAt  time.Time   `json:"-"` // начало текущего файла лога для ротации по возрасту
+	HLSPath       string      `json:"hls_path"`
+	SRTPort       int         `json:"srt_port"`
+	ServerIP      string      `json:"server_ip"`
+	Protocol      string      `json:"protocol"` // srt, rtmp, pull
+	RTMPPort      int         `json:"rtmp_port,omitempty"`
+	RTMPApp       string      `json:"rtmp_app,omitempty"`
+	RTMPKey       string      `json:"-"` // ключ публикации не попадает в JSON журнала и API
+	SRTPassphrase string      `json:"-"`
+	SRTKeyLength  int         `json:"srt_key_length,omitempty"`
+	Mode          string      `json:"mode"`
+	Preset        string      `json:"preset,omitempty"`
+	Renditions    []Rendition `json:"renditions,omitempty"`
+	LowLatency    bool        `json:"low_latency"`
+	Packaging     string      `json:"packaging"`
+
+	SourceURL string         `json:"-"`                  // может содержать учетные данные
+	Upstream  *UpstreamState `json:"upstream,omitempty"` // только для pull-потоков
+
+	DVRWindowSeconds int      `json:"dvr_window_seconds"`
+	DVR              DVRStats `json:"dvr"`
+
+	InactivityTimeoutSeconds int `json:"inactivity_timeout_seconds"`
+
+	Record   bool      `json:"record"`
+	Recorder *Recorder `json:"-"` // nil, если запись выключена
+
+	Thumbnail ThumbnailState `json:"thumbnail"`
+
+	LLHLS *LLHLSPackager `json:"-"` // упаковщик LL-HLS, nil для обычного HLS
+
+	rtmpGate *RTMPGate // прием RTMP-публикации с проверкой ключа, nil для SRT и pull
+
+	// logMu разделяет ротацию лога и чтение для tail; logGeneration - число
+	// ротаций текущего файла, по нему tail узнает о ротации, даже если файл
+	// успел дорасти до прежнего размера
+	logMu         sync.Mutex
+	logGeneration int
+
+	Progress *ProgressTracker `json:"-"` // метрики ingest из ffmpeg -progress
+
+	HLSHealth map[string]hls.Analysis `json:"-"` // анализ медиа-плейлистов по имени, под manager.mutex
+
+	Media     *MediaInfo    `json:"media,omitempty"` // параметры ingest по данным ffprobe, под manager.mutex
+	probeWake chan struct{} // внеочередная проверка параметров при переходе в running
+
+	Captions *CaptionTracks `json:"-"` // текстовые дорожки, nil - субтитров нет
+
+	AdCues *AdCues `json:"-"` // рекламные паузы, nil - выключены
+
+	Destinations []DestinationSpec     `json:"-"` // URL точек содержат ключи публикации
+	Forwarders   map[string]*Forwarder `json:"-"` // ретрансляции по ID точки, под manager.mutex
+
+	// Состояние медиа-конвейера
+	RestartCount int        `json:"restart_count"`
+	LastExitCode *int       `json:"last_exit_code,omitempty"`
+	LastExitTime *time.Time `json:"last_exit_time,omitempty"`
+	PID          int        `json:"pid,omitempty"`
+	Adopted      bool       `json:"adopted,omitempty"` // ffmpeg подхвачен после рестарта сервиса
 }
 
 type StreamManager struct {
-	streams  map[string]*StreamInstance
-	mutex    sync.RWMutex
-	basePort int
+	streams   map[string]*StreamInstance
+	mutex     sync.RWMutex
+	ports     *PortAllocator // UDP-порты SRT
+	rtmpPorts *PortAllocator // TCP-порты RTMP
+	state     *StateStore
+
+	admitting map[string]bool // допущенные к запуску, но еще не зарегистрированные потоки (true - transcode)
 }
 
 // ✅ ДОБАВИТЬ после существующих структур
@@ -58,10 +169,24 @@ type StatusUpdateRequest struct {
 
 // ✅ НОВЫЕ СТРУКТУРЫ для API ответов
 type StreamInfo struct {
-	ID           uint   `json:"id"`
-	StreamID     string `json:"stream_id"`
-	Name         string `json:"name"`
-	StreamStatus string `json:"stream_status"`
+	ID            uint   `json:"id"`
+	StreamID      string `json:"stream_id"`
+	Name          string `json:"name"`
+	StreamStatus  string `json:"stream_status"`
+	Mode          string `json:"mode"`
+	Preset        string `json:"preset"`
+	Protocol      string `json:"protocol"`
+	RTMPApp       string `json:"rtmp_app"`
+	RTMPKey       string `json:"rtmp_key"`
+	SRTPassphrase string `json:"srt_passphrase"`
+	SRTKeyLength  int    `json:"srt_key_length"`
+	SourceURL     string `json:"source_url"`
+	LowLatency    bool   `json:"low_latency"`
+	Packaging     string `json:"packaging"`
+	DVRWindow     int    `json:"dvr_window_seconds"`
+	Record        bool   `json:"record"`
+
+	InactivityTimeout int `json:"inactivity_timeout_seconds"`
 }
 
 // ✅ ДОБАВЬТЕ недостающие структуры
@@ -69,10 +194,14 @@ type StreamInstanceResponse struct {
 	StreamID  string    `json:"stream_id"`
 	Status    string    `json:"status"`
 	StartTime time.Time `json:"start_time"`
-	SRTPort   int       `json:"srt_port"`
+	SRTPort   int       `json:"srt_port,omitempty"`
+	RTMPPort  int       `json:"rtmp_port,omitempty"`
 	ServerIP  string    `json:"server_ip"`
-	SRTURL    string    `json:"srt_url"`
+	Protocol  string    `json:"protocol"`
+	IngestURL string    `json:"ingest_url"`
+	SRTURL    string    `json:"srt_url,omitempty"`
 	HLSURL    string    `json:"hls_url"`
+	Mode      string    `json:"mode"`
 }
 
 type TasksResponse struct {
@@ -83,24 +212,67 @@ type TasksResponse struct {
 var manager *StreamManager
 
 func main() {
+	serviceConfig = loadServiceConfig()
 	// Создание директорий
-	if err := os.MkdirAll("/app/hls", 0o755); err != nil {
+	if err := os.MkdirAll(serviceConfig.HLSRoot, 0o755); err != nil {
 		log.Printf("Error creating hls directory: %v", err)
 	}
-	if err := os.MkdirAll("/app/logs", 0o755); err != nil {
+	if serviceConfig.ShutdownMode != ShutdownStop && serviceConfig.ShutdownMode != ShutdownHandoff {
+		log.Printf("⚠️ Неизвестный SHUTDOWN_MODE=%q, используем %s", serviceConfig.ShutdownMode, ShutdownStop)
+		serviceConfig.ShutdownMode = ShutdownStop
+	}
+	if err := os.MkdirAll(serviceConfig.LogDir, 0o755); err != nil {
 		log.Printf("Error creating logs directory: %v", err)
 	}
+	if err := os.MkdirAll(serviceConfig.RunDir, 0o755); err != nil {
+		log.Printf("Error creating run directory: %v", err)
+	}
+	if err := os.MkdirAll(serviceConfig.RecordingsPath, 0o755); err != nil {
+		log.Printf("Error creating recordings directory: %v", err)
+	}
+
+	ports, err := NewPortAllocator(serviceConfig.SRTPortMin, serviceConfig.SRTPortMax)
+	if err != nil {
+		log.Fatalf("Ошибка настройки пула SRT портов: %v", err)
+	}
+	rtmpPorts, err := NewRTMPPortAllocator(serviceConfig.RTMPPortMin, serviceConfig.RTMPPortMax)
+	if err != nil {
+		log.Fatalf("Ошибка настройки пула RTMP портов: %v", err)
+	}
 
 	manager = &StreamManager{
-		streams:  make(map[string]*StreamInstance),
-		basePort: 10000,
+		streams:   make(map[string]*StreamInstance),
+		ports:     ports,
+		rtmpPorts: rtmpPorts,
+		state:     NewStateStore(serviceConfig.StateFile),
+		admitting: make(map[string]bool),
 	}
+	hlsWatcher = NewHLSWatcher()
+	go runLogRotation()
 
-	// ✅ НОВОЕ: Восстановление активных потоков при старте
-	go func() {
-		time.Sleep(5 * time.Second) // Ждем инициализации основного приложения
-		restoreActiveStreams()
-	}()
+	// Журнал состояния: закрепляем порты за потоками до любых запусков
+	records, err := manager.state.Load()
+	if err != nil {
+		log.Printf("⚠️ Не удалось прочитать журнал состояния %s: %v", serviceConfig.StateFile, err)
+	}
+	pruned := make(map[string]bool)
+	for _, streamID := range pruneStoppedStreams() {
+		pruned[streamID] = true
+	}
+	kept := records[:0]
+	for _, rec := range records {
+		if pruned[rec.StreamID] {
+			continue
+		}
+		kept = append(kept, rec)
+		manager.ports.Remember(rec.StreamID, rec.SRTPort)
+		manager.rtmpPorts.Remember(rec.StreamID, rec.RTMPPort)
+	}
+	records = kept
+	go runStatePruning()
+
+	// Восстановление активных потоков при старте
+	go restoreActiveStreams(records)
 
 	// API endpoints
 	http.HandleFunc("/api/streams", handleStreams)
@@ -108,97 +280,48 @@ func main() {
 	http.HandleFunc("/api/health", handleHealth)
 	http.HandleFunc("/api/debug/", handlePlaylistDebug)
 	http.HandleFunc("/api/hls/", handleHLSMetadata) // ✅ НОВЫЙ endpoint для HLS метаданных
+	http.HandleFunc("/api/llhls/", handleLLHLS)     // LL-HLS с блокирующей перезагрузкой плейлиста
+	http.HandleFunc("/api/recordings/", handleRecordings)
 	// Serve HLS files
 	//http.Handle("/hls/", http.StripPrefix("/hls/", http.FileServer(http.Dir("/app/hls"))))
 
 	log.Println("Streaming service запущен на порту :8081")
-	log.Fatal(http.ListenAndServe(":8081", nil))
+	serveUntilSignal(&http.Server{Addr: ":8081"})
 }
 
-// ИСПРАВЛЕННАЯ функция мониторинга HLS активности
-func monitorHLSActivity(streamID string, hlsPath string) {
-	log.Printf("📁 Запуск мониторинга HLS активности для потока %s", streamID)
-
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
-
-	lastModTime := time.Time{}
-	consecutiveInactiveChecks := 0
-	const maxInactiveChecks = 5 // 10 секунд без активности
-
-	for range ticker.C {
-		// Проверяем, что поток еще существует
-		manager.mutex.RLock()
-		stream, exists := manager.streams[streamID]
-		manager.mutex.RUnlock()
-
-		if !exists {
-			log.Printf("🛑 Поток %s удален, завершаем мониторинг HLS", streamID)
-			return
-		}
-
-		// Получаем информацию о НОВЕЙШИХ сегментах
-		entries, err := os.ReadDir(hlsPath)
-		if err != nil {
-			consecutiveInactiveChecks++
-			continue
-		}
-
-		newestModTime := time.Time{}
-
-		for _, entry := range entries {
-			if strings.HasSuffix(entry.Name(), ".ts") {
-				if info, err := entry.Info(); err == nil {
-					if info.ModTime().After(newestModTime) {
-						newestModTime = info.ModTime()
-					}
-				}
-			}
-		}
-
-		// Проверяем, есть ли НОВАЯ активность
-		hasNewActivity := false
-		if !newestModTime.IsZero() && newestModTime.After(lastModTime) {
-			hasNewActivity = true
-			lastModTime = newestModTime
-			consecutiveInactiveChecks = 0
-			log.Printf("🔄 Новая HLS активность для потока %s (время: %s)", streamID, newestModTime.Format("15:04:05"))
-		} else if !newestModTime.IsZero() {
-			// Если есть сегменты, но нет новых - проверяем свежесть
-			timeSinceLastMod := time.Since(newestModTime)
-			if timeSinceLastMod > 10*time.Second {
-				consecutiveInactiveChecks++
-			} else {
-				consecutiveInactiveChecks = 0
-			}
-		} else {
-			consecutiveInactiveChecks++
-		}
-
-		manager.mutex.Lock()
+// watchPipelineEvents переносит события конвейера в StreamInstance до закрытия канала
+func watchPipelineEvents(streamID string, pipeline Pipeline) {
+	applyPipelineStatus(streamID, pipeline.Status())
+	for event := range pipeline.Events() {
+		applyPipelineStatus(streamID, event.Status)
+		applyUpstreamEvent(streamID, event)
+	}
+}
 
-		// Логика перехода starting -> running (только при НОВОЙ активности)
-		if hasNewActivity && stream.Status == "starting" {
-			now := time.Now()
-			stream.StreamStart = &now
-			stream.Status = "running"
-			log.Printf("🎬 Новые HLS сегменты для потока %s, статус: running", streamID)
-			// ✅ ДОБАВИТЬ webhook уведомление
-			go notifyMainApp(streamID, "running")
-		}
+// applyPipelineStatus переносит состояние конвейера в StreamInstance
+func applyPipelineStatus(streamID string, state PipelineStatus) {
+	manager.mutex.Lock()
+	stream, exists := manager.streams[streamID]
+	if !exists {
+		manager.mutex.Unlock()
+		return
+	}
 
-		// Логика перехода running -> starting (только после продолжительной неактивности)
-		if consecutiveInactiveChecks >= maxInactiveChecks && stream.Status == "running" {
-			stream.Status = "starting"
-			stream.StreamStart = nil
-			log.Printf("⏹️  Длительная неактивность HLS для потока %s (%d проверок), статус: starting", streamID, consecutiveInactiveChecks)
-			consecutiveInactiveChecks = 0 // Сбрасываем счетчик
+	stream.RestartCount = state.RestartCount
+	stream.LastExitCode = state.LastExitCode
+	stream.LastExitTime = state.LastExitTime
+	stream.PID = state.PID
 
-			// ✅ ДОБАВИТЬ webhook уведомление
-			go notifyMainApp(streamID, "starting")
-		}
+	gaveUp := state.GaveUp && stream.Status != "error"
+	if gaveUp {
+		stream.Status = "error"
+		stream.StreamStart = nil
+	}
+	manager.mutex.Unlock()
 
-		manager.mutex.Unlock()
+	if gaveUp {
+		log.Printf("❌ Конвейер потока %s исчерпал лимит перезапусков, статус: error", streamID)
+		sendWebhook(func() { webhooks.StreamStatus(streamID, "error") })
 	}
 }
 
@@ -208,20 +331,33 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	manager.mutex.RLock()
 	totalStreams := len(manager.streams)
 	runningStreams := 0
+	var dvrDiskBytes int64
 	for _, stream := range manager.streams {
 		if stream.Status == "running" {
 			runningStreams++
 		}
+		dvrDiskBytes += stream.DVR.DiskBytes
 	}
 	manager.mutex.RUnlock()
 
+	portPool := manager.ports.Stats()
+	rtmpPortPool := manager.rtmpPorts.Stats()
+
 	response := StreamResponse{
 		Message: "Streaming service работает",
 		Data: map[string]interface{}{
 			"timestamp":       time.Now(),
 			"total_streams":   totalStreams,
 			"running_streams": runningStreams,
-			"hls_path":        "/app/hls",
+			"hls_path":        serviceConfig.HLSRoot,
+			"port_pool":       portPool,
+			"rtmp_port_pool":  rtmpPortPool,
+			"dvr": map[string]interface{}{
+				"disk_bytes":              dvrDiskBytes,
+				"stream_disk_limit_bytes": serviceConfig.DVRMaxDiskBytes,
+			},
+			"hls_watcher": hlsWatcher.Stats(),
+			"capacity":    capacityStats(),
 		},
 	}
 
@@ -271,10 +407,23 @@ func handleStreams(w http.ResponseWriter, r *http.Request) {
 		}
 
 		switch req.Action {
-		case "start":
-			response := startStream(req.StreamID)
-			if response.Error != "" {
+		case "start", "restart":
+			var options StreamOptions
+			if req.Options != nil {
+				options = *req.Options
+			}
+			var response StreamResponse
+			if req.Action == "restart" {
+				response = restartStream(req.StreamID, options)
+			} else {
+				response = startStream(req.StreamID, options)
+			}
+			if response.Code == ErrCodeCapacityExceeded || response.Code == ErrCodeShuttingDown {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			} else if response.Error != "" {
 				w.WriteHeader(http.StatusInternalServerError)
+			} else if middleware.IsAuthorized(r, serviceConfig.APIToken) {
+				response.Data = withIngestSecrets(req.StreamID, response.Data)
 			}
 			if err := json.NewEncoder(w).Encode(response); err != nil {
 				log.Printf("Error encoding JSON: %v", err)
@@ -293,10 +442,21 @@ func handleStreams(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+		case "delete":
+			response := deleteStream(req.StreamID)
+			if response.Error != "" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			if err := json.NewEncoder(w).Encode(response); err != nil {
+				log.Printf("Error encoding JSON: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
 		default:
 			response := StreamResponse{
 				Message: "Неизвестное действие",
-				Error:   "Поддерживаемые действия: start, stop",
+				Error:   "Поддерживаемые действия: start, stop, restart, delete",
 			}
 			w.WriteHeader(http.StatusBadRequest)
 			if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -314,7 +474,7 @@ func handleStreams(w http.ResponseWriter, r *http.Request) {
 func handleStreamByID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	streamID := strings.TrimPrefix(r.URL.Path, "/api/streams/")
+	streamID, subresource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/streams/"), "/")
 	if streamID == "" {
 		response := StreamResponse{
 			Message: "Не указан StreamID",
@@ -325,6 +485,12 @@ func handleStreamByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Логи остановленного потока тоже доступны, поэтому до поиска потока
+	if resource, name, _ := strings.Cut(subresource, "/"); resource == "logs" {
+		handleStreamLogs(w, r, streamID, name)
+		return
+	}
+
 	manager.mutex.RLock()
 	stream, exists := manager.streams[streamID]
 	manager.mutex.RUnlock()
@@ -339,7 +505,28 @@ func handleStreamByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch subresource {
+	case "":
+	case "destinations":
+		handleStreamDestinations(w, r, stream)
+		return
+	case "captions":
+		handleStreamCaptions(w, r, streamID, stream)
+		return
+	case "cues":
+		handleStreamCues(w, r, streamID, stream)
+		return
+	case "stats":
+		handleStreamStats(w, r, stream)
+		return
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
 	serverIP := getServerIP()
+	// Пароль SRT и ключ RTMP попадают в адрес ingest только при токене API
+	authorized := middleware.IsAuthorized(r, serviceConfig.APIToken)
 
 	// ✅ ОБНОВЛЕНО: Получаем CDN домен из переменных окружения
 	cdnDomain := os.Getenv("CDN_DOMAIN")
@@ -349,23 +536,98 @@ func handleStreamByID(w http.ResponseWriter, r *http.Request) {
 
 	// ✅ ОБНОВЛЕНО: Информация о потоке с CDN URLs
 	streamData := map[string]interface{}{
-		"stream_id":  streamID,
-		"status":     stream.Status,
-		"start_time": stream.StartTime,
-		"srt_port":   stream.SRTPort,
-		"server_ip":  serverIP,
-		"hls_path":   stream.HLSPath,
-		"log_file":   stream.LogFile,
-		"mode":       "repack_only",
+		"stream_id":   streamID,
+		"status":      stream.Status,
+		"start_time":  stream.StartTime,
+		"srt_port":    stream.SRTPort,
+		"server_ip":   serverIP,
+		"protocol":    stream.Protocol,
+		"ingest_url":  stream.IngestURL(serverIP, authorized),
+		"hls_path":    stream.HLSPath,
+		"log_file":    stream.LogFile,
+		"log_session": stream.LogSession,
+		"mode":        stream.Mode,
+		"low_latency": stream.LowLatency,
+		"packaging":   stream.Packaging,
+
+		// DVR: глубина перемотки и занятость диска
+		"dvr_window_seconds": stream.DVRWindowSeconds,
+		"dvr":                stream.DVR,
+		"record":             stream.Record,
+
+		"inactivity_timeout_seconds": stream.InactivityTimeoutSeconds,
+
+		"thumbnail_url": thumbnailURL(cdnDomain, streamID),
+		"thumbnail":     thumbnailInfo(cdnDomain, stream),
+
+		// Состояние супервизора ffmpeg
+		"restart_count":  stream.RestartCount,
+		"last_exit_code": stream.LastExitCode,
+		"last_exit_time": stream.LastExitTime,
+		"pid":            stream.PID,
+		"adopted":        stream.Adopted,
 
 		// ✅ ОБНОВЛЕННЫЕ URL через CDN/nginx
-		"srt_url": fmt.Sprintf("srt://%s:%d?mode=caller&transtype=live&streamid=%s", serverIP, stream.SRTPort, streamID),
-		"hls_url": fmt.Sprintf("https://%s/hls/%s/playlist.m3u8", cdnDomain, streamID),
+		"hls_url": fmt.Sprintf("https://%s/hls/%s/%s", cdnDomain, streamID, stream.PlaylistName()),
 		"hls_api": fmt.Sprintf("http://%s:8081/api/hls/%s", serverIP, streamID),
 
 		"description": "Поток перепаковывается без перекодирования и раздается через CDN",
 	}
 
+	if stream.Mode == ModeTranscode {
+		streamData["master_url"] = streamData["hls_url"]
+		streamData["preset"] = stream.Preset
+		streamData["renditions"] = renditionsInfo(cdnDomain, stream)
+		streamData["description"] = "Поток перекодируется в ABR-лестницу и раздается через CDN"
+	}
+
+	if stream.Packaging == PackagingCMAF {
+		streamData["dash_url"] = fmt.Sprintf("https://%s/hls/%s/%s", cdnDomain, streamID, dashManifestName)
+	}
+
+	if stream.LLHLS != nil {
+		streamData["ll_hls_url"] = fmt.Sprintf("https://%s/llhls/%s/%s", cdnDomain, streamID, mediaPlaylistName)
+		streamData["ll_hls"] = stream.LLHLS.Info()
+	}
+
+	// Адрес публикации зависит от протокола ingest
+	if stream.Protocol == ProtocolPull {
+		streamData["upstream"] = stream.Upstream
+		streamData["source_url"] = redactSourceURL(stream.SourceURL)
+		if authorized {
+			streamData["source_url"] = stream.SourceURL
+		}
+		delete(streamData, "srt_port")
+		delete(streamData, "ingest_url")
+	} else if stream.Protocol == ProtocolRTMP {
+		streamData["rtmp_port"] = stream.RTMPPort
+		streamData["rtmp_app"] = stream.RTMPApp
+		streamData["rtmp_url"] = stream.IngestURL(serverIP, authorized)
+		delete(streamData, "srt_port")
+	} else {
+		streamData["srt_url"] = stream.IngestURL(serverIP, authorized)
+		streamData["srt_encrypted"] = stream.SRTPassphrase != ""
+	}
+
+	// Последние метрики ingest из ffmpeg -progress; история - в /api/streams/{id}/stats
+	if stream.Progress != nil {
+		streamData["ingest_stats"] = stream.Progress.Stats(false)
+	}
+
+	// Ретрансляции во внешние точки; ключи публикации - только при токене API
+	manager.mutex.RLock()
+	streamData["destinations"] = forwardersInfo(stream, authorized)
+	streamData["hls_health"] = hlsHealthInfo(stream)
+	streamData["media"] = stream.Media
+	manager.mutex.RUnlock()
+
+	if stream.Captions != nil {
+		streamData["captions"] = stream.Captions.Info(cdnDomain)
+	}
+	if stream.AdCues != nil {
+		streamData["ad_cues"] = stream.AdCues.Info()
+	}
+
 	// Добавляем информацию о времени начала потока если есть
 	if stream.StreamStart != nil {
 		streamData["stream_start"] = *stream.StreamStart
@@ -390,6 +652,13 @@ func handleHLSMetadata(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 
 	streamID := strings.TrimPrefix(r.URL.Path, "/api/hls/")
+
+	// /api/hls/{id}/thumbnail.jpg и /api/hls/{id}/thumbnails/{file}
+	if id, file, ok := strings.Cut(streamID, "/"); ok {
+		serveThumbnail(w, r, id, file)
+		return
+	}
+
 	if streamID == "" {
 		response := StreamResponse{
 			Message: "StreamID required",
@@ -420,22 +689,59 @@ func handleHLSMetadata(w http.ResponseWriter, r *http.Request) {
 	}
 
 	accessToken := generateStreamToken(streamID)
+	hlsURL := fmt.Sprintf("https://%s/hls/%s/%s", cdnDomain, streamID, stream.PlaylistName())
 
 	response := StreamResponse{
 		Message:  "HLS stream metadata",
 		StreamID: streamID,
 		Status:   stream.Status,
 		Data: map[string]interface{}{
-			"hls_url":      fmt.Sprintf("https://%s/hls/%s/playlist.m3u8", cdnDomain, streamID),
-			"stream_url":   fmt.Sprintf("https://%s/hls/%s/playlist.m3u8?token=%s", cdnDomain, streamID, accessToken),
+			"hls_url":      hlsURL,
+			"stream_url":   fmt.Sprintf("%s?token=%s", hlsURL, accessToken),
 			"stream_id":    streamID,
 			"status":       stream.Status,
 			"start_time":   stream.StartTime,
 			"cdn_domain":   cdnDomain,
 			"access_token": accessToken,
+			"mode":         stream.Mode,
+			"low_latency":  stream.LowLatency,
+			"packaging":    stream.Packaging,
+
+			// Плеер разрешает перемотку на dvr_available_seconds назад
+			"dvr_window_seconds":    stream.DVRWindowSeconds,
+			"dvr_available_seconds": stream.DVR.AvailableSeconds,
+
+			"thumbnail_url":   thumbnailURL(cdnDomain, streamID),
+			"thumbnail_stale": stream.Thumbnail.Stale,
 		},
 	}
 
+	// Плеер включает субтитры из master.m3u8; здесь - те же дорожки списком
+	if stream.Captions != nil {
+		response.Data.(map[string]interface{})["captions"] = stream.Captions.Info(cdnDomain)
+	}
+
+	// Кодеки, разрешение и частота кадров ingest; null до первой проверки
+	manager.mutex.RLock()
+	response.Data.(map[string]interface{})["media"] = stream.Media
+	manager.mutex.RUnlock()
+
+	if stream.Packaging == PackagingCMAF {
+		response.Data.(map[string]interface{})["dash_url"] = fmt.Sprintf("https://%s/hls/%s/%s", cdnDomain, streamID, dashManifestName)
+	}
+
+	if stream.Mode == ModeTranscode {
+		response.Data.(map[string]interface{})["master_url"] = hlsURL
+		response.Data.(map[string]interface{})["renditions"] = renditionsInfo(cdnDomain, stream)
+	}
+
+	// Плеер переключается в режим LL-HLS по этому URL: он поддерживает _HLS_msn/_HLS_part
+	if stream.LLHLS != nil {
+		llURL := fmt.Sprintf("https://%s/llhls/%s/%s", cdnDomain, streamID, mediaPlaylistName)
+		response.Data.(map[string]interface{})["ll_hls_url"] = llURL
+		response.Data.(map[string]interface{})["part_target"] = stream.LLHLS.Info()["part_target"]
+	}
+
 	if stream.StreamStart != nil {
 		response.Data.(map[string]interface{})["stream_start"] = *stream.StreamStart
 		response.Data.(map[string]interface{})["is_live"] = true
@@ -459,191 +765,272 @@ func generateStreamToken(streamID string) string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(tokenData+secret)))[:16]
 }
 
-func createWrapperScript(streamID string, port int, hlsPath string) (string, error) {
-	scriptPath := filepath.Join("/tmp", fmt.Sprintf("ffmpeg_wrapper_%s.sh", streamID))
-
-	script := fmt.Sprintf(`#!/bin/bash
-STREAM_ID="%s"
-SRT_PORT=%d
-HLS_PATH="%s"
-LOG_FILE="/app/logs/%s.log"
-
-echo "$(date): 🚀 Запуск устойчивого wrapper для потока $STREAM_ID" >> "$LOG_FILE"
-
-# ✅ ИСПРАВЛЕНО: Правильный синтаксис функции в bash
-cleanup() {
-    echo "$(date): 🛑 Получен сигнал завершения для потока $STREAM_ID" >> "$LOG_FILE"
-    if [ ! -z "$FFMPEG_PID" ]; then
-        kill -TERM "$FFMPEG_PID" 2>/dev/null
-        wait "$FFMPEG_PID" 2>/dev/null
-    fi
-    exit 0
-}
-
-# Устанавливаем обработчики сигналов
-trap cleanup TERM INT QUIT
-
-# ✅ ОСНОВНОЙ ЦИКЛ: Бесконечный перезапуск ffmpeg
-RESTART_COUNT=0
-while true; do
-    # Проверяем файл флага остановки
-    if [ -f "/tmp/stop_$STREAM_ID" ]; then
-        echo "$(date): 🔴 Получен флаг остановки для потока $STREAM_ID" >> "$LOG_FILE"
-        rm -f "/tmp/stop_$STREAM_ID"
-        break
-    fi
-    
-    RESTART_COUNT=$((RESTART_COUNT + 1))
-    echo "$(date): 🔄 Запуск FFmpeg для потока $STREAM_ID на порту $SRT_PORT (попытка #$RESTART_COUNT)" >> "$LOG_FILE"
-    
-    # ✅ ИСПРАВЛЕНО: Убрал проблемные reconnect параметры, добавил & для фонового запуска
-    ffmpeg \
-        -hide_banner \
-        -loglevel warning \
-        -f mpegts \
-        -timeout 10000000 \
-        -i "srt://0.0.0.0:$SRT_PORT?mode=listener&transtype=live&streamid=$STREAM_ID&latency=2000000&rcvbuf=100000000&sndbuf=100000000" \
-        -c:v copy \
-        -c:a copy \
-        -avoid_negative_ts make_zero \
-        -copyts \
-        -start_at_zero \
-        -f hls \
-        -hls_time 4 \
-        -hls_list_size 6 \
-        -hls_delete_threshold 1 \
-        -hls_flags delete_segments+append_list+omit_endlist \
-        -hls_segment_type mpegts \
-        -hls_segment_filename "$HLS_PATH/segment_%%03d.ts" \
-        "$HLS_PATH/playlist.m3u8" \
-        >> "$LOG_FILE" 2>&1 &
-    
-    # Сохраняем PID процесса FFmpeg
-    FFMPEG_PID=$!
-    echo "$(date): 📊 FFmpeg запущен с PID $FFMPEG_PID" >> "$LOG_FILE"
-    
-    # ✅ МОНИТОРИНГ: Ждем завершения ffmpeg
-    while kill -0 "$FFMPEG_PID" 2>/dev/null; do
-        # Проверяем флаг остановки каждую секунду
-        if [ -f "/tmp/stop_$STREAM_ID" ]; then
-            echo "$(date): ⏹️ Остановка по флагу, завершаем FFmpeg PID $FFMPEG_PID" >> "$LOG_FILE"
-            kill -TERM "$FFMPEG_PID" 2>/dev/null
-            wait "$FFMPEG_PID" 2>/dev/null
-            rm -f "/tmp/stop_$STREAM_ID"
-            exit 0
-        fi
-        sleep 1
-    done
-    
-    # Получаем код завершения
-    wait "$FFMPEG_PID" 2>/dev/null
-    EXIT_CODE=$?
-    
-    # ✅ АНАЛИЗ ПРИЧИНЫ ЗАВЕРШЕНИЯ
-    case $EXIT_CODE in
-        0)
-            echo "$(date): ✅ FFmpeg завершился корректно (код $EXIT_CODE)" >> "$LOG_FILE"
-            sleep 2
-            ;;
-        1)
-            echo "$(date): 🔌 FFmpeg завершился из-за EOF/потери соединения (код $EXIT_CODE)" >> "$LOG_FILE"
-            echo "$(date): ⚡ Быстрый перезапуск через 1 секунду" >> "$LOG_FILE"
-            sleep 1
-            ;;
-        255)
-            echo "$(date): 📡 FFmpeg завершился из-за сетевой ошибки (код $EXIT_CODE)" >> "$LOG_FILE"
-            sleep 2
-            ;;
-        *)
-            echo "$(date): ❌ FFmpeg завершился с ошибкой $EXIT_CODE" >> "$LOG_FILE"
-            sleep 5
-            ;;
-    esac
-    
-    # Ограничение на количество быстрых перезапусков
-    if [ $RESTART_COUNT -gt 50 ]; then
-        echo "$(date): ⚠️ Слишком много перезапусков, увеличиваем задержку" >> "$LOG_FILE"
-        sleep 30
-        RESTART_COUNT=0
-    fi
-done
-
-echo "$(date): 🏁 Wrapper для потока $STREAM_ID завершен (перезапусков: $RESTART_COUNT)" >> "$LOG_FILE"
-`, streamID, port, hlsPath, streamID)
-
-	// Записываем скрипт в файл
-	err := os.WriteFile(scriptPath, []byte(script), 0755)
-	if err != nil {
-		return "", fmt.Errorf("не удалось создать wrapper-скрипт: %v", err)
+// ОБНОВЛЕННАЯ функция startStream с новой механикой статусов
+func startStream(streamID string, options StreamOptions) StreamResponse {
+	if shuttingDown.Load() {
+		return StreamResponse{
+			Message: "Сервис останавливается",
+			Error:   errShuttingDown.Error(),
+			Code:    ErrCodeShuttingDown,
+		}
+	}
+	if options.Mode == "" {
+		options.Mode = ModeRepackOnly
+	}
+	switch options.Mode {
+	case ModeRepackOnly:
+		options.Preset, options.Renditions = "", nil
+	case ModeTranscode:
+		if len(options.Renditions) == 0 {
+			return StreamResponse{
+				Message: "Не задана ABR-лестница для режима transcode",
+				Error:   "renditions are required for transcode mode",
+			}
+		}
+		if options.LowLatency {
+			return StreamResponse{
+				Message: "LL-HLS доступен только в режиме repack_only",
+				Error:   "low_latency is not supported in transcode mode",
+			}
+		}
+	default:
+		return StreamResponse{
+			Message: "Неизвестный режим потока",
+			Error:   "unknown mode: " + options.Mode,
+		}
 	}
 
-	log.Printf("✅ Создан устойчивый wrapper-скрипт: %s", scriptPath)
-	return scriptPath, nil
-}
+	if options.Packaging == "" {
+		options.Packaging = PackagingTS
+	}
+	switch {
+	case options.Packaging != PackagingTS && options.Packaging != PackagingCMAF:
+		return StreamResponse{
+			Message: "Неизвестный формат упаковки",
+			Error:   "unknown packaging: " + options.Packaging,
+		}
+	case options.Packaging == PackagingCMAF && options.LowLatency:
+		return StreamResponse{
+			Message: "LL-HLS доступен только с упаковкой ts",
+			Error:   "low_latency is not supported with cmaf packaging",
+		}
+	case options.Record && (options.Packaging != PackagingTS || options.LowLatency):
+		return StreamResponse{
+			Message: "Запись доступна только для HLS с упаковкой ts",
+			Error:   "record is not supported with cmaf packaging or low_latency",
+		}
+	case options.DVRWindowSeconds < 0:
+		return StreamResponse{
+			Message: "Некорректное окно DVR",
+			Error:   "dvr_window_seconds must not be negative",
+		}
+	case !options.Captions.Empty() && (options.Packaging != PackagingTS || options.LowLatency):
+		return StreamResponse{
+			Message: "Субтитры доступны только для HLS с упаковкой ts",
+			Error:   "captions are not supported with cmaf packaging or low_latency",
+		}
+	case options.AdCues != nil && (options.Packaging != PackagingTS || options.LowLatency):
+		return StreamResponse{
+			Message: "Рекламные паузы доступны только для HLS с упаковкой ts",
+			Error:   "ad_cues are not supported with cmaf packaging or low_latency",
+		}
+	case options.AdCues != nil && options.AdCues.SCTE35Passthrough && options.Protocol != "" && options.Protocol != ProtocolSRT:
+		return StreamResponse{
+			Message: "Метки SCTE-35 принимаются только через SRT",
+			Error:   "scte35_passthrough requires srt protocol",
+		}
+	case options.InactivityTimeoutSeconds != 0 &&
+		(options.InactivityTimeoutSeconds < MinInactivityTimeoutSeconds || options.InactivityTimeoutSeconds > MaxInactivityTimeoutSeconds):
+		return StreamResponse{
+			Message: "Некорректный порог неактивности",
+			Error:   fmt.Sprintf("inactivity_timeout_seconds must be between %d and %d", MinInactivityTimeoutSeconds, MaxInactivityTimeoutSeconds),
+		}
+	}
 
-// ОБНОВЛЕННАЯ функция startStream с новой механикой статусов
-func startStream(streamID string) StreamResponse {
-	manager.mutex.Lock()
+	if options.Protocol == "" {
+		options.Protocol = ProtocolSRT
+	}
+	switch options.Protocol {
+	case ProtocolSRT:
+		options.RTMPApp, options.RTMPKey, options.SourceURL = "", "", ""
+		if options.SRTPassphrase != "" {
+			if options.SRTKeyLength == 0 {
+				options.SRTKeyLength = 16
+			}
+			if !srtPassphrasePattern.MatchString(options.SRTPassphrase) || !validSRTKeyLength(options.SRTKeyLength) {
+				return StreamResponse{
+					Message: "Некорректные параметры шифрования SRT",
+					Error:   "srt_passphrase must be 10-79 alphanumeric characters and srt_key_length 16, 24 or 32",
+				}
+			}
+		}
+	case ProtocolRTMP:
+		options.SourceURL = ""
+		if options.RTMPApp == "" {
+			options.RTMPApp = defaultRTMPApp
+		}
+		if !rtmpNamePattern.MatchString(options.RTMPApp) || !rtmpNamePattern.MatchString(options.RTMPKey) {
+			return StreamResponse{
+				Message: "Некорректные приложение или ключ RTMP",
+				Error:   "rtmp_app and rtmp_key must match [A-Za-z0-9_-]{1,64}",
+			}
+		}
+	case ProtocolPull:
+		options.RTMPApp, options.RTMPKey = "", ""
+		options.SRTPassphrase, options.SRTKeyLength = "", 0
+		if err := validatePullURL(options.SourceURL); err != nil {
+			return StreamResponse{
+				Message: "Некорректный адрес источника",
+				Error:   err.Error(),
+			}
+		}
+	default:
+		return StreamResponse{
+			Message: "Неизвестный протокол ingest",
+			Error:   "unknown protocol: " + options.Protocol,
+		}
+	}
 
-	// Проверяем, не существует ли уже поток
-	if _, exists := manager.streams[streamID]; exists {
-		manager.mutex.Unlock()
+	if options.Captions.Empty() {
+		options.Captions = nil
+	} else if err := options.Captions.Validate(); err != nil {
 		return StreamResponse{
-			Message: "Поток уже запущен",
-			Error:   "Stream already running",
+			Message: "Некорректные текстовые дорожки",
+			Error:   err.Error(),
 		}
 	}
 
-	// Генерируем уникальный порт
-	port := manager.basePort
-	manager.basePort++
+	if err := validateDestinations(options.Destinations); err != nil {
+		return StreamResponse{
+			Message: "Некорректные точки ретрансляции",
+			Error:   err.Error(),
+		}
+	}
 
-	manager.mutex.Unlock()
+	// Проверяем лимиты и резервируем место до того, как поток появится в manager.streams
+	release, rejected := admitStream(streamID, options)
+	if rejected != nil {
+		return *rejected
+	}
+	defer release()
+
+	// Берем порт из пула протокола (предпочтительно закрепленный за потоком)
+	// Pull-поток порт не занимает: ffmpeg подключается к источнику сам
+	ports := manager.portsFor(options.Protocol)
+	port := 0
+	if ports != nil {
+		protocolName := strings.ToUpper(options.Protocol)
+		allocated, err := ports.Allocate(streamID)
+		if err != nil {
+			log.Printf("❌ Нет свободных %s портов для потока %s: %v", protocolName, streamID, err)
+			capacityRejections.Add(1)
+			return StreamResponse{
+				Message: fmt.Sprintf("Нет свободных %s портов", protocolName),
+				Error:   err.Error(),
+				Code:    ErrCodeCapacityExceeded,
+			}
+		}
+		port = allocated
+	}
 
 	// Создаем директории
-	hlsPath := filepath.Join("/app/hls", streamID)
+	hlsPath := filepath.Join(serviceConfig.HLSRoot, streamID)
 	err := os.MkdirAll(hlsPath, 0755)
 	if err != nil {
+		ports.Release(streamID)
 		return StreamResponse{
 			Message: "Ошибка создания директории HLS",
 			Error:   err.Error(),
 		}
 	}
-	// ✅ ДОБАВИТЬ: Немедленно уведомляем о starting
-	go notifyMainApp(streamID, "starting")
 
-	// Создаем wrapper-скрипт
-	scriptPath, err := createWrapperScript(streamID, port, hlsPath)
-	if err != nil {
-		return StreamResponse{
-			Message: "Ошибка создания wrapper-скрипта",
-			Error:   err.Error(),
+	// RTMP-порт слушает шлюз: он проверяет приложение и ключ публикации
+	var rtmpGate *RTMPGate
+	if options.Protocol == ProtocolRTMP {
+		rtmpGate, err = StartRTMPGate(streamID, port, options.RTMPApp, options.RTMPKey)
+		if err != nil {
+			ports.Release(streamID)
+			return StreamResponse{
+				Message: "Ошибка открытия RTMP-порта",
+				Error:   err.Error(),
+			}
+		}
+	}
+	// closeGate закрывает шлюз, если запуск дальше не удался
+	closeGate := func() {
+		if rtmpGate != nil {
+			rtmpGate.Close()
 		}
 	}
 
-	// Создаем лог-файл
-	logFile := fmt.Sprintf("/app/logs/%s.log", streamID)
-	logFileHandle, err := os.Create(logFile)
+	// ✅ ДОБАВИТЬ: Немедленно уведомляем о starting
+	sendWebhook(func() { webhooks.StreamStatus(streamID, "starting") })
+
+	// Лог прошлой сессии уходит в архив, новая сессия пишет в чистый файл
+	logFile := streamLogFile(streamID)
+	previous, _ := manager.state.Get(streamID)
+	logSession := startLogSession(streamID, previous.LogSession)
+
+	dvrWindow := time.Duration(options.DVRWindowSeconds) * time.Second
+
+	var packager *LLHLSPackager
+	if options.LowLatency {
+		packager = NewLLHLSPackager(streamID, hlsPath, serviceConfig.LLHLSPartTarget, serviceConfig.LLHLSSegmentTarget, dvrWindow)
+	}
+
+	progress := newProgressTracker(hlsPath, options.Packaging, options.Renditions)
+	adCues := NewAdCues(streamID, hlsPath, options.AdCues, options.Renditions)
+
+	spec := PipelineSpec{
+		StreamID:   streamID,
+		Protocol:   options.Protocol,
+		IngestPort: port,
+		Passphrase: options.SRTPassphrase,
+		KeyLength:  options.SRTKeyLength,
+		SourceURL:  options.SourceURL,
+		HLSPath:    hlsPath,
+		LogFile:    logFile,
+		Mode:       options.Mode,
+		Renditions: options.Renditions,
+		LowLatency: options.LowLatency,
+		Packaging:  options.Packaging,
+		DVRWindow:  dvrWindow,
+		Record:     options.Record,
+		Progress:   progress,
+
+		Subtitles:      options.Captions != nil && len(options.Captions.Languages) > 0,
+		ClosedCaptions: options.Captions != nil && len(options.Captions.ClosedCaptions) > 0,
+
+		AdCues: adCues != nil,
+	}
+	if packager != nil {
+		spec.Output = packager
+	}
+	if rtmpGate != nil {
+		spec.RTMPSocket = rtmpSocketPath(streamID)
+	}
+	if adCues != nil && options.AdCues.SCTE35Passthrough {
+		spec.SCTE35 = adCues
+	}
+
+	pipeline, err := newPipeline(spec)
 	if err != nil {
+		closeGate()
+		ports.Release(streamID)
 		return StreamResponse{
-			Message: "Ошибка создания лог-файла",
+			Message: "Ошибка создания медиа-конвейера",
 			Error:   err.Error(),
 		}
 	}
-	defer logFileHandle.Close()
-
-	// ✅ ИСПРАВЛЕНО: Запускаем wrapper-скрипт и НЕ ЖДЕМ его завершения
-	cmd := exec.Command("bash", scriptPath)
-	cmd.Stdout = logFileHandle
-	cmd.Stderr = logFileHandle
 
-	log.Printf("Запуск wrapper-скрипта для перепаковки потока %s: %s", streamID, scriptPath)
+	log.Printf("Запуск медиа-конвейера (%s) для потока %s", serviceConfig.Pipeline, streamID)
 
-	// ✅ КЛЮЧЕВОЕ ИЗМЕНЕНИЕ: Запускаем в фоне и НЕ ждем завершения
-	err = cmd.Start()
-	if err != nil {
+	// Конвейер работает в фоне до вызова stopStream
+	if err := pipeline.Start(context.Background()); err != nil {
+		closeGate()
+		ports.Release(streamID)
 		return StreamResponse{
-			Message: "Ошибка запуска wrapper-скрипта",
+			Message: "Ошибка запуска медиа-конвейера",
 			Error:   err.Error(),
 		}
 	}
@@ -659,28 +1046,102 @@ func startStream(streamID string) StreamResponse {
 		Status:      "starting",
 		StartTime:   time.Now(),
 		StreamStart: nil,
-		Process:     cmd, // Сохраняем процесс для возможности остановки
+		Pipeline:    pipeline, // Сохраняем конвейер для возможности остановки
 		LogFile:     logFile,
+		LogSession:  logSession,
 		HLSPath:     hlsPath,
-		SRTPort:     port,
 		ServerIP:    serverIP,
+		Protocol:    options.Protocol,
+		RTMPApp:     options.RTMPApp,
+		RTMPKey:     options.RTMPKey,
+
+		SRTPassphrase: options.SRTPassphrase,
+		SRTKeyLength:  options.SRTKeyLength,
+		SourceURL:     options.SourceURL,
+		Mode:          options.Mode,
+		Preset:        options.Preset,
+		Renditions:    options.Renditions,
+		LowLatency:    options.LowLatency,
+		Packaging:     options.Packaging,
+		LLHLS:         packager,
+		Progress:      progress,
+
+		DVRWindowSeconds: options.DVRWindowSeconds,
+		DVR: DVRStats{
+			WindowSeconds:  options.DVRWindowSeconds,
+			DiskLimitBytes: serviceConfig.DVRMaxDiskBytes,
+		},
+		Record: options.Record,
+
+		InactivityTimeoutSeconds: inactivityTimeoutSeconds(options.InactivityTimeoutSeconds),
+
+		LogRotatedAt: time.Now(),
+
+		Forwarders: make(map[string]*Forwarder),
+		probeWake:  make(chan struct{}, 1),
+	}
+	stream.Captions = NewCaptionTracks(streamID, hlsPath, options.Captions, options.Mode, options.Renditions, stream.StartTime)
+	stream.AdCues = adCues
+	switch options.Protocol {
+	case ProtocolRTMP:
+		stream.RTMPPort = port
+		stream.rtmpGate = rtmpGate
+	case ProtocolPull:
+		stream.Upstream = &UpstreamState{
+			State:      UpstreamConnecting,
+			SourceURL:  redactSourceURL(options.SourceURL),
+			LastChange: time.Now(),
+		}
+	default:
+		stream.SRTPort = port
+	}
+	if options.Record {
+		stream.Recorder = NewRecorder(streamID, hlsPath, options.Renditions)
+	}
+
+	// При восстановлении из журнала сохраняем исходное время запуска
+	if rec, ok := manager.state.Get(streamID); ok && rec.DesiredState == DesiredRunning && !rec.StartTime.IsZero() {
+		stream.StartTime = rec.StartTime
 	}
 
 	manager.mutex.Lock()
 	manager.streams[streamID] = stream
 	manager.mutex.Unlock()
 
-	// ✅ ВАЖНО: Запускаем мониторинг в отдельной горутине, которая НЕ ждет завершения процесса
-	go func() {
-		// Запускаем HLS мониторинг
-		go monitorHLSActivity(streamID, hlsPath)
+	if err := manager.state.Put(StreamRecord{
+		StreamID:     streamID,
+		DesiredState: DesiredRunning,
+		SRTPort:      stream.SRTPort,
+		RTMPPort:     stream.RTMPPort,
+		HLSPath:      hlsPath,
+		LogFile:      logFile,
+		LogSession:   logSession,
+		StartTime:    stream.StartTime,
+		Options:      options,
+	}); err != nil {
+		log.Printf("⚠️ Не удалось записать журнал состояния для потока %s: %v", streamID, err)
+	}
 
-		log.Printf("🚀 Поток %s запущен с автоперезапуском, мониторинг активен", streamID)
+	// События, накопленные до регистрации потока, ждут в буфере канала
+	go watchPipelineEvents(streamID, pipeline)
 
-		// ✅ НЕ ВЫЗЫВАЕМ cmd.Wait() - wrapper работает бесконечно в фоне
-		// Если нужно дождаться завершения, это будет сделано в stopStream
+	// Запускаем HLS мониторинг
+	hlsWatcher.Watch(streamID, stream, hlsPath, time.Duration(stream.InactivityTimeoutSeconds)*time.Second)
+	go monitorDVRDisk(streamID, stream)
+	if stream.Recorder != nil {
+		go runRecorder(streamID, stream)
+	}
+	go runThumbnailer(streamID, stream)
+	go runMediaProber(streamID, stream)
+	syncForwarders(stream, options.Destinations)
 
-	}()
+	log.Printf("🚀 Поток %s запущен с автоперезапуском, мониторинг активен", streamID)
+
+	// srt_url сохраняется для клиентов, которые еще не читают ingest_url
+	srtURL := ""
+	if options.Protocol == ProtocolSRT {
+		srtURL = stream.IngestURL(serverIP, false)
+	}
 
 	return StreamResponse{
 		Message:  "Поток запущен",
@@ -690,10 +1151,14 @@ func startStream(streamID string) StreamResponse {
 			StreamID:  streamID,
 			Status:    "starting",
 			StartTime: stream.StartTime,
-			SRTPort:   port,
+			SRTPort:   stream.SRTPort,
+			RTMPPort:  stream.RTMPPort,
 			ServerIP:  serverIP,
-			SRTURL:    fmt.Sprintf("srt://%s:%d?streamid=%s", serverIP, port, streamID),
-			HLSURL:    fmt.Sprintf("http://%s:8081/hls/%s/playlist.m3u8", serverIP, streamID),
+			Protocol:  options.Protocol,
+			IngestURL: stream.IngestURL(serverIP, false),
+			SRTURL:    srtURL,
+			HLSURL:    fmt.Sprintf("http://%s:8081/hls/%s/%s", serverIP, streamID, stream.PlaylistName()),
+			Mode:      options.Mode,
 		},
 	}
 }
@@ -713,69 +1178,153 @@ func stopStream(streamID string) StreamResponse {
 	log.Printf("🛑 Начинаем остановку потока %s", streamID)
 	manager.mutex.Unlock()
 
-	// ✅ Создаем файл флага для остановки wrapper-скрипта
-	stopFlagFile := fmt.Sprintf("/tmp/stop_%s", streamID)
-	err := os.WriteFile(stopFlagFile, []byte("stop"), 0644)
-	if err != nil {
-		log.Printf("⚠️ Не удалось создать флаг остановки: %v", err)
+	// Фиксируем намерение до остановки процесса, чтобы сбой посреди stop не вернул поток
+	if err := manager.state.SetDesiredState(streamID, DesiredStopped); err != nil {
+		log.Printf("⚠️ Не удалось записать журнал состояния для потока %s: %v", streamID, err)
 	}
 
-	// ✅ Даем время wrapper-скрипту завершиться корректно
-	time.Sleep(2 * time.Second)
+	teardownStream(streamID, stream)
 
-	// ✅ Если процесс все еще работает, принудительно завершаем
-	if stream.Process != nil && stream.Process.ProcessState == nil {
-		log.Printf("🔄 Принудительное завершение процесса для потока %s", streamID)
+	// Уведомляем основное приложение
+	sendWebhook(func() { webhooks.StreamStatus(streamID, "stopped") })
 
-		// Отправляем SIGTERM
-		err = stream.Process.Process.Signal(os.Interrupt)
-		if err != nil {
-			log.Printf("⚠️ Ошибка отправки SIGTERM: %v", err)
+	return StreamResponse{
+		Message:  "Поток остановлен",
+		StreamID: streamID,
+		Status:   "stopped",
+	}
+}
+
+// restartStream перезапускает поток с новыми параметрами (например, после смены
+// пароля SRT). В отличие от stop и start основное приложение не получает статус
+// stopped: запоздавшее уведомление перезаписало бы статус уже перезапущенного потока.
+func restartStream(streamID string, options StreamOptions) StreamResponse {
+	manager.mutex.RLock()
+	stream, exists := manager.streams[streamID]
+	manager.mutex.RUnlock()
+
+	if exists {
+		log.Printf("🔄 Перезапуск потока %s", streamID)
+		teardownStream(streamID, stream)
+	}
+
+	response := startStream(streamID, options)
+	if response.Error != "" && exists {
+		// Поток не поднялся: после рестарта сервиса он не должен вернуться сам
+		if err := manager.state.SetDesiredState(streamID, DesiredStopped); err != nil {
+			log.Printf("⚠️ Не удалось записать журнал состояния для потока %s: %v", streamID, err)
 		}
+	}
+	return response
+}
 
-		// Ждем 5 секунд
-		done := make(chan error, 1)
-		go func() {
-			done <- stream.Process.Wait()
-		}()
+// deleteStream останавливает поток, если он запущен, и забывает его: запись журнала
+// удаляется, закрепленные за потоком порты возвращаются в общий пул
+func deleteStream(streamID string) StreamResponse {
+	manager.mutex.RLock()
+	_, running := manager.streams[streamID]
+	manager.mutex.RUnlock()
 
-		select {
-		case <-done:
-			log.Printf("✅ Процесс для потока %s завершен корректно", streamID)
-		case <-time.After(5 * time.Second):
-			log.Printf("⚠️ Принудительное завершение процесса для потока %s", streamID)
-			stream.Process.Process.Kill()
+	if running {
+		if response := stopStream(streamID); response.Error != "" {
+			return response
 		}
 	}
 
+	if err := manager.state.Delete(streamID); err != nil {
+		log.Printf("⚠️ Не удалось записать журнал состояния для потока %s: %v", streamID, err)
+		return StreamResponse{
+			Message:  "Не удалось удалить запись журнала",
+			StreamID: streamID,
+			Error:    err.Error(),
+		}
+	}
+	forgetStreamPorts(streamID)
+	log.Printf("🗑️ Поток %s удален из журнала состояния", streamID)
+
+	return StreamResponse{
+		Message:  "Поток удален",
+		StreamID: streamID,
+		Status:   "deleted",
+	}
+}
+
+// forgetStreamPorts снимает закрепление портов SRT и RTMP за потоком
+func forgetStreamPorts(streamID string) {
+	manager.ports.Forget(streamID)
+	manager.rtmpPorts.Forget(streamID)
+}
+
+// pruneStoppedStreams убирает из журнала давно остановленные потоки и освобождает их порты
+func pruneStoppedStreams() []string {
+	if serviceConfig.StateRetention <= 0 {
+		return nil
+	}
+	pruned, err := manager.state.PruneStopped(serviceConfig.StateRetention)
+	if err != nil {
+		log.Printf("⚠️ Не удалось записать журнал состояния после очистки: %v", err)
+	}
+	for _, streamID := range pruned {
+		forgetStreamPorts(streamID)
+	}
+	if len(pruned) > 0 {
+		log.Printf("🧹 Из журнала состояния удалены остановленные потоки: %s", strings.Join(pruned, ", "))
+	}
+	return pruned
+}
+
+// runStatePruning периодически чистит журнал от остановленных потоков
+func runStatePruning() {
+	if serviceConfig.StateRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pruneStoppedStreams()
+	}
+}
+
+// teardownStream останавливает процессы потока, закрывает запись и освобождает
+// его ресурсы. Журнал состояния не меняется: это делает вызывающий.
+func teardownStream(streamID string, stream *StreamInstance) {
+	// Ретрансляции останавливаются первыми: без HLS их ffmpeg ушли бы в перезапуски
+	stopForwarders(stream)
+	hlsWatcher.Unwatch(streamID)
+
+	// Остановка конвейера: для ffmpeg - SIGTERM, затем SIGKILL по таймауту
+	if stream.Pipeline != nil {
+		stream.Pipeline.Stop()
+		log.Printf("✅ Медиа-конвейер потока %s остановлен", streamID)
+	}
+	if stream.rtmpGate != nil {
+		stream.rtmpGate.Close()
+	}
+
+	// Сегменты сессии переносятся в архив до очистки HLS-каталога
+	if stream.Recorder != nil {
+		finishRecording(stream)
+	}
+
 	// ✅ Очищаем HLS файлы
 	if stream.HLSPath != "" {
 		log.Printf("🧹 Очистка HLS файлов для потока %s: %s", streamID, stream.HLSPath)
 		os.RemoveAll(stream.HLSPath)
 	}
 
-	// Удаляем wrapper-скрипт
-	scriptPath := filepath.Join("/tmp", fmt.Sprintf("ffmpeg_wrapper_%s.sh", streamID))
-	os.Remove(scriptPath)
-
-	// ✅ Удаляем флаг остановки
-	os.Remove(stopFlagFile)
-
 	// ✅ Удаляем поток из управления
 	manager.mutex.Lock()
 	delete(manager.streams, streamID)
 	manager.mutex.Unlock()
 
-	log.Printf("✅ Поток %s полностью остановлен и очищен", streamID)
+	// Лог завершенной сессии уходит в архив и остается доступным через API
+	archiveStreamLog(streamID, stream.LogSession)
 
-	// Уведомляем основное приложение
-	go notifyMainApp(streamID, "stopped")
+	// Возвращаем порт в пул; закрепление за потоком сохраняется
+	manager.portsFor(stream.Protocol).Release(streamID)
 
-	return StreamResponse{
-		Message:  "Поток остановлен",
-		StreamID: streamID,
-		Status:   "stopped",
-	}
+	log.Printf("✅ Поток %s полностью остановлен и очищен", streamID)
 }
 
 func handlePlaylistDebug(w http.ResponseWriter, r *http.Request) {
@@ -796,22 +1345,66 @@ func handlePlaylistDebug(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Читаем содержимое плейлиста
-	playlists := make(map[string]string)
-	playlistPath := filepath.Join(stream.HLSPath, "playlist.m3u8")
+	// Читаем содержимое плейлистов (master и варианты в режиме transcode)
+	playlistNames := []string{mediaPlaylistName}
+	segmentDirs := []string{""}
+	switch {
+	case stream.Packaging == PackagingCMAF:
+		playlistNames = []string{masterPlaylistName, dashManifestName}
+		if entries, err := os.ReadDir(stream.HLSPath); err == nil {
+			for _, entry := range entries {
+				if strings.HasPrefix(entry.Name(), "media_") && strings.HasSuffix(entry.Name(), ".m3u8") {
+					playlistNames = append(playlistNames, entry.Name())
+				}
+			}
+		}
+	case stream.Mode == ModeTranscode:
+		playlistNames = []string{masterPlaylistName}
+		segmentDirs = nil
+		for _, r := range stream.Renditions {
+			playlistNames = append(playlistNames, filepath.Join(r.Name, mediaPlaylistName))
+			segmentDirs = append(segmentDirs, r.Name)
+		}
+	}
 
-	if content, err := os.ReadFile(playlistPath); err == nil {
-		playlists["playlist.m3u8"] = string(content)
-	} else {
-		playlists["playlist.m3u8"] = fmt.Sprintf("Error reading file: %v", err)
+	// Плейлисты разбираются pkg/hls; к медиа-плейлистам добавляется анализ
+	// последнего обновления плейлистов. DASH-манифест отдается как есть.
+	manager.mutex.RLock()
+	health := stream.HLSHealth
+	manager.mutex.RUnlock()
+
+	playlists := make(map[string]interface{})
+	for _, name := range playlistNames {
+		path := filepath.Join(stream.HLSPath, name)
+		if !strings.HasSuffix(name, ".m3u8") {
+			if content, err := os.ReadFile(path); err == nil {
+				playlists[name] = map[string]interface{}{"content": string(content)}
+			} else {
+				playlists[name] = map[string]interface{}{"error": fmt.Sprintf("Error reading file: %v", err)}
+			}
+			continue
+		}
+
+		playlist, err := hls.ParseFile(path)
+		if err != nil {
+			playlists[name] = map[string]interface{}{"error": fmt.Sprintf("Error parsing playlist: %v", err)}
+			continue
+		}
+		entry := map[string]interface{}{"playlist": playlist}
+		if analysis, ok := health[name]; ok {
+			entry["analysis"] = analysis
+		}
+		playlists[name] = entry
 	}
 
 	// Список сегментов
 	var segments []string
-	if entries, err := os.ReadDir(stream.HLSPath); err == nil {
-		for _, entry := range entries {
-			if strings.HasSuffix(entry.Name(), ".ts") {
-				segments = append(segments, entry.Name())
+	for _, dir := range segmentDirs {
+		if entries, err := os.ReadDir(filepath.Join(stream.HLSPath, dir)); err == nil {
+			for _, entry := range entries {
+				if isSegmentFile(entry.Name()) {
+					segments = append(segments, filepath.Join(dir, entry.Name()))
+				}
 			}
 		}
 	}
@@ -819,7 +1412,8 @@ func handlePlaylistDebug(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"stream_id":   streamID,
 		"status":      stream.Status,
-		"mode":        "repack_only",
+		"mode":        stream.Mode,
+		"packaging":   stream.Packaging,
 		"playlists":   playlists,
 		"segments":    segments,
 		"hls_path":    stream.HLSPath,
@@ -857,8 +1451,8 @@ func getServerIP() string {
 	return localAddr.IP.String()
 }
 
-// ✅ ДОБАВИТЬ новую функцию webhook
-func notifyMainApp(streamID, status string) {
+// StreamStatus сообщает основному приложению новый статус потока
+func (mainAppWebhooks) StreamStatus(streamID, status string) {
 	mainAppURL := os.Getenv("MAIN_APP_URL")
 	if mainAppURL == "" {
 		mainAppURL = "http://go-app:8080"
@@ -912,34 +1506,37 @@ func notifyMainApp(streamID, status string) {
 	log.Printf("❌ All webhook attempts failed for %s -> %s", streamID, status)
 }
 
-// ✅ НОВАЯ ФУНКЦИЯ: Восстановление активных потоков
-func restoreActiveStreams() {
+// restoreActiveStreams восстанавливает потоки при старте.
+// Основной источник - локальный журнал состояния: потоки поднимаются сразу
+// и на тех же SRT портах. Основное приложение используется как вторичный
+// источник только для потоков, о которых журнал ничего не знает.
+func restoreActiveStreams(records []StreamRecord) {
 	log.Printf("🔄 Начинаем восстановление активных потоков...")
 
-	// Получаем список активных потоков из основного приложения
+	known := restoreJournaledStreams(records)
+
+	time.Sleep(5 * time.Second) // Ждем инициализации основного приложения
+
 	activeStreams, err := getActiveStreamsFromMainApp()
 	if err != nil {
 		log.Printf("❌ Ошибка получения активных потоков: %v", err)
 		return
 	}
 
-	if len(activeStreams) == 0 {
-		log.Printf("✅ Нет активных потоков для восстановления")
-		return
-	}
-
-	log.Printf("🔄 Найдено %d активных потоков для восстановления", len(activeStreams))
-
 	for _, stream := range activeStreams {
-		log.Printf("🔄 Восстановление потока: %s (статус: %s)", stream.StreamID, stream.StreamStatus)
+		if known[stream.StreamID] {
+			continue
+		}
 
-		// Запускаем поток заново
-		response := startStream(stream.StreamID)
-		if response.Error != "" {
-			log.Printf("❌ Ошибка восстановления потока %s: %s", stream.StreamID, response.Error)
-		} else {
-			log.Printf("✅ Поток %s успешно восстановлен", stream.StreamID)
+		log.Printf("🔄 Восстановление потока по данным основного приложения: %s (статус: %s)", stream.StreamID, stream.StreamStatus)
+
+		// Полные параметры запуска: с ретрансляциями, субтитрами, рекламными паузами и ABR-лестницей
+		options, err := fetchStreamOptions(stream.StreamID)
+		if err != nil {
+			log.Printf("❌ Не удалось получить параметры потока %s из основного приложения: %v", stream.StreamID, err)
+			continue
 		}
+		restoreStream(stream.StreamID, options)
 
 		// Небольшая задержка между запусками
 		time.Sleep(1 * time.Second)
@@ -948,6 +1545,104 @@ func restoreActiveStreams() {
 	log.Printf("✅ Восстановление потоков завершено")
 }
 
+// restoreJournaledStreams восстанавливает потоки из журнала и возвращает их StreamID.
+// Основное приложение для этого не нужно: ffmpeg, переживший рестарт, усыновляется
+// с секретами из своей командной строки, а новый запуск ждет секреты в фоне.
+func restoreJournaledStreams(records []StreamRecord) map[string]bool {
+	known := make(map[string]bool, len(records))
+	for _, rec := range records {
+		known[rec.StreamID] = true
+		if rec.DesiredState != DesiredRunning {
+			continue
+		}
+
+		// Сначала пытаемся подключиться к ffmpeg, пережившему рестарт сервиса
+		if adoptStream(rec) {
+			if rec.SecretsOmitted {
+				// URL точек ретрансляции есть только в основном приложении
+				go completeAdoptedStream(rec.StreamID)
+			}
+			continue
+		}
+
+		if !rec.SecretsOmitted {
+			log.Printf("🔄 Восстановление потока из журнала: %s (порт %d)", rec.StreamID, max(rec.SRTPort, rec.RTMPPort))
+			restoreStream(rec.StreamID, rec.Options)
+			continue
+		}
+		// Секретов в журнале нет: новый ffmpeg запустится, когда их отдаст основное приложение
+		go restoreWhenOptionsAvailable(rec)
+	}
+	return known
+}
+
+// restoreWhenOptionsAvailable запускает поток из журнала, как только основное
+// приложение отдаст его секреты. Порт остается закрепленным за потоком.
+func restoreWhenOptionsAvailable(rec StreamRecord) {
+	full, ok := waitStreamOptions(rec.StreamID, func() bool {
+		manager.mutex.RLock()
+		_, running := manager.streams[rec.StreamID]
+		manager.mutex.RUnlock()
+		current, ok := manager.state.Get(rec.StreamID)
+		return !running && ok && current.DesiredState == DesiredRunning
+	})
+	if !ok {
+		return
+	}
+	log.Printf("🔄 Восстановление потока из журнала: %s (порт %d)", rec.StreamID, max(rec.SRTPort, rec.RTMPPort))
+	restoreStream(rec.StreamID, withSecrets(rec.Options, full))
+}
+
+// completeAdoptedStream запускает ретрансляции усыновленного потока, когда
+// основное приложение отдаст URL точек ретрансляции
+func completeAdoptedStream(streamID string) {
+	manager.mutex.RLock()
+	stream := manager.streams[streamID]
+	manager.mutex.RUnlock()
+	if stream == nil {
+		return
+	}
+
+	full, ok := waitStreamOptions(streamID, func() bool {
+		manager.mutex.RLock()
+		defer manager.mutex.RUnlock()
+		return manager.streams[streamID] == stream
+	})
+	if ok {
+		syncForwarders(stream, full.Destinations)
+	}
+}
+
+// waitStreamOptions запрашивает параметры потока у основного приложения каждые
+// RestoreRetryInterval, пока запрос не удастся или needed не вернет false
+func waitStreamOptions(streamID string, needed func() bool) (StreamOptions, bool) {
+	for attempt := 1; needed(); attempt++ {
+		options, err := fetchStreamOptions(streamID)
+		if err == nil {
+			return options, true
+		}
+		if errors.Is(err, errNoAPIToken) {
+			log.Printf("❌ Параметры потока %s недоступны: %v", streamID, err)
+			return StreamOptions{}, false
+		}
+		if attempt == 1 {
+			log.Printf("⏳ Основное приложение не отдало параметры потока %s (%v), повтор каждые %s",
+				streamID, err, serviceConfig.RestoreRetryInterval)
+		}
+		time.Sleep(serviceConfig.RestoreRetryInterval)
+	}
+	return StreamOptions{}, false
+}
+
+func restoreStream(streamID string, options StreamOptions) {
+	response := startStream(streamID, options)
+	if response.Error != "" {
+		log.Printf("❌ Ошибка восстановления потока %s: %s", streamID, response.Error)
+	} else {
+		log.Printf("✅ Поток %s успешно восстановлен", streamID)
+	}
+}
+
 // ✅ НОВАЯ ФУНКЦИЯ: Получение активных потоков из основного приложения
 func getActiveStreamsFromMainApp() ([]StreamInfo, error) {
 	mainAppURL := os.Getenv("MAIN_APP_URL")
@@ -970,7 +1665,16 @@ func getActiveStreamsFromMainApp() ([]StreamInfo, error) {
 		client := &http.Client{Timeout: 10 * time.Second}
 
 		for attempt := 1; attempt <= maxRetries; attempt++ {
-			resp, err := client.Get(url)
+			req, err := http.NewRequest("GET", url, nil)
+			if err != nil {
+				break
+			}
+			// С токеном основное приложение возвращает пароли SRT и ключи RTMP для перезапуска
+			if serviceConfig.APIToken != "" {
+				req.Header.Set("Authorization", "Bearer "+serviceConfig.APIToken)
+			}
+
+			resp, err := client.Do(req)
 			if err != nil {
 				log.Printf("❌ Попытка %d/%d не удалась для %s: %v", attempt, maxRetries, url, err)
 				if attempt < maxRetries {
@@ -1008,3 +1712,63 @@ func getActiveStreamsFromMainApp() ([]StreamInfo, error) {
 
 	return allStreams, nil
 }
+
+// errNoAPIToken - без токена основное приложение секреты не отдаст, повторять бесполезно
+var errNoAPIToken = errors.New("API_TOKEN is not set")
+
+// fetchStreamOptions получает параметры запуска потока; подменяется в тестах
+var fetchStreamOptions = getStreamOptionsFromMainApp
+
+// getStreamOptionsFromMainApp получает полные параметры запуска потока вместе с секретами ingest.
+// Основное приложение отдает их только с токеном API.
+func getStreamOptionsFromMainApp(streamID string) (StreamOptions, error) {
+	mainAppURL := os.Getenv("MAIN_APP_URL")
+	if mainAppURL == "" {
+		mainAppURL = "http://go-app:8080"
+	}
+	if serviceConfig.APIToken == "" {
+		return StreamOptions{}, errNoAPIToken
+	}
+
+	url := fmt.Sprintf("%s/api/streams/%s/options", mainAppURL, streamID)
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var lastErr error
+	for attempt := 1; attempt <= 5; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * 2 * time.Second)
+		}
+
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return StreamOptions{}, err
+		}
+		req.Header.Set("Authorization", "Bearer "+serviceConfig.APIToken)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		var response struct {
+			Data  *StreamOptions `json:"data"`
+			Error string         `json:"error"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("main app returned %d", resp.StatusCode)
+			continue
+		case resp.StatusCode != http.StatusOK:
+			return StreamOptions{}, fmt.Errorf("main app returned %d: %s", resp.StatusCode, response.Error)
+		case err != nil:
+			return StreamOptions{}, err
+		case response.Data == nil:
+			return StreamOptions{}, fmt.Errorf("empty options in response")
+		}
+		return *response.Data, nil
+	}
+	return StreamOptions{}, lastErr
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMain настраивает сервис один раз на все тесты пакета: фоновые горутины
+// потоков читают serviceConfig и manager и после завершения теста
+func TestMain(m *testing.M) {
+	// Тестовый бинарник, запущенный супервизором вместо ffmpeg
+	if os.Getenv(fakeFFmpegEnv) != "" {
+		os.Exit(runFakeFFmpeg(os.Args[1:]))
+	}
+	os.Setenv(fakeFFmpegEnv, "1")
+
+	root, err := os.MkdirTemp("", "streaming-service-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Усыновление узнает ffmpeg по имени бинарника
+	ffmpegPath := filepath.Join(root, "bin", "ffmpeg")
+	if err := os.MkdirAll(filepath.Dir(ffmpegPath), 0o755); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Symlink(os.Args[0], ffmpegPath); err != nil {
+		log.Fatal(err)
+	}
+
+	serviceConfig = &ServiceConfig{
+		Pipeline:             "fake",
+		FFmpegPath:           ffmpegPath,
+		RestartPolicy:        RestartPolicy{Multiplier: 2, MaxBackoff: 4 * time.Second},
+		StopTimeout:          2 * time.Second,
+		PullReadTimeout:      time.Second,
+		HLSRoot:              filepath.Join(root, "hls"),
+		StateFile:            filepath.Join(root, "state", "streams.json"),
+		RunDir:               filepath.Join(root, "run"),
+		LogDir:               filepath.Join(root, "logs"),
+		RecordingsPath:       filepath.Join(root, "recordings"),
+		FakeSegmentDuration:  200 * time.Millisecond,
+		InactivityTimeout:    time.Second,
+		DVRDiskCheckInterval: time.Hour,
+		LogSessions:          1,
+		RestoreRetryInterval: 100 * time.Millisecond,
+	}
+	for _, dir := range []string{serviceConfig.HLSRoot, serviceConfig.RunDir, serviceConfig.LogDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ports, err := NewPortAllocator(20000, 20010)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rtmpPorts, err := NewRTMPPortAllocator(21000, 21010)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manager = &StreamManager{
+		streams:   make(map[string]*StreamInstance),
+		ports:     ports,
+		rtmpPorts: rtmpPorts,
+		state:     NewStateStore(serviceConfig.StateFile),
+		admitting: make(map[string]bool),
+	}
+	hlsWatcher = NewHLSWatcher()
+	fetchStreamOptions = mainAppOptions.fetch
+
+	code := m.Run()
+	os.RemoveAll(root)
+	os.Exit(code)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// PipelineSpec описывает, что должен сделать медиа-конвейер для одного потока
+type PipelineSpec struct {
+	StreamID   string
+	Protocol   string // srt, rtmp, pull
+	SourceURL  string // источник pull-потока
+	IngestPort int    // UDP-порт SRT или TCP-порт RTMP
+	RTMPSocket string // unix-сокет RTMPGate, из которого ffmpeg читает принятую публикацию
+	Passphrase string // пароль шифрования SRT; пустой - без шифрования
+	KeyLength  int    // pbkeylen SRT
+	HLSPath    string
+	LogFile    string
+	Mode       string        // repack_only, transcode
+	Renditions []Rendition   // ABR-лестница для transcode
+	Packaging  string        // ts, cmaf
+	DVRWindow  time.Duration // глубина перемотки; 0 - только живое окно
+	Record     bool          // не удалять сегменты: сессия сохраняется в VOD-архив
+	LowLatency bool          // LL-HLS: ffmpeg отдает MPEG-TS в Output, плейлист строит Go
+	Output     io.Writer
+	Progress   *ProgressTracker // метрики ingest из ffmpeg -progress; nil - без метрик
+
+	Subtitles      bool // WebVTT из API: по EXT-X-PROGRAM-DATE-TIME фразы привязываются к сегментам
+	ClosedCaptions bool // CEA-608/708 из ingest сохраняются при перекодировании
+
+	AdCues bool    // рекламные паузы: сегменты помечаются EXT-X-PROGRAM-DATE-TIME
+	SCTE35 *AdCues // получает секции SCTE-35 первого потока данных ingest; nil - не извлекать
+}
+
+// ProgramDateTime - сегментам нужен EXT-X-PROGRAM-DATE-TIME: по нему
+// к сегментам привязываются фразы субтитров и рекламные паузы
+func (s PipelineSpec) ProgramDateTime() bool {
+	return s.Subtitles || s.AdCues
+}
+
+// PipelineStatus - снимок состояния конвейера для API
+type PipelineStatus struct {
+	RestartCount int        `json:"restart_count"`
+	LastExitCode *int       `json:"last_exit_code,omitempty"`
+	LastExitTime *time.Time `json:"last_exit_time,omitempty"`
+	PID          int        `json:"pid,omitempty"`
+	GaveUp       bool       `json:"gave_up,omitempty"`
+}
+
+type PipelineEventType string
+
+const (
+	EventProcessStarted    PipelineEventType = "process_started"
+	EventProcessExited     PipelineEventType = "process_exited"
+	EventProcessRestarting PipelineEventType = "process_restarting"
+	EventPipelineFailed    PipelineEventType = "pipeline_failed" // перезапуски исчерпаны
+)
+
+// PipelineEvent - изменение состояния конвейера вместе с актуальным статусом
+type PipelineEvent struct {
+	Type     PipelineEventType
+	StreamID string
+	Time     time.Time
+	Status   PipelineStatus
+}
+
+// Pipeline принимает ingest потока и пишет HLS в PipelineSpec.HLSPath.
+// Канал Events закрывается после окончательной остановки конвейера.
+type Pipeline interface {
+	Start(ctx context.Context) error
+	Stop()
+	Status() PipelineStatus
+	Events() <-chan PipelineEvent
+}
+
+// pipelineEventBuffer - запас канала событий; при переполнении события
+// отбрасываются, актуальное состояние всегда доступно через Status()
+const pipelineEventBuffer = 64
+
+// newPipeline создает конвейер согласно PIPELINE (ffmpeg, fake)
+func newPipeline(spec PipelineSpec) (Pipeline, error) {
+	switch serviceConfig.Pipeline {
+	case "", "ffmpeg":
+		return NewFFmpegPipeline(spec), nil
+	case "fake":
+		return NewFakePipeline(spec, serviceConfig.FakeSegmentDuration), nil
+	default:
+		return nil, fmt.Errorf("unknown pipeline %q", serviceConfig.Pipeline)
+	}
+}
+
+func emitPipelineEvent(events chan PipelineEvent, event PipelineEvent) {
+	select {
+	case events <- event:
+	default:
+	}
+}
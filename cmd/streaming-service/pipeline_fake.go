@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakePipeline - конвейер без ffmpeg и SRT: по таймеру пишет синтетические
+// .ts сегменты и playlist.m3u8, чтобы прогонять жизненный цикл статусов
+// (starting -> running -> starting) в тестах и локальной разработке.
+// Pause имитирует отключение энкодера, Resume - его возвращение.
+// Для pull-потока с http(s)-источником перед каждым сегментом проверяется
+// доступность источника, поэтому переподключение можно проверить локальным HTTP-сервером.
+type FakePipeline struct {
+	spec            PipelineSpec
+	segmentDuration time.Duration
+	listSize        int
+	events          chan PipelineEvent
+
+	mu       sync.Mutex
+	status   PipelineStatus
+	paused   bool
+	offline  bool // источник pull-потока недоступен
+	closed   bool
+	sequence int
+	started  map[int]time.Time // время начала сегментов для EXT-X-PROGRAM-DATE-TIME
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewFakePipeline(spec PipelineSpec, segmentDuration time.Duration) *FakePipeline {
+	if segmentDuration <= 0 {
+		segmentDuration = time.Second
+	}
+	return &FakePipeline{
+		spec:            spec,
+		segmentDuration: segmentDuration,
+		listSize:        dvrListSize(spec.DVRWindow, segmentDuration),
+		events:          make(chan PipelineEvent, pipelineEventBuffer),
+		started:         make(map[int]time.Time),
+	}
+}
+
+func (p *FakePipeline) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done != nil {
+		return errors.New("pipeline already started")
+	}
+	for _, dir := range p.outputDirs() {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	if p.spec.Mode == ModeTranscode {
+		if err := p.writeMaster(); err != nil {
+			return err
+		}
+	}
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	go p.run(ctx)
+	return nil
+}
+
+func (p *FakePipeline) Stop() {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Pause прекращает выпуск сегментов, как при потере соединения с энкодером
+func (p *FakePipeline) Pause() {
+	p.mu.Lock()
+	p.paused = true
+	p.mu.Unlock()
+	p.emit(EventProcessExited, func(st *PipelineStatus) {
+		code, now := 1, time.Now()
+		st.LastExitCode = &code
+		st.LastExitTime = &now
+	})
+}
+
+// Resume возобновляет выпуск сегментов
+func (p *FakePipeline) Resume() {
+	p.mu.Lock()
+	p.paused = false
+	p.mu.Unlock()
+	p.emit(EventProcessRestarting, func(st *PipelineStatus) { st.RestartCount++ })
+}
+
+func (p *FakePipeline) Status() PipelineStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+func (p *FakePipeline) Events() <-chan PipelineEvent {
+	return p.events
+}
+
+func (p *FakePipeline) run(ctx context.Context) {
+	defer func() {
+		p.mu.Lock()
+		p.closed = true
+		close(p.events)
+		p.mu.Unlock()
+		close(p.done)
+	}()
+
+	p.emit(EventProcessStarted, func(*PipelineStatus) {})
+
+	ticker := time.NewTicker(p.segmentDuration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if p.spec.Protocol == ProtocolPull && !p.checkSource(ctx) {
+			continue
+		}
+
+		p.mu.Lock()
+		paused := p.paused
+		p.mu.Unlock()
+		if paused {
+			continue
+		}
+
+		if err := p.writeSegment(); err != nil {
+			p.appendLog("❌ Fake pipeline: ошибка записи сегмента: %v", err)
+		}
+		p.writeProgress()
+	}
+}
+
+// checkSource проверяет http(s)-источник pull-потока и выпускает события
+// отключения и переподключения, как это делал бы супервизор ffmpeg
+func (p *FakePipeline) checkSource(ctx context.Context) bool {
+	u, err := url.Parse(p.spec.SourceURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return true
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, p.segmentDuration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(probeCtx, "GET", p.spec.SourceURL, nil)
+	if err != nil {
+		return false
+	}
+	online := false
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+		online = resp.StatusCode < 400
+	}
+
+	p.mu.Lock()
+	changed := p.offline == online
+	p.offline = !online
+	p.mu.Unlock()
+
+	if changed && !online {
+		p.appendLog("⚠️ Fake pipeline: источник %s недоступен", redactSourceURL(p.spec.SourceURL))
+		p.emit(EventProcessExited, func(st *PipelineStatus) {
+			code, now := 1, time.Now()
+			st.LastExitCode = &code
+			st.LastExitTime = &now
+		})
+		p.emit(EventProcessRestarting, func(st *PipelineStatus) { st.RestartCount++ })
+	}
+	if changed && online {
+		p.emit(EventProcessStarted, func(*PipelineStatus) {})
+	}
+	return online
+}
+
+// outputDirs - каталоги с медиа-плейлистами: по одному на вариант в режиме transcode
+func (p *FakePipeline) outputDirs() []string {
+	if p.spec.Mode == ModeTranscode {
+		return renditionDirs(p.spec.HLSPath, p.spec.Renditions)
+	}
+	return []string{p.spec.HLSPath}
+}
+
+// writeMaster пишет master.m3u8 со ссылками на варианты лестницы
+func (p *FakePipeline) writeMaster() error {
+	var master strings.Builder
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range p.spec.Renditions {
+		bandwidth := (r.VideoBitrate + r.AudioBitrate) * 1000
+		if r.AudioOnly {
+			fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"mp4a.40.2\"\n", bandwidth)
+		} else {
+			fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n", bandwidth, r.Width, r.Height)
+		}
+		fmt.Fprintf(&master, "%s/%s\n", r.Name, mediaPlaylistName)
+	}
+	return os.WriteFile(filepath.Join(p.spec.HLSPath, masterPlaylistName), []byte(master.String()), 0o644)
+}
+
+// writeSegment пишет очередной сегмент во все выходные каталоги
+func (p *FakePipeline) writeSegment() error {
+	p.mu.Lock()
+	seq := p.sequence
+	p.sequence++
+	p.started[seq] = time.Now().Add(-p.segmentDuration)
+	delete(p.started, seq-p.listSize)
+	p.mu.Unlock()
+
+	for _, dir := range p.outputDirs() {
+		if err := p.writeSegmentTo(dir, seq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeProgress отдает блок в формате ffmpeg -progress (25 fps, битрейт - N/A, как у muxer hls)
+func (p *FakePipeline) writeProgress() {
+	if p.spec.Progress == nil {
+		return
+	}
+	p.mu.Lock()
+	outTime := time.Duration(p.sequence) * p.segmentDuration
+	p.mu.Unlock()
+
+	fmt.Fprintf(p.spec.Progress,
+		"frame=%d\nfps=25.00\nbitrate=N/A\ntotal_size=N/A\nout_time_us=%d\ndup_frames=0\ndrop_frames=0\nspeed=1.00x\nprogress=continue\n",
+		int64(outTime.Seconds()*25), outTime.Microseconds())
+}
+
+// writeSegmentTo пишет сегмент seq в dir и обновляет скользящий плейлист
+func (p *FakePipeline) writeSegmentTo(dir string, seq int) error {
+
+	// Пакетов MPEG-TS из одних sync byte достаточно для проверок по mtime и размеру;
+	// первый пакет начинает видео PES с PTS, по нему выравниваются субтитры
+	packet := make([]byte, 188)
+	packet[0] = 0x47
+	segment := make([]byte, 0, 188*16)
+	segment = append(segment, fakePESPacket(uint64(p.segmentDuration.Seconds()*90000)*uint64(seq))...)
+	for i := 1; i < 16; i++ {
+		segment = append(segment, packet...)
+	}
+
+	name := fmt.Sprintf("segment_%03d.ts", seq)
+	if err := os.WriteFile(filepath.Join(dir, name), segment, 0o644); err != nil {
+		return err
+	}
+
+	first := seq - p.listSize + 1
+	if first < 0 {
+		first = 0
+	}
+	if stale := first - 1; stale >= 0 && !p.spec.Record {
+		os.Remove(filepath.Join(dir, fmt.Sprintf("segment_%03d.ts", stale)))
+	}
+
+	var playlist strings.Builder
+	target := int(p.segmentDuration.Round(time.Second) / time.Second)
+	if target < 1 {
+		target = 1
+	}
+	fmt.Fprintf(&playlist, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:%d\n", target, first)
+	for i := first; i <= seq; i++ {
+		p.mu.Lock()
+		started, known := p.started[i]
+		p.mu.Unlock()
+		if p.spec.ProgramDateTime() && known {
+			fmt.Fprintf(&playlist, "#EXT-X-PROGRAM-DATE-TIME:%s\n", started.UTC().Format("2006-01-02T15:04:05.000Z"))
+		}
+		fmt.Fprintf(&playlist, "#EXTINF:%.3f,\nsegment_%03d.ts\n", p.segmentDuration.Seconds(), i)
+	}
+
+	playlistPath := filepath.Join(dir, mediaPlaylistName)
+	tmpPath := playlistPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(playlist.String()), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, playlistPath)
+}
+
+func (p *FakePipeline) emit(eventType PipelineEventType, fn func(*PipelineStatus)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fn(&p.status)
+	if p.closed {
+		return
+	}
+	emitPipelineEvent(p.events, PipelineEvent{
+		Type:     eventType,
+		StreamID: p.spec.StreamID,
+		Time:     time.Now(),
+		Status:   p.status,
+	})
+}
+
+func (p *FakePipeline) appendLog(format string, args ...interface{}) {
+	if p.spec.LogFile == "" {
+		return
+	}
+	f, err := os.OpenFile(p.spec.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s: %s\n", time.Now().Format(time.RFC1123), fmt.Sprintf(format, args...))
+}
+
+// fakePESPacket - пакет MPEG-TS (PID 0x100) с началом видео PES и заданным PTS
+func fakePESPacket(pts uint64) []byte {
+	packet := make([]byte, 188)
+	copy(packet, []byte{0x47, 0x41, 0x00, 0x10, 0x00, 0x00, 0x01, 0xE0, 0x00, 0x00, 0x80, 0x80, 0x05})
+	packet[13] = 0x21 | byte(pts>>29)&0x0E
+	packet[14] = byte(pts >> 22)
+	packet[15] = byte(pts>>14) | 0x01
+	packet[16] = byte(pts >> 7)
+	packet[17] = byte(pts<<1) | 0x01
+	for i := 18; i < len(packet); i++ {
+		packet[i] = 0xFF
+	}
+	return packet
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FFmpegPipeline - перепаковка SRT в HLS через ffmpeg под управлением Supervisor
+type FFmpegPipeline struct {
+	spec   PipelineSpec
+	events chan PipelineEvent
+
+	mu         sync.Mutex
+	supervisor *Supervisor
+}
+
+func NewFFmpegPipeline(spec PipelineSpec) *FFmpegPipeline {
+	return &FFmpegPipeline{
+		spec:   spec,
+		events: make(chan PipelineEvent, pipelineEventBuffer),
+	}
+}
+
+// Start запускает ffmpeg с новым (обрезанным) лог-файлом
+// Лог открывается с O_APPEND: лог прошлой сессии уже перенесен в архив
+// (startLogSession), а ротация обрезает файл под работающим ffmpeg
+func (p *FFmpegPipeline) Start(ctx context.Context) error {
+	return p.start(ctx, 0)
+}
+
+// Adopt подключается к уже работающему ffmpeg, продолжая его лог
+func (p *FFmpegPipeline) Adopt(ctx context.Context, pid int) error {
+	return p.start(ctx, pid)
+}
+
+func (p *FFmpegPipeline) start(ctx context.Context, adoptPID int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.supervisor != nil {
+		return errors.New("pipeline already started")
+	}
+
+	// ffmpeg не создает каталоги вариантов сам (в CMAF все варианты в одном каталоге)
+	if p.spec.Packaging != PackagingCMAF {
+		for _, dir := range renditionDirs(p.spec.HLSPath, p.spec.Renditions) {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+		}
+	}
+
+	logFileHandle, err := os.OpenFile(p.spec.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	supervisor := NewSupervisor(p.spec.StreamID, serviceConfig.FFmpegPath, ffmpegArgs(p.spec),
+		logFileHandle, serviceConfig.RestartPolicy, serviceConfig.StopTimeout)
+	supervisor.PIDFile = pidFilePath(p.spec.StreamID)
+	if p.spec.LowLatency {
+		supervisor.Stdout = p.spec.Output
+	}
+	if p.spec.Progress != nil {
+		supervisor.Progress = p.spec.Progress
+	}
+	if p.spec.SCTE35 != nil {
+		supervisor.SCTE35 = p.spec.SCTE35
+	}
+	supervisor.OnEvent = func(event PipelineEvent) {
+		emitPipelineEvent(p.events, event)
+	}
+
+	if adoptPID > 0 {
+		err = supervisor.Adopt(ctx, adoptPID)
+	} else {
+		err = supervisor.Start(ctx)
+	}
+	if err != nil {
+		logFileHandle.Close()
+		return err
+	}
+	p.supervisor = supervisor
+
+	go func() {
+		<-supervisor.Done()
+		logFileHandle.Close()
+		close(p.events)
+	}()
+	return nil
+}
+
+func (p *FFmpegPipeline) Stop() {
+	p.mu.Lock()
+	supervisor := p.supervisor
+	p.mu.Unlock()
+
+	if supervisor != nil {
+		supervisor.Stop()
+	}
+}
+
+func (p *FFmpegPipeline) Status() PipelineStatus {
+	p.mu.Lock()
+	supervisor := p.supervisor
+	p.mu.Unlock()
+
+	if supervisor == nil {
+		return PipelineStatus{}
+	}
+	return supervisor.State()
+}
+
+func (p *FFmpegPipeline) Events() <-chan PipelineEvent {
+	return p.events
+}
+
+// ffmpegArgs формирует аргументы ffmpeg для приема SRT или RTMP и вывода в HLS:
+// перепаковка без перекодирования или ABR-лестница с master.m3u8,
+// в MPEG-TS или в CMAF с дополнительным DASH-манифестом
+func ffmpegArgs(spec PipelineSpec) []string {
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "warning",
+	}
+	if spec.Progress != nil {
+		args = append(args, "-progress", fmt.Sprintf("pipe:%d", progressFD))
+	}
+	args = append(args, ingestInputArgs(spec)...)
+
+	if spec.Mode == ModeTranscode {
+		encodeArgs, varStreamMap := transcodeArgs(spec.Renditions)
+		args = append(args, encodeArgs...)
+		if spec.ClosedCaptions {
+			// libx264 переносит CEA-608/708 из SEI исходника в каждую ступень
+			args = append(args, "-a53cc", "1")
+		}
+		if spec.Packaging == PackagingCMAF {
+			return append(args, cmafOutputArgs(spec)...)
+		}
+		args = append(args,
+			"-f", "hls",
+			"-hls_time", fmt.Sprint(hlsSegmentSeconds),
+			"-hls_list_size", fmt.Sprint(dvrListSize(spec.DVRWindow, hlsSegmentSeconds*time.Second)),
+			"-hls_delete_threshold", "1",
+			"-hls_flags", hlsFlags(spec, "independent_segments+omit_endlist"),
+			"-hls_start_number_source", hlsStartNumberSource(spec),
+			"-hls_segment_type", "mpegts",
+			"-master_pl_name", masterPlaylistName,
+			"-var_stream_map", varStreamMap,
+			"-hls_segment_filename", filepath.Join(spec.HLSPath, "%v", "segment_%03d.ts"),
+			filepath.Join(spec.HLSPath, "%v", mediaPlaylistName),
+		)
+		return append(args, scte35OutputArgs(spec)...)
+	}
+
+	if spec.LowLatency {
+		// Частичные сегменты режет LLHLSPackager, ffmpeg только перепаковывает в stdout
+		return append(args,
+			"-c:v", "copy",
+			"-c:a", "copy",
+			"-avoid_negative_ts", "make_zero",
+			"-copyts",
+			"-start_at_zero",
+			"-flush_packets", "1",
+			"-f", "mpegts",
+			"pipe:1",
+		)
+	}
+
+	if spec.Packaging == PackagingCMAF {
+		args = append(args,
+			"-c:v", "copy",
+			"-c:a", "copy",
+			"-avoid_negative_ts", "make_zero",
+		)
+		return append(args, cmafOutputArgs(spec)...)
+	}
+
+	args = append(args,
+		"-c:v", "copy",
+		"-c:a", "copy",
+		"-avoid_negative_ts", "make_zero",
+		"-copyts",
+		"-start_at_zero",
+		"-f", "hls",
+		"-hls_time", fmt.Sprint(hlsSegmentSeconds),
+		"-hls_list_size", fmt.Sprint(dvrListSize(spec.DVRWindow, hlsSegmentSeconds*time.Second)),
+		"-hls_delete_threshold", "1",
+		"-hls_flags", hlsFlags(spec, "append_list+omit_endlist"),
+		"-hls_start_number_source", hlsStartNumberSource(spec),
+		"-hls_segment_type", "mpegts",
+		"-hls_segment_filename", filepath.Join(spec.HLSPath, "segment_%03d.ts"),
+		filepath.Join(spec.HLSPath, mediaPlaylistName),
+	)
+	return append(args, scte35OutputArgs(spec)...)
+}
+
+// scte35OutputArgs - второй выход ffmpeg: пакеты первого потока данных ingest
+// (секции SCTE-35) без изменений в дескриптор scte35FD. Без потока данных
+// в источнике ffmpeg не запустится, поэтому выход добавляется только по опции потока.
+func scte35OutputArgs(spec PipelineSpec) []string {
+	if spec.SCTE35 == nil {
+		return nil
+	}
+	return []string{
+		"-map", "0:d:0",
+		"-c", "copy",
+		"-f", "data",
+		fmt.Sprintf("pipe:%d", scte35FD),
+	}
+}
+
+// hlsFlags - при записи сегменты за пределами окна не удаляются: их заберет Recorder.
+// Для субтитров и рекламных пауз сегменты помечаются временем начала (EXT-X-PROGRAM-DATE-TIME).
+func hlsFlags(spec PipelineSpec, flags string) string {
+	if spec.ProgramDateTime() {
+		flags += "+program_date_time"
+	}
+	if spec.Record {
+		return flags
+	}
+	return "delete_segments+" + flags
+}
+
+// hlsStartNumberSource - при записи номера сегментов начинаются с unix-времени,
+// чтобы перезапуск ffmpeg не перезаписал уже записанные сегменты сессии
+func hlsStartNumberSource(spec PipelineSpec) string {
+	if spec.Record {
+		return "epoch"
+	}
+	return "generic"
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+var ErrPortsExhausted = errors.New("ingest port pool exhausted")
+
+// PortAllocator выдает порты ingest (UDP для SRT, TCP для RTMP) из фиксированного диапазона.
+// Освобожденные порты возвращаются в free list, а за потоком закрепляется
+// последний выданный порт (sticky), чтобы после перезапуска энкодер не перенастраивать.
+type PortAllocator struct {
+	mu       sync.Mutex
+	min, max int
+	free     []int          // свободные порты в порядке освобождения
+	inUse    map[int]string // порт -> streamID
+	sticky   map[string]int // streamID -> последний выданный порт
+	failures int            // сколько раз пул оказался исчерпан
+
+	// probe проверяет, что порт можно занять; подменяется при необходимости
+	probe func(port int) bool
+}
+
+// PortPoolStats - состояние пула для health endpoint
+type PortPoolStats struct {
+	RangeMin        int  `json:"range_min"`
+	RangeMax        int  `json:"range_max"`
+	Total           int  `json:"total"`
+	InUse           int  `json:"in_use"`
+	Free            int  `json:"free"`
+	Sticky          int  `json:"sticky"`
+	Exhausted       bool `json:"exhausted"`
+	ExhaustedEvents int  `json:"exhausted_events"`
+}
+
+func NewPortAllocator(min, max int) (*PortAllocator, error) {
+	if min <= 0 || max > 65535 || min > max {
+		return nil, fmt.Errorf("invalid port range %d-%d", min, max)
+	}
+
+	free := make([]int, 0, max-min+1)
+	for port := min; port <= max; port++ {
+		free = append(free, port)
+	}
+
+	return &PortAllocator{
+		min:    min,
+		max:    max,
+		free:   free,
+		inUse:  make(map[int]string),
+		sticky: make(map[string]int),
+		probe:  isUDPPortBindable,
+	}, nil
+}
+
+// Allocate выдает порт потоку. Закрепленный за потоком порт имеет приоритет,
+// затем берутся свободные порты, не закрепленные за другими потоками,
+// и только в последнюю очередь - чужие закрепленные.
+func (a *PortAllocator) Allocate(streamID string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for port, owner := range a.inUse {
+		if owner == streamID {
+			return port, nil
+		}
+	}
+
+	if port, ok := a.sticky[streamID]; ok {
+		if idx := a.freeIndex(port); idx >= 0 && a.probe(port) {
+			a.take(idx, streamID)
+			return port, nil
+		}
+	}
+
+	reserved := make(map[int]bool, len(a.sticky))
+	for owner, port := range a.sticky {
+		if owner != streamID {
+			reserved[port] = true
+		}
+	}
+
+	for _, allowReserved := range []bool{false, true} {
+		for idx := 0; idx < len(a.free); idx++ {
+			port := a.free[idx]
+			if reserved[port] && !allowReserved {
+				continue
+			}
+			if !a.probe(port) {
+				continue
+			}
+			if reserved[port] {
+				a.dropStickyPort(port)
+			}
+			a.take(idx, streamID)
+			return port, nil
+		}
+	}
+
+	a.failures++
+	return 0, ErrPortsExhausted
+}
+
+// Reserve занимает конкретный порт за потоком (восстановление состояния)
+func (a *PortAllocator) Reserve(streamID string, port int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if owner, ok := a.inUse[port]; ok {
+		if owner == streamID {
+			return nil
+		}
+		return fmt.Errorf("port %d already used by stream %s", port, owner)
+	}
+
+	idx := a.freeIndex(port)
+	if idx < 0 {
+		return fmt.Errorf("port %d is outside of range %d-%d", port, a.min, a.max)
+	}
+	a.take(idx, streamID)
+	return nil
+}
+
+// Remember закрепляет порт за потоком без его занятия (восстановление из журнала)
+func (a *PortAllocator) Remember(streamID string, port int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if port < a.min || port > a.max {
+		return
+	}
+	a.dropStickyPort(port)
+	a.sticky[streamID] = port
+}
+
+// Release возвращает порт потока в пул. Закрепление порта за потоком сохраняется.
+// Для потоков без порта (pull) пул равен nil, и вызов ничего не делает.
+func (a *PortAllocator) Release(streamID string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for port, owner := range a.inUse {
+		if owner == streamID {
+			delete(a.inUse, port)
+			a.free = append(a.free, port)
+			return
+		}
+	}
+}
+
+// Forget снимает закрепление порта за потоком (поток удален или забыт журналом).
+// Занятый порт остается за потоком до Release.
+func (a *PortAllocator) Forget(streamID string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sticky, streamID)
+}
+
+// Stats возвращает текущее состояние пула
+func (a *PortAllocator) Stats() PortPoolStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return PortPoolStats{
+		RangeMin:        a.min,
+		RangeMax:        a.max,
+		Total:           a.max - a.min + 1,
+		InUse:           len(a.inUse),
+		Free:            len(a.free),
+		Sticky:          len(a.sticky),
+		Exhausted:       len(a.free) == 0,
+		ExhaustedEvents: a.failures,
+	}
+}
+
+func (a *PortAllocator) freeIndex(port int) int {
+	for idx, p := range a.free {
+		if p == port {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (a *PortAllocator) take(idx int, streamID string) {
+	port := a.free[idx]
+	a.free = append(a.free[:idx], a.free[idx+1:]...)
+	a.inUse[port] = streamID
+	a.sticky[streamID] = port
+}
+
+func (a *PortAllocator) dropStickyPort(port int) {
+	for owner, p := range a.sticky {
+		if p == port {
+			delete(a.sticky, owner)
+		}
+	}
+}
+
+// isUDPPortBindable проверяет, что UDP-порт не занят другим процессом
+func isUDPPortBindable(port int) bool {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
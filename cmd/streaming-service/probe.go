@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MediaInfo - параметры входящего потока по данным ffprobe.
+// В режиме transcode исходник после перекодирования недоступен,
+// поэтому параметры описывают старшую ступень лестницы.
+type MediaInfo struct {
+	VideoCodec    string    `json:"video_codec,omitempty"`
+	Width         int       `json:"width,omitempty"`
+	Height        int       `json:"height,omitempty"`
+	FPS           float64   `json:"fps,omitempty"`
+	AudioCodec    string    `json:"audio_codec,omitempty"`
+	SampleRate    int       `json:"sample_rate,omitempty"`
+	AudioChannels int       `json:"audio_channels,omitempty"`
+	ProbedAt      time.Time `json:"probed_at"`
+}
+
+// SameAs сравнивает параметры без времени проверки
+func (m MediaInfo) SameAs(other MediaInfo) bool {
+	m.ProbedAt, other.ProbedAt = time.Time{}, time.Time{}
+	return m == other
+}
+
+func (m MediaInfo) String() string {
+	parts := []string{}
+	if m.VideoCodec != "" {
+		parts = append(parts, fmt.Sprintf("%s %dx%d@%g", m.VideoCodec, m.Width, m.Height, m.FPS))
+	}
+	if m.AudioCodec != "" {
+		parts = append(parts, fmt.Sprintf("%s %d Гц, %d кан.", m.AudioCodec, m.SampleRate, m.AudioChannels))
+	}
+	if len(parts) == 0 {
+		return "нет видео и аудио"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fakeMediaInfo - параметры синтетических сегментов fake-конвейера
+func fakeMediaInfo(now time.Time) MediaInfo {
+	return MediaInfo{
+		VideoCodec:    "h264",
+		Width:         1920,
+		Height:        1080,
+		FPS:           30,
+		AudioCodec:    "aac",
+		SampleRate:    48000,
+		AudioChannels: 2,
+		ProbedAt:      now,
+	}
+}
+
+// probeSources - сегменты, по которым ffprobe определяет параметры потока.
+// fMP4-фрагменты читаются вместе с init-сегментом своего представления.
+func probeSources(stream *StreamInstance) ([]string, error) {
+	switch {
+	case stream.Packaging == PackagingCMAF:
+		inits, _ := filepath.Glob(filepath.Join(stream.HLSPath, "init_*.m4s"))
+		sort.Strings(inits)
+		sources := []string{}
+		for _, initSegment := range inits {
+			id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(initSegment), "init_"), ".m4s")
+			chunks, _ := filepath.Glob(filepath.Join(stream.HLSPath, "chunk_"+id+"_*.m4s"))
+			if len(chunks) == 0 {
+				continue
+			}
+			sort.Strings(chunks)
+			sources = append(sources, "concat:"+initSegment+"|"+chunks[len(chunks)-1])
+		}
+		return sources, nil
+
+	case stream.Mode == ModeTranscode:
+		for _, r := range stream.Renditions {
+			if !r.AudioOnly {
+				path, _, err := newestSegmentFile(filepath.Join(stream.HLSPath, r.Name))
+				if path == "" {
+					return nil, err
+				}
+				return []string{path}, err
+			}
+		}
+		return nil, fmt.Errorf("no video renditions")
+	}
+
+	path, _, err := newestSegmentFile(stream.HLSPath)
+	if path == "" {
+		return nil, err
+	}
+	return []string{path}, nil
+}
+
+// ffprobeStream - поля потока из ffprobe -show_streams
+type ffprobeStream struct {
+	CodecType    string `json:"codec_type"`
+	CodecName    string `json:"codec_name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	AvgFrameRate string `json:"avg_frame_rate"`
+	RFrameRate   string `json:"r_frame_rate"`
+	SampleRate   string `json:"sample_rate"`
+	Channels     int    `json:"channels"`
+}
+
+// probeMedia запускает ffprobe по каждому источнику и берет первые
+// видео- и аудиодорожку
+func probeMedia(ctx context.Context, sources []string) (MediaInfo, error) {
+	info := MediaInfo{ProbedAt: time.Now()}
+	for _, source := range sources {
+		streams, err := runFFprobe(ctx, source)
+		if err != nil {
+			return MediaInfo{}, err
+		}
+		for _, s := range streams {
+			switch {
+			case s.CodecType == "video" && info.VideoCodec == "":
+				info.VideoCodec = s.CodecName
+				info.Width, info.Height = s.Width, s.Height
+				info.FPS = parseFrameRate(s.AvgFrameRate)
+				if info.FPS == 0 {
+					info.FPS = parseFrameRate(s.RFrameRate)
+				}
+			case s.CodecType == "audio" && info.AudioCodec == "":
+				info.AudioCodec = s.CodecName
+				info.SampleRate, _ = strconv.Atoi(s.SampleRate)
+				info.AudioChannels = s.Channels
+			}
+		}
+	}
+	if info.VideoCodec == "" && info.AudioCodec == "" {
+		return MediaInfo{}, fmt.Errorf("no audio or video streams found")
+	}
+	return info, nil
+}
+
+func runFFprobe(ctx context.Context, source string) ([]ffprobeStream, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, serviceConfig.FFprobePath,
+		"-hide_banner",
+		"-loglevel", "error",
+		"-show_entries", "stream=codec_type,codec_name,width,height,avg_frame_rate,r_frame_rate,sample_rate,channels",
+		"-of", "json",
+		source,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var result struct {
+		Streams []ffprobeStream `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %v", err)
+	}
+	return result.Streams, nil
+}
+
+// parseFrameRate разбирает частоту кадров ffprobe вида 30000/1001
+func parseFrameRate(value string) float64 {
+	num, den, found := strings.Cut(value, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if found {
+		d, err := strconv.ParseFloat(den, 64)
+		if err != nil || d == 0 {
+			return 0
+		}
+		n /= d
+	}
+	return math.Round(n*100) / 100
+}
+
+// requestMediaProbe будит пробник потока вне расписания; вызывается под manager.mutex
+func requestMediaProbe(stream *StreamInstance) {
+	if stream.probeWake == nil {
+		return
+	}
+	select {
+	case stream.probeWake <- struct{}{}:
+	default:
+	}
+}
+
+// runMediaProber определяет параметры потока при переходе в running
+// и перепроверяет их каждые PROBE_INTERVAL; основное приложение
+// уведомляется только при изменении параметров
+func runMediaProber(streamID string, instance *StreamInstance) {
+	if serviceConfig.ProbeInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(serviceConfig.ProbeInterval)
+	defer ticker.Stop()
+
+	lastError := ""
+	for {
+		select {
+		case <-ticker.C:
+		case <-instance.probeWake:
+		}
+
+		manager.mutex.RLock()
+		stream, exists := manager.streams[streamID]
+		running := exists && stream == instance && stream.Status == "running"
+		manager.mutex.RUnlock()
+
+		if !exists || stream != instance {
+			return
+		}
+		if !running {
+			continue
+		}
+
+		var info MediaInfo
+		var err error
+		if serviceConfig.Pipeline == "fake" {
+			info = fakeMediaInfo(time.Now())
+		} else {
+			var sources []string
+			sources, err = probeSources(instance)
+			if err == nil && len(sources) == 0 {
+				continue
+			}
+			if err == nil {
+				info, err = probeMedia(context.Background(), sources)
+			}
+		}
+		if err != nil {
+			if err.Error() != lastError {
+				log.Printf("⚠️ Не удалось определить параметры потока %s: %v", streamID, err)
+				lastError = err.Error()
+			}
+			continue
+		}
+		lastError = ""
+
+		manager.mutex.Lock()
+		if manager.streams[streamID] != instance {
+			manager.mutex.Unlock()
+			return
+		}
+		changed := instance.Media == nil || !instance.Media.SameAs(info)
+		instance.Media = &info
+		manager.mutex.Unlock()
+
+		if changed {
+			log.Printf("🎞️ Параметры потока %s: %s", streamID, info)
+			sendWebhook(func() { webhooks.StreamMedia(streamID, info) })
+		}
+	}
+}
+
+// MediaUpdateRequest - уведомление основного приложения о параметрах потока
+type MediaUpdateRequest struct {
+	StreamID string    `json:"stream_id"`
+	Media    MediaInfo `json:"media"`
+}
+
+// StreamMedia сохраняет параметры потока в основном приложении
+func (mainAppWebhooks) StreamMedia(streamID string, info MediaInfo) {
+	mainAppURL := os.Getenv("MAIN_APP_URL")
+	if mainAppURL == "" {
+		mainAppURL = "http://go-app:8080"
+	}
+
+	jsonData, err := json.Marshal(MediaUpdateRequest{StreamID: streamID, Media: info})
+	if err != nil {
+		log.Printf("❌ Failed to marshal media data: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	maxRetries := 3
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		resp, err := client.Post(mainAppURL+"/api/internal/stream-media", "application/json", bytes.NewBuffer(jsonData))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		log.Printf("❌ Media webhook attempt %d failed: %v", attempt, err)
+		if attempt < maxRetries {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+	}
+}
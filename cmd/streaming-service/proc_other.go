@@ -0,0 +1,29 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func detachedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func processAlive(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
+
+func terminateProcess(pid int, timeout time.Duration) {
+	if proc, err := os.FindProcess(pid); err == nil {
+		proc.Kill()
+	}
+}
+
+// diskFreeBytes не поддерживается: проверка свободного места пропускается
+func diskFreeBytes(path string) (int64, bool) {
+	return 0, false
+}
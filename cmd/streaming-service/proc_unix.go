@@ -0,0 +1,49 @@
+//go:build unix
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// detachedProcAttr запускает ffmpeg в собственной группе процессов,
+// чтобы сигналы группе сервиса не завершали ingest
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// processAlive проверяет, что процесс существует. Если процесс был переподчинен
+// нам (сервис работает как PID 1 в контейнере) и уже завершился, он собирается через wait4.
+func processAlive(pid int) bool {
+	var status syscall.WaitStatus
+	if reaped, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err == nil && reaped == pid {
+		return false
+	}
+	return syscall.Kill(pid, 0) == nil
+}
+
+// terminateProcess отправляет SIGTERM и через timeout - SIGKILL
+func terminateProcess(pid int, timeout time.Duration) {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// diskFreeBytes возвращает место, доступное сервису на файловой системе path
+func diskFreeBytes(path string) (int64, bool) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, false
+	}
+	return int64(fs.Bavail) * int64(fs.Bsize), true
+}
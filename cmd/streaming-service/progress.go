@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"my-go-app/pkg/hls"
+)
+
+// progressFD - номер дескриптора, в который ffmpeg пишет -progress.
+// stdout занят MPEG-TS в режиме LL-HLS, поэтому используется отдельный pipe (ExtraFiles[0]).
+const progressFD = 3
+
+// progressStaleAfter - без новых блоков дольше этого метрики считаются устаревшими
+const progressStaleAfter = 5 * time.Second
+
+// ProgressSample - один блок машиночитаемого вывода ffmpeg -progress
+type ProgressSample struct {
+	Time           time.Time `json:"time"`
+	Frame          int64     `json:"frame"`
+	FPS            float64   `json:"fps"`
+	BitrateKbps    float64   `json:"bitrate_kbps"`
+	TotalSize      int64     `json:"total_size,omitempty"`
+	OutTimeSeconds float64   `json:"out_time_seconds"`
+	DupFrames      int64     `json:"dup_frames"`
+	DropFrames     int64     `json:"drop_frames"`
+	Speed          float64   `json:"speed"`
+}
+
+// IngestStats - последние метрики ingest и короткая история для API
+type IngestStats struct {
+	Latest    *ProgressSample  `json:"latest,omitempty"`
+	History   []ProgressSample `json:"history,omitempty"`
+	Stale     bool             `json:"stale"`
+	UpdatedAt *time.Time       `json:"updated_at,omitempty"`
+}
+
+// ProgressTracker разбирает вывод ffmpeg -progress (блоки key=value,
+// завершающиеся строкой progress=continue|end) и хранит последние
+// STATS_HISTORY блоков. Реализует io.Writer для Supervisor.Progress.
+type ProgressTracker struct {
+	historySize int
+	// fallbackBitrate оценивает битрейт по сегментам, когда ffmpeg его не знает
+	// (muxer hls не пишет в общий выходной файл, и ffmpeg отдает bitrate=N/A)
+	fallbackBitrate func() float64
+
+	mu      sync.Mutex
+	partial []byte
+	current map[string]string
+	history []ProgressSample
+}
+
+func NewProgressTracker(historySize int, fallbackBitrate func() float64) *ProgressTracker {
+	if historySize < 1 {
+		historySize = 1
+	}
+	return &ProgressTracker{
+		historySize:     historySize,
+		fallbackBitrate: fallbackBitrate,
+		current:         make(map[string]string),
+	}
+}
+
+func (t *ProgressTracker) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	t.partial = append(t.partial, p...)
+	var completed []map[string]string
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(t.partial[:i]))
+		t.partial = t.partial[i+1:]
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if key != "progress" {
+			t.current[key] = value
+			continue
+		}
+		completed = append(completed, t.current)
+		t.current = make(map[string]string)
+	}
+	// Без перевода строки в потоке не копим мусор бесконечно
+	if len(t.partial) > 4096 {
+		t.partial = nil
+	}
+	t.mu.Unlock()
+
+	// Оценка по сегментам читает диск - вне мьютекса
+	for _, fields := range completed {
+		t.add(parseProgress(fields, t.fallbackBitrate))
+	}
+	return len(p), nil
+}
+
+func (t *ProgressTracker) add(sample ProgressSample) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.history = append(t.history, sample)
+	if extra := len(t.history) - t.historySize; extra > 0 {
+		t.history = append([]ProgressSample(nil), t.history[extra:]...)
+	}
+}
+
+// Stats - копия текущих метрик; withHistory добавляет историю
+func (t *ProgressTracker) Stats(withHistory bool) IngestStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := IngestStats{Stale: true}
+	if len(t.history) == 0 {
+		return stats
+	}
+	latest := t.history[len(t.history)-1]
+	stats.Latest = &latest
+	stats.UpdatedAt = &latest.Time
+	stats.Stale = time.Since(latest.Time) > progressStaleAfter
+	if withHistory {
+		stats.History = append([]ProgressSample(nil), t.history...)
+	}
+	return stats
+}
+
+// handleStreamStats: GET /api/streams/{stream_id}/stats - метрики ingest с историей
+func handleStreamStats(w http.ResponseWriter, r *http.Request, stream *StreamInstance) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := IngestStats{Stale: true}
+	if stream.Progress != nil {
+		stats = stream.Progress.Stats(true)
+	}
+	json.NewEncoder(w).Encode(StreamResponse{
+		Message:  "Метрики ingest",
+		StreamID: stream.StreamID,
+		Status:   stream.Status,
+		Data:     stats,
+	})
+}
+
+// parseProgress переводит поля блока в ProgressSample; N/A и пустые значения дают ноль
+func parseProgress(fields map[string]string, fallbackBitrate func() float64) ProgressSample {
+	sample := ProgressSample{
+		Time:       time.Now(),
+		Frame:      parseProgressInt(fields["frame"]),
+		FPS:        parseProgressFloat(fields["fps"]),
+		TotalSize:  parseProgressInt(fields["total_size"]),
+		DupFrames:  parseProgressInt(fields["dup_frames"]),
+		DropFrames: parseProgressInt(fields["drop_frames"]),
+		// bitrate=1234.5kbits/s, speed=1.01x
+		BitrateKbps: parseProgressFloat(strings.TrimSuffix(fields["bitrate"], "kbits/s")),
+		Speed:       parseProgressFloat(strings.TrimSuffix(fields["speed"], "x")),
+	}
+	// out_time_ms исторически содержит микросекунды, как и out_time_us
+	outTime := fields["out_time_us"]
+	if outTime == "" {
+		outTime = fields["out_time_ms"]
+	}
+	sample.OutTimeSeconds = float64(parseProgressInt(outTime)) / 1e6
+
+	if sample.BitrateKbps == 0 && fallbackBitrate != nil {
+		sample.BitrateKbps = fallbackBitrate()
+	}
+	return sample
+}
+
+func parseProgressInt(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func parseProgressFloat(value string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// newProgressTracker - трекер метрик потока с оценкой битрейта по его сегментам
+func newProgressTracker(hlsPath, packaging string, renditions []Rendition) *ProgressTracker {
+	return NewProgressTracker(serviceConfig.StatsHistory, func() float64 {
+		return segmentBitrateKbps(hlsPath, packaging, renditions)
+	})
+}
+
+// segmentBitrateKbps оценивает битрейт по последним сегментам медиа-плейлистов:
+// размер файлов, деленный на их длительность из #EXTINF. Плейлисты вариантов
+// transcode и представлений CMAF суммируются.
+func segmentBitrateKbps(hlsPath, packaging string, renditions []Rendition) float64 {
+	var total float64
+	for _, name := range mediaPlaylistPaths(hlsPath, packaging, renditions) {
+		total += playlistBitrateKbps(filepath.Join(hlsPath, name), 3)
+	}
+	return total
+}
+
+// playlistBitrateKbps - битрейт последних n сегментов медиа-плейлиста
+func playlistBitrateKbps(playlist string, n int) float64 {
+	parsed, err := hls.ParseFile(playlist)
+	if err != nil || parsed.Media == nil {
+		return 0
+	}
+	segments := parsed.Media.Segments
+	if len(segments) > n {
+		segments = segments[len(segments)-n:]
+	}
+
+	dir := filepath.Dir(playlist)
+	var bytesTotal int64
+	var seconds float64
+	for _, seg := range segments {
+		info, err := os.Stat(filepath.Join(dir, filepath.Base(seg.URI)))
+		if err != nil || seg.Duration <= 0 {
+			continue
+		}
+		bytesTotal += info.Size()
+		seconds += seg.Duration
+	}
+	if seconds == 0 {
+		return 0
+	}
+	return float64(bytesTotal) * 8 / 1000 / seconds
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Состояния подключения pull-потока к источнику
+const (
+	UpstreamConnecting   = "connecting"   // ffmpeg запущен, данных от источника еще нет
+	UpstreamConnected    = "connected"    // источник отдает данные, сегменты пишутся
+	UpstreamStalled      = "stalled"      // соединение есть, но новых сегментов нет
+	UpstreamReconnecting = "reconnecting" // ffmpeg завершился, ждем перезапуска по backoff
+	UpstreamFailed       = "failed"       // перезапуски исчерпаны (FFMPEG_RESTART_MAX)
+)
+
+// pullSchemes - поддерживаемые источники: SRT caller, RTMP pull, HLS и HTTP-TS
+var pullSchemes = map[string]bool{
+	"srt":   true,
+	"rtmp":  true,
+	"rtmps": true,
+	"http":  true,
+	"https": true,
+}
+
+// UpstreamState - состояние подключения к источнику pull-потока
+type UpstreamState struct {
+	State             string     `json:"state"`
+	SourceURL         string     `json:"source_url"` // без учетных данных
+	ConnectedAt       *time.Time `json:"connected_at,omitempty"`
+	LastChange        time.Time  `json:"last_change"`
+	LastError         string     `json:"last_error,omitempty"`
+	ReconnectAttempts int        `json:"reconnect_attempts"`
+}
+
+// validatePullURL проверяет адрес источника
+func validatePullURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid source_url: %v", err)
+	}
+	if !pullSchemes[strings.ToLower(u.Scheme)] {
+		return fmt.Errorf("unsupported source_url scheme %q (srt, rtmp, rtmps, http, https)", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("source_url must contain a host")
+	}
+	return nil
+}
+
+// redactSourceURL убирает из адреса источника пароль и параметры запроса
+func redactSourceURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if u.User != nil {
+		u.User = url.User(u.User.Username())
+	}
+	// В query бывают passphrase и токены, поэтому параметры не показываются
+	u.RawQuery = ""
+	return u.String()
+}
+
+// pullInputArgs - вход ffmpeg для pull-потока. rw_timeout обрывает зависшее
+// соединение, после чего супервизор переподключается с экспоненциальной задержкой.
+func pullInputArgs(spec PipelineSpec) []string {
+	source := spec.SourceURL
+	if u, err := url.Parse(source); err == nil && strings.EqualFold(u.Scheme, "srt") {
+		query := u.Query()
+		if query.Get("mode") == "" {
+			query.Set("mode", "caller")
+		}
+		if query.Get("transtype") == "" {
+			query.Set("transtype", "live")
+		}
+		u.RawQuery = query.Encode()
+		source = u.String()
+	}
+
+	return []string{
+		"-rw_timeout", fmt.Sprint(serviceConfig.PullReadTimeout.Microseconds()),
+		"-i", source,
+	}
+}
+
+// setUpstreamState меняет состояние источника; вызывается под manager.mutex
+func setUpstreamState(stream *StreamInstance, state, lastError string) {
+	if stream.Upstream == nil || stream.Upstream.State == state && lastError == "" {
+		return
+	}
+
+	now := time.Now()
+	upstream := stream.Upstream
+	if upstream.State != state {
+		log.Printf("🔌 Источник потока %s: %s -> %s", stream.StreamID, upstream.State, state)
+	}
+	upstream.State = state
+	upstream.LastChange = now
+	if lastError != "" {
+		upstream.LastError = lastError
+	}
+
+	switch state {
+	case UpstreamConnected:
+		upstream.ConnectedAt = &now
+	case UpstreamReconnecting:
+		upstream.ConnectedAt = nil
+		upstream.ReconnectAttempts++
+	case UpstreamFailed:
+		upstream.ConnectedAt = nil
+	}
+}
+
+// applyUpstreamEvent переводит события супервизора ffmpeg в состояние источника
+func applyUpstreamEvent(streamID string, event PipelineEvent) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	stream, exists := manager.streams[streamID]
+	if !exists || stream.Upstream == nil {
+		return
+	}
+
+	switch event.Type {
+	case EventProcessStarted:
+		setUpstreamState(stream, UpstreamConnecting, "")
+	case EventProcessRestarting:
+		lastError := "ffmpeg exited"
+		if event.Status.LastExitCode != nil {
+			lastError = fmt.Sprintf("ffmpeg exited with code %d", *event.Status.LastExitCode)
+		}
+		setUpstreamState(stream, UpstreamReconnecting, lastError)
+	case EventPipelineFailed:
+		setUpstreamState(stream, UpstreamFailed, "restart limit reached")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeFFmpegEnv переводит тестовый бинарник в режим ffmpeg (см. TestMain)
+const fakeFFmpegEnv = "STREAMING_TEST_FAKE_FFMPEG"
+
+// runFakeFFmpeg заменяет ffmpeg потока: пока источник из -i отдает HLS-плейлист,
+// пишет сегменты и плейлист в выход из ffmpegArgs. Недоступный источник завершает
+// процесс с кодом 1, как ffmpeg по EOF или -rw_timeout. SRT listener считается
+// всегда получающим данные.
+func runFakeFFmpeg(args []string) int {
+	source := ""
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-i" {
+			source = args[i+1]
+		}
+	}
+	playlist := args[len(args)-1]
+	dir := filepath.Dir(playlist)
+	client := &http.Client{Timeout: time.Second}
+
+	// Нумерация продолжается после перезапуска, как с append_list
+	start := time.Now().Unix() * 10
+	for seq := start; ; seq++ {
+		if !strings.HasPrefix(source, "srt://") {
+			resp, err := client.Get(source)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				fmt.Fprintf(os.Stderr, "%s: HTTP %d\n", source, resp.StatusCode)
+				return 1
+			}
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("segment_%d.ts", seq)), make([]byte, 188), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		first := max(seq-2, start)
+		var media strings.Builder
+		fmt.Fprintf(&media, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+		for i := first; i <= seq; i++ {
+			fmt.Fprintf(&media, "#EXTINF:0.200,\nsegment_%d.ts\n", i)
+		}
+		if err := os.WriteFile(playlist+".tmp", []byte(media.String()), 0o644); err != nil {
+			return 1
+		}
+		os.Rename(playlist+".tmp", playlist)
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// upstreamOf возвращает копию состояния источника и статус потока
+func upstreamOf(streamID string) (UpstreamState, string) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	stream := manager.streams[streamID]
+	if stream == nil || stream.Upstream == nil {
+		return UpstreamState{}, ""
+	}
+	return *stream.Upstream, stream.Status
+}
+
+// waitUpstream ждет, пока состояние источника не удовлетворит условию
+func waitUpstream(t *testing.T, streamID string, timeout time.Duration, what string, ok func(UpstreamState, string) bool) UpstreamState {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		upstream, status := upstreamOf(streamID)
+		if ok(upstream, status) {
+			return upstream
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: upstream %+v, status %q after %s", what, upstream, status, timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestPullStreamReconnectsToHLSSource(t *testing.T) {
+	useRecordingWebhooks(t)
+	serviceConfig.Pipeline = "ffmpeg"
+	t.Cleanup(func() { serviceConfig.Pipeline = "fake" })
+
+	var online atomic.Bool
+	var requests atomic.Int64
+	online.Store(true)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !online.Load() || r.URL.Path != "/live/index.m3u8" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXTINF:1.000,\nsource.ts\n")
+	}))
+	defer source.Close()
+
+	sourceURL := source.URL + "/live/index.m3u8?token=source-secret"
+	resp := startStream("pull1", StreamOptions{Protocol: ProtocolPull, SourceURL: sourceURL})
+	if resp.Error != "" {
+		t.Fatalf("startStream() = %+v", resp)
+	}
+	t.Cleanup(func() { stopStream("pull1") })
+
+	upstream, _ := upstreamOf("pull1")
+	if upstream.State != UpstreamConnecting || upstream.SourceURL != source.URL+"/live/index.m3u8" {
+		t.Fatalf("initial upstream %+v", upstream)
+	}
+
+	// Первые сегменты из источника: connected и running
+	upstream = waitUpstream(t, "pull1", 5*time.Second, "connect", func(u UpstreamState, status string) bool {
+		return u.State == UpstreamConnected && status == "running"
+	})
+	if upstream.ConnectedAt == nil || requests.Load() == 0 {
+		t.Fatalf("connected upstream %+v after %d source requests", upstream, requests.Load())
+	}
+
+	// Источник пропал: ffmpeg завершается, супервизор переподключается с растущей задержкой
+	online.Store(false)
+	upstream = waitUpstream(t, "pull1", 8*time.Second, "reconnect", func(u UpstreamState, _ string) bool {
+		return u.ReconnectAttempts >= 2
+	})
+	if upstream.ConnectedAt != nil || upstream.LastError != "ffmpeg exited with code 1" {
+		t.Fatalf("reconnecting upstream %+v", upstream)
+	}
+
+	logData, err := os.ReadFile(streamLogFile("pull1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := strings.Index(string(logData), "Перезапуск через 1s")
+	second := strings.Index(string(logData), "Перезапуск через 2s")
+	if first < 0 || second < first {
+		t.Fatalf("restart backoff does not grow, log:\n%s", logData)
+	}
+
+	// Источник вернулся: следующая попытка снова дает connected
+	online.Store(true)
+	upstream = waitUpstream(t, "pull1", 8*time.Second, "recover", func(u UpstreamState, status string) bool {
+		return u.State == UpstreamConnected && status == "running"
+	})
+	if upstream.ConnectedAt == nil || upstream.ReconnectAttempts < 2 {
+		t.Fatalf("recovered upstream %+v", upstream)
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"my-go-app/pkg/middleware"
+)
+
+// recordingSessionFile - незавершенная сессия записи внутри HLS-каталога потока,
+// чтобы запись продолжилась после рестарта сервиса
+const recordingSessionFile = "recording.json"
+
+type recordedSegment struct {
+	URI           string  `json:"uri"`
+	Duration      float64 `json:"duration"`
+	Discontinuity bool    `json:"discontinuity,omitempty"`
+}
+
+// RecordingInfo - готовый VOD-архив сессии; отправляется в основное приложение
+type RecordingInfo struct {
+	StreamID        string    `json:"stream_id"`
+	SessionID       string    `json:"session_id"`
+	StartedAt       time.Time `json:"started_at"`
+	EndedAt         time.Time `json:"ended_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	SegmentCount    int       `json:"segment_count"`
+	SizeBytes       int64     `json:"size_bytes"`
+	Path            string    `json:"path"`          // каталог архива на диске streaming service
+	PlaylistPath    string    `json:"playlist_path"` // путь плейлиста относительно /recordings/
+}
+
+type recordingSession struct {
+	SessionID string                       `json:"session_id"`
+	StartedAt time.Time                    `json:"started_at"`
+	Segments  map[string][]recordedSegment `json:"segments"` // по вариантам, "" - единственный плейлист
+}
+
+// Recorder собирает сегменты живой сессии из плейлистов ffmpeg. ffmpeg в режиме
+// записи не удаляет сегменты, а Recorder запоминает их длительности, пока они
+// видны в скользящем окне. При остановке сегменты переносятся в архив и
+// получают VOD-плейлист с EXT-X-ENDLIST.
+type Recorder struct {
+	streamID string
+	hlsPath  string
+	variants []string
+	master   bool
+
+	mu      sync.Mutex
+	session recordingSession
+	seen    map[string]map[string]bool
+}
+
+func NewRecorder(streamID, hlsPath string, renditions []Rendition) *Recorder {
+	r := &Recorder{
+		streamID: streamID,
+		hlsPath:  hlsPath,
+		variants: []string{""},
+		seen:     make(map[string]map[string]bool),
+	}
+	if len(renditions) > 0 {
+		r.master = true
+		r.variants = nil
+		for _, rendition := range renditions {
+			r.variants = append(r.variants, rendition.Name)
+		}
+	}
+
+	// Продолжаем сессию, прерванную рестартом сервиса
+	if data, err := os.ReadFile(filepath.Join(hlsPath, recordingSessionFile)); err == nil {
+		if err := json.Unmarshal(data, &r.session); err == nil && r.session.SessionID != "" {
+			log.Printf("📼 Продолжение записи потока %s, сессия %s", streamID, r.session.SessionID)
+		}
+	}
+	if r.session.SessionID == "" {
+		r.session = recordingSession{
+			SessionID: time.Now().UTC().Format("20060102-150405"),
+			StartedAt: time.Now(),
+		}
+	}
+	if r.session.Segments == nil {
+		r.session.Segments = make(map[string][]recordedSegment)
+	}
+	for variant, segments := range r.session.Segments {
+		r.seen[variant] = make(map[string]bool, len(segments))
+		for _, seg := range segments {
+			r.seen[variant][seg.URI] = true
+		}
+	}
+	return r
+}
+
+// Poll дочитывает новые сегменты из живых плейлистов
+func (r *Recorder) Poll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := false
+	for _, variant := range r.variants {
+		data, err := os.ReadFile(filepath.Join(r.hlsPath, variant, mediaPlaylistName))
+		if err != nil {
+			continue
+		}
+		if r.seen[variant] == nil {
+			r.seen[variant] = make(map[string]bool)
+		}
+
+		discontinuity := false
+		duration := 0.0
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "#EXT-X-DISCONTINUITY":
+				discontinuity = true
+			case strings.HasPrefix(line, "#EXTINF:"):
+				value := strings.TrimSuffix(strings.SplitN(strings.TrimPrefix(line, "#EXTINF:"), ",", 2)[0], ",")
+				duration, _ = strconv.ParseFloat(value, 64)
+			case line == "" || strings.HasPrefix(line, "#"):
+			default:
+				if !r.seen[variant][line] {
+					r.seen[variant][line] = true
+					r.session.Segments[variant] = append(r.session.Segments[variant], recordedSegment{
+						URI:           line,
+						Duration:      duration,
+						Discontinuity: discontinuity && len(r.session.Segments[variant]) > 0,
+					})
+					changed = true
+				}
+				discontinuity = false
+				duration = 0
+			}
+		}
+	}
+
+	if changed {
+		if data, err := json.Marshal(r.session); err == nil {
+			tmp := filepath.Join(r.hlsPath, recordingSessionFile+".tmp")
+			if err := os.WriteFile(tmp, data, 0o644); err == nil {
+				os.Rename(tmp, filepath.Join(r.hlsPath, recordingSessionFile))
+			}
+		}
+	}
+}
+
+// Finalize переносит сегменты сессии в архив и пишет VOD-плейлисты.
+// Возвращает nil без ошибки, если записывать нечего.
+func (r *Recorder) Finalize(root string) (*RecordingInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := filepath.Join(root, r.streamID, r.session.SessionID)
+	info := &RecordingInfo{
+		StreamID:  r.streamID,
+		SessionID: r.session.SessionID,
+		StartedAt: r.session.StartedAt,
+		EndedAt:   time.Now(),
+		Path:      dir,
+	}
+
+	for _, variant := range r.variants {
+		if len(r.session.Segments[variant]) == 0 {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Join(dir, variant), 0o755); err != nil {
+			return nil, err
+		}
+
+		var kept []recordedSegment
+		gap := false
+		variantDuration := 0.0
+		for _, seg := range r.session.Segments[variant] {
+			src := filepath.Join(r.hlsPath, variant, seg.URI)
+			size, err := moveFile(src, filepath.Join(dir, variant, seg.URI))
+			if err != nil {
+				// Сегмент потерян (удален по лимиту диска или не дописан) - склеиваем через разрыв
+				gap = true
+				continue
+			}
+			seg.Discontinuity = (seg.Discontinuity || gap) && len(kept) > 0
+			gap = false
+			kept = append(kept, seg)
+			info.SizeBytes += size
+			variantDuration += seg.Duration
+		}
+		if len(kept) == 0 {
+			continue
+		}
+
+		if err := writeVODPlaylist(filepath.Join(dir, variant, mediaPlaylistName), kept); err != nil {
+			return nil, err
+		}
+		info.SegmentCount += len(kept)
+		info.DurationSeconds = math.Max(info.DurationSeconds, variantDuration)
+	}
+
+	if info.SegmentCount == 0 {
+		os.RemoveAll(dir)
+		os.Remove(filepath.Join(r.hlsPath, recordingSessionFile))
+		return nil, nil
+	}
+
+	playlist := mediaPlaylistName
+	if r.master {
+		playlist = masterPlaylistName
+		if _, err := moveFile(filepath.Join(r.hlsPath, masterPlaylistName), filepath.Join(dir, masterPlaylistName)); err != nil {
+			return nil, fmt.Errorf("master playlist: %v", err)
+		}
+	}
+	info.PlaylistPath = filepath.ToSlash(filepath.Join(r.streamID, r.session.SessionID, playlist))
+
+	// Метаданные рядом с архивом позволяют перерегистрировать его вручную
+	if data, err := json.MarshalIndent(info, "", "  "); err == nil {
+		os.WriteFile(filepath.Join(dir, "recording.json"), data, 0o644)
+	}
+	os.Remove(filepath.Join(r.hlsPath, recordingSessionFile))
+	return info, nil
+}
+
+func writeVODPlaylist(path string, segments []recordedSegment) error {
+	targetDuration := 1
+	for _, seg := range segments {
+		if d := int(math.Ceil(seg.Duration)); d > targetDuration {
+			targetDuration = d
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for _, seg := range segments {
+		if seg.Discontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", seg.Duration, seg.URI)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// moveFile переносит файл; архив может лежать на другом томе, поэтому
+// при неудаче rename файл копируется
+func moveFile(src, dst string) (int64, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return info.Size(), nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+	os.Remove(src)
+	return info.Size(), nil
+}
+
+// runRecorder опрашивает плейлисты потока, пока поток зарегистрирован
+func runRecorder(streamID string, instance *StreamInstance) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		manager.mutex.RLock()
+		stream, exists := manager.streams[streamID]
+		manager.mutex.RUnlock()
+
+		if !exists || stream != instance {
+			return
+		}
+		instance.Recorder.Poll()
+	}
+}
+
+// finishRecording завершает сессию записи остановленного потока и регистрирует архив
+func finishRecording(stream *StreamInstance) {
+	stream.Recorder.Poll()
+	info, err := stream.Recorder.Finalize(serviceConfig.RecordingsPath)
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения записи потока %s: %v", stream.StreamID, err)
+		return
+	}
+	if info == nil {
+		log.Printf("📼 Запись потока %s пуста, архив не создан", stream.StreamID)
+		return
+	}
+
+	log.Printf("📼 Запись потока %s сохранена: %s (%d сегментов, %.0f с)", stream.StreamID, info.Path, info.SegmentCount, info.DurationSeconds)
+	sendWebhook(func() { webhooks.RecordingCreated(*info) })
+}
+
+// RecordingCreated регистрирует архив в основном приложении
+func (mainAppWebhooks) RecordingCreated(info RecordingInfo) {
+	mainAppURL := os.Getenv("MAIN_APP_URL")
+	if mainAppURL == "" {
+		mainAppURL = "http://go-app:8080"
+	}
+
+	jsonData, err := json.Marshal(info)
+	if err != nil {
+		log.Printf("❌ Failed to marshal recording data: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	maxRetries := 3
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		resp, err := client.Post(mainAppURL+"/api/internal/recordings", "application/json", bytes.NewBuffer(jsonData))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+				log.Printf("✅ Запись %s/%s зарегистрирована", info.StreamID, info.SessionID)
+				return
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		log.Printf("❌ Recording webhook attempt %d failed: %v", attempt, err)
+		if attempt < maxRetries {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+	}
+
+	log.Printf("❌ Запись %s не зарегистрирована, метаданные: %s", info.SessionID, filepath.Join(info.Path, "recording.json"))
+}
+
+// handleRecordings: GET /api/recordings/{stream_id} - архивы потока на диске,
+// DELETE /api/recordings/{stream_id}/{session_id} - удаление архива, нужен токен API
+func handleRecordings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/recordings/"), "/"), "/")
+	if parts[0] == "" || len(parts) > 2 || strings.Contains(r.URL.Path, "..") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message: "Ожидается /api/recordings/{stream_id}[/{session_id}]",
+			Error:   "invalid path",
+		})
+		return
+	}
+	streamID := parts[0]
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1:
+		recordings := []RecordingInfo{}
+		entries, _ := os.ReadDir(filepath.Join(serviceConfig.RecordingsPath, streamID))
+		for _, entry := range entries {
+			data, err := os.ReadFile(filepath.Join(serviceConfig.RecordingsPath, streamID, entry.Name(), "recording.json"))
+			if err != nil {
+				continue
+			}
+			var info RecordingInfo
+			if json.Unmarshal(data, &info) == nil {
+				recordings = append(recordings, info)
+			}
+		}
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Записи потока",
+			StreamID: streamID,
+			Data:     recordings,
+		})
+
+	case r.Method == http.MethodDelete && len(parts) == 2:
+		if !middleware.IsAuthorized(r, serviceConfig.APIToken) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message:  "Требуется токен API",
+				StreamID: streamID,
+				Error:    "unauthorized",
+			})
+			return
+		}
+		dir := filepath.Join(serviceConfig.RecordingsPath, streamID, parts[1])
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message: "Запись не найдена",
+				Error:   "recording not found",
+			})
+			return
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(StreamResponse{
+				Message: "Ошибка удаления записи",
+				Error:   err.Error(),
+			})
+			return
+		}
+		log.Printf("🗑️ Запись %s потока %s удалена", parts[1], streamID)
+		json.NewEncoder(w).Encode(StreamResponse{
+			Message:  "Запись удалена",
+			StreamID: streamID,
+		})
+
+	default:
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	}
+}
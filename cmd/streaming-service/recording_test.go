@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeleteRecordingRequiresToken(t *testing.T) {
+	serviceConfig.APIToken = "secret"
+	t.Cleanup(func() { serviceConfig.APIToken = "" })
+
+	dir := filepath.Join(serviceConfig.RecordingsPath, "rec1", "20260101-000000")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		exists bool
+	}{
+		{"without token", "", http.StatusUnauthorized, true},
+		{"wrong token", "other", http.StatusUnauthorized, true},
+		{"with token", "secret", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/api/recordings/rec1/20260101-000000", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handleRecordings(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("DELETE status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if _, err := os.Stat(dir); (err == nil) != tt.exists {
+				t.Fatalf("recording exists = %v, want %v", err == nil, tt.exists)
+			}
+		})
+	}
+}
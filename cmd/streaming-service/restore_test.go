@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeMainAppOptions заменяет основное приложение при запросе параметров потока:
+// пока параметры потока не заданы, запрос завершается ошибкой, как при недоступном go-app
+type fakeMainAppOptions struct {
+	mu       sync.Mutex
+	options  map[string]StreamOptions
+	requests map[string]int
+}
+
+var mainAppOptions = &fakeMainAppOptions{options: map[string]StreamOptions{}, requests: map[string]int{}}
+
+func (f *fakeMainAppOptions) fetch(streamID string) (StreamOptions, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[streamID]++
+	options, ok := f.options[streamID]
+	if !ok {
+		return StreamOptions{}, errors.New("dial tcp go-app:8080: connection refused")
+	}
+	return options, nil
+}
+
+func (f *fakeMainAppOptions) set(streamID string, options StreamOptions) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.options[streamID] = options
+}
+
+func (f *fakeMainAppOptions) requested(streamID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[streamID]
+}
+
+// waitFor ждет выполнения условия
+func waitFor(t *testing.T, timeout time.Duration, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: not within %s", what, timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func runningStream(streamID string) *StreamInstance {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	return manager.streams[streamID]
+}
+
+// TestRestoreWithMainAppUnreachable: после рестарта сервиса при недоступном основном
+// приложении ffmpeg, переживший рестарт, усыновляется с паролем SRT из своей командной
+// строки, а поток без процесса запускается, как только основное приложение вернется
+func TestRestoreWithMainAppUnreachable(t *testing.T) {
+	useRecordingWebhooks(t)
+	serviceConfig.Pipeline = "ffmpeg"
+	t.Cleanup(func() { serviceConfig.Pipeline = "fake" })
+
+	// ffmpeg прежнего экземпляра сервиса
+	spec := PipelineSpec{
+		StreamID:   "adopt1",
+		Protocol:   ProtocolSRT,
+		IngestPort: 20010,
+		Passphrase: "adopted-passphrase",
+		KeyLength:  16,
+		HLSPath:    filepath.Join(serviceConfig.HLSRoot, "adopt1"),
+		LogFile:    streamLogFile("adopt1"),
+	}
+	if err := os.MkdirAll(spec.HLSPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	orphan := exec.Command(serviceConfig.FFmpegPath, ffmpegArgs(spec)...)
+	if err := orphan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go orphan.Wait() // процесс - наш потомок: без Wait он остался бы зомби
+	t.Cleanup(func() { orphan.Process.Kill() })
+
+	adopted := StreamRecord{StreamID: "adopt1", DesiredState: DesiredRunning, SRTPort: spec.IngestPort,
+		HLSPath: spec.HLSPath, LogFile: spec.LogFile, StartTime: time.Now(),
+		Options: StreamOptions{Protocol: ProtocolSRT, SRTPassphrase: spec.Passphrase, SRTKeyLength: 16}}
+	fresh := StreamRecord{StreamID: "restore2", DesiredState: DesiredRunning, SRTPort: 20009, StartTime: time.Now(),
+		Options: StreamOptions{Protocol: ProtocolSRT, SRTPassphrase: "fresh-passphrase", SRTKeyLength: 16}}
+	for _, rec := range []StreamRecord{adopted, fresh} {
+		if err := manager.state.Put(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Записи в журнале без секретов, как после рестарта
+	adopted, _ = manager.state.Get("adopt1")
+	fresh, _ = manager.state.Get("restore2")
+	if !adopted.SecretsOmitted || adopted.Options.SRTPassphrase != "" {
+		t.Fatalf("journaled record keeps secrets: %+v", adopted)
+	}
+	t.Cleanup(func() {
+		stopStream("adopt1")
+		stopStream("restore2")
+	})
+
+	// Как при старте сервиса: порты из журнала закреплены до восстановления
+	for _, rec := range []StreamRecord{adopted, fresh} {
+		manager.ports.Remember(rec.StreamID, rec.SRTPort)
+	}
+	t.Cleanup(func() {
+		manager.ports.Forget("adopt1")
+		manager.ports.Forget("restore2")
+	})
+
+	known := restoreJournaledStreams([]StreamRecord{adopted, fresh})
+	if !known["adopt1"] || !known["restore2"] {
+		t.Fatalf("known = %v", known)
+	}
+
+	stream := runningStream("adopt1")
+	if stream == nil || !stream.Adopted || stream.SRTPassphrase != "adopted-passphrase" {
+		t.Fatalf("adopted stream = %+v", stream)
+	}
+	// Супервизор выставляет PID усыновленного процесса в фоне
+	waitFor(t, 3*time.Second, "adopted PID", func() bool { return stream.Pipeline.Status().PID == orphan.Process.Pid })
+
+	// Основное приложение недоступно: поток без процесса ждет секреты, не занимая чужой порт
+	waitFor(t, 3*time.Second, "retry options of restore2", func() bool { return mainAppOptions.requested("restore2") >= 2 })
+	if runningStream("restore2") != nil {
+		t.Fatal("restore2 started without secrets")
+	}
+
+	// Сбой усыновленного ffmpeg: супервизор перезапускает его с тем же паролем
+	orphan.Process.Signal(syscall.SIGKILL)
+	var restarted int
+	waitFor(t, 5*time.Second, "restart of adopted ffmpeg", func() bool {
+		restarted = stream.Pipeline.Status().PID
+		return restarted != 0 && restarted != orphan.Process.Pid
+	})
+	if cmdline := strings.Join(processCmdline(restarted), " "); !strings.Contains(cmdline, "passphrase=adopted-passphrase") {
+		t.Fatalf("restarted ffmpeg without passphrase: %s", cmdline)
+	}
+
+	// Основное приложение вернулось: поток запускается с его секретами
+	mainAppOptions.set("adopt1", StreamOptions{Protocol: ProtocolSRT, SRTPassphrase: "adopted-passphrase", SRTKeyLength: 16})
+	mainAppOptions.set("restore2", StreamOptions{Protocol: ProtocolSRT, SRTPassphrase: "fresh-passphrase", SRTKeyLength: 16})
+	waitFor(t, 3*time.Second, "restore of restore2", func() bool { return runningStream("restore2") != nil })
+	if restored := runningStream("restore2"); restored.SRTPassphrase != "fresh-passphrase" || restored.SRTPort != 20009 {
+		t.Fatalf("restored stream = %+v", restored)
+	}
+}
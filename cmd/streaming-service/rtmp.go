@@ -0,0 +1,888 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rtmpVersion         = 3
+	rtmpHandshakeSize   = 1536
+	rtmpInChunkSize     = 128 // размер чанка клиента до Set Chunk Size
+	rtmpOutChunkSize    = 4096
+	rtmpWindowAckSize   = 2500000
+	rtmpMaxMessageSize  = 16 << 20
+	rtmpMaxChunkStreams = 64
+
+	// До проверки ключа энкодер шлет только небольшие AMF-команды: лимит сообщения
+	// меньше, а число таких подключений к шлюзу ограничено
+	rtmpSetupMaxMessageSize = 64 << 10
+	rtmpMaxPendingConns     = 8
+
+	// rtmpSetupTimeout - сколько ждать команды publish после подключения энкодера
+	rtmpSetupTimeout = 10 * time.Second
+	// rtmpReadTimeout - публикация без данных дольше этого срока обрывается
+	rtmpReadTimeout = 30 * time.Second
+	// rtmpSinkTimeout - сколько ждать подключения ffmpeg к сокету (например, во время его перезапуска)
+	rtmpSinkTimeout = 15 * time.Second
+
+	// Типы сообщений RTMP
+	rtmpMsgSetChunkSize     = 1
+	rtmpMsgAbort            = 2
+	rtmpMsgAck              = 3
+	rtmpMsgWindowAckSize    = 5
+	rtmpMsgSetPeerBandwidth = 6
+	rtmpMsgAudio            = 8
+	rtmpMsgVideo            = 9
+	rtmpMsgDataAMF3         = 15
+	rtmpMsgCommandAMF3      = 17
+	rtmpMsgDataAMF0         = 18
+	rtmpMsgCommandAMF0      = 20
+	rtmpMsgAggregate        = 22
+
+	// Chunk stream для ответов: управление протоколом, команды соединения, статусы потока
+	rtmpControlChunkStream = 2
+	rtmpCommandChunkStream = 3
+	rtmpStatusChunkStream  = 5
+
+	// rtmpPublishStreamID - message stream id, который получает энкодер в ответе на createStream
+	rtmpPublishStreamID = 1
+)
+
+// rtmpSocketPath - unix-сокет, из которого ffmpeg потока читает принятую публикацию
+func rtmpSocketPath(streamID string) string {
+	return filepath.Join(serviceConfig.RunDir, streamID+".rtmp.sock")
+}
+
+// RTMPGate принимает RTMP-публикацию на порту потока вместо ffmpeg. RTMP-сервер ffmpeg
+// (-listen 1) не проверяет ни приложение, ни ключ: чужое имя потока он только пишет в лог.
+// Шлюз сверяет app из connect и ключ из publish и только после этого передает аудио,
+// видео и метаданные в ffmpeg как FLV через unix-сокет, к которому ffmpeg подключается сам.
+// Одновременно принимается одна публикация.
+type RTMPGate struct {
+	streamID string
+	app      string
+	key      string
+
+	listener net.Listener // TCP-порт потока для энкодера
+	sink     net.Listener // unix-сокет для ffmpeg
+	ffmpeg   chan net.Conn
+
+	mu        sync.Mutex
+	publisher net.Conn // энкодер, прошедший проверку
+	active    net.Conn // ffmpeg, получающий его публикацию
+	pending   int      // подключения, еще не прошедшие проверку ключа
+	closed    bool
+}
+
+// StartRTMPGate открывает порт потока и сокет для ffmpeg
+func StartRTMPGate(streamID string, port int, app, key string) (*RTMPGate, error) {
+	socket := rtmpSocketPath(streamID)
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return nil, err
+	}
+	// Сокет мог остаться от экземпляра сервиса, завершившегося аварийно
+	os.Remove(socket)
+
+	sink, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		sink.Close()
+		return nil, err
+	}
+
+	g := &RTMPGate{
+		streamID: streamID,
+		app:      app,
+		key:      key,
+		listener: listener,
+		sink:     sink,
+		ffmpeg:   make(chan net.Conn, 1),
+	}
+	go g.acceptFFmpeg()
+	go g.acceptPublishers()
+	return g, nil
+}
+
+// Close закрывает порт и сокет и обрывает текущую публикацию
+func (g *RTMPGate) Close() {
+	g.mu.Lock()
+	g.closed = true
+	publisher, active := g.publisher, g.active
+	g.mu.Unlock()
+
+	g.listener.Close()
+	g.sink.Close()
+	if publisher != nil {
+		publisher.Close()
+	}
+	if active != nil {
+		active.Close()
+	}
+	select {
+	case conn := <-g.ffmpeg:
+		conn.Close()
+	default:
+	}
+}
+
+// acceptFFmpeg держит последнее подключение ffmpeg до начала публикации:
+// перезапущенный ffmpeg подключается заново, прежнее подключение уже мертво
+func (g *RTMPGate) acceptFFmpeg() {
+	for {
+		conn, err := g.sink.Accept()
+		if err != nil {
+			return
+		}
+		select {
+		case stale := <-g.ffmpeg:
+			stale.Close()
+		default:
+		}
+		g.mu.Lock()
+		closed := g.closed
+		g.mu.Unlock()
+		if closed {
+			conn.Close()
+			return
+		}
+		g.ffmpeg <- conn
+	}
+}
+
+func (g *RTMPGate) acceptPublishers() {
+	for {
+		conn, err := g.listener.Accept()
+		if err != nil {
+			g.mu.Lock()
+			closed := g.closed
+			g.mu.Unlock()
+			if closed || !isTemporary(err) {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		// Лишние непроверенные подключения закрываются без лога: их поток и есть атака
+		g.mu.Lock()
+		admitted := g.pending < rtmpMaxPendingConns
+		if admitted {
+			g.pending++
+		}
+		g.mu.Unlock()
+		if !admitted {
+			conn.Close()
+			continue
+		}
+		go g.serve(conn)
+	}
+}
+
+// releasePending снимает подключение со счета непроверенных
+func (g *RTMPGate) releasePending() {
+	g.mu.Lock()
+	g.pending--
+	g.mu.Unlock()
+}
+
+func isTemporary(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// serve проводит сессию энкодера до publish, проверяет ключ и передает публикацию ffmpeg
+func (g *RTMPGate) serve(conn net.Conn) {
+	defer conn.Close()
+	remote := conn.RemoteAddr().String()
+	pending := true
+	defer func() {
+		if pending {
+			g.releasePending()
+		}
+	}()
+
+	conn.SetDeadline(time.Now().Add(rtmpSetupTimeout))
+	c := newRTMPConn(conn)
+	if err := c.handshake(); err != nil {
+		return
+	}
+	publish, err := c.negotiate(g.app)
+	if err != nil {
+		log.Printf("🚫 RTMP подключение к потоку %s отклонено (%s): %v", g.streamID, remote, err)
+		return
+	}
+
+	if !rtmpKeyMatches(publish.name, g.key) {
+		log.Printf("🚫 RTMP публикация в поток %s отклонена: неверный ключ (%s)", g.streamID, remote)
+		c.writeStatus(publish, "error", "NetStream.Publish.BadName", "invalid stream key")
+		return
+	}
+	// Ключ верный: дальше идут медиаданные с полным лимитом сообщения
+	pending = false
+	g.releasePending()
+	c.maxMessageSize = rtmpMaxMessageSize
+
+	g.mu.Lock()
+	if g.publisher != nil || g.closed {
+		g.mu.Unlock()
+		log.Printf("🚫 RTMP публикация в поток %s отклонена: поток уже публикуется (%s)", g.streamID, remote)
+		c.writeStatus(publish, "error", "NetStream.Publish.BadName", "stream is already being published")
+		return
+	}
+	g.publisher = conn
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.publisher, g.active = nil, nil
+		g.mu.Unlock()
+	}()
+
+	var sink net.Conn
+	select {
+	case sink = <-g.ffmpeg:
+	case <-time.After(rtmpSinkTimeout):
+		log.Printf("⚠️ RTMP публикация в поток %s не принята: ffmpeg не подключился к %s", g.streamID, g.sink.Addr())
+		c.writeStatus(publish, "error", "NetStream.Publish.Failed", "ingest is not ready")
+		return
+	}
+	defer sink.Close()
+	g.mu.Lock()
+	g.active = sink
+	g.mu.Unlock()
+
+	if err := c.writeStatus(publish, "status", "NetStream.Publish.Start", "publishing"); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	log.Printf("📡 RTMP публикация в поток %s начата (%s)", g.streamID, remote)
+
+	err = c.relay(newFLVWriter(sink))
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		log.Printf("⚠️ RTMP публикация в поток %s прервана: %v", g.streamID, err)
+		return
+	}
+	log.Printf("📡 RTMP публикация в поток %s завершена (%s)", g.streamID, remote)
+}
+
+// rtmpKeyMatches сравнивает имя потока из publish с ключом; параметры после "?" не учитываются
+func rtmpKeyMatches(name, key string) bool {
+	name, _, _ = strings.Cut(name, "?")
+	return key != "" && subtle.ConstantTimeCompare([]byte(name), []byte(key)) == 1
+}
+
+// rtmpAppMatches сравнивает app из connect; энкодеры добавляют к нему "/" и параметры
+func rtmpAppMatches(app, expected string) bool {
+	app, _, _ = strings.Cut(app, "?")
+	return strings.Trim(app, "/") == expected
+}
+
+// rtmpMessage - собранное из чанков сообщение RTMP
+type rtmpMessage struct {
+	typeID    byte
+	streamID  uint32
+	timestamp uint32
+	payload   []byte
+}
+
+// rtmpChunkState - заголовок последнего сообщения chunk stream: чанки
+// с сокращенным заголовком наследуют его поля
+type rtmpChunkState struct {
+	timestamp  uint32
+	delta      uint32
+	length     uint32
+	typeID     byte
+	streamID   uint32
+	extended   bool
+	inProgress bool
+	buf        []byte
+}
+
+// rtmpPublish - команда publish, прошедшая разбор
+type rtmpPublish struct {
+	name     string
+	streamID uint32
+}
+
+// rtmpConn - серверная сторона соединения RTMP
+type rtmpConn struct {
+	conn   net.Conn
+	in     *countingReader
+	r      *bufio.Reader
+	w      *bufio.Writer
+	chunks map[uint32]*rtmpChunkState
+
+	readChunkSize  uint32
+	maxMessageSize uint32 // до проверки ключа - rtmpSetupMaxMessageSize
+	ackWindow      uint32
+	acked          uint64
+}
+
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+func newRTMPConn(conn net.Conn) *rtmpConn {
+	in := &countingReader{r: conn}
+	return &rtmpConn{
+		conn:           conn,
+		in:             in,
+		r:              bufio.NewReaderSize(in, 64*1024),
+		w:              bufio.NewWriterSize(conn, rtmpOutChunkSize+16),
+		chunks:         make(map[uint32]*rtmpChunkState),
+		readChunkSize:  rtmpInChunkSize,
+		maxMessageSize: rtmpSetupMaxMessageSize,
+	}
+}
+
+// handshake - простое рукопожатие без дайджеста: S2 повторяет C1
+func (c *rtmpConn) handshake() error {
+	c0c1 := make([]byte, 1+rtmpHandshakeSize)
+	if _, err := io.ReadFull(c.r, c0c1); err != nil {
+		return err
+	}
+	if c0c1[0] != rtmpVersion {
+		return fmt.Errorf("unsupported RTMP version %d", c0c1[0])
+	}
+
+	s0s1s2 := make([]byte, 1+2*rtmpHandshakeSize)
+	s0s1s2[0] = rtmpVersion
+	rand.Read(s0s1s2[1+8 : 1+rtmpHandshakeSize])
+	copy(s0s1s2[1+rtmpHandshakeSize:], c0c1[1:])
+	if _, err := c.w.Write(s0s1s2); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	_, err := io.ReadFull(c.r, make([]byte, rtmpHandshakeSize))
+	return err
+}
+
+// negotiate отвечает на команды энкодера до publish. Приложение проверяется в connect,
+// ключ - вызывающим по результату: так ответ на неверный ключ уходит как статус publish.
+func (c *rtmpConn) negotiate(app string) (rtmpPublish, error) {
+	connected := false
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return rtmpPublish{}, err
+		}
+		values, ok := commandValues(msg)
+		if !ok {
+			// Медиаданные до publish не принимаются
+			continue
+		}
+		name, _ := values[0].(string)
+		txn, _ := values[1].(float64)
+
+		switch name {
+		case "connect":
+			var requested string
+			if len(values) > 2 {
+				if props, ok := values[2].(amfObject); ok {
+					requested, _ = props["app"].(string)
+				}
+			}
+			if !rtmpAppMatches(requested, app) {
+				c.writeCommand(rtmpCommandChunkStream, 0, "_error", txn, nil,
+					rtmpStatus("error", "NetConnection.Connect.Rejected", "invalid application"))
+				return rtmpPublish{}, fmt.Errorf("unknown application %q", requested)
+			}
+			c.writeControl(rtmpMsgWindowAckSize, binary.BigEndian.AppendUint32(nil, rtmpWindowAckSize))
+			c.writeControl(rtmpMsgSetPeerBandwidth, append(binary.BigEndian.AppendUint32(nil, rtmpWindowAckSize), 2))
+			c.writeControl(rtmpMsgSetChunkSize, binary.BigEndian.AppendUint32(nil, rtmpOutChunkSize))
+			err := c.writeCommand(rtmpCommandChunkStream, 0, "_result", txn,
+				amfObject{"fmsVer": "FMS/3,0,1,123", "capabilities": 31.0},
+				rtmpStatus("status", "NetConnection.Connect.Success", "Connection succeeded."))
+			if err != nil {
+				return rtmpPublish{}, err
+			}
+			connected = true
+
+		case "createStream":
+			if err := c.writeCommand(rtmpCommandChunkStream, 0, "_result", txn, nil, float64(rtmpPublishStreamID)); err != nil {
+				return rtmpPublish{}, err
+			}
+
+		case "releaseStream", "FCPublish":
+			if txn != 0 {
+				if err := c.writeCommand(rtmpCommandChunkStream, 0, "_result", txn, nil, amfUndefined{}); err != nil {
+					return rtmpPublish{}, err
+				}
+			}
+
+		case "publish":
+			if !connected {
+				return rtmpPublish{}, errors.New("publish before connect")
+			}
+			var stream string
+			if len(values) > 3 {
+				stream, _ = values[3].(string)
+			}
+			return rtmpPublish{name: stream, streamID: msg.streamID}, nil
+
+		case "play":
+			return rtmpPublish{}, errors.New("playback is not supported")
+		}
+	}
+}
+
+// relay передает аудио, видео и метаданные публикации в ffmpeg до ее окончания
+func (c *rtmpConn) relay(flv *flvWriter) error {
+	if err := flv.writeHeader(); err != nil {
+		return err
+	}
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(rtmpReadTimeout))
+		msg, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+
+		switch msg.typeID {
+		case rtmpMsgAudio, rtmpMsgVideo:
+			err = flv.writeTag(msg.typeID, msg.timestamp, msg.payload)
+		case rtmpMsgDataAMF0, rtmpMsgDataAMF3:
+			payload := msg.payload
+			if msg.typeID == rtmpMsgDataAMF3 && len(payload) > 0 {
+				payload = payload[1:]
+			}
+			err = flv.writeTag(rtmpMsgDataAMF0, msg.timestamp, stripSetDataFrame(payload))
+		case rtmpMsgAggregate:
+			err = flv.writeAggregate(msg.timestamp, msg.payload)
+		case rtmpMsgCommandAMF0, rtmpMsgCommandAMF3:
+			if values, ok := commandValues(msg); ok {
+				switch values[0] {
+				case "FCUnpublish", "deleteStream", "closeStream":
+					return nil
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// commandValues разбирает команду AMF0 (или AMF3 с AMF0-содержимым): имя, транзакция, аргументы
+func commandValues(msg *rtmpMessage) ([]interface{}, bool) {
+	payload := msg.payload
+	switch msg.typeID {
+	case rtmpMsgCommandAMF0:
+	case rtmpMsgCommandAMF3:
+		if len(payload) == 0 {
+			return nil, false
+		}
+		payload = payload[1:]
+	default:
+		return nil, false
+	}
+	values, err := amfDecode(payload)
+	if err != nil || len(values) < 2 {
+		return nil, false
+	}
+	if _, ok := values[0].(string); !ok {
+		return nil, false
+	}
+	return values, true
+}
+
+// stripSetDataFrame убирает обертку @setDataFrame: в FLV метаданные пишутся как onMetaData
+func stripSetDataFrame(payload []byte) []byte {
+	const prefix = "\x02\x00\x0d@setDataFrame"
+	return []byte(strings.TrimPrefix(string(payload), prefix))
+}
+
+// readMessage читает чанки до первого собранного сообщения. Сообщения управления
+// протоколом применяются здесь же и тоже возвращаются.
+func (c *rtmpConn) readMessage() (*rtmpMessage, error) {
+	for {
+		b0, err := c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		format := b0 >> 6
+		csid := uint32(b0 & 0x3F)
+		switch csid {
+		case 0:
+			b, err := c.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			csid = 64 + uint32(b)
+		case 1:
+			var b [2]byte
+			if _, err := io.ReadFull(c.r, b[:]); err != nil {
+				return nil, err
+			}
+			csid = 64 + uint32(b[0]) + uint32(b[1])<<8
+		}
+
+		st := c.chunks[csid]
+		if st == nil {
+			if format != 0 {
+				return nil, fmt.Errorf("chunk stream %d starts without a full header", csid)
+			}
+			if len(c.chunks) >= rtmpMaxChunkStreams {
+				return nil, errors.New("too many chunk streams")
+			}
+			st = &rtmpChunkState{}
+			c.chunks[csid] = st
+		}
+
+		var header [11]byte
+		headerSize := [4]int{11, 7, 3, 0}[format]
+		if _, err := io.ReadFull(c.r, header[:headerSize]); err != nil {
+			return nil, err
+		}
+		if format <= 2 {
+			st.delta = uint24(header[0:3])
+			st.extended = st.delta == 0xFFFFFF
+		}
+		if format <= 1 {
+			st.length = uint24(header[3:6])
+			st.typeID = header[6]
+		}
+		if format == 0 {
+			st.streamID = binary.LittleEndian.Uint32(header[7:11])
+		}
+		if st.extended {
+			var ext [4]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+				return nil, err
+			}
+			if format <= 2 {
+				st.delta = binary.BigEndian.Uint32(ext[:])
+			}
+		}
+
+		if !st.inProgress {
+			// Как в ffmpeg: полный заголовок задает абсолютное время, остальные - приращение
+			if format == 0 {
+				st.timestamp = st.delta
+			} else {
+				st.timestamp += st.delta
+			}
+			if st.length > c.maxMessageSize {
+				return nil, fmt.Errorf("message of %d bytes exceeds limit of %d", st.length, c.maxMessageSize)
+			}
+			st.buf = nil
+			st.inProgress = true
+		}
+
+		// Буфер растет по мере прихода чанков, а не по длине из заголовка:
+		// заявленная длина ничего не стоит клиенту, пока он не прислал данные
+		n := min(c.readChunkSize, st.length-uint32(len(st.buf)))
+		start := len(st.buf)
+		st.buf = slices.Grow(st.buf, int(n))[:start+int(n)]
+		if _, err := io.ReadFull(c.r, st.buf[start:]); err != nil {
+			return nil, err
+		}
+		if err := c.acknowledge(); err != nil {
+			return nil, err
+		}
+		if uint32(len(st.buf)) < st.length {
+			continue
+		}
+
+		msg := &rtmpMessage{typeID: st.typeID, streamID: st.streamID, timestamp: st.timestamp, payload: st.buf}
+		st.buf, st.inProgress = nil, false
+
+		switch msg.typeID {
+		case rtmpMsgSetChunkSize:
+			if len(msg.payload) >= 4 {
+				size := binary.BigEndian.Uint32(msg.payload) & 0x7FFFFFFF
+				if size == 0 {
+					return nil, errors.New("invalid chunk size 0")
+				}
+				c.readChunkSize = min(size, rtmpMaxMessageSize)
+			}
+		case rtmpMsgAbort:
+			if len(msg.payload) >= 4 {
+				if aborted := c.chunks[binary.BigEndian.Uint32(msg.payload)]; aborted != nil {
+					aborted.buf, aborted.inProgress = nil, false
+				}
+			}
+		case rtmpMsgWindowAckSize:
+			if len(msg.payload) >= 4 {
+				c.ackWindow = binary.BigEndian.Uint32(msg.payload)
+			}
+		}
+		return msg, nil
+	}
+}
+
+// acknowledge подтверждает прием, когда энкодер задал окно подтверждений
+func (c *rtmpConn) acknowledge() error {
+	received := c.in.n - uint64(c.r.Buffered())
+	if c.ackWindow == 0 || received-c.acked < uint64(c.ackWindow) {
+		return nil
+	}
+	c.acked = received
+	return c.writeControl(rtmpMsgAck, binary.BigEndian.AppendUint32(nil, uint32(received)))
+}
+
+func (c *rtmpConn) writeControl(typeID byte, payload []byte) error {
+	return c.writeMessage(rtmpControlChunkStream, typeID, 0, payload)
+}
+
+func (c *rtmpConn) writeCommand(csid uint32, streamID uint32, values ...interface{}) error {
+	return c.writeMessage(csid, rtmpMsgCommandAMF0, streamID, amfEncode(values...))
+}
+
+func (c *rtmpConn) writeStatus(publish rtmpPublish, level, code, description string) error {
+	return c.writeCommand(rtmpStatusChunkStream, publish.streamID, "onStatus", 0.0, nil, rtmpStatus(level, code, description))
+}
+
+func rtmpStatus(level, code, description string) amfObject {
+	return amfObject{"level": level, "code": code, "description": description}
+}
+
+// writeMessage отправляет сообщение чанками rtmpOutChunkSize с нулевым временем
+func (c *rtmpConn) writeMessage(csid uint32, typeID byte, streamID uint32, payload []byte) error {
+	header := []byte{byte(csid), 0, 0, 0, byte(len(payload) >> 16), byte(len(payload) >> 8), byte(len(payload)), typeID}
+	header = binary.LittleEndian.AppendUint32(header, streamID)
+	c.w.Write(header)
+	for len(payload) > 0 {
+		n := min(len(payload), rtmpOutChunkSize)
+		c.w.Write(payload[:n])
+		payload = payload[n:]
+		if len(payload) > 0 {
+			c.w.WriteByte(0xC0 | byte(csid))
+		}
+	}
+	return c.w.Flush()
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
+
+// flvWriter пишет публикацию в FLV для ffmpeg -f flv
+type flvWriter struct {
+	w *bufio.Writer
+}
+
+func newFLVWriter(conn net.Conn) *flvWriter {
+	return &flvWriter{w: bufio.NewWriterSize(conn, 64*1024)}
+}
+
+// writeHeader пишет заголовок без флагов аудио и видео, как RTMP-сервер ffmpeg:
+// демультиплексор создает потоки по первым тегам
+func (f *flvWriter) writeHeader() error {
+	f.w.WriteString("FLV\x01\x00\x00\x00\x00\x09\x00\x00\x00\x00")
+	return f.w.Flush()
+}
+
+func (f *flvWriter) writeTag(tagType byte, timestamp uint32, data []byte) error {
+	size := len(data)
+	f.w.Write([]byte{
+		tagType,
+		byte(size >> 16), byte(size >> 8), byte(size),
+		byte(timestamp >> 16), byte(timestamp >> 8), byte(timestamp), byte(timestamp >> 24),
+		0, 0, 0,
+	})
+	f.w.Write(data)
+	f.w.Write(binary.BigEndian.AppendUint32(nil, uint32(11+size)))
+	return f.w.Flush()
+}
+
+// writeAggregate раскладывает агрегатное сообщение на теги FLV: время вложенных
+// тегов отсчитывается от времени сообщения
+func (f *flvWriter) writeAggregate(timestamp uint32, payload []byte) error {
+	var base uint32
+	for first := true; len(payload) >= 11; first = false {
+		size := int(uint24(payload[1:4]))
+		if 11+size+4 > len(payload) {
+			break
+		}
+		tagTime := uint24(payload[4:7]) | uint32(payload[7])<<24
+		if first {
+			base = tagTime
+		}
+		if err := f.writeTag(payload[0]&0x1F, timestamp+tagTime-base, payload[11:11+size]); err != nil {
+			return err
+		}
+		payload = payload[11+size+4:]
+	}
+	return nil
+}
+
+// AMF0: ровно то, что нужно для команд connect/createStream/publish и ответов на них
+
+type (
+	amfObject    map[string]interface{}
+	amfUndefined struct{}
+)
+
+const amfMaxDepth = 16
+
+var errAMF = errors.New("malformed AMF0 data")
+
+func amfDecode(data []byte) ([]interface{}, error) {
+	var values []interface{}
+	for len(data) > 0 {
+		value, rest, err := amfDecodeValue(data, 0)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+		data = rest
+	}
+	return values, nil
+}
+
+func amfDecodeValue(data []byte, depth int) (interface{}, []byte, error) {
+	if len(data) == 0 || depth > amfMaxDepth {
+		return nil, nil, errAMF
+	}
+	marker, data := data[0], data[1:]
+	switch marker {
+	case 0x00: // number
+		if len(data) < 8 {
+			return nil, nil, errAMF
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+	case 0x01: // boolean
+		if len(data) < 1 {
+			return nil, nil, errAMF
+		}
+		return data[0] != 0, data[1:], nil
+	case 0x02: // string
+		return amfDecodeString(data, 2)
+	case 0x0C: // long string
+		return amfDecodeString(data, 4)
+	case 0x03: // object
+		return amfDecodeObject(data, depth)
+	case 0x08: // ECMA array: число элементов, затем пары как у объекта
+		if len(data) < 4 {
+			return nil, nil, errAMF
+		}
+		return amfDecodeObject(data[4:], depth)
+	case 0x0A: // strict array
+		if len(data) < 4 {
+			return nil, nil, errAMF
+		}
+		count := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(count) > uint64(len(data)) {
+			return nil, nil, errAMF
+		}
+		items := make([]interface{}, 0, count)
+		for i := uint32(0); i < count; i++ {
+			item, rest, err := amfDecodeValue(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items, data = append(items, item), rest
+		}
+		return items, data, nil
+	case 0x05: // null
+		return nil, data, nil
+	case 0x06: // undefined
+		return amfUndefined{}, data, nil
+	case 0x0B: // date: миллисекунды и часовой пояс
+		if len(data) < 10 {
+			return nil, nil, errAMF
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[10:], nil
+	}
+	return nil, nil, fmt.Errorf("unsupported AMF0 marker %#x", marker)
+}
+
+func amfDecodeString(data []byte, lengthSize int) (interface{}, []byte, error) {
+	if len(data) < lengthSize {
+		return nil, nil, errAMF
+	}
+	var length uint64
+	if lengthSize == 2 {
+		length = uint64(binary.BigEndian.Uint16(data))
+	} else {
+		length = uint64(binary.BigEndian.Uint32(data))
+	}
+	data = data[lengthSize:]
+	if length > uint64(len(data)) {
+		return nil, nil, errAMF
+	}
+	return string(data[:length]), data[length:], nil
+}
+
+func amfDecodeObject(data []byte, depth int) (interface{}, []byte, error) {
+	object := amfObject{}
+	for {
+		if len(data) < 3 {
+			return nil, nil, errAMF
+		}
+		keyLength := int(binary.BigEndian.Uint16(data))
+		if keyLength == 0 && data[2] == 0x09 {
+			return object, data[3:], nil
+		}
+		if 2+keyLength > len(data) {
+			return nil, nil, errAMF
+		}
+		key := string(data[2 : 2+keyLength])
+		value, rest, err := amfDecodeValue(data[2+keyLength:], depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		object[key], data = value, rest
+	}
+}
+
+func amfEncode(values ...interface{}) []byte {
+	var out []byte
+	for _, value := range values {
+		out = amfAppend(out, value)
+	}
+	return out
+}
+
+func amfAppend(out []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case float64:
+		return binary.BigEndian.AppendUint64(append(out, 0x00), math.Float64bits(v))
+	case bool:
+		if v {
+			return append(out, 0x01, 1)
+		}
+		return append(out, 0x01, 0)
+	case string:
+		out = binary.BigEndian.AppendUint16(append(out, 0x02), uint16(len(v)))
+		return append(out, v...)
+	case amfObject:
+		out = append(out, 0x03)
+		for key, item := range v {
+			out = binary.BigEndian.AppendUint16(out, uint16(len(key)))
+			out = amfAppend(append(out, key...), item)
+		}
+		return append(out, 0, 0, 0x09)
+	case amfUndefined:
+		return append(out, 0x06)
+	}
+	return append(out, 0x05)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// rtmpTestPublisher - энкодер, публикующий в RTMPGate
+type rtmpTestPublisher struct {
+	t *testing.T
+	*rtmpConn
+}
+
+func dialRTMPGate(t *testing.T, port int) *rtmpTestPublisher {
+	t.Helper()
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	c0c1 := make([]byte, 1+rtmpHandshakeSize)
+	c0c1[0] = rtmpVersion
+	if _, err := conn.Write(c0c1); err != nil {
+		t.Fatal(err)
+	}
+	p := &rtmpTestPublisher{t: t, rtmpConn: newRTMPConn(conn)}
+	if _, err := io.ReadFull(p.r, make([]byte, 1+2*rtmpHandshakeSize)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(make([]byte, rtmpHandshakeSize)); err != nil {
+		t.Fatal(err)
+	}
+	p.writeControl(rtmpMsgSetChunkSize, binary.BigEndian.AppendUint32(nil, rtmpOutChunkSize))
+	return p
+}
+
+// call отправляет команду и возвращает первую команду в ответ
+func (p *rtmpTestPublisher) call(streamID uint32, values ...interface{}) []interface{} {
+	p.t.Helper()
+	if err := p.writeCommand(rtmpCommandChunkStream, streamID, values...); err != nil {
+		p.t.Fatal(err)
+	}
+	for {
+		msg, err := p.readMessage()
+		if err != nil {
+			return nil
+		}
+		if values, ok := commandValues(msg); ok {
+			return values
+		}
+	}
+}
+
+// publish проходит connect, createStream и publish и возвращает код статуса
+func (p *rtmpTestPublisher) publish(app, key string) string {
+	p.t.Helper()
+	reply := p.call(0, "connect", 1.0, amfObject{"app": app, "type": "nonprivate"})
+	if len(reply) == 0 || reply[0] != "_result" {
+		return fmt.Sprint(reply)
+	}
+	p.call(0, "releaseStream", 2.0, nil, key)
+	reply = p.call(0, "createStream", 3.0, nil)
+	if len(reply) < 4 {
+		p.t.Fatalf("createStream reply %v", reply)
+	}
+	streamID := uint32(reply[3].(float64))
+	reply = p.call(streamID, "publish", 0.0, nil, key, "live")
+	if len(reply) < 4 {
+		return fmt.Sprint(reply)
+	}
+	status, _ := reply[3].(amfObject)
+	code, _ := status["code"].(string)
+	return code
+}
+
+func startTestRTMPGate(t *testing.T) (*RTMPGate, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	gate, err := StartRTMPGate("rtmp-test", port, "live", "secret-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(gate.Close)
+	return gate, port
+}
+
+// dialFFmpeg подключается к сокету шлюза, как ffmpeg -f flv -i unix:...
+func dialFFmpeg(t *testing.T) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("unix", rtmpSocketPath("rtmp-test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestRTMPGateAcceptsValidKey(t *testing.T) {
+	_, port := startTestRTMPGate(t)
+	ffmpeg := dialFFmpeg(t)
+
+	p := dialRTMPGate(t, port)
+	if code := p.publish("live/", "secret-key?obs=1"); code != "NetStream.Publish.Start" {
+		t.Fatalf("publish status = %q, want NetStream.Publish.Start", code)
+	}
+
+	metadata := append([]byte("\x02\x00\x0d@setDataFrame"), amfEncode("onMetaData", amfObject{"width": 1280.0})...)
+	video := bytes.Repeat([]byte{0x17}, 100<<10) // несколько чанков, больше лимита до проверки ключа
+	p.writeMessage(6, rtmpMsgDataAMF0, 1, metadata)
+	p.writeMessage(6, rtmpMsgVideo, 1, video)
+
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(ffmpeg, header); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(header[:3], []byte("FLV")) {
+		t.Fatalf("FLV header = %x", header)
+	}
+
+	wantTags := []struct {
+		tagType byte
+		data    []byte
+	}{
+		{rtmpMsgDataAMF0, amfEncode("onMetaData", amfObject{"width": 1280.0})},
+		{rtmpMsgVideo, video},
+	}
+	for _, want := range wantTags {
+		tag := make([]byte, 11)
+		if _, err := io.ReadFull(ffmpeg, tag); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, uint24(tag[1:4])+4)
+		if _, err := io.ReadFull(ffmpeg, data); err != nil {
+			t.Fatal(err)
+		}
+		if tag[0] != want.tagType || !bytes.Equal(data[:len(data)-4], want.data) {
+			t.Fatalf("tag type %d with %d bytes, want type %d with %d bytes", tag[0], len(data)-4, want.tagType, len(want.data))
+		}
+	}
+
+	// Вторая публикация при активной первой отклоняется
+	second := dialRTMPGate(t, port)
+	if code := second.publish("live", "secret-key"); code != "NetStream.Publish.BadName" {
+		t.Fatalf("second publish status = %q, want NetStream.Publish.BadName", code)
+	}
+}
+
+func TestRTMPGateRejectsWrongKey(t *testing.T) {
+	_, port := startTestRTMPGate(t)
+	ffmpeg := dialFFmpeg(t)
+
+	p := dialRTMPGate(t, port)
+	if code := p.publish("live", "guessed-key"); code != "NetStream.Publish.BadName" {
+		t.Fatalf("publish status = %q, want NetStream.Publish.BadName", code)
+	}
+
+	// ffmpeg не получает ни байта отклоненной публикации
+	ffmpeg.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := ffmpeg.Read(make([]byte, 1)); n != 0 || err == nil {
+		t.Fatalf("ffmpeg received data of rejected publish: n=%d err=%v", n, err)
+	}
+
+	// После отказа публикация с верным ключом принимается тем же ffmpeg
+	valid := dialRTMPGate(t, port)
+	if code := valid.publish("live", "secret-key"); code != "NetStream.Publish.Start" {
+		t.Fatalf("publish status = %q, want NetStream.Publish.Start", code)
+	}
+}
+
+func TestRTMPGateRejectsWrongApp(t *testing.T) {
+	_, port := startTestRTMPGate(t)
+
+	p := dialRTMPGate(t, port)
+	reply := p.call(0, "connect", 1.0, amfObject{"app": "other"})
+	if len(reply) == 0 || reply[0] != "_error" {
+		t.Fatalf("connect reply = %v, want _error", reply)
+	}
+}
+
+// expectClosed ждет, что шлюз закроет соединение, ничего больше не прислав
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		t.Fatalf("connection is not closed by gate: %v", err)
+	}
+}
+
+func TestRTMPGateRejectsOversizedMessageBeforePublish(t *testing.T) {
+	_, port := startTestRTMPGate(t)
+
+	// Заголовок команды длиной 1 МиБ без данных: шлюз не резервирует память и закрывает соединение
+	p := dialRTMPGate(t, port)
+	header := []byte{0x03, 0, 0, 0, 0x10, 0x00, 0x00, rtmpMsgCommandAMF0, 0, 0, 0, 0}
+	if _, err := p.conn.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	p.w.Flush()
+	expectClosed(t, p.conn)
+}
+
+func TestRTMPGateLimitsPendingConnections(t *testing.T) {
+	_, port := startTestRTMPGate(t)
+	dialFFmpeg(t)
+
+	pending := make([]net.Conn, 0, rtmpMaxPendingConns)
+	for i := 0; i < rtmpMaxPendingConns; i++ {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		pending = append(pending, conn)
+	}
+	// Рукопожатие первых подключений не начато, следующее закрывается сразу
+	extra, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer extra.Close()
+	expectClosed(t, extra)
+
+	// Освободившееся место занимает энкодер с верным ключом
+	for _, conn := range pending {
+		conn.Close()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			break // соединение принято и ждет рукопожатия
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pending connections are not released after close")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	p := dialRTMPGate(t, port)
+	if code := p.publish("live", "secret-key"); code != "NetStream.Publish.Start" {
+		t.Fatalf("publish status = %q, want NetStream.Publish.Start", code)
+	}
+}
+
+func TestRTMPKeyMatches(t *testing.T) {
+	tests := []struct {
+		name, key string
+		want      bool
+	}{
+		{"secret", "secret", true},
+		{"secret?token=1", "secret", true},
+		{"secret2", "secret", false},
+		{"", "secret", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := rtmpKeyMatches(tt.name, tt.key); got != tt.want {
+			t.Errorf("rtmpKeyMatches(%q, %q) = %v, want %v", tt.name, tt.key, got, tt.want)
+		}
+	}
+}
+
+func FuzzAMFDecode(f *testing.F) {
+	f.Add(amfEncode("connect", 1.0, amfObject{"app": "live"}))
+	f.Add([]byte{0x0A, 0xFF, 0xFF, 0xFF, 0xFF})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		amfDecode(data)
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Режимы остановки сервиса по SIGTERM (SHUTDOWN_MODE)
+const (
+	// ShutdownStop - потоки останавливаются, записи закрываются, основное приложение
+	// получает stopped. Журнал сохраняет намерение, и следующий экземпляр запустит их заново.
+	ShutdownStop = "stop"
+	// ShutdownHandoff - ffmpeg продолжает публикацию, следующий экземпляр подключается
+	// к нему по PID-файлам. Потоки, которые подхватить нельзя, останавливаются.
+	ShutdownHandoff = "handoff"
+)
+
+var (
+	// shuttingDown - сервис получил SIGTERM и больше не запускает потоки
+	shuttingDown atomic.Bool
+	// shutdownCh закрывается в начале остановки; по нему завершаются долгие ответы (SSE)
+	shutdownCh = make(chan struct{})
+	// pendingWebhooks - уведомления основного приложения, которые еще доставляются
+	pendingWebhooks atomic.Int64
+)
+
+// errShuttingDown - запуск отклонен, сервис останавливается
+var errShuttingDown = errors.New("streaming service is shutting down")
+
+// sendWebhook доставляет уведомление основному приложению в фоне;
+// при остановке сервис ждет, пока все уведомления уйдут
+func sendWebhook(notify func()) {
+	pendingWebhooks.Add(1)
+	go func() {
+		defer pendingWebhooks.Add(-1)
+		notify()
+	}()
+}
+
+// serveUntilSignal обслуживает HTTP до SIGTERM или SIGINT, затем останавливает сервис
+// по SHUTDOWN_MODE. SIGHUP - перезапуск с передачей потоков независимо от SHUTDOWN_MODE:
+// в контейнере его отправляет супервизор (deployments/streaming-entrypoint.sh),
+// который затем запускает следующий экземпляр.
+func serveUntilSignal(srv *http.Server) {
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	mode := serviceConfig.ShutdownMode
+	select {
+	case err := <-errCh:
+		log.Fatal(err)
+	case sig := <-signals:
+		if sig == syscall.SIGHUP {
+			mode = ShutdownHandoff
+		}
+		log.Printf("🛑 Получен сигнал %s, останавливаем streaming service (режим %s, срок %s)",
+			sig, mode, serviceConfig.ShutdownTimeout)
+	}
+	shutdown(srv, mode)
+}
+
+// shutdown прекращает прием запросов, дожидается текущих, останавливает
+// или передает потоки и доставляет последние уведомления основному приложению
+func shutdown(srv *http.Server, mode string) {
+	ctx, cancel := context.WithTimeout(context.Background(), serviceConfig.ShutdownTimeout)
+	defer cancel()
+
+	shuttingDown.Store(true)
+	close(shutdownCh)
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ Не все HTTP-запросы завершились до срока: %v", err)
+		srv.Close()
+	}
+
+	manager.mutex.RLock()
+	streams := make(map[string]*StreamInstance, len(manager.streams))
+	for streamID, stream := range manager.streams {
+		streams[streamID] = stream
+	}
+	manager.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for streamID, stream := range streams {
+		wg.Add(1)
+		go func(streamID string, stream *StreamInstance) {
+			defer wg.Done()
+			if mode == ShutdownHandoff && canAdopt(stream.Protocol, stream.LowLatency) {
+				handOffStream(streamID, stream)
+				return
+			}
+			teardownStream(streamID, stream)
+			sendWebhook(func() { webhooks.StreamStatus(streamID, "stopped") })
+		}(streamID, stream)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("⚠️ Не все потоки остановлены до срока")
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for pendingWebhooks.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			log.Printf("⚠️ Не доставлено уведомлений основному приложению: %d", pendingWebhooks.Load())
+			return
+		case <-ticker.C:
+		}
+	}
+
+	log.Printf("✅ Streaming service остановлен (потоков: %d)", len(streams))
+}
+
+// handOffStream оставляет ffmpeg потока работать для следующего экземпляра сервиса:
+// PID-файл и запись журнала сохраняются. Ретрансляции останавливаются - их
+// запустит заново экземпляр, подключившийся к ffmpeg.
+func handOffStream(streamID string, stream *StreamInstance) {
+	stopForwarders(stream)
+	hlsWatcher.Unwatch(streamID)
+
+	pid := 0
+	if stream.Pipeline != nil {
+		pid = stream.Pipeline.Status().PID
+	}
+	log.Printf("🤝 Поток %s передан следующему экземпляру: ffmpeg PID %d продолжает работу", streamID, pid)
+}
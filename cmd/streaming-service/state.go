@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DesiredRunning = "running"
+	DesiredStopped = "stopped"
+)
+
+// StreamRecord - запись журнала о потоке, достаточная для его восстановления
+type StreamRecord struct {
+	StreamID     string        `json:"stream_id"`
+	DesiredState string        `json:"desired_state"` // running, stopped
+	SRTPort      int           `json:"srt_port"`
+	RTMPPort     int           `json:"rtmp_port,omitempty"`
+	HLSPath      string        `json:"hls_path"`
+	LogFile      string        `json:"log_file"`
+	LogSession   string        `json:"log_session,omitempty"`
+	StartTime    time.Time     `json:"start_time"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	Options      StreamOptions `json:"options"`
+
+	// SecretsOmitted - в Options не записаны секреты ingest и точки ретрансляции,
+	// перед восстановлением их нужно получить из основного приложения
+	SecretsOmitted bool `json:"secrets_omitted,omitempty"`
+}
+
+type stateSnapshot struct {
+	Version int             `json:"version"`
+	SavedAt time.Time       `json:"saved_at"`
+	Streams []*StreamRecord `json:"streams"`
+}
+
+const stateVersion = 1
+
+// StateStore хранит runtime-состояние streaming service в локальном файле.
+// Каждое изменение записывается целиком во временный файл, синхронизируется
+// на диск и атомарно переименовывается, поэтому файл всегда консистентен.
+type StateStore struct {
+	path    string
+	mu      sync.Mutex
+	records map[string]*StreamRecord
+}
+
+func NewStateStore(path string) *StateStore {
+	return &StateStore{
+		path:    path,
+		records: make(map[string]*StreamRecord),
+	}
+}
+
+// Load читает журнал с диска. Отсутствующий файл не считается ошибкой.
+func (s *StateStore) Load() ([]StreamRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot stateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("corrupted state file %s: %v", s.path, err)
+	}
+	if snapshot.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported state file version %d", snapshot.Version)
+	}
+
+	s.records = make(map[string]*StreamRecord, len(snapshot.Streams))
+	scrubbed := false
+	for _, rec := range snapshot.Streams {
+		if rec != nil && rec.StreamID != "" {
+			// Журналы прежних версий хранили секреты: вычищаем их при загрузке
+			var omitted bool
+			rec.Options, omitted = journalOptions(rec.Options)
+			if omitted {
+				rec.SecretsOmitted = true
+				scrubbed = true
+			}
+			s.records[rec.StreamID] = rec
+		}
+	}
+	if scrubbed {
+		if err := s.flushLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.listLocked(), nil
+}
+
+// Put сохраняет запись о потоке. Секреты из параметров запуска в журнал не попадают.
+func (s *StateStore) Put(rec StreamRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var omitted bool
+	rec.Options, omitted = journalOptions(rec.Options)
+	rec.SecretsOmitted = rec.SecretsOmitted || omitted
+	rec.UpdatedAt = time.Now()
+	s.records[rec.StreamID] = &rec
+	return s.flushLocked()
+}
+
+// SetDesiredState меняет желаемое состояние потока, сохраняя остальные поля
+func (s *StateStore) SetDesiredState(streamID, desired string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[streamID]
+	if !ok {
+		return nil
+	}
+	rec.DesiredState = desired
+	rec.UpdatedAt = time.Now()
+	return s.flushLocked()
+}
+
+// Delete удаляет запись о потоке (поток удален в основном приложении)
+func (s *StateStore) Delete(streamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[streamID]; !ok {
+		return nil
+	}
+	delete(s.records, streamID)
+	return s.flushLocked()
+}
+
+// PruneStopped удаляет записи остановленных потоков, не менявшиеся дольше retention,
+// и возвращает их StreamID. Записи запущенных потоков хранятся без ограничения.
+func (s *StateStore) PruneStopped(retention time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-retention)
+	var pruned []string
+	for id, rec := range s.records {
+		if rec.DesiredState == DesiredStopped && rec.UpdatedAt.Before(cutoff) {
+			delete(s.records, id)
+			pruned = append(pruned, id)
+		}
+	}
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+	sort.Strings(pruned)
+	return pruned, s.flushLocked()
+}
+
+// Get возвращает копию записи о потоке
+func (s *StateStore) Get(streamID string) (StreamRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[streamID]
+	if !ok {
+		return StreamRecord{}, false
+	}
+	return *rec, true
+}
+
+// journalOptions убирает из параметров запуска пароль SRT, ключ RTMP, URL источника
+// и точки ретрансляции, URL которых содержат ключи площадок. Журнал лежит на диске
+// открытым текстом, поэтому эти значения остаются только в основном приложении.
+func journalOptions(options StreamOptions) (StreamOptions, bool) {
+	omitted := options.SRTPassphrase != "" || options.RTMPKey != "" || options.SourceURL != "" || len(options.Destinations) > 0
+	options.SRTPassphrase = ""
+	options.RTMPKey = ""
+	options.SourceURL = ""
+	options.Destinations = nil
+	return options, omitted
+}
+
+// withSecrets возвращает параметры из журнала с секретами из полных параметров основного приложения
+func withSecrets(options, full StreamOptions) StreamOptions {
+	options.SRTPassphrase = full.SRTPassphrase
+	options.RTMPKey = full.RTMPKey
+	options.SourceURL = full.SourceURL
+	options.Destinations = full.Destinations
+	return options
+}
+
+func (s *StateStore) listLocked() []StreamRecord {
+	list := make([]StreamRecord, 0, len(s.records))
+	for _, rec := range s.records {
+		list = append(list, *rec)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartTime.Before(list[j].StartTime)
+	})
+	return list
+}
+
+func (s *StateStore) flushLocked() error {
+	snapshot := stateSnapshot{
+		Version: stateVersion,
+		SavedAt: time.Now(),
+	}
+	for _, rec := range s.listLocked() {
+		rec := rec
+		snapshot.Streams = append(snapshot.Streams, &rec)
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".streams-*.json")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	// Синхронизируем директорию, чтобы переименование пережило сбой питания
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
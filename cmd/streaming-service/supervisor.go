@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RestartPolicy описывает правила перезапуска ffmpeg супервизором.
+// Базовая задержка берется из класса завершения (см. classifyExit) и растет
+// экспоненциально при подряд идущих неудачах.
+type RestartPolicy struct {
+	Multiplier  float64       // множитель задержки для каждой следующей неудачи подряд
+	MaxBackoff  time.Duration // верхняя граница задержки
+	MaxRestarts int           // 0 - перезапускать бесконечно
+	ResetAfter  time.Duration // процесс, проработавший дольше, сбрасывает счетчик неудач
+}
+
+// Backoff возвращает задержку перед перезапуском для failures неудач подряд
+func (p RestartPolicy) Backoff(base time.Duration, failures int) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := time.Duration(float64(base) * math.Pow(multiplier, float64(failures-1)))
+	if p.MaxBackoff > 0 && (delay > p.MaxBackoff || delay < 0) {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// ExitClass - причина завершения ffmpeg
+type ExitClass string
+
+const (
+	ExitClean   ExitClass = "clean"   // код 0
+	ExitEOF     ExitClass = "eof"     // код 1: EOF / потеря соединения с энкодером
+	ExitNetwork ExitClass = "network" // код 255: сетевая ошибка
+	ExitError   ExitClass = "error"   // прочие коды, ошибки запуска, сигналы
+)
+
+// classifyExit повторяет анализ кодов завершения из прежнего wrapper-скрипта
+// и возвращает класс вместе с базовой задержкой перезапуска
+func classifyExit(code int) (ExitClass, time.Duration) {
+	switch code {
+	case 0:
+		return ExitClean, 2 * time.Second
+	case 1:
+		return ExitEOF, 1 * time.Second
+	case 255:
+		return ExitNetwork, 2 * time.Second
+	default:
+		return ExitError, 5 * time.Second
+	}
+}
+
+// Supervisor владеет дочерним процессом ffmpeg одного потока:
+// запускает его, перезапускает по RestartPolicy и останавливает через отмену контекста.
+type Supervisor struct {
+	streamID    string
+	binary      string
+	args        []string
+	log         io.Writer
+	policy      RestartPolicy
+	stopTimeout time.Duration
+
+	// OnEvent вызывается после каждого запуска, завершения и перезапуска процесса
+	OnEvent func(PipelineEvent)
+	// PIDFile - куда записывать PID текущего ffmpeg для повторного подключения после рестарта сервиса
+	PIDFile string
+	// Stdout - куда направлять stdout процесса (по умолчанию в лог); используется
+	// для MPEG-TS, который упаковывает LL-HLS упаковщик
+	Stdout io.Writer
+	// Progress получает вывод -progress из дескриптора progressFD; ffmpeg должен
+	// запускаться с -progress pipe:3, иначе pipe просто не используется
+	Progress io.Writer
+	// SCTE35 получает секции SCTE-35 из дескриптора scte35FD (-f data pipe:4)
+	SCTE35 io.Writer
+
+	mu       sync.Mutex
+	state    PipelineStatus
+	adoptPID int
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewSupervisor(streamID, binary string, args []string, logWriter io.Writer, policy RestartPolicy, stopTimeout time.Duration) *Supervisor {
+	return &Supervisor{
+		streamID:    streamID,
+		binary:      binary,
+		args:        args,
+		log:         logWriter,
+		policy:      policy,
+		stopTimeout: stopTimeout,
+	}
+}
+
+// Start запускает цикл супервизора в фоне. Повторный вызов возвращает ошибку.
+func (s *Supervisor) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done != nil {
+		return errors.New("supervisor already started")
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	go s.run(ctx)
+	return nil
+}
+
+// Adopt запускает цикл супервизора, который сначала сопровождает уже работающий
+// ffmpeg с указанным PID (оставшийся от предыдущего экземпляра сервиса),
+// а после его завершения перезапускает ffmpeg обычным образом
+func (s *Supervisor) Adopt(ctx context.Context, pid int) error {
+	s.mu.Lock()
+	s.adoptPID = pid
+	s.mu.Unlock()
+	return s.Start(ctx)
+}
+
+// Stop отменяет контекст (ffmpeg получает SIGTERM, затем SIGKILL по таймауту)
+// и ждет завершения цикла супервизора
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Done закрывается, когда цикл супервизора завершен
+func (s *Supervisor) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// State возвращает копию текущего состояния
+func (s *Supervisor) State() PipelineStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *Supervisor) run(ctx context.Context) {
+	defer close(s.done)
+
+	s.logf("🚀 Запуск супервизора для потока %s", s.streamID)
+	failures := 0
+
+	s.mu.Lock()
+	adoptPID := s.adoptPID
+	s.mu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		startedAt := time.Now()
+		var code int
+		if attempt == 1 && adoptPID > 0 {
+			s.logf("🔗 Подключение к работающему FFmpeg PID %d для потока %s", adoptPID, s.streamID)
+			code = s.waitAdopted(ctx, adoptPID)
+		} else {
+			s.logf("🔄 Запуск FFmpeg для потока %s (попытка #%d)", s.streamID, attempt)
+			code = s.runOnce(ctx)
+		}
+
+		if ctx.Err() != nil {
+			s.logf("🏁 Супервизор потока %s остановлен (перезапусков: %d)", s.streamID, s.State().RestartCount)
+			return
+		}
+
+		class, base := classifyExit(code)
+		if attempt == 1 && adoptPID > 0 {
+			// Код завершения чужого дочернего процесса недоступен - перезапускаем как после EOF
+			class, base = classifyExit(1)
+		}
+		switch class {
+		case ExitClean:
+			s.logf("✅ FFmpeg завершился корректно (код %d)", code)
+		case ExitEOF:
+			s.logf("🔌 FFmpeg завершился из-за EOF/потери соединения (код %d)", code)
+		case ExitNetwork:
+			s.logf("📡 FFmpeg завершился из-за сетевой ошибки (код %d)", code)
+		default:
+			s.logf("❌ FFmpeg завершился с ошибкой %d", code)
+		}
+
+		if s.policy.ResetAfter > 0 && time.Since(startedAt) >= s.policy.ResetAfter {
+			failures = 0
+		}
+		failures++
+
+		if s.policy.MaxRestarts > 0 && s.State().RestartCount >= s.policy.MaxRestarts {
+			s.logf("⚠️ Достигнут лимит перезапусков (%d), супервизор потока %s сдается", s.policy.MaxRestarts, s.streamID)
+			s.update(EventPipelineFailed, func(st *PipelineStatus) { st.GaveUp = true })
+			return
+		}
+
+		delay := s.policy.Backoff(base, failures)
+		s.logf("⏳ Перезапуск через %s (неудач подряд: %d)", delay, failures)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.logf("🏁 Супервизор потока %s остановлен (перезапусков: %d)", s.streamID, s.State().RestartCount)
+			return
+		case <-timer.C:
+		}
+
+		s.update(EventProcessRestarting, func(st *PipelineStatus) { st.RestartCount++ })
+	}
+}
+
+// runOnce запускает ffmpeg один раз и возвращает код завершения (-1 при ошибке запуска или сигнале)
+func (s *Supervisor) runOnce(ctx context.Context) int {
+	cmd := exec.CommandContext(ctx, s.binary, s.args...)
+	cmd.Stdout = s.log
+	if s.Stdout != nil {
+		cmd.Stdout = s.Stdout
+	}
+	cmd.Stderr = s.log
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = s.stopTimeout
+	// Отдельная группа процессов: ffmpeg переживает перезапуск сервиса и может быть усыновлен
+	cmd.SysProcAttr = detachedProcAttr()
+
+	// Дескрипторы начиная с 3: -progress (progressFD) и секции SCTE-35 (scte35FD).
+	// Усыновленный после рестарта сервиса ffmpeg пишет в закрытый pipe:
+	// ffmpeg игнорирует SIGPIPE, поэтому теряются только метрики и метки
+	outputs := []io.Writer{s.Progress, s.SCTE35}
+	for len(outputs) > 0 && outputs[len(outputs)-1] == nil {
+		outputs = outputs[:len(outputs)-1]
+	}
+	readers := make([]*os.File, 0, len(outputs))
+	closePipes := func() {
+		for _, f := range append(readers, cmd.ExtraFiles...) {
+			f.Close()
+		}
+	}
+	for range outputs {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			s.logf("❌ Не удалось создать pipe для ffmpeg: %v", err)
+			closePipes()
+			s.recordExit(-1)
+			return -1
+		}
+		readers = append(readers, reader)
+		cmd.ExtraFiles = append(cmd.ExtraFiles, writer)
+	}
+
+	if err := cmd.Start(); err != nil {
+		s.logf("❌ Не удалось запустить FFmpeg: %v", err)
+		closePipes()
+		s.recordExit(-1)
+		return -1
+	}
+
+	for i, output := range outputs {
+		// Родителю копия пишущего конца не нужна: EOF придет с завершением ffmpeg
+		cmd.ExtraFiles[i].Close()
+		if output == nil {
+			output = io.Discard
+		}
+		go func(reader *os.File, output io.Writer) {
+			defer reader.Close()
+			io.Copy(output, reader)
+		}(readers[i], output)
+	}
+
+	pid := cmd.Process.Pid
+	s.logf("📊 FFmpeg запущен с PID %d", pid)
+	s.update(EventProcessStarted, func(st *PipelineStatus) { st.PID = pid })
+	s.writePIDFile(pid)
+
+	err := cmd.Wait()
+	s.removePIDFile()
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else {
+			code = -1
+		}
+	}
+
+	s.recordExit(code)
+	return code
+}
+
+// waitAdopted ждет завершения усыновленного процесса. Дождаться его через Wait
+// нельзя (это не наш дочерний процесс), поэтому состояние проверяется опросом.
+// При отмене контекста процесс получает SIGTERM, а по таймауту - SIGKILL.
+func (s *Supervisor) waitAdopted(ctx context.Context, pid int) int {
+	s.update(EventProcessStarted, func(st *PipelineStatus) { st.PID = pid })
+	s.writePIDFile(pid)
+	defer s.removePIDFile()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for processAlive(pid) {
+		select {
+		case <-ctx.Done():
+			terminateProcess(pid, s.stopTimeout)
+			s.recordExit(-1)
+			return -1
+		case <-ticker.C:
+		}
+	}
+
+	s.logf("🔌 Усыновленный FFmpeg PID %d завершился", pid)
+	s.recordExit(-1)
+	return -1
+}
+
+func (s *Supervisor) writePIDFile(pid int) {
+	if s.PIDFile == "" {
+		return
+	}
+	if err := os.WriteFile(s.PIDFile, []byte(strconv.Itoa(pid)+"\n"), 0o644); err != nil {
+		s.logf("⚠️ Не удалось записать PID-файл %s: %v", s.PIDFile, err)
+	}
+}
+
+func (s *Supervisor) removePIDFile() {
+	if s.PIDFile != "" {
+		os.Remove(s.PIDFile)
+	}
+}
+
+func (s *Supervisor) recordExit(code int) {
+	now := time.Now()
+	s.update(EventProcessExited, func(st *PipelineStatus) {
+		st.PID = 0
+		st.LastExitCode = &code
+		st.LastExitTime = &now
+	})
+}
+
+func (s *Supervisor) update(eventType PipelineEventType, fn func(*PipelineStatus)) {
+	s.mu.Lock()
+	fn(&s.state)
+	state := s.state
+	s.mu.Unlock()
+
+	if s.OnEvent != nil {
+		s.OnEvent(PipelineEvent{
+			Type:     eventType,
+			StreamID: s.streamID,
+			Time:     time.Now(),
+			Status:   state,
+		})
+	}
+}
+
+func (s *Supervisor) logf(format string, args ...interface{}) {
+	if s.log == nil {
+		return
+	}
+	fmt.Fprintf(s.log, "%s: %s\n", time.Now().Format(time.RFC1123), fmt.Sprintf(format, args...))
+}
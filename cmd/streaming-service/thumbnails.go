@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// thumbnailsDir - каталог снимков внутри HLS-каталога потока; очищается вместе с ним
+const thumbnailsDir = "thumbnails"
+
+// ThumbnailState - последние снимки потока. Stale выставляется, когда монитор
+// возвращает поток в starting: снимок больше не соответствует эфиру.
+type ThumbnailState struct {
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	Stale     bool       `json:"stale"`
+	History   []string   `json:"history,omitempty"` // имена файлов от старых к новым
+}
+
+// Latest - имя последнего снимка или пустая строка
+func (t ThumbnailState) Latest() string {
+	if len(t.History) == 0 {
+		return ""
+	}
+	return t.History[len(t.History)-1]
+}
+
+// thumbnailSource выбирает сегмент с видео, из которого делается снимок
+func thumbnailSource(stream *StreamInstance) (string, error) {
+	switch {
+	case stream.Packaging == PackagingCMAF:
+		// Представление 0 - видео (в transcode - старшая ступень)
+		matches, _ := filepath.Glob(filepath.Join(stream.HLSPath, "chunk_0_*.m4s"))
+		if len(matches) == 0 {
+			return "", fmt.Errorf("no cmaf segments yet")
+		}
+		sort.Strings(matches)
+		// fMP4-фрагмент декодируется только вместе с init-сегментом
+		return "concat:" + filepath.Join(stream.HLSPath, "init_0.m4s") + "|" + matches[len(matches)-1], nil
+
+	case stream.Mode == ModeTranscode:
+		for _, r := range stream.Renditions {
+			if !r.AudioOnly {
+				path, _, err := newestSegmentFile(filepath.Join(stream.HLSPath, r.Name))
+				return path, err
+			}
+		}
+		return "", fmt.Errorf("no video renditions")
+	}
+
+	path, _, err := newestSegmentFile(stream.HLSPath)
+	return path, err
+}
+
+// newestSegmentFile - самый свежий медиасегмент в каталоге и подкаталогах
+func newestSegmentFile(dir string) (string, time.Time, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	newestPath, newestModTime := "", time.Time{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if entry.Name() == thumbnailsDir {
+				continue
+			}
+			if path, modTime, err := newestSegmentFile(filepath.Join(dir, entry.Name())); err == nil && modTime.After(newestModTime) {
+				newestPath, newestModTime = path, modTime
+			}
+			continue
+		}
+		if isSegmentFile(entry.Name()) {
+			if info, err := entry.Info(); err == nil && info.ModTime().After(newestModTime) {
+				newestPath, newestModTime = filepath.Join(dir, entry.Name()), info.ModTime()
+			}
+		}
+	}
+	if newestPath == "" {
+		return "", time.Time{}, nil
+	}
+	return newestPath, newestModTime, nil
+}
+
+// captureThumbnail снимает один кадр из сегмента в JPEG
+func captureThumbnail(ctx context.Context, source, output string) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, serviceConfig.FFmpegPath,
+		"-hide_banner",
+		"-loglevel", "error",
+		"-y",
+		"-i", source,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=-2:%d", serviceConfig.ThumbnailHeight),
+		"-q:v", "5",
+		output,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// runThumbnailer снимает кадр каждые THUMBNAIL_INTERVAL, пока поток в running,
+// и хранит THUMBNAIL_HISTORY последних снимков
+func runThumbnailer(streamID string, instance *StreamInstance) {
+	if serviceConfig.ThumbnailInterval <= 0 {
+		return
+	}
+
+	dir := filepath.Join(instance.HLSPath, thumbnailsDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("⚠️ Не удалось создать каталог снимков потока %s: %v", streamID, err)
+		return
+	}
+
+	ticker := time.NewTicker(serviceConfig.ThumbnailInterval)
+	defer ticker.Stop()
+
+	lastError := ""
+	for range ticker.C {
+		manager.mutex.RLock()
+		stream, exists := manager.streams[streamID]
+		running := exists && stream == instance && stream.Status == "running"
+		manager.mutex.RUnlock()
+
+		if !exists || stream != instance {
+			return
+		}
+		if !running {
+			continue
+		}
+
+		source, err := thumbnailSource(instance)
+		if err == nil && source == "" {
+			continue
+		}
+
+		now := time.Now()
+		name := fmt.Sprintf("thumb_%d.jpg", now.Unix())
+		if err == nil {
+			err = captureThumbnail(context.Background(), source, filepath.Join(dir, name))
+		}
+		if err != nil {
+			// Одинаковые ошибки подряд не засоряют лог
+			if err.Error() != lastError {
+				log.Printf("⚠️ Не удалось снять кадр потока %s: %v", streamID, err)
+				lastError = err.Error()
+			}
+			continue
+		}
+		lastError = ""
+
+		manager.mutex.Lock()
+		// Монитор мог вернуть поток в starting, пока ffmpeg снимал кадр
+		if instance.Status != "running" {
+			manager.mutex.Unlock()
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		instance.Thumbnail.History = append(instance.Thumbnail.History, name)
+		instance.Thumbnail.UpdatedAt = &now
+		instance.Thumbnail.Stale = false
+
+		var expired []string
+		if extra := len(instance.Thumbnail.History) - max(serviceConfig.ThumbnailHistory, 1); extra > 0 {
+			expired = append(expired, instance.Thumbnail.History[:extra]...)
+			instance.Thumbnail.History = append([]string(nil), instance.Thumbnail.History[extra:]...)
+		}
+		manager.mutex.Unlock()
+
+		for _, old := range expired {
+			os.Remove(filepath.Join(dir, old))
+		}
+	}
+}
+
+// thumbnailURL - публичный адрес последнего снимка потока
+func thumbnailURL(cdnDomain, streamID string) string {
+	return fmt.Sprintf("https://%s/api/hls/%s/thumbnail.jpg", cdnDomain, streamID)
+}
+
+// serveThumbnail отдает /api/hls/{id}/thumbnail.jpg (последний снимок)
+// и /api/hls/{id}/thumbnails/{file}.jpg (снимок из истории)
+func serveThumbnail(w http.ResponseWriter, r *http.Request, streamID, name string) {
+	manager.mutex.RLock()
+	stream, exists := manager.streams[streamID]
+	var state ThumbnailState
+	var hlsPath string
+	if exists {
+		state = stream.Thumbnail
+		state.History = append([]string(nil), stream.Thumbnail.History...)
+		hlsPath = stream.HLSPath
+	}
+	manager.mutex.RUnlock()
+
+	if !exists {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	file := ""
+	if name == "thumbnail.jpg" {
+		file = state.Latest()
+	} else {
+		for _, h := range state.History {
+			if "thumbnails/"+h == name {
+				file = h
+			}
+		}
+	}
+	if file == "" {
+		http.Error(w, "Thumbnail not available", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Thumbnail-Stale", fmt.Sprint(state.Stale))
+	if state.UpdatedAt != nil {
+		w.Header().Set("X-Thumbnail-Updated-At", state.UpdatedAt.UTC().Format(time.RFC3339))
+	}
+	http.ServeFile(w, r, filepath.Join(hlsPath, thumbnailsDir, file))
+}
+
+// thumbnailInfo - описание снимков для API
+func thumbnailInfo(cdnDomain string, stream *StreamInstance) map[string]interface{} {
+	history := make([]string, 0, len(stream.Thumbnail.History))
+	for _, name := range stream.Thumbnail.History {
+		history = append(history, fmt.Sprintf("https://%s/api/hls/%s/%s/%s", cdnDomain, stream.StreamID, thumbnailsDir, name))
+	}
+	return map[string]interface{}{
+		"url":        thumbnailURL(cdnDomain, stream.StreamID),
+		"available":  stream.Thumbnail.Latest() != "",
+		"stale":      stream.Thumbnail.Stale,
+		"updated_at": stream.Thumbnail.UpdatedAt,
+		"history":    history,
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	mediaPlaylistName  = "playlist.m3u8"
+	masterPlaylistName = "master.m3u8"
+
+	// hlsSegmentSeconds - длительность сегмента; ключевые кадры при перекодировании
+	// выравниваются по ней, чтобы варианты лестницы переключались на границах сегментов
+	hlsSegmentSeconds = 4
+)
+
+// PlaylistName - точка входа для плеера: master.m3u8 в режиме transcode, в CMAF
+// и у потоков с субтитрами (дорожки объявляются только в master)
+func (s *StreamInstance) PlaylistName() string {
+	if s.Mode == ModeTranscode || s.Packaging == PackagingCMAF || s.Captions != nil {
+		return masterPlaylistName
+	}
+	return mediaPlaylistName
+}
+
+// renditionsInfo описывает варианты лестницы для API
+func renditionsInfo(cdnDomain string, stream *StreamInstance) []map[string]interface{} {
+	renditions := make([]map[string]interface{}, 0, len(stream.Renditions))
+	for _, r := range stream.Renditions {
+		playlist := filepath.Join(r.Name, mediaPlaylistName)
+		if stream.Packaging == PackagingCMAF {
+			playlist = cmafVariantPlaylist(stream.Renditions, r.Name)
+		}
+		info := map[string]interface{}{
+			"name":          r.Name,
+			"audio_only":    r.AudioOnly,
+			"audio_bitrate": r.AudioBitrate,
+			"bandwidth":     (r.VideoBitrate + r.AudioBitrate) * 1000,
+			"playlist_url":  fmt.Sprintf("https://%s/hls/%s/%s", cdnDomain, stream.StreamID, playlist),
+		}
+		if !r.AudioOnly {
+			info["width"] = r.Width
+			info["height"] = r.Height
+			info["video_bitrate"] = r.VideoBitrate
+		}
+		renditions = append(renditions, info)
+	}
+	return renditions
+}
+
+// transcodeArgs формирует кодирование ABR-лестницы и var_stream_map для HLS-муксера
+func transcodeArgs(renditions []Rendition) (args []string, varStreamMap string) {
+	var video []Rendition
+	for _, r := range renditions {
+		if !r.AudioOnly {
+			video = append(video, r)
+		}
+	}
+
+	if len(video) > 0 {
+		var filter strings.Builder
+		fmt.Fprintf(&filter, "[0:v]split=%d", len(video))
+		for i := range video {
+			fmt.Fprintf(&filter, "[v%d]", i)
+		}
+		for i, r := range video {
+			fmt.Fprintf(&filter, ";[v%d]scale=-2:%d[v%dout]", i, r.Height, i)
+		}
+		args = append(args, "-filter_complex", filter.String())
+	}
+
+	var entries []string
+	videoIdx, audioIdx := 0, 0
+	for _, r := range renditions {
+		if r.AudioOnly {
+			args = append(args, "-map", "0:a:0")
+			entries = append(entries, fmt.Sprintf("a:%d,name:%s", audioIdx, r.Name))
+		} else {
+			args = append(args,
+				"-map", fmt.Sprintf("[v%dout]", videoIdx),
+				"-map", "0:a:0",
+				fmt.Sprintf("-b:v:%d", videoIdx), fmt.Sprintf("%dk", r.VideoBitrate),
+				fmt.Sprintf("-maxrate:v:%d", videoIdx), fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+				fmt.Sprintf("-bufsize:v:%d", videoIdx), fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+			)
+			entries = append(entries, fmt.Sprintf("v:%d,a:%d,name:%s", videoIdx, audioIdx, r.Name))
+			videoIdx++
+		}
+		args = append(args, fmt.Sprintf("-b:a:%d", audioIdx), fmt.Sprintf("%dk", r.AudioBitrate))
+		audioIdx++
+	}
+
+	args = append(args,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-profile:v", "main",
+		"-sc_threshold", "0",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsSegmentSeconds),
+		"-c:a", "aac",
+		"-ac", "2",
+	)
+
+	return args, strings.Join(entries, " ")
+}
+
+// renditionDirs - каталоги вариантов внутри HLS-директории потока
+func renditionDirs(hlsPath string, renditions []Rendition) []string {
+	dirs := make([]string, 0, len(renditions))
+	for _, r := range renditions {
+		dirs = append(dirs, filepath.Join(hlsPath, r.Name))
+	}
+	return dirs
+}
@@ -0,0 +1,16 @@
+package main
+
+// WebhookNotifier доставляет уведомления основному приложению. Вызывается
+// из sendWebhook, поэтому реализация может ждать ответа и повторять запрос.
+type WebhookNotifier interface {
+	StreamStatus(streamID, status string)
+	StreamEvent(event StreamEventRequest)
+	StreamMedia(streamID string, info MediaInfo)
+	RecordingCreated(info RecordingInfo)
+}
+
+// mainAppWebhooks отправляет уведомления в основное приложение по HTTP (MAIN_APP_URL)
+type mainAppWebhooks struct{}
+
+// webhooks - получатель уведомлений; тесты подменяют его, чтобы не ходить в сеть
+var webhooks WebhookNotifier = mainAppWebhooks{}
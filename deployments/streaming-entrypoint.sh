@@ -0,0 +1,44 @@
+#!/bin/sh
+# Супервизор streaming service в контейнере. PID 1 - tini: ffmpeg, переживший сервис,
+# переходит к нему, поэтому контейнер живет, пока работает этот скрипт, а не сам сервис.
+#
+#   SIGTERM, SIGINT (docker stop) - передаются сервису, он останавливается по SHUTDOWN_MODE,
+#                                   скрипт выходит вместе с ним, контейнер завершается
+#   SIGHUP (docker kill -s HUP)   - сервис передает потоки (handoff) и выходит, скрипт
+#                                   запускает новый экземпляр, он подключается к тем же ffmpeg
+#   падение сервиса               - скрипт запускает новый экземпляр, он подключается к ffmpeg
+set -u
+
+service_pid=0
+stopping=0
+
+forward() {
+    if [ "$service_pid" -ne 0 ]; then
+        kill -"$1" "$service_pid" 2>/dev/null
+    fi
+}
+
+trap 'stopping=1; forward TERM' TERM INT
+trap 'forward HUP' HUP
+
+while :; do
+    "$@" &
+    service_pid=$!
+
+    # wait прерывается сигналом, поэтому ждем, пока процесс действительно завершится
+    while :; do
+        wait "$service_pid"
+        status=$?
+        kill -0 "$service_pid" 2>/dev/null || break
+    done
+    service_pid=0
+
+    if [ "$stopping" -eq 1 ]; then
+        exit "$status"
+    fi
+    echo "🔄 streaming service завершился с кодом $status, запускаем заново"
+    sleep 1
+    if [ "$stopping" -eq 1 ]; then
+        exit 0
+    fi
+done
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"my-go-app/internal/domain/stream"
+	"my-go-app/pkg/config"
+	"my-go-app/pkg/middleware"
+)
+
+// maxCaptionsRequestBytes - предел тела запроса с фразами субтитров
+const maxCaptionsRequestBytes = 1 << 20
+
+// handleCaptions проксирует текстовые дорожки потока в streaming service
+//
+// Поддерживаемые методы:
+//
+//	GET  /api/streams/{stream_id}/captions - дорожки WebVTT и каналы CEA-608/708 потока
+//	POST /api/streams/{stream_id}/captions - фразы для дорожки WebVTT:
+//	     {"language": "ru", "cues": [{"text": "...", "start": "...", "end": "..."}]}
+//
+// Фразы сразу попадают в эфир, поэтому оба метода требуют токен API.
+func (h *StreamHandler) handleCaptions(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream) {
+	if !middleware.IsAuthorized(r, h.apiToken) {
+		response := middleware.Response{
+			Message: "Authorization required",
+			Error:   "unauthorized",
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(streamEntity.SubtitleLanguages) == 0 && len(streamEntity.ClosedCaptions) == 0 {
+		response := middleware.Response{
+			Message: "Captions are not enabled for this stream",
+			Error:   "set subtitle_languages or closed_captions when creating the stream",
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	targetURL := fmt.Sprintf("%s/api/streams/%s/captions",
+		config.GetEnv("STREAMING_SERVICE_URL", "http://streaming-service:8081"), url.PathEscape(streamEntity.StreamID))
+
+	var body io.Reader
+	if r.Method == "POST" {
+		body = http.MaxBytesReader(w, r.Body, maxCaptionsRequestBytes)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, body)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+h.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("❌ Failed to send captions of stream %s: %v", streamEntity.StreamID, err)
+		response := middleware.Response{
+			Message: "Failed to communicate with streaming service",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Ответ streaming service (в том числе 404, если поток не запущен) отдается как есть
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"my-go-app/internal/domain/stream"
+	"my-go-app/pkg/config"
+	"my-go-app/pkg/middleware"
+)
+
+// maxCueRequestBytes - предел тела запроса рекламной паузы
+const maxCueRequestBytes = 4 << 10
+
+// handleCues проксирует рекламные паузы потока в streaming service
+//
+// Поддерживаемые методы:
+//
+//	GET  /api/streams/{stream_id}/cues - паузы текущей сессии
+//	POST /api/streams/{stream_id}/cues - пауза с ближайшей границы сегмента:
+//	     {"duration_seconds": 30}
+//
+// Пауза сразу попадает в эфир, поэтому оба метода требуют токен API.
+// Поставленные и пришедшие в ingest паузы сохраняются в истории событий потока.
+func (h *StreamHandler) handleCues(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream) {
+	if !middleware.IsAuthorized(r, h.apiToken) {
+		response := middleware.Response{
+			Message: "Authorization required",
+			Error:   "unauthorized",
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !streamEntity.AdCues {
+		response := middleware.Response{
+			Message: "Ad cues are not enabled for this stream",
+			Error:   "set ad_cues when creating the stream",
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	targetURL := fmt.Sprintf("%s/api/streams/%s/cues",
+		config.GetEnv("STREAMING_SERVICE_URL", "http://streaming-service:8081"), url.PathEscape(streamEntity.StreamID))
+
+	var body io.Reader
+	if r.Method == "POST" {
+		body = http.MaxBytesReader(w, r.Body, maxCueRequestBytes)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, body)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+h.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("❌ Failed to send ad cue of stream %s: %v", streamEntity.StreamID, err)
+		response := middleware.Response{
+			Message: "Failed to communicate with streaming service",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Ответ streaming service (в том числе 404, если поток не запущен) отдается как есть
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// handleEvents возвращает историю событий потока (рекламные паузы), новые первыми
+//
+//	GET /api/streams/{stream_id}/events?limit=100
+func (h *StreamHandler) handleEvents(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	events, err := h.eventService.ListEvents(r.Context(), streamEntity.StreamID, limit)
+	if err != nil {
+		response := middleware.Response{
+			Message: "Failed to get stream events",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := middleware.Response{
+		Message: "Stream events retrieved successfully",
+		Data:    events,
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"my-go-app/internal/application/services"
+	"my-go-app/internal/domain/stream"
+	"my-go-app/pkg/config"
+	"my-go-app/pkg/middleware"
+)
+
+// handleDestinations обрабатывает точки ретрансляции потока (simulcast)
+//
+// Поддерживаемые методы:
+//
+//	GET    /api/streams/{stream_id}/destinations      - список точек с состоянием ретрансляции
+//	POST   /api/streams/{stream_id}/destinations      - новая точка {"name", "url", "enabled"}
+//	GET    /api/streams/{stream_id}/destinations/{id} - одна точка
+//	PUT    /api/streams/{stream_id}/destinations/{id} - замена name и url (+ enabled)
+//	PATCH  /api/streams/{stream_id}/destinations/{id} - изменение переданных полей, например {"enabled": false}
+//	DELETE /api/streams/{stream_id}/destinations/{id} - удаление точки
+//
+// URL точек содержат ключи публикации, поэтому изменения требуют токен API,
+// а без него URL в ответах маскируются. Изменения активного потока сразу
+// передаются в streaming service.
+func (h *StreamHandler) handleDestinations(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream, idStr string) {
+	ctx := r.Context()
+	authorized := middleware.IsAuthorized(r, h.apiToken)
+
+	if r.Method != "GET" && !authorized {
+		response := middleware.Response{
+			Message: "Authorization required",
+			Error:   "unauthorized",
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if idStr == "" {
+		switch r.Method {
+		case "GET":
+			destinations, err := h.destinationService.ListDestinations(ctx, streamEntity.StreamID)
+			if err != nil {
+				response := middleware.Response{
+					Message: "Failed to get destinations",
+					Error:   err.Error(),
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+			h.attachForwarderStatus(r, streamEntity, destinations)
+			for _, dest := range destinations {
+				h.exposeDestinationURL(r, dest)
+			}
+
+			response := middleware.Response{
+				Message: "Destinations retrieved successfully",
+				Data:    destinations,
+			}
+			json.NewEncoder(w).Encode(response)
+
+		case "POST":
+			var req services.DestinationRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				response := middleware.Response{
+					Message: "Invalid request format",
+					Error:   err.Error(),
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+
+			dest, err := h.destinationService.CreateDestination(ctx, streamEntity.StreamID, &req)
+			if err != nil {
+				response := middleware.Response{
+					Message: "Failed to create destination",
+					Error:   err.Error(),
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+
+			h.syncDestinations(r, streamEntity)
+			w.WriteHeader(http.StatusCreated)
+			response := middleware.Response{
+				Message: "Destination created successfully",
+				Data:    dest,
+			}
+			json.NewEncoder(w).Encode(response)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		response := middleware.Response{
+			Message: "Invalid destination ID",
+			Error:   "expected /api/streams/{stream_id}/destinations/{id}",
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	dest, err := h.destinationService.GetDestination(ctx, streamEntity.StreamID, uint(id))
+	if err != nil {
+		response := middleware.Response{
+			Message: "Destination not found",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		h.attachForwarderStatus(r, streamEntity, []*stream.Destination{dest})
+		h.exposeDestinationURL(r, dest)
+		response := middleware.Response{
+			Message: "Destination found",
+			Data:    dest,
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case "PUT", "PATCH":
+		var req services.DestinationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response := middleware.Response{
+				Message: "Invalid request format",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		if r.Method == "PUT" && (req.Name == nil || req.URL == nil) {
+			response := middleware.Response{
+				Message: "Invalid request format",
+				Error:   "name and url are required for PUT, use PATCH for partial updates",
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		updated, err := h.destinationService.UpdateDestination(ctx, streamEntity.StreamID, dest.ID, &req)
+		if err != nil {
+			response := middleware.Response{
+				Message: "Failed to update destination",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		h.syncDestinations(r, streamEntity)
+		response := middleware.Response{
+			Message: "Destination updated successfully",
+			Data:    updated,
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case "DELETE":
+		if err := h.destinationService.DeleteDestination(ctx, streamEntity.StreamID, dest.ID); err != nil {
+			response := middleware.Response{
+				Message: "Failed to delete destination",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		h.syncDestinations(r, streamEntity)
+		response := middleware.Response{
+			Message: "Destination deleted successfully",
+		}
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// exposeDestinationURL маскирует ключ публикации в URL точки для неавторизованного вызова
+func (h *StreamHandler) exposeDestinationURL(r *http.Request, dest *stream.Destination) {
+	if !middleware.IsAuthorized(r, h.apiToken) {
+		dest.URL = stream.RedactDestinationURL(dest.URL)
+	}
+}
+
+// syncDestinations передает включенные точки в streaming service, если поток активен.
+// Ошибка не отменяет изменение в базе: точки применятся при следующем запуске потока.
+func (h *StreamHandler) syncDestinations(r *http.Request, streamEntity *stream.Stream) {
+	if streamEntity.StreamStatus != stream.StatusStarting && streamEntity.StreamStatus != stream.StatusRunning {
+		return
+	}
+
+	specs, err := h.destinationService.EnabledSpecs(r.Context(), streamEntity.StreamID)
+	if err != nil {
+		log.Printf("❌ Failed to load destinations of stream %s: %v", streamEntity.StreamID, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{"destinations": specs})
+	if err != nil {
+		return
+	}
+
+	targetURL := fmt.Sprintf("%s/api/streams/%s/destinations",
+		config.GetEnv("STREAMING_SERVICE_URL", "http://streaming-service:8081"), url.PathEscape(streamEntity.StreamID))
+	req, err := http.NewRequest(http.MethodPut, targetURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("❌ Failed to sync destinations of stream %s: %v", streamEntity.StreamID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("⚠️ Streaming service rejected destinations of stream %s: status %d", streamEntity.StreamID, resp.StatusCode)
+		return
+	}
+	log.Printf("📡 Destinations of stream %s synced: %d enabled", streamEntity.StreamID, len(specs))
+}
+
+// attachForwarderStatus добавляет к точкам состояние ретрансляции из streaming service.
+// Для остановленного потока и при недоступности сервиса состояние не заполняется.
+func (h *StreamHandler) attachForwarderStatus(r *http.Request, streamEntity *stream.Stream, destinations []*stream.Destination) {
+	if streamEntity.StreamStatus != stream.StatusStarting && streamEntity.StreamStatus != stream.StatusRunning {
+		return
+	}
+
+	targetURL := fmt.Sprintf("%s/api/streams/%s/destinations",
+		config.GetEnv("STREAMING_SERVICE_URL", "http://streaming-service:8081"), url.PathEscape(streamEntity.StreamID))
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, targetURL, nil)
+	if err != nil {
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("⚠️ Failed to get forwarder status of stream %s: %v", streamEntity.StreamID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&body) != nil {
+		return
+	}
+
+	byID := make(map[string]map[string]interface{}, len(body.Data))
+	for _, status := range body.Data {
+		if id, ok := status["id"].(string); ok {
+			delete(status, "url") // URL берется из базы и маскируется отдельно
+			byID[id] = status
+		}
+	}
+	for _, dest := range destinations {
+		dest.Status = byID[strconv.FormatUint(uint64(dest.ID), 10)]
+	}
+}
@@ -62,22 +62,35 @@ func (h *HealthHandler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	// ✅ ИСПОЛЬЗУЕМ config.GetEnv
 	streamingServiceURL := config.GetEnv("STREAMING_SERVICE_URL", "http://streaming-service:8081") + "/api/health"
 
+	// Остаток емкости streaming service: сколько еще потоков он примет
+	var streamingCapacity json.RawMessage
+
 	httpClient := &http.Client{Timeout: 3 * time.Second}
 	if resp, err := httpClient.Get(streamingServiceURL); err == nil {
-		resp.Body.Close()
 		if resp.StatusCode == 200 {
 			streamingStatus = "CONNECTED"
+
+			var health struct {
+				Data struct {
+					Capacity json.RawMessage `json:"capacity"`
+				} `json:"data"`
+			}
+			if json.NewDecoder(resp.Body).Decode(&health) == nil {
+				streamingCapacity = health.Data.Capacity
+			}
 		}
+		resp.Body.Close()
 	}
 
 	response := middleware.Response{
 		Message: "Server is running",
 		Data: map[string]interface{}{
-			"timestamp":         time.Now(),
-			"status":            "OK",
-			"database":          dbStatus,
-			"database_pool":     dbStats,
-			"streaming_service": streamingStatus,
+			"timestamp":          time.Now(),
+			"status":             "OK",
+			"database":           dbStatus,
+			"database_pool":      dbStats,
+			"streaming_service":  streamingStatus,
+			"streaming_capacity": streamingCapacity,
 		},
 	}
 	json.NewEncoder(w).Encode(response)
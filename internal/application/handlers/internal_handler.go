@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"my-go-app/internal/application/services"
 	"my-go-app/internal/domain/stream"
@@ -19,6 +20,7 @@ import (
 //   - Batch jobs корректируют статусы потоков
 type InternalHandler struct {
 	streamService *services.StreamService
+	eventService  *services.EventService
 }
 
 type StatusUpdateRequest struct {
@@ -26,9 +28,27 @@ type StatusUpdateRequest struct {
 	Status   string `json:"status"`
 }
 
-func NewInternalHandler(streamService *services.StreamService) *InternalHandler {
+// MediaUpdateRequest - параметры ingest потока от streaming service
+type MediaUpdateRequest struct {
+	StreamID string           `json:"stream_id"`
+	Media    stream.MediaInfo `json:"media"`
+}
+
+// StreamEventRequest - событие потока от streaming service (начало или конец рекламной паузы)
+type StreamEventRequest struct {
+	StreamID        string    `json:"stream_id"`
+	Type            string    `json:"type"`
+	Source          string    `json:"source"`
+	CueID           string    `json:"cue_id"`
+	Time            time.Time `json:"time"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	SCTE35          string    `json:"scte35"`
+}
+
+func NewInternalHandler(streamService *services.StreamService, eventService *services.EventService) *InternalHandler {
 	return &InternalHandler{
 		streamService: streamService,
+		eventService:  eventService,
 	}
 }
 
@@ -98,3 +118,97 @@ func (h *InternalHandler) HandleStreamStatusUpdate(w http.ResponseWriter, r *htt
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// HandleStreamMediaUpdate сохраняет кодеки, разрешение, частоту кадров и аудио
+// потока, которые streaming service определил через ffprobe
+func (h *InternalHandler) HandleStreamMediaUpdate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MediaUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.StreamID == "" {
+		response := middleware.Response{
+			Message: "Invalid request format",
+			Error:   "stream_id is required",
+		}
+		if err != nil {
+			response.Error = err.Error()
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := h.streamService.UpdateMediaInfo(r.Context(), req.StreamID, req.Media); err != nil {
+		log.Printf("❌ Failed to update stream media info: %v", err)
+		response := middleware.Response{
+			Message: "Failed to update stream media info",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	log.Printf("🎞️ Stream %s media: video=%s %dx%d@%g audio=%s %d Hz %d ch",
+		req.StreamID, req.Media.VideoCodec, req.Media.Width, req.Media.Height, req.Media.FPS,
+		req.Media.AudioCodec, req.Media.SampleRate, req.Media.AudioChannels)
+
+	response := middleware.Response{
+		Message: "Media info updated successfully",
+		Data:    req.Media,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleStreamEvent записывает в историю потока рекламную паузу,
+// поставленную через API или пришедшую в ingest как метка SCTE-35
+func (h *InternalHandler) HandleStreamEvent(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req StreamEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response := middleware.Response{
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	event := &stream.Event{
+		StreamID:        req.StreamID,
+		Type:            req.Type,
+		Source:          req.Source,
+		CueID:           req.CueID,
+		Time:            req.Time,
+		DurationSeconds: req.DurationSeconds,
+		SCTE35:          req.SCTE35,
+	}
+	if err := h.eventService.RecordEvent(r.Context(), event); err != nil {
+		log.Printf("❌ Failed to record stream event: %v", err)
+		response := middleware.Response{
+			Message: "Failed to record stream event",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := middleware.Response{
+		Message: "Stream event recorded successfully",
+		Data:    event,
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"my-go-app/internal/domain/stream"
+	"my-go-app/pkg/config"
+	"my-go-app/pkg/middleware"
+)
+
+// handleLogs проксирует логи ffmpeg потока из streaming service
+//
+// Поддерживаемые методы:
+//
+//	GET /api/streams/{stream_id}/logs        - сессии потока и их файлы
+//	GET /api/streams/{stream_id}/logs/tail   - текущий лог в реальном времени (Server-Sent Events)
+//	GET /api/streams/{stream_id}/logs/{name} - файл лога, поддерживает заголовок Range
+//
+// Логи содержат адреса ingest с ключами, поэтому доступны только с токеном API.
+func (h *StreamHandler) handleLogs(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream, name string) {
+	if !middleware.IsAuthorized(r, h.apiToken) {
+		response := middleware.Response{
+			Message: "Authorization required",
+			Error:   "unauthorized",
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	targetURL := fmt.Sprintf("%s/api/streams/%s/logs",
+		config.GetEnv("STREAMING_SERVICE_URL", "http://streaming-service:8081"), url.PathEscape(streamEntity.StreamID))
+	if name != "" {
+		targetURL += "/" + url.PathEscape(name)
+	}
+	if r.URL.RawQuery != "" {
+		targetURL += "?" + r.URL.RawQuery
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, targetURL, nil)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+h.apiToken)
+	for _, header := range []string{"Range", "If-Range", "Last-Event-ID"} {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	// Поток событий tail живет, пока клиент не отключится
+	client := &http.Client{}
+	if name != "tail" {
+		client.Timeout = 30 * time.Second
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("❌ Failed to get logs of stream %s: %v", streamEntity.StreamID, err)
+		response := middleware.Response{
+			Message: "Failed to communicate with streaming service",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges",
+		"Last-Modified", "Cache-Control", "X-Accel-Buffering"} {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return // io.EOF или отключение streaming service
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"my-go-app/internal/application/services"
+	"my-go-app/internal/domain/stream"
+	"my-go-app/pkg/middleware"
+)
+
+// PresetHandler управляет пресетами ABR-лестниц для режима transcode.
+type PresetHandler struct {
+	presetService *services.PresetService
+}
+
+func NewPresetHandler(presetService *services.PresetService) *PresetHandler {
+	return &PresetHandler{
+		presetService: presetService,
+	}
+}
+
+// HandlePresets обрабатывает /api/presets
+//
+// Поддерживаемые методы:
+//
+//	GET  - список пресетов
+//	POST - создание пресета {"name": "...", "renditions": [...]}
+func (h *PresetHandler) HandlePresets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	switch r.Method {
+	case "GET":
+		presets, err := h.presetService.ListPresets(ctx)
+		if err != nil {
+			response := middleware.Response{
+				Message: "Failed to get presets",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response := middleware.Response{
+			Message: "Presets retrieved successfully",
+			Data:    presets,
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case "POST":
+		var req stream.Preset
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response := middleware.Response{
+				Message: "Invalid request format",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		preset, err := h.presetService.CreatePreset(ctx, &stream.Preset{
+			Name:       req.Name,
+			Renditions: req.Renditions,
+		})
+		if err != nil {
+			response := middleware.Response{
+				Message: "Failed to create preset",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response := middleware.Response{
+			Message: "Preset created successfully",
+			Data:    preset,
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandlePresetByName обрабатывает /api/presets/{name} (GET, DELETE)
+func (h *PresetHandler) HandlePresetByName(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/presets/")
+	if name == "" {
+		response := middleware.Response{
+			Message: "Preset name is required",
+			Error:   "Preset name is required",
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		preset, err := h.presetService.GetPreset(ctx, name)
+		if err != nil {
+			response := middleware.Response{
+				Message: "Preset not found",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response := middleware.Response{
+			Message: "Preset found",
+			Data:    preset,
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case "DELETE":
+		if err := h.presetService.DeletePreset(ctx, name); err != nil {
+			response := middleware.Response{
+				Message: "Failed to delete preset",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response := middleware.Response{
+			Message: "Preset deleted successfully",
+		}
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-go-app/internal/application/services"
+	"my-go-app/internal/domain/stream"
+	"my-go-app/pkg/config"
+	"my-go-app/pkg/middleware"
+)
+
+// RecordingHandler управляет VOD-архивами записанных сессий потоков.
+type RecordingHandler struct {
+	recordingService *services.RecordingService
+	apiToken         string // токен API: без него архив нельзя удалить
+}
+
+func NewRecordingHandler(recordingService *services.RecordingService, apiToken string) *RecordingHandler {
+	return &RecordingHandler{
+		recordingService: recordingService,
+		apiToken:         apiToken,
+	}
+}
+
+// HandleRecordings обрабатывает GET /api/recordings?stream_id={stream_id} - записи потока
+func (h *RecordingHandler) HandleRecordings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	recordings, err := h.recordingService.ListRecordings(r.Context(), r.URL.Query().Get("stream_id"))
+	if err != nil {
+		response := middleware.Response{
+			Message: "Failed to get recordings",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := middleware.Response{
+		Message: "Recordings retrieved successfully",
+		Data:    recordings,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleRecordingByID обрабатывает /api/recordings/{id}
+//
+// Поддерживаемые методы:
+//
+//	GET    /api/recordings/{id}          - запись с playback_url
+//	GET    /api/recordings/{id}/playback - редирект на VOD-плейлист
+//	DELETE /api/recordings/{id}          - удаление файлов архива и записи, нужен токен API
+func (h *RecordingHandler) HandleRecordingByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/recordings/"), "/")
+	idStr, action, _ := strings.Cut(path, "/")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil || (action != "" && action != "playback") {
+		response := middleware.Response{
+			Message: "Invalid recording path",
+			Error:   "expected /api/recordings/{id}[/playback]",
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if r.Method == "DELETE" && !middleware.IsAuthorized(r, h.apiToken) {
+		response := middleware.Response{
+			Message: "Authorization required",
+			Error:   "unauthorized",
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	rec, err := h.recordingService.GetRecording(ctx, uint(id))
+	if err != nil {
+		response := middleware.Response{
+			Message: "Recording not found",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && action == "playback":
+		http.Redirect(w, r, rec.PlaybackURL, http.StatusFound)
+
+	case r.Method == "GET":
+		response := middleware.Response{
+			Message: "Recording found",
+			Data:    rec,
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case r.Method == "DELETE" && action == "":
+		// Сначала файлы: запись в БД без файлов бесполезна, а наоборот - теряется место на диске
+		if err := h.deleteRecordingFiles(rec); err != nil {
+			log.Printf("❌ Failed to delete recording files %s: %v", rec.SessionID, err)
+			response := middleware.Response{
+				Message: "Failed to delete recording files",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		if err := h.recordingService.DeleteRecording(ctx, rec.ID); err != nil {
+			response := middleware.Response{
+				Message: "Failed to delete recording",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response := middleware.Response{
+			Message: "Recording deleted successfully",
+		}
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRecordingWebhook принимает от streaming service готовый архив сессии
+func (h *RecordingHandler) HandleRecordingWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req stream.Recording
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response := middleware.Response{
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	rec, err := h.recordingService.RegisterRecording(r.Context(), &req)
+	if err != nil {
+		log.Printf("❌ Failed to register recording %s/%s: %v", req.StreamID, req.SessionID, err)
+		response := middleware.Response{
+			Message: "Failed to register recording",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := middleware.Response{
+		Message: "Recording registered",
+		Data:    rec,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// deleteRecordingFiles удаляет архив на диске streaming service; удаление там тоже требует токен API
+func (h *RecordingHandler) deleteRecordingFiles(rec *stream.Recording) error {
+	streamingServiceURL := config.GetEnv("STREAMING_SERVICE_URL", "http://streaming-service:8081")
+	targetURL := fmt.Sprintf("%s/api/recordings/%s/%s", streamingServiceURL, url.PathEscape(rec.StreamID), url.PathEscape(rec.SessionID))
+
+	req, err := http.NewRequest(http.MethodDelete, targetURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+h.apiToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Архива уже нет на диске - удаляем только запись
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("streaming service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"my-go-app/internal/application/services"
+	"my-go-app/internal/domain/stream"
+	"my-go-app/pkg/middleware"
+)
+
+// handleSchedule обрабатывает разовое окно эфира потока
+//
+//	GET /api/streams/{stream_id}/schedule - окно и повторяющиеся расписания
+//	PUT /api/streams/{stream_id}/schedule - {"scheduled_start": "...", "scheduled_end": "..."}, null очищает время
+func (h *StreamHandler) handleSchedule(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case "GET":
+		schedules, err := h.scheduleService.ListSchedules(ctx, streamEntity.StreamID)
+		if err != nil {
+			response := middleware.Response{
+				Message: "Failed to get schedules",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response := middleware.Response{
+			Message: "Stream schedule retrieved successfully",
+			Data: map[string]interface{}{
+				"stream_id":       streamEntity.StreamID,
+				"scheduled_start": streamEntity.ScheduledStart,
+				"scheduled_end":   streamEntity.ScheduledEnd,
+				"schedules":       schedules,
+			},
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case "PUT":
+		var req services.ScheduledWindowRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response := middleware.Response{
+				Message: "Invalid request format",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		if err := h.scheduleService.SetScheduledWindow(ctx, streamEntity.StreamID, &req); err != nil {
+			response := middleware.Response{
+				Message: "Failed to update stream schedule",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response := middleware.Response{
+			Message: "Stream schedule updated successfully",
+			Data: map[string]interface{}{
+				"stream_id":       streamEntity.StreamID,
+				"scheduled_start": req.ScheduledStart,
+				"scheduled_end":   req.ScheduledEnd,
+			},
+		}
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSchedules обрабатывает повторяющиеся расписания потока
+//
+// Поддерживаемые методы:
+//
+//	GET    /api/streams/{stream_id}/schedules      - список расписаний
+//	POST   /api/streams/{stream_id}/schedules      - новое расписание {"weekdays", "start_time", "duration_minutes", "timezone", "enabled"}
+//	GET    /api/streams/{stream_id}/schedules/{id} - одно расписание
+//	PUT    /api/streams/{stream_id}/schedules/{id} - замена start_time и duration_minutes (+ остальные поля)
+//	PATCH  /api/streams/{stream_id}/schedules/{id} - изменение переданных полей, например {"enabled": false}
+//	DELETE /api/streams/{stream_id}/schedules/{id} - удаление расписания
+func (h *StreamHandler) handleSchedules(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream, idStr string) {
+	ctx := r.Context()
+
+	if idStr == "" {
+		switch r.Method {
+		case "GET":
+			schedules, err := h.scheduleService.ListSchedules(ctx, streamEntity.StreamID)
+			if err != nil {
+				response := middleware.Response{
+					Message: "Failed to get schedules",
+					Error:   err.Error(),
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+
+			response := middleware.Response{
+				Message: "Schedules retrieved successfully",
+				Data:    schedules,
+			}
+			json.NewEncoder(w).Encode(response)
+
+		case "POST":
+			var req services.ScheduleRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				response := middleware.Response{
+					Message: "Invalid request format",
+					Error:   err.Error(),
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+
+			schedule, err := h.scheduleService.CreateSchedule(ctx, streamEntity.StreamID, &req)
+			if err != nil {
+				response := middleware.Response{
+					Message: "Failed to create schedule",
+					Error:   err.Error(),
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			response := middleware.Response{
+				Message: "Schedule created successfully",
+				Data:    schedule,
+			}
+			json.NewEncoder(w).Encode(response)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		response := middleware.Response{
+			Message: "Invalid schedule ID",
+			Error:   "expected /api/streams/{stream_id}/schedules/{id}",
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	schedule, err := h.scheduleService.GetSchedule(ctx, streamEntity.StreamID, uint(id))
+	if err != nil {
+		response := middleware.Response{
+			Message: "Schedule not found",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		response := middleware.Response{
+			Message: "Schedule found",
+			Data:    schedule,
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case "PUT", "PATCH":
+		var req services.ScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response := middleware.Response{
+				Message: "Invalid request format",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		if r.Method == "PUT" && (req.StartTime == nil || req.DurationMinutes == nil) {
+			response := middleware.Response{
+				Message: "Invalid request format",
+				Error:   "start_time and duration_minutes are required for PUT, use PATCH for partial updates",
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		updated, err := h.scheduleService.UpdateSchedule(ctx, streamEntity.StreamID, schedule.ID, &req)
+		if err != nil {
+			response := middleware.Response{
+				Message: "Failed to update schedule",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response := middleware.Response{
+			Message: "Schedule updated successfully",
+			Data:    updated,
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case "DELETE":
+		if err := h.scheduleService.DeleteSchedule(ctx, streamEntity.StreamID, schedule.ID); err != nil {
+			response := middleware.Response{
+				Message: "Failed to delete schedule",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		response := middleware.Response{
+			Message: "Schedule deleted successfully",
+		}
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleScheduleRuns возвращает результаты действий планировщика, новые первыми
+//
+//	GET /api/streams/{stream_id}/schedule-runs?limit=100
+func (h *StreamHandler) handleScheduleRuns(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	runs, err := h.scheduleService.ListRuns(r.Context(), streamEntity.StreamID, limit)
+	if err != nil {
+		response := middleware.Response{
+			Message: "Failed to get schedule runs",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := middleware.Response{
+		Message: "Schedule runs retrieved successfully",
+		Data:    runs,
+	}
+	json.NewEncoder(w).Encode(response)
+}
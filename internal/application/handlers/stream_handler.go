@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"my-go-app/internal/application/services"
@@ -19,7 +22,11 @@ import (
 // Реализует полный CRUD (Create, Read, Update, Delete) функционал для стримов.
 // Также обеспечивает интеграцию с внешним streaming service через HTTP вызовы.
 type StreamHandler struct {
-	streamService *services.StreamService
+	streamService      *services.StreamService
+	destinationService *services.DestinationService
+	eventService       *services.EventService
+	scheduleService    *services.ScheduleService
+	apiToken           string // токен, открывающий секреты ingest (пароль SRT, ключ RTMP)
 }
 
 // StreamingResponse - стандартизированный формат ответа для операций со streaming service.
@@ -30,6 +37,19 @@ type StreamingResponse struct {
 	Status   string      `json:"status,omitempty"`
 	Data     interface{} `json:"data,omitempty"`
 	Error    string      `json:"error,omitempty"`
+	Code     string      `json:"code,omitempty"`
+}
+
+// Коды отказа streaming service в запуске: поток не запущен из-за нехватки
+// ресурсов или остановки сервиса, и запуск можно повторить позже
+const (
+	StreamingCodeCapacityExceeded = "capacity_exceeded"
+	StreamingCodeShuttingDown     = "shutting_down"
+)
+
+// Rejected сообщает, что streaming service отказал в запуске, не пытаясь запустить поток
+func (r *StreamingResponse) Rejected() bool {
+	return r.Code == StreamingCodeCapacityExceeded || r.Code == StreamingCodeShuttingDown
 }
 
 // NewStreamHandler создает новый экземпляр обработчика потоков.
@@ -37,14 +57,38 @@ type StreamingResponse struct {
 //
 // Параметры:
 //
-//	streamService - сервис содержащий бизнес-логику для работы с потоками
+//	streamService      - сервис содержащий бизнес-логику для работы с потоками
+//	destinationService - точки ретрансляции потоков (simulcast)
+//	eventService       - история событий потоков (рекламные паузы)
+//	scheduleService    - расписания запуска и остановки потоков
+//	apiToken      - токен API; только с ним в ответах появляются секреты ingest
 //
 // Возвращает:
 //
 //	*StreamHandler - новый экземпляр обработчика
-func NewStreamHandler(streamService *services.StreamService) *StreamHandler {
+func NewStreamHandler(streamService *services.StreamService, destinationService *services.DestinationService, eventService *services.EventService, scheduleService *services.ScheduleService, apiToken string) *StreamHandler {
 	return &StreamHandler{
-		streamService: streamService,
+		streamService:      streamService,
+		destinationService: destinationService,
+		eventService:       eventService,
+		scheduleService:    scheduleService,
+		apiToken:           apiToken,
+	}
+}
+
+// exposeIngestSecrets раскрывает пароль SRT авторизованному вызову
+// и убирает секреты ingest из ответа для всех остальных
+func (h *StreamHandler) exposeIngestSecrets(r *http.Request, st *stream.Stream) {
+	if middleware.IsAuthorized(r, h.apiToken) {
+		if err := h.streamService.RevealIngestSecrets(st); err != nil {
+			log.Printf("⚠️ Failed to decrypt ingest secrets of stream %s: %v", st.StreamID, err)
+		}
+		return
+	}
+	st.SRTPassphrase = ""
+	st.RTMPKey = ""
+	if st.SourceURL != "" {
+		st.SourceURL = stream.RedactSourceURL(st.SourceURL)
 	}
 }
 
@@ -61,7 +105,7 @@ func NewStreamHandler(streamService *services.StreamService) *StreamHandler {
 //
 // POST body (JSON):
 //
-//	{"name": "stream_name", "stream_id": "unique_id"}
+//	{"name": "stream_name", "mode": "repack_only|transcode", "preset": "abr_default"}
 //
 // Возвращает:
 //
@@ -87,6 +131,10 @@ func (h *StreamHandler) HandleStreams(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		for _, st := range streams {
+			h.exposeIngestSecrets(r, st)
+		}
+
 		response := middleware.Response{
 			Message: "Streams retrieved successfully",
 			Data:    streams,
@@ -116,6 +164,8 @@ func (h *StreamHandler) HandleStreams(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		h.exposeIngestSecrets(r, stream)
+
 		response := middleware.Response{
 			Message: "Stream created successfully",
 			Data:    stream,
@@ -157,6 +207,8 @@ func (h *StreamHandler) HandleStreamByID(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		h.exposeIngestSecrets(r, stream)
+
 		response := middleware.Response{
 			Message: "Stream found",
 			Data:    stream,
@@ -164,7 +216,19 @@ func (h *StreamHandler) HandleStreamByID(w http.ResponseWriter, r *http.Request)
 		json.NewEncoder(w).Encode(response)
 
 	case "DELETE":
-		err := h.streamService.DeleteStream(ctx, uint(id))
+		// StreamID нужен после удаления записи: streaming service забывает поток по нему
+		existing, err := h.streamService.GetStreamByID(ctx, uint(id))
+		if err != nil {
+			response := middleware.Response{
+				Message: "Stream not found",
+				Error:   err.Error(),
+			}
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		err = h.streamService.DeleteStream(ctx, uint(id))
 		if err != nil {
 			response := middleware.Response{
 				Message: "Failed to delete stream",
@@ -175,6 +239,14 @@ func (h *StreamHandler) HandleStreamByID(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		// Поток останавливается, его журнал и закрепленные порты освобождаются.
+		// Недоступный streaming service удаление не отменяет: журнал вычистит старые записи сам.
+		if streamingResp, err := h.callStreamingService(ctx, r.Header.Get("Authorization"), existing.StreamID, "delete", nil); err != nil {
+			log.Printf("⚠️ Failed to delete stream %s in streaming service: %v", existing.StreamID, err)
+		} else if streamingResp.Error != "" {
+			log.Printf("⚠️ Streaming service failed to delete stream %s: %s", existing.StreamID, streamingResp.Error)
+		}
+
 		response := middleware.Response{
 			Message: "Stream deleted successfully",
 		}
@@ -189,7 +261,7 @@ func (h *StreamHandler) HandleStreamControl(w http.ResponseWriter, r *http.Reque
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
 
-	streamID := strings.TrimPrefix(r.URL.Path, "/api/streams/")
+	streamID, subresource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/streams/"), "/")
 	if streamID == "" {
 		response := middleware.Response{
 			Message: "StreamID is required",
@@ -211,6 +283,44 @@ func (h *StreamHandler) HandleStreamControl(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	resource, rest, _ := strings.Cut(subresource, "/")
+	switch {
+	case subresource == "":
+	case subresource == "rotate-passphrase":
+		h.handleRotatePassphrase(w, r, streamEntity)
+		return
+	case subresource == "options":
+		h.handleStreamingOptions(w, r, streamEntity)
+		return
+	case resource == "destinations":
+		h.handleDestinations(w, r, streamEntity, strings.Trim(rest, "/"))
+		return
+	case resource == "logs":
+		h.handleLogs(w, r, streamEntity, strings.Trim(rest, "/"))
+		return
+	case subresource == "captions":
+		h.handleCaptions(w, r, streamEntity)
+		return
+	case subresource == "cues":
+		h.handleCues(w, r, streamEntity)
+		return
+	case subresource == "events":
+		h.handleEvents(w, r, streamEntity)
+		return
+	case subresource == "schedule":
+		h.handleSchedule(w, r, streamEntity)
+		return
+	case resource == "schedules":
+		h.handleSchedules(w, r, streamEntity, strings.Trim(rest, "/"))
+		return
+	case subresource == "schedule-runs":
+		h.handleScheduleRuns(w, r, streamEntity)
+		return
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
 	switch r.Method {
 	case "POST":
 		var req struct {
@@ -229,8 +339,23 @@ func (h *StreamHandler) HandleStreamControl(w http.ResponseWriter, r *http.Reque
 
 		log.Printf("🎬 Stream action requested: %s for stream %s", req.Action, streamID)
 
-		// Отправляем запрос в streaming service
-		streamingResp, err := h.callStreamingService(streamID, req.Action)
+		// Для запуска передаем режим и ABR-лестницу потока
+		var options *services.StreamingOptions
+		if req.Action == "start" {
+			options, err = h.streamService.BuildStreamingOptions(ctx, streamEntity)
+			if err != nil {
+				response := middleware.Response{
+					Message: "Invalid stream configuration",
+					Error:   err.Error(),
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+		}
+
+		// Отправляем запрос в streaming service и обновляем статус в базе
+		streamingResp, newStatus, err := h.controlStream(ctx, r.Header.Get("Authorization"), streamID, req.Action, options)
 		if err != nil {
 			log.Printf("❌ Failed to communicate with streaming service: %v", err)
 			response := middleware.Response{
@@ -242,56 +367,39 @@ func (h *StreamHandler) HandleStreamControl(w http.ResponseWriter, r *http.Reque
 			return
 		}
 
-		// ✅ ИСПРАВЛЕНА ЛОГИКА: правильное определение статуса
-		var newStatus stream.Status
-
-		if req.Action == "start" {
-			if streamingResp.Error == "" {
-				// Успешный запуск
-				newStatus = stream.StatusStarting
-				log.Printf("✅ Stream %s starting successfully", streamID)
-			} else {
-				// Ошибка запуска
-				newStatus = stream.StatusError
-				log.Printf("❌ Stream %s failed to start: %s", streamID, streamingResp.Error)
-			}
-		} else if req.Action == "stop" {
-			newStatus = stream.StatusStopped
-			log.Printf("🛑 Stream %s stopped", streamID)
-		} else {
-			// Неизвестное действие
-			newStatus = stream.StatusError
-			log.Printf("⚠️ Unknown action %s for stream %s", req.Action, streamID)
-		}
-
-		// Обновляем статус в базе данных
-		if err := h.streamService.UpdateStreamStatus(ctx, streamID, newStatus); err != nil {
-			log.Printf("❌ Failed to update stream status to %s: %v", newStatus, err)
-			// Не прерываем выполнение, просто логируем
-		} else {
-			log.Printf("✅ Stream %s status updated to %s", streamID, newStatus)
+		if newStatus == "" {
+			newStatus = streamEntity.StreamStatus
 		}
 
 		// Формируем ответ
+		data := map[string]interface{}{
+			"stream_id":      streamID,
+			"stream_status":  newStatus,
+			"action":         req.Action,
+			"streaming_data": streamingResp.Data,
+		}
 		response := middleware.Response{
 			Message: streamingResp.Message,
-			Data: map[string]interface{}{
-				"stream_id":      streamID,
-				"stream_status":  newStatus,
-				"action":         req.Action,
-				"streaming_data": streamingResp.Data,
-			},
+			Data:    data,
 		}
 
-		// Если была ошибка в streaming service, возвращаем ошибку
+		// Если была ошибка в streaming service, возвращаем ошибку;
+		// отказ по емкости - 503 с кодом, запуск можно повторить позже
 		if streamingResp.Error != "" {
 			response.Error = streamingResp.Error
-			w.WriteHeader(http.StatusInternalServerError)
+			if streamingResp.Rejected() {
+				data["code"] = streamingResp.Code
+				w.WriteHeader(http.StatusServiceUnavailable)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
 		}
 
 		json.NewEncoder(w).Encode(response)
 
 	case "GET":
+		h.exposeIngestSecrets(r, streamEntity)
+
 		response := middleware.Response{
 			Message: "Stream status retrieved",
 			Data:    streamEntity,
@@ -303,22 +411,223 @@ func (h *StreamHandler) HandleStreamControl(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-func (h *StreamHandler) callStreamingService(streamID, action string) (*StreamingResponse, error) {
+// controlStream передает действие в streaming service и записывает в базу новый статус потока.
+// Общий путь для POST /api/streams/{stream_id} и планировщика. При отказе в запуске
+// по емкости статус в базе не меняется и возвращается пустым.
+func (h *StreamHandler) controlStream(ctx context.Context, auth, streamID, action string, options *services.StreamingOptions) (*StreamingResponse, stream.Status, error) {
+	streamingResp, err := h.callStreamingService(ctx, auth, streamID, action, options)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// ✅ ИСПРАВЛЕНА ЛОГИКА: правильное определение статуса
+	var newStatus stream.Status
+
+	if action == "start" {
+		if streamingResp.Error == "" {
+			// Успешный запуск
+			newStatus = stream.StatusStarting
+			log.Printf("✅ Stream %s starting successfully", streamID)
+		} else if streamingResp.Rejected() {
+			// Отказ по емкости: поток не запускался, статус в базе не меняем
+			log.Printf("🚫 Stream %s start rejected (%s): %s", streamID, streamingResp.Code, streamingResp.Error)
+			return streamingResp, "", nil
+		} else {
+			// Ошибка запуска
+			newStatus = stream.StatusError
+			log.Printf("❌ Stream %s failed to start: %s", streamID, streamingResp.Error)
+		}
+	} else if action == "stop" {
+		newStatus = stream.StatusStopped
+		log.Printf("🛑 Stream %s stopped", streamID)
+	} else {
+		// Неизвестное действие
+		newStatus = stream.StatusError
+		log.Printf("⚠️ Unknown action %s for stream %s", action, streamID)
+	}
+
+	// Обновляем статус в базе данных
+	if err := h.streamService.UpdateStreamStatus(ctx, streamID, newStatus); err != nil {
+		log.Printf("❌ Failed to update stream status to %s: %v", newStatus, err)
+		// Не прерываем выполнение, просто логируем
+	} else {
+		log.Printf("✅ Stream %s status updated to %s", streamID, newStatus)
+	}
+
+	return streamingResp, newStatus, nil
+}
+
+// RunScheduledAction выполняет действие планировщика теми же вызовами, что и
+// POST /api/streams/{stream_id}. Вызов идет с токеном API, как от оператора.
+func (h *StreamHandler) RunScheduledAction(ctx context.Context, streamID, action string) error {
+	streamEntity, err := h.streamService.GetStreamByStreamID(ctx, streamID)
+	if err != nil {
+		return err
+	}
+
+	var options *services.StreamingOptions
+	if action == "start" {
+		options, err = h.streamService.BuildStreamingOptions(ctx, streamEntity)
+		if err != nil {
+			return fmt.Errorf("invalid stream configuration: %w", err)
+		}
+	}
+
+	auth := ""
+	if h.apiToken != "" {
+		auth = "Bearer " + h.apiToken
+	}
+	streamingResp, _, err := h.controlStream(ctx, auth, streamID, action, options)
+	if err != nil {
+		return err
+	}
+	if streamingResp.Rejected() {
+		return fmt.Errorf("%s: %s", streamingResp.Code, streamingResp.Error)
+	}
+	if streamingResp.Error != "" {
+		return errors.New(streamingResp.Error)
+	}
+	return nil
+}
+
+// handleRotatePassphrase обрабатывает POST /api/streams/{stream_id}/rotate-passphrase.
+// Активный поток перезапускается, чтобы listener сразу перестал принимать старый пароль.
+func (h *StreamHandler) handleRotatePassphrase(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream) {
+	ctx := r.Context()
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !middleware.IsAuthorized(r, h.apiToken) {
+		response := middleware.Response{
+			Message: "Authorization required",
+			Error:   "unauthorized",
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	rotated, err := h.streamService.RotateSRTPassphrase(ctx, streamEntity.StreamID)
+	if err != nil {
+		response := middleware.Response{
+			Message: "Failed to rotate passphrase",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	data := map[string]interface{}{
+		"stream_id":      rotated.StreamID,
+		"srt_passphrase": rotated.SRTPassphrase,
+		"srt_key_length": rotated.SRTKeyLength,
+		"restarted":      false,
+	}
+
+	active := rotated.StreamStatus == stream.StatusStarting || rotated.StreamStatus == stream.StatusRunning
+	if active {
+		log.Printf("🔄 Restarting stream %s to apply new SRT passphrase", rotated.StreamID)
+
+		// restart вместо stop и start: streaming service не шлет уведомление stopped,
+		// которое могло бы прийти позже и перезаписать статус перезапущенного потока
+		newStatus := stream.StatusError
+		options, err := h.streamService.BuildStreamingOptions(ctx, rotated)
+		if err == nil {
+			var streamingResp *StreamingResponse
+			streamingResp, err = h.callStreamingService(ctx, r.Header.Get("Authorization"), rotated.StreamID, "restart", options)
+			if err == nil && streamingResp.Error == "" {
+				newStatus = stream.StatusStarting
+				data["streaming_data"] = streamingResp.Data
+			}
+		}
+		if err != nil {
+			log.Printf("❌ Failed to restart stream %s after passphrase rotation: %v", rotated.StreamID, err)
+		}
+
+		if err := h.streamService.UpdateStreamStatus(ctx, rotated.StreamID, newStatus); err != nil {
+			log.Printf("❌ Failed to update stream status to %s: %v", newStatus, err)
+		}
+		data["restarted"] = newStatus == stream.StatusStarting
+		data["stream_status"] = newStatus
+	}
+
+	response := middleware.Response{
+		Message: "SRT passphrase rotated",
+		Data:    data,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleStreamingOptions обрабатывает GET /api/streams/{stream_id}/options.
+// Возвращает полные параметры запуска вместе с секретами ingest и URL точек
+// ретрансляции: streaming service не хранит их в журнале и запрашивает здесь при восстановлении.
+func (h *StreamHandler) handleStreamingOptions(w http.ResponseWriter, r *http.Request, streamEntity *stream.Stream) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !middleware.IsAuthorized(r, h.apiToken) {
+		response := middleware.Response{
+			Message: "Authorization required",
+			Error:   "unauthorized",
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	options, err := h.streamService.BuildStreamingOptions(r.Context(), streamEntity)
+	if err != nil {
+		response := middleware.Response{
+			Message: "Invalid stream configuration",
+			Error:   err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := middleware.Response{
+		Message: "Streaming options retrieved",
+		Data:    options,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// callStreamingService передает действие в streaming service. Заголовок Authorization
+// исходного запроса (auth) пробрасывается, чтобы секреты ingest в ответе видел только авторизованный вызов.
+func (h *StreamHandler) callStreamingService(ctx context.Context, auth, streamID, action string, options *services.StreamingOptions) (*StreamingResponse, error) {
 	streamingServiceURL := config.GetEnv("STREAMING_SERVICE_URL", "http://streaming-service:8081") + "/api/streams"
 
-	requestBody := map[string]string{
+	requestBody := map[string]interface{}{
 		"stream_id": streamID,
 		"action":    action,
 	}
+	if options != nil {
+		requestBody["options"] = options
+	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("📡 Calling streaming service: %s with %s", streamingServiceURL, string(jsonData))
+	// Тело запроса содержит секреты ingest, поэтому в лог пишется только действие
+	log.Printf("📡 Calling streaming service: %s action=%s stream=%s", streamingServiceURL, action, streamID)
 
-	resp, err := http.Post(streamingServiceURL, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", streamingServiceURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Printf("❌ HTTP request to streaming service failed: %v", err)
 		return nil, err
@@ -331,16 +640,14 @@ func (h *StreamHandler) callStreamingService(streamID, action string) (*Streamin
 		return nil, err
 	}
 
-	log.Printf("📡 Streaming service response: %s", string(body))
-
 	var streamingResponse StreamingResponse
 	if err := json.Unmarshal(body, &streamingResponse); err != nil {
 		log.Printf("❌ Failed to parse streaming service response: %v", err)
 		return nil, err
 	}
 
-	log.Printf("📡 Parsed streaming response: Message=%s, Status=%s, Error=%s",
-		streamingResponse.Message, streamingResponse.Status, streamingResponse.Error)
+	log.Printf("📡 Parsed streaming response: Message=%s, Status=%s, Error=%s, Code=%s",
+		streamingResponse.Message, streamingResponse.Status, streamingResponse.Error, streamingResponse.Code)
 
 	return &streamingResponse, nil
 }
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"my-go-app/internal/domain/stream"
+)
+
+// MaxDestinationsPerStream ограничивает число ретрансляций: каждая - отдельный процесс ffmpeg
+const MaxDestinationsPerStream = 10
+
+type DestinationService struct {
+	repo       stream.DestinationRepository
+	streamRepo stream.Repository
+}
+
+func NewDestinationService(repo stream.DestinationRepository, streamRepo stream.Repository) *DestinationService {
+	return &DestinationService{
+		repo:       repo,
+		streamRepo: streamRepo,
+	}
+}
+
+// DestinationRequest - тело POST/PUT/PATCH для точки ретрансляции.
+// Указатели позволяют PATCH менять только переданные поля.
+type DestinationRequest struct {
+	Name    *string `json:"name"`
+	URL     *string `json:"url"`
+	Enabled *bool   `json:"enabled"`
+}
+
+// DestinationSpec - точка ретрансляции в параметрах запуска streaming service
+type DestinationSpec struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+}
+
+func (s *DestinationService) ListDestinations(ctx context.Context, streamID string) ([]*stream.Destination, error) {
+	return s.repo.ListByStreamID(ctx, streamID)
+}
+
+// GetDestination возвращает точку ретрансляции, только если она принадлежит потоку
+func (s *DestinationService) GetDestination(ctx context.Context, streamID string, id uint) (*stream.Destination, error) {
+	dest, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if dest.StreamID != streamID {
+		return nil, errors.New("destination not found")
+	}
+	return dest, nil
+}
+
+func (s *DestinationService) CreateDestination(ctx context.Context, streamID string, req *DestinationRequest) (*stream.Destination, error) {
+	if _, err := s.streamRepo.GetByStreamID(ctx, streamID); err != nil {
+		return nil, err
+	}
+	if req.URL == nil {
+		return nil, errors.New("url is required")
+	}
+
+	existing, err := s.repo.ListByStreamID(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxDestinationsPerStream {
+		return nil, fmt.Errorf("stream already has %d destinations", MaxDestinationsPerStream)
+	}
+
+	dest := &stream.Destination{StreamID: streamID, Enabled: true}
+	if err := applyDestinationRequest(dest, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, dest); err != nil {
+		return nil, err
+	}
+
+	log.Printf("📡 Destination %d (%s) added to stream %s", dest.ID, dest.Name, streamID)
+	return dest, nil
+}
+
+// UpdateDestination применяет переданные поля; для PUT обработчик требует name и url
+func (s *DestinationService) UpdateDestination(ctx context.Context, streamID string, id uint, req *DestinationRequest) (*stream.Destination, error) {
+	dest, err := s.GetDestination(ctx, streamID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyDestinationRequest(dest, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, dest); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (s *DestinationService) DeleteDestination(ctx context.Context, streamID string, id uint) error {
+	if _, err := s.GetDestination(ctx, streamID, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// EnabledSpecs - включенные точки ретрансляции в формате streaming service
+func (s *DestinationService) EnabledSpecs(ctx context.Context, streamID string) ([]DestinationSpec, error) {
+	destinations, err := s.repo.ListByStreamID(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+	return enabledDestinationSpecs(destinations), nil
+}
+
+func enabledDestinationSpecs(destinations []*stream.Destination) []DestinationSpec {
+	specs := []DestinationSpec{}
+	for _, dest := range destinations {
+		if dest.Enabled {
+			specs = append(specs, DestinationSpec{ID: fmt.Sprint(dest.ID), Name: dest.Name, URL: dest.URL})
+		}
+	}
+	return specs
+}
+
+func applyDestinationRequest(dest *stream.Destination, req *DestinationRequest) error {
+	if req.Name != nil {
+		dest.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		if err := stream.ValidateDestinationURL(*req.URL); err != nil {
+			return err
+		}
+		dest.URL = *req.URL
+	}
+	if req.Enabled != nil {
+		dest.Enabled = *req.Enabled
+	}
+	if dest.Name == "" {
+		if u, err := url.Parse(dest.URL); err == nil {
+			dest.Name = u.Host
+		}
+	}
+	if len(dest.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"my-go-app/internal/domain/stream"
+)
+
+// Число событий в ответе GET /api/streams/{stream_id}/events
+const (
+	DefaultEventsLimit = 100
+	MaxEventsLimit     = 1000
+)
+
+type EventService struct {
+	repo       stream.EventRepository
+	streamRepo stream.Repository
+}
+
+func NewEventService(repo stream.EventRepository, streamRepo stream.Repository) *EventService {
+	return &EventService{
+		repo:       repo,
+		streamRepo: streamRepo,
+	}
+}
+
+// RecordEvent сохраняет событие потока, присланное streaming service
+func (s *EventService) RecordEvent(ctx context.Context, event *stream.Event) error {
+	if event.StreamID == "" || event.Time.IsZero() {
+		return errors.New("stream_id and time are required")
+	}
+	switch event.Type {
+	case stream.EventCueOut, stream.EventCueIn:
+	default:
+		return fmt.Errorf("unknown event type: %q", event.Type)
+	}
+	if _, err := s.streamRepo.GetByStreamID(ctx, event.StreamID); err != nil {
+		return err
+	}
+
+	event.ID = 0
+	if err := s.repo.Create(ctx, event); err != nil {
+		return err
+	}
+
+	log.Printf("📢 Stream %s event %s (%s, cue %s)", event.StreamID, event.Type, event.Source, event.CueID)
+	return nil
+}
+
+// ListEvents возвращает последние события потока; limit вне 1..MaxEventsLimit
+// заменяется значением по умолчанию
+func (s *EventService) ListEvents(ctx context.Context, streamID string, limit int) ([]*stream.Event, error) {
+	if limit <= 0 || limit > MaxEventsLimit {
+		limit = DefaultEventsLimit
+	}
+	return s.repo.ListByStreamID(ctx, streamID, limit)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"my-go-app/internal/domain/stream"
+)
+
+type PresetService struct {
+	repo       stream.PresetRepository
+	streamRepo stream.Repository
+}
+
+func NewPresetService(repo stream.PresetRepository, streamRepo stream.Repository) *PresetService {
+	return &PresetService{
+		repo:       repo,
+		streamRepo: streamRepo,
+	}
+}
+
+// EnsureDefaultPreset создает пресет по умолчанию, если его еще нет
+func (s *PresetService) EnsureDefaultPreset(ctx context.Context) error {
+	if _, err := s.repo.GetByName(ctx, stream.DefaultPresetName); err == nil {
+		return nil
+	}
+
+	log.Printf("🎚️ Создание пресета по умолчанию %s", stream.DefaultPresetName)
+	return s.repo.Create(ctx, stream.DefaultPreset())
+}
+
+func (s *PresetService) ListPresets(ctx context.Context) ([]*stream.Preset, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *PresetService) GetPreset(ctx context.Context, name string) (*stream.Preset, error) {
+	return s.repo.GetByName(ctx, name)
+}
+
+func (s *PresetService) CreatePreset(ctx context.Context, preset *stream.Preset) (*stream.Preset, error) {
+	if err := preset.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetByName(ctx, preset.Name); err == nil {
+		return nil, errors.New("preset already exists")
+	}
+
+	if err := s.repo.Create(ctx, preset); err != nil {
+		return nil, err
+	}
+	return preset, nil
+}
+
+// DeletePreset удаляет пресет, если на него не ссылается ни один поток
+func (s *PresetService) DeletePreset(ctx context.Context, name string) error {
+	if _, err := s.repo.GetByName(ctx, name); err != nil {
+		return err
+	}
+
+	inUse, err := s.streamRepo.Count(ctx, &stream.Filter{Preset: name})
+	if err != nil {
+		return err
+	}
+	if inUse > 0 {
+		return fmt.Errorf("preset is used by %d stream(s)", inUse)
+	}
+
+	return s.repo.Delete(ctx, name)
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"my-go-app/internal/domain/stream"
+	"my-go-app/pkg/config"
+)
+
+type RecordingService struct {
+	repo       stream.RecordingRepository
+	streamRepo stream.Repository
+}
+
+func NewRecordingService(repo stream.RecordingRepository, streamRepo stream.Repository) *RecordingService {
+	return &RecordingService{
+		repo:       repo,
+		streamRepo: streamRepo,
+	}
+}
+
+// RegisterRecording сохраняет архив, присланный streaming service.
+// Повторная регистрация той же сессии возвращает существующую запись.
+func (s *RecordingService) RegisterRecording(ctx context.Context, rec *stream.Recording) (*stream.Recording, error) {
+	if rec.StreamID == "" || rec.SessionID == "" || rec.PlaylistPath == "" {
+		return nil, errors.New("stream_id, session_id and playlist_path are required")
+	}
+	if _, err := s.streamRepo.GetByStreamID(ctx, rec.StreamID); err != nil {
+		return nil, err
+	}
+
+	if existing, err := s.repo.GetBySession(ctx, rec.StreamID, rec.SessionID); err == nil {
+		return withPlaybackURL(existing), nil
+	}
+
+	rec.ID = 0
+	if err := s.repo.Create(ctx, rec); err != nil {
+		return nil, err
+	}
+
+	log.Printf("📼 Recording %s registered for stream %s", rec.SessionID, rec.StreamID)
+	return withPlaybackURL(rec), nil
+}
+
+func (s *RecordingService) ListRecordings(ctx context.Context, streamID string) ([]*stream.Recording, error) {
+	if streamID == "" {
+		return nil, errors.New("stream_id is required")
+	}
+	recordings, err := s.repo.ListByStreamID(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recordings {
+		withPlaybackURL(rec)
+	}
+	return recordings, nil
+}
+
+func (s *RecordingService) GetRecording(ctx context.Context, id uint) (*stream.Recording, error) {
+	rec, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return withPlaybackURL(rec), nil
+}
+
+func (s *RecordingService) DeleteRecording(ctx context.Context, id uint) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// withPlaybackURL заполняет URL воспроизведения: архивы раздает nginx из /recordings/
+func withPlaybackURL(rec *stream.Recording) *stream.Recording {
+	domain := config.GetEnv("CDN_DOMAIN", config.GetEnv("SERVER_IP", "localhost"))
+	rec.PlaybackURL = fmt.Sprintf("https://%s/recordings/%s", domain, rec.PlaylistPath)
+	return rec
+}
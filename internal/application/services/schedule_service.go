@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"my-go-app/internal/domain/stream"
+)
+
+// Число записей в ответе GET /api/streams/{stream_id}/schedule-runs
+const (
+	DefaultScheduleRunsLimit = 100
+	MaxScheduleRunsLimit     = 1000
+)
+
+type ScheduleService struct {
+	repo       stream.ScheduleRepository
+	runRepo    stream.ScheduleRunRepository
+	streamRepo stream.Repository
+}
+
+func NewScheduleService(repo stream.ScheduleRepository, runRepo stream.ScheduleRunRepository, streamRepo stream.Repository) *ScheduleService {
+	return &ScheduleService{
+		repo:       repo,
+		runRepo:    runRepo,
+		streamRepo: streamRepo,
+	}
+}
+
+// ScheduleRequest - тело POST/PUT/PATCH для повторяющегося расписания.
+// Указатели позволяют PATCH менять только переданные поля.
+type ScheduleRequest struct {
+	Weekdays        *[]int  `json:"weekdays"`
+	StartTime       *string `json:"start_time"`
+	DurationMinutes *int    `json:"duration_minutes"`
+	Timezone        *string `json:"timezone"`
+	Enabled         *bool   `json:"enabled"`
+}
+
+// ScheduledWindowRequest - тело PUT /api/streams/{stream_id}/schedule;
+// отсутствующее или null время очищает его
+type ScheduledWindowRequest struct {
+	ScheduledStart *time.Time `json:"scheduled_start"`
+	ScheduledEnd   *time.Time `json:"scheduled_end"`
+}
+
+// SetScheduledWindow задает разовое время запуска и остановки потока
+func (s *ScheduleService) SetScheduledWindow(ctx context.Context, streamID string, req *ScheduledWindowRequest) error {
+	if err := stream.ValidateScheduledWindow(req.ScheduledStart, req.ScheduledEnd); err != nil {
+		return err
+	}
+	if err := s.streamRepo.UpdateScheduledWindow(ctx, streamID, req.ScheduledStart, req.ScheduledEnd); err != nil {
+		return err
+	}
+
+	log.Printf("⏰ Stream %s scheduled window: start=%v end=%v", streamID, req.ScheduledStart, req.ScheduledEnd)
+	return nil
+}
+
+func (s *ScheduleService) ListSchedules(ctx context.Context, streamID string) ([]*stream.Schedule, error) {
+	return s.repo.ListByStreamID(ctx, streamID)
+}
+
+// GetSchedule возвращает расписание, только если оно принадлежит потоку
+func (s *ScheduleService) GetSchedule(ctx context.Context, streamID string, id uint) (*stream.Schedule, error) {
+	schedule, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.StreamID != streamID {
+		return nil, errors.New("schedule not found")
+	}
+	return schedule, nil
+}
+
+func (s *ScheduleService) CreateSchedule(ctx context.Context, streamID string, req *ScheduleRequest) (*stream.Schedule, error) {
+	if _, err := s.streamRepo.GetByStreamID(ctx, streamID); err != nil {
+		return nil, err
+	}
+	if req.StartTime == nil || req.DurationMinutes == nil {
+		return nil, errors.New("start_time and duration_minutes are required")
+	}
+
+	existing, err := s.repo.ListByStreamID(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= stream.MaxSchedulesPerStream {
+		return nil, fmt.Errorf("stream already has %d schedules", stream.MaxSchedulesPerStream)
+	}
+
+	schedule := &stream.Schedule{StreamID: streamID, Enabled: true}
+	applyScheduleRequest(schedule, req)
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, schedule); err != nil {
+		return nil, err
+	}
+
+	log.Printf("⏰ Schedule %d added to stream %s: %s for %d min (%s)",
+		schedule.ID, streamID, schedule.StartTime, schedule.DurationMinutes, schedule.Timezone)
+	return schedule, nil
+}
+
+// UpdateSchedule применяет переданные поля; для PUT обработчик требует start_time и duration_minutes
+func (s *ScheduleService) UpdateSchedule(ctx context.Context, streamID string, id uint, req *ScheduleRequest) (*stream.Schedule, error) {
+	schedule, err := s.GetSchedule(ctx, streamID, id)
+	if err != nil {
+		return nil, err
+	}
+	applyScheduleRequest(schedule, req)
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (s *ScheduleService) DeleteSchedule(ctx context.Context, streamID string, id uint) error {
+	if _, err := s.GetSchedule(ctx, streamID, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// ListRuns возвращает последние действия планировщика; limit вне 1..MaxScheduleRunsLimit
+// заменяется значением по умолчанию
+func (s *ScheduleService) ListRuns(ctx context.Context, streamID string, limit int) ([]*stream.ScheduleRun, error) {
+	if limit <= 0 || limit > MaxScheduleRunsLimit {
+		limit = DefaultScheduleRunsLimit
+	}
+	return s.runRepo.ListByStreamID(ctx, streamID, limit)
+}
+
+func applyScheduleRequest(schedule *stream.Schedule, req *ScheduleRequest) {
+	if req.Weekdays != nil {
+		schedule.Weekdays = append([]int(nil), (*req.Weekdays)...)
+	}
+	if req.StartTime != nil {
+		schedule.StartTime = *req.StartTime
+	}
+	if req.DurationMinutes != nil {
+		schedule.DurationMinutes = *req.DurationMinutes
+	}
+	if req.Timezone != nil {
+		schedule.Timezone = *req.Timezone
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+}
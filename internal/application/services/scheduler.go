@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"my-go-app/internal/domain/stream"
+)
+
+// scheduledActionTimeout ограничивает один вызов streaming service из планировщика
+const scheduledActionTimeout = 30 * time.Second
+
+// StreamActionFunc выполняет start или stop так же, как POST /api/streams/{stream_id}
+type StreamActionFunc func(ctx context.Context, streamID, action string) error
+
+// Scheduler запускает и останавливает потоки по разовому окну scheduled_start/scheduled_end
+// и по повторяющимся расписаниям. Каждая реплика go-app проверяет слоты раз в interval,
+// но выполняет действие только та, что первой записала слот в schedule_runs.
+// Слоты старше maxLateness (например, пока все реплики были остановлены) пропускаются.
+type Scheduler struct {
+	scheduleRepo stream.ScheduleRepository
+	runRepo      stream.ScheduleRunRepository
+	streamRepo   stream.Repository
+	action       StreamActionFunc
+	interval     time.Duration
+	maxLateness  time.Duration
+	instance     string
+}
+
+func NewScheduler(scheduleRepo stream.ScheduleRepository, runRepo stream.ScheduleRunRepository, streamRepo stream.Repository,
+	action StreamActionFunc, interval, maxLateness time.Duration) *Scheduler {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = fmt.Sprintf("pid-%d", os.Getpid())
+	}
+	return &Scheduler{
+		scheduleRepo: scheduleRepo,
+		runRepo:      runRepo,
+		streamRepo:   streamRepo,
+		action:       action,
+		interval:     interval,
+		maxLateness:  maxLateness,
+		instance:     instance,
+	}
+}
+
+// Run проверяет слоты до отмены ctx; начатое действие при этом завершается
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Printf("⏰ Scheduler started on %s (interval %s, max lateness %s)", s.instance, s.interval, s.maxLateness)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			log.Printf("⏰ Scheduler stopped on %s", s.instance)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick выполняет слоты, наступившие в (now-maxLateness, now]
+func (s *Scheduler) tick(ctx context.Context, now time.Time) {
+	from := now.Add(-s.maxLateness)
+
+	var slots []stream.ScheduleSlot
+	streams, err := s.streamRepo.ListScheduled(ctx, from, now)
+	if err != nil {
+		log.Printf("❌ Scheduler failed to list scheduled streams: %v", err)
+		return
+	}
+	for _, st := range streams {
+		slots = append(slots, st.ScheduledSlots(from, now)...)
+	}
+
+	schedules, err := s.scheduleRepo.ListEnabled(ctx)
+	if err != nil {
+		log.Printf("❌ Scheduler failed to list schedules: %v", err)
+		return
+	}
+	for _, schedule := range schedules {
+		slots = append(slots, schedule.Slots(from, now)...)
+	}
+
+	// Остановка раньше запуска в тот же момент: смежные окна не должны оставить поток выключенным
+	sort.SliceStable(slots, func(i, j int) bool {
+		if !slots[i].At.Equal(slots[j].At) {
+			return slots[i].At.Before(slots[j].At)
+		}
+		return slots[i].Action == stream.ScheduleActionStop && slots[j].Action != stream.ScheduleActionStop
+	})
+
+	starts := make(map[string]bool)
+	for _, slot := range slots {
+		if slot.Action == stream.ScheduleActionStart {
+			starts[slotKey(slot)] = true
+		}
+	}
+
+	for _, slot := range slots {
+		if ctx.Err() != nil {
+			return
+		}
+		s.execute(ctx, slot, starts[slotKey(slot)], now)
+	}
+}
+
+// execute занимает слот и выполняет действие; continued - в тот же момент
+// начинается следующее окно, поэтому остановка не нужна
+func (s *Scheduler) execute(ctx context.Context, slot stream.ScheduleSlot, continued bool, now time.Time) {
+	run := &stream.ScheduleRun{
+		StreamID:    slot.StreamID,
+		Action:      slot.Action,
+		ScheduledAt: slot.At,
+		ScheduleID:  slot.ScheduleID,
+		Status:      stream.ScheduleRunPending,
+		Instance:    s.instance,
+		StartedAt:   time.Now(),
+	}
+	claimed, err := s.runRepo.Claim(ctx, run)
+	if err != nil {
+		log.Printf("❌ Scheduler failed to claim %s of stream %s at %s: %v", slot.Action, slot.StreamID, slot.At.Format(time.RFC3339), err)
+		return
+	}
+	if !claimed {
+		// Слот уже выполнен этой или другой репликой
+		return
+	}
+	// Занятый слот доводится до конца и при остановке go-app, иначе он останется pending
+	ctx = context.WithoutCancel(ctx)
+
+	run.Status, run.Error = s.perform(ctx, slot, continued, now)
+	finished := time.Now()
+	run.FinishedAt = &finished
+	if err := s.runRepo.Update(ctx, run); err != nil {
+		log.Printf("❌ Scheduler failed to record result of %s for stream %s: %v", slot.Action, slot.StreamID, err)
+	}
+
+	switch run.Status {
+	case stream.ScheduleRunSucceeded:
+		log.Printf("⏰ Scheduled %s of stream %s succeeded", slot.Action, slot.StreamID)
+	case stream.ScheduleRunSkipped:
+		log.Printf("⏰ Scheduled %s of stream %s skipped: %s", slot.Action, slot.StreamID, run.Error)
+	default:
+		log.Printf("❌ Scheduled %s of stream %s failed: %s", slot.Action, slot.StreamID, run.Error)
+	}
+}
+
+// perform возвращает статус и причину для записи в schedule_runs
+func (s *Scheduler) perform(ctx context.Context, slot stream.ScheduleSlot, continued bool, now time.Time) (string, string) {
+	st, err := s.streamRepo.GetByStreamID(ctx, slot.StreamID)
+	if err != nil {
+		return stream.ScheduleRunFailed, err.Error()
+	}
+	active := st.StreamStatus == stream.StatusStarting || st.StreamStatus == stream.StatusRunning
+
+	switch slot.Action {
+	case stream.ScheduleActionStart:
+		if !slot.Until.IsZero() && !slot.Until.After(now) {
+			return stream.ScheduleRunSkipped, "schedule window has already ended"
+		}
+		if active {
+			return stream.ScheduleRunSkipped, "stream is already active"
+		}
+	case stream.ScheduleActionStop:
+		if continued {
+			return stream.ScheduleRunSkipped, "next scheduled window starts at the same time"
+		}
+		if !active && st.StreamStatus != stream.StatusError {
+			return stream.ScheduleRunSkipped, "stream is already stopped"
+		}
+	}
+
+	actionCtx, cancel := context.WithTimeout(ctx, scheduledActionTimeout)
+	defer cancel()
+	if err := s.action(actionCtx, slot.StreamID, slot.Action); err != nil {
+		return stream.ScheduleRunFailed, err.Error()
+	}
+	return stream.ScheduleRunSucceeded, ""
+}
+
+func slotKey(slot stream.ScheduleSlot) string {
+	return slot.StreamID + "@" + slot.At.UTC().Format(time.RFC3339Nano)
+}
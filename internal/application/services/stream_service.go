@@ -2,27 +2,114 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
+	"regexp"
 	"time"
 
 	"github.com/google/uuid"
 
 	"my-go-app/internal/domain/stream"
+	"my-go-app/pkg/secretbox"
 )
 
 type StreamService struct {
-	repo stream.Repository
+	repo            stream.Repository
+	presetRepo      stream.PresetRepository
+	destinationRepo stream.DestinationRepository
+	secrets         *secretbox.Box // шифрование паролей SRT в базе данных
 }
 
-func NewStreamService(repo stream.Repository) *StreamService {
+func NewStreamService(repo stream.Repository, presetRepo stream.PresetRepository, destinationRepo stream.DestinationRepository, secrets *secretbox.Box) *StreamService {
 	return &StreamService{
-		repo: repo,
+		repo:            repo,
+		presetRepo:      presetRepo,
+		destinationRepo: destinationRepo,
+		secrets:         secrets,
 	}
 }
 
 type CreateStreamRequest struct {
-	Name string `json:"name"`
+	Name   string      `json:"name"`
+	Mode   stream.Mode `json:"mode,omitempty"`   // repack_only (по умолчанию) или transcode
+	Preset string      `json:"preset,omitempty"` // пресет ABR-лестницы для transcode
+
+	LowLatency bool             `json:"low_latency,omitempty"` // LL-HLS с частичными сегментами
+	Packaging  stream.Packaging `json:"packaging,omitempty"`   // ts (по умолчанию) или cmaf (HLS + DASH)
+
+	DVRWindowSeconds int  `json:"dvr_window_seconds,omitempty"` // например 1800 (30 минут) или 7200 (2 часа)
+	Record           bool `json:"record,omitempty"`             // сохранять каждую сессию в VOD-архив
+
+	InactivityTimeoutSeconds int `json:"inactivity_timeout_seconds,omitempty"` // 0 - порог streaming service
+
+	SubtitleLanguages []string `json:"subtitle_languages,omitempty"` // дорожки WebVTT, например ["ru", "en"]
+	ClosedCaptions    []string `json:"closed_captions,omitempty"`    // CEA-608/708 в ingest, например ["CC1"]
+
+	AdCues            bool `json:"ad_cues,omitempty"`            // рекламные паузы через POST /api/streams/{id}/cues
+	SCTE35Passthrough bool `json:"scte35_passthrough,omitempty"` // метки SCTE-35 из SRT ingest, включает ad_cues
+
+	ScheduledStart *time.Time `json:"scheduled_start,omitempty"` // разовый запуск планировщиком
+	ScheduledEnd   *time.Time `json:"scheduled_end,omitempty"`   // разовая остановка планировщиком
+
+	Protocol     stream.Protocol `json:"protocol,omitempty"`       // srt (по умолчанию) или rtmp
+	RTMPApp      string          `json:"rtmp_app,omitempty"`       // приложение RTMP, по умолчанию live
+	SRTKeyLength int             `json:"srt_key_length,omitempty"` // 16 (по умолчанию), 24 или 32
+	SourceURL    string          `json:"source_url,omitempty"`     // источник для protocol=pull
+}
+
+// StreamingOptions - параметры запуска, передаваемые в streaming service
+type StreamingOptions struct {
+	Mode       stream.Mode        `json:"mode"`
+	Preset     string             `json:"preset,omitempty"`
+	Renditions []stream.Rendition `json:"renditions,omitempty"`
+	LowLatency bool               `json:"low_latency,omitempty"`
+	Packaging  stream.Packaging   `json:"packaging,omitempty"`
+
+	DVRWindowSeconds int  `json:"dvr_window_seconds,omitempty"`
+	Record           bool `json:"record,omitempty"`
+
+	InactivityTimeoutSeconds int `json:"inactivity_timeout_seconds,omitempty"`
+
+	Protocol stream.Protocol `json:"protocol,omitempty"`
+	RTMPApp  string          `json:"rtmp_app,omitempty"`
+	RTMPKey  string          `json:"rtmp_key,omitempty"`
+
+	SRTPassphrase string `json:"srt_passphrase,omitempty"`
+	SRTKeyLength  int    `json:"srt_key_length,omitempty"`
+
+	SourceURL string `json:"source_url,omitempty"`
+
+	Destinations []DestinationSpec `json:"destinations,omitempty"` // включенные точки ретрансляции
+
+	Captions *CaptionsSpec `json:"captions,omitempty"`
+
+	AdCues *AdCuesSpec `json:"ad_cues,omitempty"`
+}
+
+// CaptionsSpec - текстовые дорожки потока для streaming service
+type CaptionsSpec struct {
+	Languages      []string `json:"languages,omitempty"`
+	ClosedCaptions []string `json:"closed_captions,omitempty"`
+}
+
+// AdCuesSpec - рекламные паузы потока для streaming service
+type AdCuesSpec struct {
+	SCTE35Passthrough bool `json:"scte35_passthrough,omitempty"`
+}
+
+// rtmpAppPattern - допустимое имя приложения RTMP (сегмент пути в rtmp:// URL)
+var rtmpAppPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// generateIngestSecret - случайный ключ публикации RTMP или пароль SRT (32 hex-символа)
+func generateIngestSecret() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
 }
 
 type StreamActionRequest struct {
@@ -34,11 +121,148 @@ func (s *StreamService) CreateStream(ctx context.Context, req *CreateStreamReque
 		return nil, errors.New("name is required")
 	}
 
+	mode := req.Mode
+	if mode == "" {
+		mode = stream.ModeRepackOnly
+	}
+	if !mode.IsValid() {
+		return nil, errors.New("invalid mode")
+	}
+
+	packaging := req.Packaging
+	if packaging == "" {
+		packaging = stream.PackagingTS
+	}
+	if !packaging.IsValid() {
+		return nil, errors.New("invalid packaging")
+	}
+
+	if req.DVRWindowSeconds < 0 || req.DVRWindowSeconds > stream.MaxDVRWindowSeconds {
+		return nil, fmt.Errorf("dvr_window_seconds must be between 0 and %d", stream.MaxDVRWindowSeconds)
+	}
+
+	if req.InactivityTimeoutSeconds != 0 &&
+		(req.InactivityTimeoutSeconds < stream.MinInactivityTimeoutSeconds || req.InactivityTimeoutSeconds > stream.MaxInactivityTimeoutSeconds) {
+		return nil, fmt.Errorf("inactivity_timeout_seconds must be between %d and %d",
+			stream.MinInactivityTimeoutSeconds, stream.MaxInactivityTimeoutSeconds)
+	}
+
+	if req.Record && (req.LowLatency || packaging != stream.PackagingTS) {
+		return nil, errors.New("record is only supported with ts packaging without low_latency")
+	}
+
+	if req.LowLatency && (mode != stream.ModeRepackOnly || packaging != stream.PackagingTS) {
+		return nil, errors.New("low_latency is only supported in repack_only mode with ts packaging")
+	}
+
+	if err := stream.ValidateCaptions(req.SubtitleLanguages, req.ClosedCaptions); err != nil {
+		return nil, err
+	}
+	if (len(req.SubtitleLanguages) > 0 || len(req.ClosedCaptions) > 0) && (req.LowLatency || packaging != stream.PackagingTS) {
+		return nil, errors.New("captions are only supported with ts packaging without low_latency")
+	}
+
+	if req.SCTE35Passthrough {
+		req.AdCues = true
+	}
+	if req.AdCues && (req.LowLatency || packaging != stream.PackagingTS) {
+		return nil, errors.New("ad_cues are only supported with ts packaging without low_latency")
+	}
+
+	if err := stream.ValidateScheduledWindow(req.ScheduledStart, req.ScheduledEnd); err != nil {
+		return nil, err
+	}
+
+	protocol := req.Protocol
+	if protocol == "" {
+		protocol = stream.ProtocolSRT
+	}
+	if !protocol.IsValid() {
+		return nil, errors.New("invalid protocol")
+	}
+	if req.SCTE35Passthrough && protocol != stream.ProtocolSRT {
+		return nil, errors.New("scte35_passthrough is only supported with srt protocol")
+	}
+
+	rtmpApp, rtmpKey := "", ""
+	if protocol == stream.ProtocolRTMP {
+		rtmpApp = req.RTMPApp
+		if rtmpApp == "" {
+			rtmpApp = stream.DefaultRTMPApp
+		}
+		if !rtmpAppPattern.MatchString(rtmpApp) {
+			return nil, errors.New("invalid rtmp_app: only letters, digits, '-' and '_' are allowed")
+		}
+		key, err := generateIngestSecret()
+		if err != nil {
+			return nil, err
+		}
+		rtmpKey = key
+	}
+
+	sourceURL := ""
+	if protocol == stream.ProtocolPull {
+		if err := stream.ValidateSourceURL(req.SourceURL); err != nil {
+			return nil, err
+		}
+		sourceURL = req.SourceURL
+	}
+
+	srtKeyLength := 0
+	if protocol == stream.ProtocolSRT {
+		srtKeyLength = req.SRTKeyLength
+		if srtKeyLength == 0 {
+			srtKeyLength = stream.DefaultSRTKeyLength
+		}
+		if !stream.IsValidSRTKeyLength(srtKeyLength) {
+			return nil, errors.New("srt_key_length must be 16, 24 or 32")
+		}
+	}
+
+	preset := ""
+	if mode == stream.ModeTranscode {
+		preset = req.Preset
+		if preset == "" {
+			preset = stream.DefaultPresetName
+		}
+		if _, err := s.presetRepo.GetByName(ctx, preset); err != nil {
+			return nil, err
+		}
+	}
+
 	newStream := &stream.Stream{
 		Name:         req.Name,
 		StreamID:     uuid.New().String(),
 		StreamStatus: stream.StatusStopped,
+		Mode:         mode,
+		Preset:       preset,
+		LowLatency:   req.LowLatency,
+		Packaging:    packaging,
+		DVRWindow:    req.DVRWindowSeconds,
+		Record:       req.Record,
+		Protocol:     protocol,
+		RTMPApp:      rtmpApp,
+		RTMPKey:      rtmpKey,
+		SRTKeyLength: srtKeyLength,
+		SourceURL:    sourceURL,
 		CreatedAt:    time.Now(),
+
+		InactivityTimeout: req.InactivityTimeoutSeconds,
+
+		SubtitleLanguages: req.SubtitleLanguages,
+		ClosedCaptions:    req.ClosedCaptions,
+
+		AdCues:            req.AdCues,
+		SCTE35Passthrough: req.SCTE35Passthrough,
+
+		ScheduledStart: req.ScheduledStart,
+		ScheduledEnd:   req.ScheduledEnd,
+	}
+
+	if protocol == stream.ProtocolSRT {
+		if err := s.setSRTPassphrase(newStream); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := s.repo.Create(ctx, newStream); err != nil {
@@ -95,6 +319,127 @@ func (s *StreamService) UpdateStreamStatus(ctx context.Context, streamID string,
 	return s.repo.UpdateStatus(ctx, streamID, newStatus)
 }
 
+// UpdateMediaInfo сохраняет параметры ingest, определенные streaming service
+func (s *StreamService) UpdateMediaInfo(ctx context.Context, streamID string, info stream.MediaInfo) error {
+	return s.repo.UpdateMediaInfo(ctx, streamID, info)
+}
+
+// BuildStreamingOptions разворачивает режим и пресет потока в параметры запуска
+func (s *StreamService) BuildStreamingOptions(ctx context.Context, st *stream.Stream) (*StreamingOptions, error) {
+	options := &StreamingOptions{Mode: st.Mode, LowLatency: st.LowLatency, Packaging: st.Packaging}
+	if options.Packaging == "" {
+		options.Packaging = stream.PackagingTS
+	}
+	options.DVRWindowSeconds = st.DVRWindow
+	options.Record = st.Record
+	options.InactivityTimeoutSeconds = st.InactivityTimeout
+	if len(st.SubtitleLanguages) > 0 || len(st.ClosedCaptions) > 0 {
+		options.Captions = &CaptionsSpec{Languages: st.SubtitleLanguages, ClosedCaptions: st.ClosedCaptions}
+	}
+	if st.AdCues {
+		options.AdCues = &AdCuesSpec{SCTE35Passthrough: st.SCTE35Passthrough}
+	}
+	options.Protocol = st.Protocol
+	if options.Protocol == "" {
+		options.Protocol = stream.ProtocolSRT
+	}
+	if options.Protocol == stream.ProtocolRTMP {
+		options.RTMPApp = st.RTMPApp
+		options.RTMPKey = st.RTMPKey
+	}
+	if options.Protocol == stream.ProtocolPull {
+		options.SourceURL = st.SourceURL
+	}
+	if options.Protocol == stream.ProtocolSRT {
+		// Потоки, созданные до появления паролей, получают пароль при первом запуске
+		if st.SRTPassphraseEncrypted == "" {
+			if err := s.setSRTPassphrase(st); err != nil {
+				return nil, err
+			}
+			if err := s.repo.Update(ctx, st.ID, st); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.RevealIngestSecrets(st); err != nil {
+			return nil, err
+		}
+		options.SRTPassphrase = st.SRTPassphrase
+		options.SRTKeyLength = st.SRTKeyLength
+	}
+	if options.Mode == "" {
+		options.Mode = stream.ModeRepackOnly
+	}
+
+	destinations, err := s.destinationRepo.ListByStreamID(ctx, st.StreamID)
+	if err != nil {
+		return nil, err
+	}
+	options.Destinations = enabledDestinationSpecs(destinations)
+
+	if options.Mode == stream.ModeTranscode {
+		preset, err := s.presetRepo.GetByName(ctx, st.Preset)
+		if err != nil {
+			return nil, err
+		}
+		options.Preset = preset.Name
+		options.Renditions = preset.Renditions
+	}
+
+	return options, nil
+}
+
+// setSRTPassphrase генерирует новый пароль SRT и сохраняет его в потоке в зашифрованном виде
+func (s *StreamService) setSRTPassphrase(st *stream.Stream) error {
+	passphrase, err := generateIngestSecret()
+	if err != nil {
+		return err
+	}
+	encrypted, err := s.secrets.Seal(passphrase)
+	if err != nil {
+		return err
+	}
+	if st.SRTKeyLength == 0 {
+		st.SRTKeyLength = stream.DefaultSRTKeyLength
+	}
+	st.SRTPassphrase = passphrase
+	st.SRTPassphraseEncrypted = encrypted
+	return nil
+}
+
+// RevealIngestSecrets расшифровывает пароль SRT для ответа авторизованному вызову
+func (s *StreamService) RevealIngestSecrets(st *stream.Stream) error {
+	if st.SRTPassphraseEncrypted == "" {
+		return nil
+	}
+	passphrase, err := s.secrets.Open(st.SRTPassphraseEncrypted)
+	if err != nil {
+		return err
+	}
+	st.SRTPassphrase = passphrase
+	return nil
+}
+
+// RotateSRTPassphrase заменяет пароль SRT потока, не удаляя сам поток
+func (s *StreamService) RotateSRTPassphrase(ctx context.Context, streamID string) (*stream.Stream, error) {
+	st, err := s.repo.GetByStreamID(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+	if st.Protocol != "" && st.Protocol != stream.ProtocolSRT {
+		return nil, errors.New("passphrase rotation is only supported for srt streams")
+	}
+
+	if err := s.setSRTPassphrase(st); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, st.ID, st); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔑 Stream %s: SRT passphrase rotated", streamID)
+	return st, nil
+}
+
 func (s *StreamService) DeleteStream(ctx context.Context, id uint) error {
 	return s.repo.Delete(ctx, id)
 }
@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Destination - внешняя точка ретрансляции потока (другая платформа или резервный origin)
+type Destination struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	StreamID  string    `json:"stream_id" gorm:"not null;index"`
+	Name      string    `json:"name" gorm:"not null"`
+	URL       string    `json:"url" gorm:"not null"`     // rtmp(s)://host/app/key или srt://host:port?streamid=...
+	Enabled   bool      `json:"enabled" gorm:"not null"` // без default: gorm заменил бы false значением по умолчанию
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Состояние ретрансляции из streaming service, только для активного потока
+	Status map[string]interface{} `json:"status,omitempty" gorm:"-"`
+	Stream *Stream                `json:"-" gorm:"foreignKey:StreamID;references:StreamID;constraint:OnDelete:CASCADE"`
+}
+
+type DestinationRepository interface {
+	Create(ctx context.Context, dest *Destination) error
+	GetByID(ctx context.Context, id uint) (*Destination, error)
+	ListByStreamID(ctx context.Context, streamID string) ([]*Destination, error)
+	Update(ctx context.Context, dest *Destination) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// destinationSchemes - протоколы, которыми streaming service умеет отдавать поток наружу
+var destinationSchemes = map[string]bool{"rtmp": true, "rtmps": true, "srt": true}
+
+// ValidateDestinationURL проверяет адрес точки ретрансляции
+func ValidateDestinationURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("url must be an absolute URL")
+	}
+	if !destinationSchemes[strings.ToLower(u.Scheme)] {
+		return errors.New("url scheme must be rtmp, rtmps or srt")
+	}
+	return nil
+}
+
+// RedactDestinationURL скрывает ключ публикации и пароли в адресе для неавторизованных ответов
+func RedactDestinationURL(raw string) string {
+	redacted := RedactSourceURL(raw)
+	u, err := url.Parse(redacted)
+	if err != nil {
+		return ""
+	}
+	// У RTMP ключ публикации - последний сегмент пути
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme == "rtmp" || scheme == "rtmps") && strings.Count(strings.Trim(u.Path, "/"), "/") >= 1 {
+		return u.Scheme + "://" + u.Host + path.Dir(u.Path) + "/{stream_key}"
+	}
+	return redacted
+}
@@ -2,6 +2,11 @@ package stream
 
 import (
 	//"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -10,8 +15,179 @@ type Stream struct {
 	Name         string    `json:"name" gorm:"not null;index"`
 	StreamID     string    `json:"stream_id" gorm:"uniqueIndex;not null"`
 	StreamStatus Status    `json:"stream_status" gorm:"default:'stopped';index"`
-	CreatedAt    time.Time `json:"created_at" gorm:"index"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	Mode         Mode      `json:"mode" gorm:"default:'repack_only'"`
+	Preset       string    `json:"preset,omitempty" gorm:"index"`    // имя пресета для режима transcode
+	LowLatency   bool      `json:"low_latency" gorm:"default:false"` // LL-HLS (только repack_only)
+	Packaging    Packaging `json:"packaging" gorm:"default:'ts'"`
+	DVRWindow    int       `json:"dvr_window_seconds" gorm:"default:0"` // глубина перемотки, 0 - без DVR
+	Record       bool      `json:"record" gorm:"default:false"`         // сохранять сессии в VOD-архив
+	Protocol     Protocol  `json:"protocol" gorm:"default:'srt'"`
+	RTMPApp      string    `json:"rtmp_app,omitempty"` // приложение RTMP, например live
+	RTMPKey      string    `json:"rtmp_key,omitempty"` // ключ публикации, генерируется при создании
+	// Пароль SRT хранится зашифрованным; открытый текст заполняется только для авторизованных вызовов
+	SRTPassphrase          string    `json:"srt_passphrase,omitempty" gorm:"-"`
+	SRTPassphraseEncrypted string    `json:"-"`
+	SRTKeyLength           int       `json:"srt_key_length,omitempty"` // pbkeylen: 16, 24 или 32 байта
+	SourceURL              string    `json:"source_url,omitempty"`     // источник pull-потока (srt://, rtmp://, http(s)://)
+	InactivityTimeout      int       `json:"inactivity_timeout_seconds" gorm:"default:0"`
+	CreatedAt              time.Time `json:"created_at" gorm:"index"`
+	UpdatedAt              time.Time `json:"updated_at"`
+
+	// Текстовые дорожки: языки WebVTT для фраз из API и каналы CEA-608/708 в ingest
+	SubtitleLanguages []string `json:"subtitle_languages,omitempty" gorm:"serializer:json"`
+	ClosedCaptions    []string `json:"closed_captions,omitempty" gorm:"serializer:json"`
+
+	// Рекламные паузы из API и метки SCTE-35 из SRT ingest
+	AdCues            bool `json:"ad_cues" gorm:"default:false"`
+	SCTE35Passthrough bool `json:"scte35_passthrough" gorm:"default:false"`
+
+	// Разовое окно эфира: планировщик запускает и останавливает поток в эти моменты
+	ScheduledStart *time.Time `json:"scheduled_start,omitempty" gorm:"index"`
+	ScheduledEnd   *time.Time `json:"scheduled_end,omitempty" gorm:"index"`
+
+	// Параметры ingest, которые сообщает streaming service по данным ffprobe
+	VideoCodec    string     `json:"video_codec,omitempty"`
+	Width         int        `json:"width,omitempty"`
+	Height        int        `json:"height,omitempty"`
+	FPS           float64    `json:"fps,omitempty"`
+	AudioCodec    string     `json:"audio_codec,omitempty"`
+	SampleRate    int        `json:"sample_rate,omitempty"`
+	AudioChannels int        `json:"audio_channels,omitempty"`
+	MediaProbedAt *time.Time `json:"media_probed_at,omitempty"`
+}
+
+// MediaInfo - параметры входящего потока: кодеки, разрешение, частота кадров и аудио
+type MediaInfo struct {
+	VideoCodec    string    `json:"video_codec"`
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	FPS           float64   `json:"fps"`
+	AudioCodec    string    `json:"audio_codec"`
+	SampleRate    int       `json:"sample_rate"`
+	AudioChannels int       `json:"audio_channels"`
+	ProbedAt      time.Time `json:"probed_at"`
+}
+
+// MaxSubtitleLanguages - предельное число дорожек WebVTT потока
+const MaxSubtitleLanguages = 8
+
+var (
+	// subtitleLanguagePattern - код языка BCP 47: ru, en, pt-BR
+	subtitleLanguagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+	// closedCaptionPattern - INSTREAM-ID: каналы CEA-608 (CC1-CC4) или сервисы CEA-708 (SERVICE1-SERVICE63)
+	closedCaptionPattern = regexp.MustCompile(`^(CC[1-4]|SERVICE([1-9]|[1-5][0-9]|6[0-3]))$`)
+)
+
+// ValidateCaptions проверяет языки субтитров и каналы CEA-608/708
+func ValidateCaptions(languages, closedCaptions []string) error {
+	if len(languages) > MaxSubtitleLanguages {
+		return fmt.Errorf("at most %d subtitle languages are supported", MaxSubtitleLanguages)
+	}
+	seen := make(map[string]bool)
+	for _, lang := range languages {
+		if !subtitleLanguagePattern.MatchString(lang) {
+			return fmt.Errorf("invalid subtitle language: %q", lang)
+		}
+		if seen[lang] {
+			return fmt.Errorf("duplicate subtitle language: %s", lang)
+		}
+		seen[lang] = true
+	}
+	for _, id := range closedCaptions {
+		if !closedCaptionPattern.MatchString(id) {
+			return fmt.Errorf("invalid closed caption channel: %q (expected CC1-CC4 or SERVICE1-SERVICE63)", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("duplicate closed caption channel: %s", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// MaxDVRWindowSeconds - предельная глубина DVR (6 часов)
+const MaxDVRWindowSeconds = 6 * 60 * 60
+
+// Допустимый порог неактивности потока (Stream.InactivityTimeout), секунды:
+// без новых сегментов дольше порога поток возвращается в starting.
+// 0 - порог streaming service по умолчанию.
+const (
+	MinInactivityTimeoutSeconds = 5
+	MaxInactivityTimeoutSeconds = 600
+)
+
+// Packaging - формат сегментов потока
+type Packaging string
+
+const (
+	PackagingTS   Packaging = "ts"   // HLS с MPEG-TS сегментами
+	PackagingCMAF Packaging = "cmaf" // fMP4 сегменты, общие для HLS и DASH (manifest.mpd)
+)
+
+func (p Packaging) IsValid() bool {
+	switch p {
+	case PackagingTS, PackagingCMAF:
+		return true
+	default:
+		return false
+	}
+}
+
+// Protocol - протокол приема потока от энкодера
+type Protocol string
+
+const (
+	ProtocolSRT  Protocol = "srt"
+	ProtocolRTMP Protocol = "rtmp"
+	ProtocolPull Protocol = "pull" // streaming service сам забирает поток по SourceURL
+)
+
+// DefaultRTMPApp - приложение RTMP, если оно не задано при создании
+const DefaultRTMPApp = "live"
+
+// DefaultSRTKeyLength - длина ключа AES для SRT (pbkeylen), если она не задана при создании
+const DefaultSRTKeyLength = 16
+
+// IsValidSRTKeyLength проверяет pbkeylen: SRT поддерживает AES-128/192/256
+func IsValidSRTKeyLength(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+func (p Protocol) IsValid() bool {
+	switch p {
+	case ProtocolSRT, ProtocolRTMP, ProtocolPull:
+		return true
+	default:
+		return false
+	}
+}
+
+// pullSchemes - схемы источников, которые умеет забирать streaming service
+var pullSchemes = map[string]bool{"srt": true, "rtmp": true, "rtmps": true, "http": true, "https": true}
+
+// ValidateSourceURL проверяет адрес источника pull-потока
+func ValidateSourceURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("source_url must be an absolute URL")
+	}
+	if !pullSchemes[strings.ToLower(u.Scheme)] {
+		return errors.New("source_url scheme must be srt, rtmp, rtmps, http or https")
+	}
+	return nil
+}
+
+// RedactSourceURL скрывает пароль в адресе источника для неавторизованных ответов
+func RedactSourceURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if u.User != nil {
+		u.User = url.User(u.User.Username())
+	}
+	u.RawQuery = ""
+	return u.String()
 }
 
 type Status string
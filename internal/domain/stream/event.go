@@ -0,0 +1,38 @@
+package stream
+
+import (
+	"context"
+	"time"
+)
+
+// Типы событий потока
+const (
+	EventCueOut = "cue_out" // начало рекламной паузы
+	EventCueIn  = "cue_in"  // возврат из рекламной паузы
+)
+
+// Источники рекламных меток
+const (
+	EventSourceAPI    = "api"    // пауза поставлена через POST /api/streams/{id}/cues
+	EventSourceSCTE35 = "scte35" // метка SCTE-35 пришла в SRT ingest
+)
+
+// Event - событие в истории потока, например начало или конец рекламной паузы
+type Event struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	StreamID        string    `json:"stream_id" gorm:"not null;index:idx_events_stream_time"`
+	Type            string    `json:"type" gorm:"not null"`
+	Source          string    `json:"source,omitempty"`
+	CueID           string    `json:"cue_id,omitempty"`
+	Time            time.Time `json:"time" gorm:"index:idx_events_stream_time"` // время в эфире (EXT-X-PROGRAM-DATE-TIME сегмента)
+	DurationSeconds float64   `json:"duration_seconds,omitempty"`               // cue_out - заявленная, cue_in - фактическая
+	SCTE35          string    `json:"scte35,omitempty"`                         // splice_info_section в base64
+	CreatedAt       time.Time `json:"created_at"`
+
+	Stream *Stream `json:"-" gorm:"foreignKey:StreamID;references:StreamID;constraint:OnDelete:CASCADE"`
+}
+
+type EventRepository interface {
+	Create(ctx context.Context, event *Event) error
+	ListByStreamID(ctx context.Context, streamID string, limit int) ([]*Event, error)
+}
@@ -0,0 +1,102 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Mode - режим обработки потока в streaming service
+type Mode string
+
+const (
+	ModeRepackOnly Mode = "repack_only" // -c copy в один playlist.m3u8
+	ModeTranscode  Mode = "transcode"   // ABR-лестница по пресету + master.m3u8
+)
+
+func (m Mode) IsValid() bool {
+	switch m {
+	case ModeRepackOnly, ModeTranscode:
+		return true
+	default:
+		return false
+	}
+}
+
+// Rendition - одна ступень ABR-лестницы
+type Rendition struct {
+	Name         string `json:"name"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	VideoBitrate int    `json:"video_bitrate,omitempty"` // кбит/с
+	AudioBitrate int    `json:"audio_bitrate"`           // кбит/с
+	AudioOnly    bool   `json:"audio_only,omitempty"`
+}
+
+// Preset - именованная ABR-лестница для режима transcode
+type Preset struct {
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	Name       string      `json:"name" gorm:"uniqueIndex;not null"`
+	Renditions []Rendition `json:"renditions" gorm:"serializer:json;not null"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+const DefaultPresetName = "abr_default"
+
+// DefaultPreset - лестница, создаваемая при первом запуске
+func DefaultPreset() *Preset {
+	return &Preset{
+		Name: DefaultPresetName,
+		Renditions: []Rendition{
+			{Name: "1080p", Width: 1920, Height: 1080, VideoBitrate: 5000, AudioBitrate: 128},
+			{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+			{Name: "480p", Width: 854, Height: 480, VideoBitrate: 1400, AudioBitrate: 96},
+			{Name: "audio", AudioBitrate: 96, AudioOnly: true},
+		},
+	}
+}
+
+// Validate проверяет пресет перед сохранением
+func (p *Preset) Validate() error {
+	if p.Name == "" {
+		return errors.New("preset name is required")
+	}
+	if len(p.Renditions) == 0 {
+		return errors.New("preset must contain at least one rendition")
+	}
+
+	names := make(map[string]bool, len(p.Renditions))
+	hasVideo := false
+	for _, r := range p.Renditions {
+		if r.Name == "" {
+			return errors.New("rendition name is required")
+		}
+		if names[r.Name] {
+			return errors.New("duplicate rendition name: " + r.Name)
+		}
+		names[r.Name] = true
+
+		if r.AudioBitrate <= 0 {
+			return errors.New("rendition " + r.Name + ": audio_bitrate must be positive")
+		}
+		if r.AudioOnly {
+			continue
+		}
+		hasVideo = true
+		if r.Height <= 0 || r.VideoBitrate <= 0 {
+			return errors.New("rendition " + r.Name + ": height and video_bitrate must be positive")
+		}
+	}
+	if !hasVideo {
+		return errors.New("preset must contain at least one video rendition")
+	}
+	return nil
+}
+
+type PresetRepository interface {
+	Create(ctx context.Context, preset *Preset) error
+	GetByName(ctx context.Context, name string) (*Preset, error)
+	List(ctx context.Context) ([]*Preset, error)
+	Delete(ctx context.Context, name string) error
+}
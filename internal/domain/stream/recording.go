@@ -0,0 +1,32 @@
+package stream
+
+import (
+	"context"
+	"time"
+)
+
+// Recording - VOD-архив одной живой сессии потока
+type Recording struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	StreamID        string    `json:"stream_id" gorm:"not null;uniqueIndex:idx_recordings_session"`
+	SessionID       string    `json:"session_id" gorm:"not null;uniqueIndex:idx_recordings_session"`
+	StartedAt       time.Time `json:"started_at"`
+	EndedAt         time.Time `json:"ended_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	SegmentCount    int       `json:"segment_count"`
+	SizeBytes       int64     `json:"size_bytes"`
+	Path            string    `json:"path"`          // каталог архива в streaming service
+	PlaylistPath    string    `json:"playlist_path"` // путь плейлиста относительно /recordings/
+	CreatedAt       time.Time `json:"created_at" gorm:"index"`
+
+	PlaybackURL string  `json:"playback_url,omitempty" gorm:"-"`
+	Stream      *Stream `json:"-" gorm:"foreignKey:StreamID;references:StreamID;constraint:OnDelete:CASCADE"`
+}
+
+type RecordingRepository interface {
+	Create(ctx context.Context, rec *Recording) error
+	GetByID(ctx context.Context, id uint) (*Recording, error)
+	GetBySession(ctx context.Context, streamID, sessionID string) (*Recording, error)
+	ListByStreamID(ctx context.Context, streamID string) ([]*Recording, error)
+	Delete(ctx context.Context, id uint) error
+}
@@ -1,6 +1,9 @@
 package stream
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Repository interface {
 	Create(ctx context.Context, stream *Stream) error
@@ -8,6 +11,10 @@ type Repository interface {
 	GetByStreamID(ctx context.Context, streamID string) (*Stream, error)
 	List(ctx context.Context, filter *Filter) ([]*Stream, error)
 	UpdateStatus(ctx context.Context, streamID string, status Status) error
+	UpdateMediaInfo(ctx context.Context, streamID string, info MediaInfo) error
+	UpdateScheduledWindow(ctx context.Context, streamID string, start, end *time.Time) error
+	// ListScheduled возвращает потоки, у которых scheduled_start или scheduled_end попадает в (from, to]
+	ListScheduled(ctx context.Context, from, to time.Time) ([]*Stream, error)
 	Update(ctx context.Context, id uint, stream *Stream) error
 	Delete(ctx context.Context, id uint) error
 	Count(ctx context.Context, filter *Filter) (int64, error)
@@ -15,6 +22,7 @@ type Repository interface {
 
 type Filter struct {
 	Status Status
+	Preset string
 	Limit  int
 	Offset int
 }
@@ -0,0 +1,181 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Действия планировщика - те же, что POST /api/streams/{stream_id}
+const (
+	ScheduleActionStart = "start"
+	ScheduleActionStop  = "stop"
+)
+
+// Результаты запусков планировщика
+const (
+	ScheduleRunPending   = "pending"   // слот занят репликой, вызов еще выполняется
+	ScheduleRunSucceeded = "succeeded" // streaming service выполнил действие
+	ScheduleRunFailed    = "failed"    // streaming service недоступен или вернул ошибку
+	ScheduleRunSkipped   = "skipped"   // действие не требовалось: поток уже в нужном состоянии или окно закончилось
+)
+
+// MaxSchedulesPerStream ограничивает число повторяющихся расписаний потока
+const MaxSchedulesPerStream = 20
+
+// MaxScheduleDurationMinutes - предельная длина окна расписания (сутки):
+// окно не должно перекрывать следующее вхождение того же расписания
+const MaxScheduleDurationMinutes = 24 * 60
+
+// Schedule - повторяющееся окно эфира: по дням недели Weekdays (пусто - каждый день)
+// поток запускается в StartTime по часовому поясу Timezone и останавливается
+// через DurationMinutes
+type Schedule struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	StreamID        string    `json:"stream_id" gorm:"not null;index"`
+	Weekdays        []int     `json:"weekdays,omitempty" gorm:"serializer:json"` // 0 - воскресенье ... 6 - суббота
+	StartTime       string    `json:"start_time" gorm:"not null"`                // ЧЧ:ММ по местному времени
+	DurationMinutes int       `json:"duration_minutes" gorm:"not null"`
+	Timezone        string    `json:"timezone" gorm:"not null"` // IANA, например Europe/Moscow
+	Enabled         bool      `json:"enabled" gorm:"not null"`  // без default: gorm заменил бы false значением по умолчанию
+	CreatedAt       time.Time `json:"created_at" gorm:"index"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	Stream *Stream `json:"-" gorm:"foreignKey:StreamID;references:StreamID;constraint:OnDelete:CASCADE"`
+}
+
+// ScheduleRun - результат одного действия планировщика. Уникальный индекс по
+// потоку, действию и времени слота гарантирует, что из нескольких реплик
+// go-app действие выполнит только та, что первой записала слот.
+type ScheduleRun struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	StreamID    string     `json:"stream_id" gorm:"not null;uniqueIndex:idx_schedule_runs_slot,priority:1"`
+	Action      string     `json:"action" gorm:"not null;uniqueIndex:idx_schedule_runs_slot,priority:2"`
+	ScheduledAt time.Time  `json:"scheduled_at" gorm:"not null;uniqueIndex:idx_schedule_runs_slot,priority:3"`
+	ScheduleID  *uint      `json:"schedule_id,omitempty"` // nil - разовое время scheduled_start/scheduled_end потока
+	Status      string     `json:"status" gorm:"not null"`
+	Error       string     `json:"error,omitempty"`
+	Instance    string     `json:"instance,omitempty"` // реплика go-app, выполнившая действие
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+
+	Stream *Stream `json:"-" gorm:"foreignKey:StreamID;references:StreamID;constraint:OnDelete:CASCADE"`
+}
+
+// ScheduleSlot - действие, которое планировщик должен выполнить в момент At
+type ScheduleSlot struct {
+	StreamID   string
+	ScheduleID *uint
+	Action     string
+	At         time.Time
+	Until      time.Time // для start - конец окна, нулевое - окно без конца
+}
+
+type ScheduleRepository interface {
+	Create(ctx context.Context, schedule *Schedule) error
+	GetByID(ctx context.Context, id uint) (*Schedule, error)
+	ListByStreamID(ctx context.Context, streamID string) ([]*Schedule, error)
+	ListEnabled(ctx context.Context) ([]*Schedule, error)
+	Update(ctx context.Context, schedule *Schedule) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type ScheduleRunRepository interface {
+	// Claim записывает слот и возвращает false, если его уже заняла другая реплика
+	Claim(ctx context.Context, run *ScheduleRun) (bool, error)
+	Update(ctx context.Context, run *ScheduleRun) error
+	ListByStreamID(ctx context.Context, streamID string, limit int) ([]*ScheduleRun, error)
+}
+
+// ValidateScheduledWindow проверяет разовое окно эфира потока
+func ValidateScheduledWindow(start, end *time.Time) error {
+	if start != nil && end != nil && !end.After(*start) {
+		return errors.New("scheduled_end must be after scheduled_start")
+	}
+	return nil
+}
+
+// Validate проверяет поля расписания и подставляет часовой пояс UTC по умолчанию
+func (s *Schedule) Validate() error {
+	if _, err := time.Parse("15:04", s.StartTime); err != nil {
+		return fmt.Errorf("invalid start_time %q: expected HH:MM", s.StartTime)
+	}
+	if s.DurationMinutes < 1 || s.DurationMinutes > MaxScheduleDurationMinutes {
+		return fmt.Errorf("duration_minutes must be between 1 and %d", MaxScheduleDurationMinutes)
+	}
+	if s.Timezone == "" {
+		s.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	seen := make(map[int]bool)
+	for _, day := range s.Weekdays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("invalid weekday %d: expected 0 (Sunday) to 6 (Saturday)", day)
+		}
+		if seen[day] {
+			return fmt.Errorf("duplicate weekday %d", day)
+		}
+		seen[day] = true
+	}
+	sort.Ints(s.Weekdays)
+	return nil
+}
+
+// Slots возвращает запуски и остановки расписания, попадающие в полуинтервал (from, to]
+func (s *Schedule) Slots(from, to time.Time) []ScheduleSlot {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil
+	}
+	clock, err := time.Parse("15:04", s.StartTime)
+	if err != nil {
+		return nil
+	}
+	duration := time.Duration(s.DurationMinutes) * time.Minute
+
+	days := make(map[time.Weekday]bool)
+	for _, day := range s.Weekdays {
+		days[time.Weekday(day)] = true
+	}
+
+	var slots []ScheduleSlot
+	inWindow := func(t time.Time) bool { return t.After(from) && !t.After(to) }
+
+	// Окно, начавшееся накануне, может закончиться внутри интервала
+	first := from.In(loc).Add(-duration - 24*time.Hour)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	for ; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if len(days) > 0 && !days[day.Weekday()] {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		end := start.Add(duration)
+		if inWindow(start) {
+			slots = append(slots, ScheduleSlot{StreamID: s.StreamID, ScheduleID: &s.ID, Action: ScheduleActionStart, At: start.UTC(), Until: end.UTC()})
+		}
+		if inWindow(end) {
+			slots = append(slots, ScheduleSlot{StreamID: s.StreamID, ScheduleID: &s.ID, Action: ScheduleActionStop, At: end.UTC()})
+		}
+	}
+	return slots
+}
+
+// ScheduledSlots возвращает разовые запуск и остановку потока, попадающие в (from, to]
+func (s *Stream) ScheduledSlots(from, to time.Time) []ScheduleSlot {
+	var slots []ScheduleSlot
+	if s.ScheduledStart != nil && s.ScheduledStart.After(from) && !s.ScheduledStart.After(to) {
+		slot := ScheduleSlot{StreamID: s.StreamID, Action: ScheduleActionStart, At: s.ScheduledStart.UTC()}
+		if s.ScheduledEnd != nil {
+			slot.Until = s.ScheduledEnd.UTC()
+		}
+		slots = append(slots, slot)
+	}
+	if s.ScheduledEnd != nil && s.ScheduledEnd.After(from) && !s.ScheduledEnd.After(to) {
+		slots = append(slots, ScheduleSlot{StreamID: s.StreamID, Action: ScheduleActionStop, At: s.ScheduledEnd.UTC()})
+	}
+	return slots
+}
@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScheduleSlots(t *testing.T) {
+	// slot - слот в виде строк RFC 3339 по UTC, чтобы ожидания читались в таблице
+	type slot struct {
+		action string
+		at     string
+		until  string
+	}
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from     string
+		to       string
+		want     []slot
+	}{
+		{
+			name:     "window crossing spring forward lasts its full duration",
+			schedule: Schedule{StartTime: "01:30", DurationMinutes: 60, Timezone: "Europe/Berlin"},
+			from:     "2026-03-29T00:00:00Z",
+			to:       "2026-03-29T02:00:00Z",
+			want: []slot{
+				{ScheduleActionStart, "2026-03-29T00:30:00Z", "2026-03-29T01:30:00Z"},
+				{ScheduleActionStop, "2026-03-29T01:30:00Z", ""},
+			},
+		},
+		{
+			name:     "start keeps local time after fall back",
+			schedule: Schedule{StartTime: "09:00", DurationMinutes: 60, Timezone: "Europe/Berlin"},
+			from:     "2026-10-24T06:00:00Z",
+			to:       "2026-10-25T10:00:00Z",
+			want: []slot{
+				{ScheduleActionStart, "2026-10-24T07:00:00Z", "2026-10-24T08:00:00Z"},
+				{ScheduleActionStop, "2026-10-24T08:00:00Z", ""},
+				{ScheduleActionStart, "2026-10-25T08:00:00Z", "2026-10-25T09:00:00Z"},
+				{ScheduleActionStop, "2026-10-25T09:00:00Z", ""},
+			},
+		},
+		{
+			name:     "window spanning midnight starts and stops",
+			schedule: Schedule{Weekdays: []int{5}, StartTime: "23:00", DurationMinutes: 120, Timezone: "UTC"},
+			from:     "2026-10-16T22:00:00Z",
+			to:       "2026-10-17T02:00:00Z",
+			want: []slot{
+				{ScheduleActionStart, "2026-10-16T23:00:00Z", "2026-10-17T01:00:00Z"},
+				{ScheduleActionStop, "2026-10-17T01:00:00Z", ""},
+			},
+		},
+		{
+			name:     "window from previous weekday stops on a day outside weekdays",
+			schedule: Schedule{Weekdays: []int{5}, StartTime: "23:00", DurationMinutes: 120, Timezone: "UTC"},
+			from:     "2026-10-17T00:00:00Z",
+			to:       "2026-10-17T12:00:00Z",
+			want: []slot{
+				{ScheduleActionStop, "2026-10-17T01:00:00Z", ""},
+			},
+		},
+		{
+			name:     "weekday and midnight are taken in schedule timezone",
+			schedule: Schedule{Weekdays: []int{5}, StartTime: "23:00", DurationMinutes: 120, Timezone: "Europe/Moscow"},
+			from:     "2026-10-16T21:00:00Z",
+			to:       "2026-10-17T00:00:00Z",
+			want: []slot{
+				{ScheduleActionStop, "2026-10-16T22:00:00Z", ""},
+			},
+		},
+		{
+			name:     "slot at lateness boundary is skipped",
+			schedule: Schedule{StartTime: "12:00", DurationMinutes: 30, Timezone: "UTC"},
+			from:     "2026-10-16T12:00:00Z",
+			to:       "2026-10-16T12:10:00Z",
+			want:     nil,
+		},
+		{
+			name:     "slot just inside lateness runs",
+			schedule: Schedule{StartTime: "12:00", DurationMinutes: 30, Timezone: "UTC"},
+			from:     "2026-10-16T11:59:59Z",
+			to:       "2026-10-16T12:10:00Z",
+			want: []slot{
+				{ScheduleActionStart, "2026-10-16T12:00:00Z", "2026-10-16T12:30:00Z"},
+			},
+		},
+		{
+			name:     "slot at tick time runs",
+			schedule: Schedule{StartTime: "12:00", DurationMinutes: 30, Timezone: "UTC"},
+			from:     "2026-10-16T11:55:00Z",
+			to:       "2026-10-16T12:00:00Z",
+			want: []slot{
+				{ScheduleActionStart, "2026-10-16T12:00:00Z", "2026-10-16T12:30:00Z"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, err := time.Parse(time.RFC3339, tt.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			to, err := time.Parse(time.RFC3339, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []slot
+			for _, s := range tt.schedule.Slots(from, to) {
+				if s.ScheduleID != &tt.schedule.ID {
+					t.Errorf("slot %s at %s has foreign schedule id", s.Action, s.At)
+				}
+				until := ""
+				if !s.Until.IsZero() {
+					until = s.Until.Format(time.RFC3339)
+				}
+				got = append(got, slot{s.Action, s.At.Format(time.RFC3339), until})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Slots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"my-go-app/internal/domain/stream"
+)
+
+type DestinationRepository struct {
+	db *gorm.DB
+}
+
+func NewDestinationRepository(db *gorm.DB) *DestinationRepository {
+	return &DestinationRepository{db: db}
+}
+
+func (r *DestinationRepository) Create(ctx context.Context, dest *stream.Destination) error {
+	return r.db.WithContext(ctx).Create(dest).Error
+}
+
+func (r *DestinationRepository) GetByID(ctx context.Context, id uint) (*stream.Destination, error) {
+	var dest stream.Destination
+	err := r.db.WithContext(ctx).First(&dest, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("destination not found")
+		}
+		return nil, err
+	}
+	return &dest, nil
+}
+
+func (r *DestinationRepository) ListByStreamID(ctx context.Context, streamID string) ([]*stream.Destination, error) {
+	var destinations []*stream.Destination
+	err := r.db.WithContext(ctx).Where("stream_id = ?", streamID).Order("id ASC").Find(&destinations).Error
+	return destinations, err
+}
+
+// Update сохраняет все поля, включая enabled=false (Updates со структурой пропустил бы нулевые значения)
+func (r *DestinationRepository) Update(ctx context.Context, dest *stream.Destination) error {
+	return r.db.WithContext(ctx).Save(dest).Error
+}
+
+func (r *DestinationRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&stream.Destination{}, id).Error
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"my-go-app/internal/domain/stream"
+)
+
+type EventRepository struct {
+	db *gorm.DB
+}
+
+func NewEventRepository(db *gorm.DB) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+func (r *EventRepository) Create(ctx context.Context, event *stream.Event) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+// ListByStreamID возвращает последние limit событий потока, новые первыми
+func (r *EventRepository) ListByStreamID(ctx context.Context, streamID string, limit int) ([]*stream.Event, error) {
+	var events []*stream.Event
+	err := r.db.WithContext(ctx).Where("stream_id = ?", streamID).Order("time DESC, id DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
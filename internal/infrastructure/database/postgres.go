@@ -63,7 +63,7 @@ func NewConnection(cfg *Config) (*gorm.DB, error) {
 	}
 
 	// Автомиграция
-	if err := database.AutoMigrate(&stream.Stream{}); err != nil {
+	if err := database.AutoMigrate(&stream.Stream{}, &stream.Preset{}, &stream.Recording{}, &stream.Destination{}, &stream.Event{}, &stream.Schedule{}, &stream.ScheduleRun{}); err != nil {
 		return nil, fmt.Errorf("failed to migrate: %v", err)
 	}
 
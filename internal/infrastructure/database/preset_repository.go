@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"my-go-app/internal/domain/stream"
+)
+
+type PresetRepository struct {
+	db *gorm.DB
+}
+
+func NewPresetRepository(db *gorm.DB) *PresetRepository {
+	return &PresetRepository{db: db}
+}
+
+func (r *PresetRepository) Create(ctx context.Context, p *stream.Preset) error {
+	return r.db.WithContext(ctx).Create(p).Error
+}
+
+func (r *PresetRepository) GetByName(ctx context.Context, name string) (*stream.Preset, error) {
+	var p stream.Preset
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(&p).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("preset not found")
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *PresetRepository) List(ctx context.Context) ([]*stream.Preset, error) {
+	var presets []*stream.Preset
+	err := r.db.WithContext(ctx).Order("name").Find(&presets).Error
+	return presets, err
+}
+
+func (r *PresetRepository) Delete(ctx context.Context, name string) error {
+	return r.db.WithContext(ctx).Where("name = ?", name).Delete(&stream.Preset{}).Error
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"my-go-app/internal/domain/stream"
+)
+
+type RecordingRepository struct {
+	db *gorm.DB
+}
+
+func NewRecordingRepository(db *gorm.DB) *RecordingRepository {
+	return &RecordingRepository{db: db}
+}
+
+func (r *RecordingRepository) Create(ctx context.Context, rec *stream.Recording) error {
+	return r.db.WithContext(ctx).Create(rec).Error
+}
+
+func (r *RecordingRepository) GetByID(ctx context.Context, id uint) (*stream.Recording, error) {
+	var rec stream.Recording
+	err := r.db.WithContext(ctx).First(&rec, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("recording not found")
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (r *RecordingRepository) GetBySession(ctx context.Context, streamID, sessionID string) (*stream.Recording, error) {
+	var rec stream.Recording
+	err := r.db.WithContext(ctx).Where("stream_id = ? AND session_id = ?", streamID, sessionID).First(&rec).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("recording not found")
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (r *RecordingRepository) ListByStreamID(ctx context.Context, streamID string) ([]*stream.Recording, error) {
+	var recordings []*stream.Recording
+	err := r.db.WithContext(ctx).Where("stream_id = ?", streamID).Order("started_at DESC").Find(&recordings).Error
+	return recordings, err
+}
+
+func (r *RecordingRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&stream.Recording{}, id).Error
+}
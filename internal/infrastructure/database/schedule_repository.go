@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-go-app/internal/domain/stream"
+)
+
+type ScheduleRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduleRepository(db *gorm.DB) *ScheduleRepository {
+	return &ScheduleRepository{db: db}
+}
+
+func (r *ScheduleRepository) Create(ctx context.Context, schedule *stream.Schedule) error {
+	return r.db.WithContext(ctx).Create(schedule).Error
+}
+
+func (r *ScheduleRepository) GetByID(ctx context.Context, id uint) (*stream.Schedule, error) {
+	var schedule stream.Schedule
+	err := r.db.WithContext(ctx).First(&schedule, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("schedule not found")
+		}
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (r *ScheduleRepository) ListByStreamID(ctx context.Context, streamID string) ([]*stream.Schedule, error) {
+	var schedules []*stream.Schedule
+	err := r.db.WithContext(ctx).Where("stream_id = ?", streamID).Order("id ASC").Find(&schedules).Error
+	return schedules, err
+}
+
+func (r *ScheduleRepository) ListEnabled(ctx context.Context) ([]*stream.Schedule, error) {
+	var schedules []*stream.Schedule
+	err := r.db.WithContext(ctx).Where("enabled = ?", true).Order("id ASC").Find(&schedules).Error
+	return schedules, err
+}
+
+// Update сохраняет все поля, включая enabled=false (Updates со структурой пропустил бы нулевые значения)
+func (r *ScheduleRepository) Update(ctx context.Context, schedule *stream.Schedule) error {
+	return r.db.WithContext(ctx).Save(schedule).Error
+}
+
+func (r *ScheduleRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&stream.Schedule{}, id).Error
+}
+
+type ScheduleRunRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduleRunRepository(db *gorm.DB) *ScheduleRunRepository {
+	return &ScheduleRunRepository{db: db}
+}
+
+// Claim вставляет слот с ON CONFLICT DO NOTHING: при гонке реплик строку
+// запишет только одна, остальные получат false и пропустят действие
+func (r *ScheduleRunRepository) Claim(ctx context.Context, run *stream.ScheduleRun) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(run)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *ScheduleRunRepository) Update(ctx context.Context, run *stream.ScheduleRun) error {
+	return r.db.WithContext(ctx).Save(run).Error
+}
+
+// ListByStreamID возвращает последние limit запусков планировщика, новые первыми
+func (r *ScheduleRunRepository) ListByStreamID(ctx context.Context, streamID string, limit int) ([]*stream.ScheduleRun, error) {
+	var runs []*stream.ScheduleRun
+	err := r.db.WithContext(ctx).Where("stream_id = ?", streamID).Order("scheduled_at DESC, id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -54,6 +55,9 @@ func (r *StreamRepository) List(ctx context.Context, filter *stream.Filter) ([]*
 		if filter.Status != "" {
 			query = query.Where("stream_status = ?", filter.Status)
 		}
+		if filter.Preset != "" {
+			query = query.Where("preset = ?", filter.Preset)
+		}
 		if filter.Limit > 0 {
 			query = query.Limit(filter.Limit)
 		}
@@ -72,6 +76,53 @@ func (r *StreamRepository) UpdateStatus(ctx context.Context, streamID string, st
 		Update("stream_status", status).Error
 }
 
+func (r *StreamRepository) UpdateMediaInfo(ctx context.Context, streamID string, info stream.MediaInfo) error {
+	result := r.db.WithContext(ctx).Model(&stream.Stream{}).
+		Where("stream_id = ?", streamID).
+		Updates(map[string]interface{}{
+			"video_codec":     info.VideoCodec,
+			"width":           info.Width,
+			"height":          info.Height,
+			"fps":             info.FPS,
+			"audio_codec":     info.AudioCodec,
+			"sample_rate":     info.SampleRate,
+			"audio_channels":  info.AudioChannels,
+			"media_probed_at": info.ProbedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("stream not found")
+	}
+	return nil
+}
+
+// UpdateScheduledWindow сохраняет разовое окно эфира; nil очищает время
+func (r *StreamRepository) UpdateScheduledWindow(ctx context.Context, streamID string, start, end *time.Time) error {
+	result := r.db.WithContext(ctx).Model(&stream.Stream{}).
+		Where("stream_id = ?", streamID).
+		Updates(map[string]interface{}{
+			"scheduled_start": start,
+			"scheduled_end":   end,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("stream not found")
+	}
+	return nil
+}
+
+func (r *StreamRepository) ListScheduled(ctx context.Context, from, to time.Time) ([]*stream.Stream, error) {
+	var streams []*stream.Stream
+	err := r.db.WithContext(ctx).
+		Where("(scheduled_start > ? AND scheduled_start <= ?) OR (scheduled_end > ? AND scheduled_end <= ?)", from, to, from, to).
+		Find(&streams).Error
+	return streams, err
+}
+
 func (r *StreamRepository) Update(ctx context.Context, id uint, s *stream.Stream) error {
 	return r.db.WithContext(ctx).Model(&stream.Stream{}).Where("id = ?", id).Updates(s).Error
 }
@@ -85,8 +136,13 @@ func (r *StreamRepository) Count(ctx context.Context, filter *stream.Filter) (in
 
 	query := r.db.WithContext(ctx).Model(&stream.Stream{})
 
-	if filter != nil && filter.Status != "" {
-		query = query.Where("stream_status = ?", filter.Status)
+	if filter != nil {
+		if filter.Status != "" {
+			query = query.Where("stream_status = ?", filter.Status)
+		}
+		if filter.Preset != "" {
+			query = query.Where("preset = ?", filter.Preset)
+		}
 	}
 
 	err := query.Count(&count).Error
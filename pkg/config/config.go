@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -27,10 +29,54 @@ func GetEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// GetEnvInt возвращает целое значение переменной окружения или значение по умолчанию
+func GetEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️ Некорректное значение %s=%q, используем %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvFloat возвращает дробное значение переменной окружения или значение по умолчанию
+func GetEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("⚠️ Некорректное значение %s=%q, используем %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvDuration возвращает длительность (формат time.ParseDuration) или значение по умолчанию
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️ Некорректное значение %s=%q, используем %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
 // Config содержит настройки приложения
 type Config struct {
-	DatabaseConfig *DatabaseConfig
-	ServerConfig   *ServerConfig
+	DatabaseConfig  *DatabaseConfig
+	ServerConfig    *ServerConfig
+	SecurityConfig  *SecurityConfig
+	SchedulerConfig *SchedulerConfig
 }
 
 type DatabaseConfig struct {
@@ -46,6 +92,23 @@ type ServerConfig struct {
 	Port                string
 	StreamingServiceURL string
 	ServerIP            string
+	ShutdownTimeout     time.Duration // срок завершения текущих запросов по SIGTERM
+}
+
+type SecurityConfig struct {
+	APIToken   string // токен доступа к секретам ingest (Authorization: Bearer)
+	SecretsKey string // ключ шифрования секретов в базе данных, обязателен
+}
+
+// LegacyDefaultSecretsKey - ключ, который раньше подставлялся при пустом SECRETS_KEY.
+// Установки, зашифровавшие им пароли, должны задать его явно и перешифровать секреты.
+const LegacyDefaultSecretsKey = "default-secret-change-in-production"
+
+// SchedulerConfig - планировщик запусков и остановок потоков
+type SchedulerConfig struct {
+	Enabled     bool          // SCHEDULER_ENABLED=false отключает планировщик на этой реплике
+	Interval    time.Duration // период проверки слотов
+	MaxLateness time.Duration // пропущенные дольше слоты не выполняются
 }
 
 // NewConfig создает новую конфигурацию из переменных окружения
@@ -63,6 +126,16 @@ func NewConfig() *Config {
 			Port:                GetEnv("SERVER_PORT", ":8080"),
 			StreamingServiceURL: GetEnv("STREAMING_SERVICE_URL", "http://streaming-service:8081"),
 			ServerIP:            GetEnv("SERVER_IP", "192.168.3.55"),
+			ShutdownTimeout:     GetEnvDuration("SHUTDOWN_TIMEOUT", 20*time.Second),
+		},
+		SecurityConfig: &SecurityConfig{
+			APIToken:   GetEnv("API_TOKEN", ""),
+			SecretsKey: GetEnv("SECRETS_KEY", ""),
+		},
+		SchedulerConfig: &SchedulerConfig{
+			Enabled:     GetEnv("SCHEDULER_ENABLED", "true") != "false",
+			Interval:    GetEnvDuration("SCHEDULER_INTERVAL", 10*time.Second),
+			MaxLateness: GetEnvDuration("SCHEDULER_MAX_LATENESS", 5*time.Minute),
 		},
 	}
 }
@@ -0,0 +1,167 @@
+package hls
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdBreak - рекламная пауза на шкале сегментов медиа-плейлиста
+type AdBreak struct {
+	ID          string
+	Start       time.Time     // EXT-X-PROGRAM-DATE-TIME первого сегмента паузы
+	Planned     time.Duration // заявленная длительность, 0 - неизвестна
+	OutSequence uint64        // первый сегмент паузы
+	InSequence  uint64        // первый сегмент после паузы, 0 - пауза продолжается
+	End         time.Time     // EXT-X-PROGRAM-DATE-TIME сегмента InSequence
+	SCTE35Out   []byte        // splice_info_section начала паузы
+	SCTE35In    []byte        // splice_info_section возврата в эфир
+}
+
+// adBreakTags - теги разметки пауз; при повторной разметке прежние удаляются
+var adBreakTags = map[string]bool{
+	"#EXT-X-DATERANGE":    true,
+	"#EXT-X-CUE-OUT":      true,
+	"#EXT-X-CUE-OUT-CONT": true,
+	"#EXT-X-CUE-IN":       true,
+}
+
+// playlistHeaderTags - теги медиа-плейлиста, относящиеся ко всему плейлисту, а не к сегменту
+var playlistHeaderTags = map[string]bool{
+	"#EXTM3U":                       true,
+	"#EXT-X-VERSION":                true,
+	"#EXT-X-TARGETDURATION":         true,
+	"#EXT-X-MEDIA-SEQUENCE":         true,
+	"#EXT-X-DISCONTINUITY-SEQUENCE": true,
+	"#EXT-X-PLAYLIST-TYPE":          true,
+	"#EXT-X-INDEPENDENT-SEGMENTS":   true,
+	"#EXT-X-ALLOW-CACHE":            true,
+	"#EXT-X-START":                  true,
+}
+
+// TagAdBreaks размечает медиа-плейлист паузами: EXT-X-DATERANGE с SCTE35-OUT/SCTE35-IN
+// (RFC 8216) и теги EXT-X-CUE-OUT / EXT-X-CUE-OUT-CONT / EXT-X-CUE-IN для плееров
+// и SSAI, которые понимают только их. Прежняя разметка удаляется, поэтому
+// повторный вызов с теми же паузами возвращает тот же плейлист.
+func TagAdBreaks(playlist string, breaks []AdBreak) (string, error) {
+	lines := strings.Split(strings.TrimRight(playlist, "\n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "#EXTM3U" {
+		return "", fmt.Errorf("missing #EXTM3U header")
+	}
+
+	var out strings.Builder
+	var block []string
+	var mediaSequence, index uint64
+	var pdt time.Time // время начала текущего сегмента
+	var duration float64
+	inSegments := false
+
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		tag, value, _ := strings.Cut(line, ":")
+		switch {
+		case adBreakTags[tag]:
+			continue
+
+		case !inSegments && (line == "" || playlistHeaderTags[tag]):
+			if tag == "#EXT-X-MEDIA-SEQUENCE" {
+				seq, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					return "", fmt.Errorf("invalid media sequence %q", value)
+				}
+				mediaSequence = seq
+			}
+			out.WriteString(line + "\n")
+			continue
+
+		case strings.HasPrefix(line, "#"):
+			inSegments = true
+			switch tag {
+			case "#EXT-X-PROGRAM-DATE-TIME":
+				if t, ok := parseDateTime(value); ok {
+					pdt = t
+				}
+			case "#EXTINF":
+				durationStr, _, _ := strings.Cut(value, ",")
+				duration, _ = strconv.ParseFloat(strings.TrimSpace(durationStr), 64)
+			}
+			block = append(block, line)
+			continue
+
+		case line == "":
+			block = append(block, line)
+			continue
+		}
+
+		// URI завершает сегмент: разметка ставится перед его тегами
+		inSegments = true
+		for _, tagLine := range adBreakLines(breaks, mediaSequence+index, pdt) {
+			out.WriteString(tagLine + "\n")
+		}
+		for _, blockLine := range block {
+			out.WriteString(blockLine + "\n")
+		}
+		out.WriteString(line + "\n")
+		block = block[:0]
+		index++
+		if !pdt.IsZero() {
+			pdt = pdt.Add(time.Duration(duration * float64(time.Second)))
+		}
+	}
+	// Теги после последнего сегмента (EXT-X-ENDLIST)
+	for _, blockLine := range block {
+		out.WriteString(blockLine + "\n")
+	}
+	return out.String(), nil
+}
+
+// adBreakLines - теги пауз перед сегментом seq, начинающимся в pdt
+func adBreakLines(breaks []AdBreak, seq uint64, pdt time.Time) []string {
+	var lines []string
+	for _, b := range breaks {
+		switch {
+		case seq == b.OutSequence:
+			daterange := fmt.Sprintf(`#EXT-X-DATERANGE:ID="%s",START-DATE="%s"`, b.ID, formatDateTime(b.Start))
+			cueOut := "#EXT-X-CUE-OUT"
+			if b.Planned > 0 {
+				daterange += fmt.Sprintf(",PLANNED-DURATION=%.3f", b.Planned.Seconds())
+				cueOut += fmt.Sprintf(":DURATION=%.3f", b.Planned.Seconds())
+			}
+			if len(b.SCTE35Out) > 0 {
+				daterange += fmt.Sprintf(",SCTE35-OUT=0x%X", b.SCTE35Out)
+			}
+			lines = append(lines, daterange, cueOut)
+
+		case seq > b.OutSequence && (b.InSequence == 0 || seq < b.InSequence):
+			attrs := []string{}
+			if !pdt.IsZero() {
+				attrs = append(attrs, fmt.Sprintf("ElapsedTime=%.3f", max(pdt.Sub(b.Start).Seconds(), 0)))
+			}
+			if b.Planned > 0 {
+				attrs = append(attrs, fmt.Sprintf("Duration=%.3f", b.Planned.Seconds()))
+			}
+			cont := "#EXT-X-CUE-OUT-CONT"
+			if len(attrs) > 0 {
+				cont += ":" + strings.Join(attrs, ",")
+			}
+			lines = append(lines, cont)
+
+		case b.InSequence != 0 && seq == b.InSequence:
+			daterange := fmt.Sprintf(`#EXT-X-DATERANGE:ID="%s",START-DATE="%s"`, b.ID, formatDateTime(b.Start))
+			if !b.End.IsZero() {
+				daterange += fmt.Sprintf(`,END-DATE="%s",DURATION=%.3f`, formatDateTime(b.End), b.End.Sub(b.Start).Seconds())
+			}
+			if len(b.SCTE35In) > 0 {
+				daterange += fmt.Sprintf(",SCTE35-IN=0x%X", b.SCTE35In)
+			}
+			lines = append(lines, daterange, "#EXT-X-CUE-IN")
+		}
+	}
+	return lines
+}
+
+// formatDateTime - дата ISO 8601 с миллисекундами, как в EXT-X-PROGRAM-DATE-TIME
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
@@ -0,0 +1,97 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	// tsProbeBytes - сколько байт сегмента просматривается в поисках PTS
+	tsProbeBytes = 1 << 20
+)
+
+// ErrNoPTS - в начале сегмента нет PES-пакета с PTS
+var ErrNoPTS = errors.New("no PTS found in MPEG-TS segment")
+
+// FirstPTSFile - FirstPTS для сегмента на диске
+func FirstPTSFile(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return FirstPTS(f)
+}
+
+// FirstPTS возвращает PTS (90 кГц) первого видео PES-пакета MPEG-TS сегмента,
+// а если видео нет - первого аудио. Нужен для X-TIMESTAMP-MAP субтитров WebVTT.
+func FirstPTS(r io.Reader) (uint64, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	packet := make([]byte, tsPacketSize)
+
+	var audioPTS uint64
+	audioFound := false
+	for read := 0; read < tsProbeBytes; read += tsPacketSize {
+		if _, err := io.ReadFull(br, packet); err != nil {
+			break
+		}
+		if packet[0] != tsSyncByte {
+			return 0, errors.New("lost MPEG-TS sync")
+		}
+		if packet[1]&0x40 == 0 {
+			continue // не начало PES
+		}
+
+		payload := packet[4:]
+		switch (packet[3] >> 4) & 0x03 {
+		case 0x01:
+		case 0x03:
+			adaptationLength := int(packet[4])
+			if 1+adaptationLength >= len(payload) {
+				continue
+			}
+			payload = payload[1+adaptationLength:]
+		default:
+			continue // нет полезной нагрузки
+		}
+
+		streamID, pts, ok := pesPTS(payload)
+		if !ok {
+			continue
+		}
+		switch {
+		case streamID >= 0xE0 && streamID <= 0xEF:
+			return pts, nil
+		case streamID >= 0xC0 && streamID <= 0xDF && !audioFound:
+			audioPTS, audioFound = pts, true
+		}
+	}
+
+	if audioFound {
+		return audioPTS, nil
+	}
+	return 0, ErrNoPTS
+}
+
+// pesPTS разбирает заголовок PES-пакета
+func pesPTS(payload []byte) (streamID byte, pts uint64, ok bool) {
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 {
+		return 0, 0, false
+	}
+	streamID = payload[3]
+	if payload[7]&0x80 == 0 {
+		return streamID, 0, false // PTS отсутствует
+	}
+	b := payload[9:14]
+	pts = uint64(b[0]>>1&0x07)<<30 |
+		uint64(b[1])<<22 |
+		uint64(b[2]>>1)<<15 |
+		uint64(b[3])<<7 |
+		uint64(b[4]>>1)
+	return streamID, pts, true
+}
@@ -0,0 +1,337 @@
+// Package hls разбирает master- и медиа-плейлисты HLS (RFC 8216) и проверяет
+// живые медиа-плейлисты: превышение target duration, сброс media sequence,
+// остановку плейлиста и сегменты, которых нет на диске. Для субтитров пакет
+// формирует сегменты WebVTT и читает PTS сегментов MPEG-TS, для рекламы -
+// разбирает и формирует метки SCTE-35 и размечает ими медиа-плейлисты.
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Playlist - результат разбора m3u8: ровно одно из полей заполнено
+type Playlist struct {
+	Master *MasterPlaylist `json:"master,omitempty"`
+	Media  *MediaPlaylist  `json:"media,omitempty"`
+}
+
+// MasterPlaylist - список вариантов (EXT-X-STREAM-INF) и альтернативных дорожек (EXT-X-MEDIA)
+type MasterPlaylist struct {
+	Version             int            `json:"version,omitempty"`
+	IndependentSegments bool           `json:"independent_segments,omitempty"`
+	Variants            []Variant      `json:"variants"`
+	Renditions          []MediaTagInfo `json:"renditions,omitempty"`
+}
+
+// Variant - вариант потока из EXT-X-STREAM-INF
+type Variant struct {
+	URI              string  `json:"uri"`
+	Bandwidth        int     `json:"bandwidth"`
+	AverageBandwidth int     `json:"average_bandwidth,omitempty"`
+	Resolution       string  `json:"resolution,omitempty"`
+	Codecs           string  `json:"codecs,omitempty"`
+	FrameRate        float64 `json:"frame_rate,omitempty"`
+	Audio            string  `json:"audio,omitempty"`
+	Subtitles        string  `json:"subtitles,omitempty"`
+}
+
+// MediaTagInfo - альтернативная дорожка из EXT-X-MEDIA (аудио, субтитры)
+type MediaTagInfo struct {
+	Type     string `json:"type"`
+	GroupID  string `json:"group_id"`
+	Name     string `json:"name"`
+	Language string `json:"language,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+}
+
+// MediaPlaylist - медиа-плейлист со списком сегментов
+type MediaPlaylist struct {
+	Version               int       `json:"version,omitempty"`
+	TargetDuration        int       `json:"target_duration"`
+	MediaSequence         uint64    `json:"media_sequence"`
+	DiscontinuitySequence uint64    `json:"discontinuity_sequence,omitempty"`
+	PlaylistType          string    `json:"playlist_type,omitempty"` // EVENT, VOD или пусто для live
+	EndList               bool      `json:"endlist"`
+	MapURI                string    `json:"map_uri,omitempty"` // init-сегмент fMP4 (EXT-X-MAP)
+	Segments              []Segment `json:"segments"`
+}
+
+// Segment - медиасегмент плейлиста
+type Segment struct {
+	Sequence        uint64     `json:"sequence"`
+	URI             string     `json:"uri"`
+	Duration        float64    `json:"duration"`
+	Title           string     `json:"title,omitempty"`
+	Discontinuity   bool       `json:"discontinuity,omitempty"`
+	ProgramDateTime *time.Time `json:"program_date_time,omitempty"`
+}
+
+// Duration - суммарная длительность сегментов
+func (m *MediaPlaylist) Duration() float64 {
+	total := 0.0
+	for _, seg := range m.Segments {
+		total += seg.Duration
+	}
+	return total
+}
+
+// LastSequence - номер последнего сегмента; вместе с MediaSequence показывает,
+// продвигается ли живой плейлист. Для пустого плейлиста равен MediaSequence.
+func (m *MediaPlaylist) LastSequence() uint64 {
+	if len(m.Segments) == 0 {
+		return m.MediaSequence
+	}
+	return m.Segments[len(m.Segments)-1].Sequence
+}
+
+// Discontinuities - число разрывов (EXT-X-DISCONTINUITY) в текущем окне
+func (m *MediaPlaylist) Discontinuities() int {
+	count := 0
+	for _, seg := range m.Segments {
+		if seg.Discontinuity {
+			count++
+		}
+	}
+	return count
+}
+
+// ParseFile читает и разбирает плейлист с диска
+func ParseFile(path string) (*Playlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse разбирает master- или медиа-плейлист. Неизвестные теги (в том числе
+// EXT-X-PART и другие теги LL-HLS) пропускаются.
+func Parse(r io.Reader) (*Playlist, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("empty playlist")
+	}
+	if strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff")) != "#EXTM3U" {
+		return nil, errors.New("missing #EXTM3U header")
+	}
+
+	master := &MasterPlaylist{Variants: []Variant{}}
+	media := &MediaPlaylist{Segments: []Segment{}}
+	isMaster, isMedia := false, false
+
+	var pendingVariant *Variant
+	var pending Segment
+	hasPending := false
+
+	for lineNo := 2; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			switch {
+			case pendingVariant != nil:
+				pendingVariant.URI = line
+				master.Variants = append(master.Variants, *pendingVariant)
+				pendingVariant = nil
+			case hasPending:
+				pending.URI = line
+				media.Segments = append(media.Segments, pending)
+				pending = Segment{}
+				hasPending = false
+			default:
+				return nil, fmt.Errorf("line %d: URI without #EXTINF or #EXT-X-STREAM-INF", lineNo)
+			}
+			continue
+		}
+
+		tag, value, _ := strings.Cut(line, ":")
+		switch tag {
+		case "#EXT-X-VERSION":
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid version %q", lineNo, value)
+			}
+			master.Version, media.Version = v, v
+
+		case "#EXT-X-INDEPENDENT-SEGMENTS":
+			master.IndependentSegments = true
+
+		case "#EXT-X-STREAM-INF":
+			isMaster = true
+			variant, err := parseVariant(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			pendingVariant = &variant
+
+		case "#EXT-X-MEDIA":
+			isMaster = true
+			attrs := parseAttributes(value)
+			master.Renditions = append(master.Renditions, MediaTagInfo{
+				Type:     attrs["TYPE"],
+				GroupID:  attrs["GROUP-ID"],
+				Name:     attrs["NAME"],
+				Language: attrs["LANGUAGE"],
+				URI:      attrs["URI"],
+				Default:  attrs["DEFAULT"] == "YES",
+			})
+
+		case "#EXT-X-TARGETDURATION":
+			isMedia = true
+			d, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid target duration %q", lineNo, value)
+			}
+			media.TargetDuration = d
+
+		case "#EXT-X-MEDIA-SEQUENCE":
+			isMedia = true
+			seq, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid media sequence %q", lineNo, value)
+			}
+			if len(media.Segments) > 0 || hasPending {
+				return nil, fmt.Errorf("line %d: EXT-X-MEDIA-SEQUENCE after first segment", lineNo)
+			}
+			media.MediaSequence = seq
+
+		case "#EXT-X-DISCONTINUITY-SEQUENCE":
+			seq, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid discontinuity sequence %q", lineNo, value)
+			}
+			media.DiscontinuitySequence = seq
+
+		case "#EXT-X-PLAYLIST-TYPE":
+			media.PlaylistType = value
+
+		case "#EXT-X-ENDLIST":
+			isMedia = true
+			media.EndList = true
+
+		case "#EXT-X-MAP":
+			media.MapURI = parseAttributes(value)["URI"]
+
+		case "#EXT-X-DISCONTINUITY":
+			pending.Discontinuity = true
+
+		case "#EXT-X-PROGRAM-DATE-TIME":
+			if t, ok := parseDateTime(value); ok {
+				pending.ProgramDateTime = &t
+			}
+
+		case "#EXTINF":
+			isMedia = true
+			durationStr, title, _ := strings.Cut(value, ",")
+			d, err := strconv.ParseFloat(strings.TrimSpace(durationStr), 64)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("line %d: invalid segment duration %q", lineNo, durationStr)
+			}
+			pending.Duration = d
+			pending.Title = title
+			pending.Sequence = media.MediaSequence + uint64(len(media.Segments))
+			hasPending = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if isMaster && isMedia {
+		return nil, errors.New("playlist mixes master and media tags")
+	}
+	if isMaster {
+		if pendingVariant != nil {
+			return nil, errors.New("EXT-X-STREAM-INF without URI")
+		}
+		return &Playlist{Master: master}, nil
+	}
+	if hasPending {
+		// Последний #EXTINF без URI: плейлист прочитан во время записи
+		return nil, errors.New("EXTINF without URI")
+	}
+	return &Playlist{Media: media}, nil
+}
+
+// parseDateTime принимает ISO 8601 со смещением как с двоеточием, так и без него
+// (ffmpeg пишет 2024-01-02T15:04:05.000+0000)
+func parseDateTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// RoundedDuration - длительность сегмента, округленная по правилам EXT-X-TARGETDURATION
+func RoundedDuration(d float64) int {
+	return int(math.Round(d))
+}
+
+func parseVariant(value string) (Variant, error) {
+	attrs := parseAttributes(value)
+	bandwidth, err := strconv.Atoi(attrs["BANDWIDTH"])
+	if err != nil {
+		return Variant{}, errors.New("EXT-X-STREAM-INF without valid BANDWIDTH")
+	}
+	variant := Variant{
+		Bandwidth:  bandwidth,
+		Resolution: attrs["RESOLUTION"],
+		Codecs:     attrs["CODECS"],
+		Audio:      attrs["AUDIO"],
+		Subtitles:  attrs["SUBTITLES"],
+	}
+	if avg, err := strconv.Atoi(attrs["AVERAGE-BANDWIDTH"]); err == nil {
+		variant.AverageBandwidth = avg
+	}
+	if fps, err := strconv.ParseFloat(attrs["FRAME-RATE"], 64); err == nil {
+		variant.FrameRate = fps
+	}
+	return variant, nil
+}
+
+// parseAttributes разбирает список атрибутов вида KEY=VALUE,KEY="quoted,value"
+func parseAttributes(value string) map[string]string {
+	attrs := make(map[string]string)
+	for value != "" {
+		key, rest, ok := strings.Cut(value, "=")
+		if !ok {
+			break
+		}
+		key = strings.TrimSpace(key)
+
+		var attr string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				attr, rest = rest[1:], ""
+			} else {
+				attr, rest = rest[1:end+1], rest[end+2:]
+			}
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			attr, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[key] = attr
+		value = rest
+	}
+	return attrs
+}
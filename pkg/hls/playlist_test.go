@@ -0,0 +1,206 @@
+package hls
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMedia(t *testing.T) {
+	pdt := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		playlist string
+		want     MediaPlaylist
+	}{
+		{
+			name: "live window numbered from media sequence",
+			playlist: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:120
+
+#EXTINF:4.000,
+segment_120.ts
+#EXTINF:3.500,title
+segment_121.ts
+`,
+			want: MediaPlaylist{
+				Version:        3,
+				TargetDuration: 4,
+				MediaSequence:  120,
+				Segments: []Segment{
+					{Sequence: 120, URI: "segment_120.ts", Duration: 4},
+					{Sequence: 121, URI: "segment_121.ts", Duration: 3.5, Title: "title"},
+				},
+			},
+		},
+		{
+			name: "byte order mark, CRLF, discontinuity and program date time",
+			playlist: "\ufeff#EXTM3U\r\n#EXT-X-TARGETDURATION:2\r\n#EXT-X-DISCONTINUITY-SEQUENCE:3\r\n" +
+				"#EXT-X-PROGRAM-DATE-TIME:2024-01-02T15:04:05.000+0000\r\n#EXTINF:2,\r\na.ts\r\n" +
+				"#EXT-X-DISCONTINUITY\r\n#EXTINF:2,\r\nb.ts\r\n",
+			want: MediaPlaylist{
+				TargetDuration:        2,
+				DiscontinuitySequence: 3,
+				Segments: []Segment{
+					{Sequence: 0, URI: "a.ts", Duration: 2, ProgramDateTime: &pdt},
+					{Sequence: 1, URI: "b.ts", Duration: 2, Discontinuity: true},
+				},
+			},
+		},
+		{
+			name: "fMP4 VOD with map and endlist, unknown tags skipped",
+			playlist: `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init_0.m4s"
+#EXT-X-PART-INF:PART-TARGET=0.5
+#EXTINF:4.000,
+chunk_0_00001.m4s
+#EXT-X-ENDLIST
+`,
+			want: MediaPlaylist{
+				Version:        7,
+				TargetDuration: 4,
+				PlaylistType:   "VOD",
+				EndList:        true,
+				MapURI:         "init_0.m4s",
+				Segments:       []Segment{{Sequence: 0, URI: "chunk_0_00001.m4s", Duration: 4}},
+			},
+		},
+		{
+			name:     "empty live playlist",
+			playlist: "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:7\n",
+			want:     MediaPlaylist{TargetDuration: 4, MediaSequence: 7, Segments: []Segment{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := Parse(strings.NewReader(tt.playlist))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Master != nil || parsed.Media == nil {
+				t.Fatalf("Parse() = %+v, want media playlist", parsed)
+			}
+			// Время сравнивается через Equal: смещение +0000 дает зону без имени
+			got := *parsed.Media
+			for i, seg := range got.Segments {
+				if i < len(tt.want.Segments) && seg.ProgramDateTime != nil && tt.want.Segments[i].ProgramDateTime != nil &&
+					seg.ProgramDateTime.Equal(*tt.want.Segments[i].ProgramDateTime) {
+					got.Segments[i].ProgramDateTime = tt.want.Segments[i].ProgramDateTime
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaPlaylistSummary(t *testing.T) {
+	parsed, err := Parse(strings.NewReader(`#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:10
+#EXTINF:4,
+a.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:2.5,
+b.ts
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := parsed.Media
+	if m.Duration() != 6.5 || m.LastSequence() != 11 || m.Discontinuities() != 1 {
+		t.Fatalf("Duration() = %v, LastSequence() = %d, Discontinuities() = %d", m.Duration(), m.LastSequence(), m.Discontinuities())
+	}
+	empty := &MediaPlaylist{MediaSequence: 5}
+	if empty.LastSequence() != 5 {
+		t.Fatalf("LastSequence() of empty playlist = %d, want 5", empty.LastSequence())
+	}
+}
+
+func TestParseMaster(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Русский",LANGUAGE="ru",DEFAULT=YES,URI="subtitles/ru/playlist.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=2628000,AVERAGE-BANDWIDTH=2500000,RESOLUTION=1280x720,CODECS="avc1.64001f,mp4a.40.2",FRAME-RATE=25.000,SUBTITLES="subs"
+720p/playlist.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=128000,CODECS="mp4a.40.2"
+audio/playlist.m3u8
+`
+	parsed, err := Parse(strings.NewReader(playlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Media != nil || parsed.Master == nil {
+		t.Fatalf("Parse() = %+v, want master playlist", parsed)
+	}
+
+	want := MasterPlaylist{
+		Version:             6,
+		IndependentSegments: true,
+		Variants: []Variant{
+			{
+				URI:              "720p/playlist.m3u8",
+				Bandwidth:        2628000,
+				AverageBandwidth: 2500000,
+				Resolution:       "1280x720",
+				Codecs:           "avc1.64001f,mp4a.40.2",
+				FrameRate:        25,
+				Subtitles:        "subs",
+			},
+			{URI: "audio/playlist.m3u8", Bandwidth: 128000, Codecs: "mp4a.40.2"},
+		},
+		Renditions: []MediaTagInfo{{
+			Type:     "SUBTITLES",
+			GroupID:  "subs",
+			Name:     "Русский",
+			Language: "ru",
+			URI:      "subtitles/ru/playlist.m3u8",
+			Default:  true,
+		}},
+	}
+	if !reflect.DeepEqual(*parsed.Master, want) {
+		t.Fatalf("Parse() = %+v\nwant %+v", *parsed.Master, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     string
+	}{
+		{"empty", "", "empty playlist"},
+		{"missing header", "#EXT-X-TARGETDURATION:4\n", "missing #EXTM3U header"},
+		{"invalid version", "#EXTM3U\n#EXT-X-VERSION:x\n", "line 2: invalid version"},
+		{"invalid target duration", "#EXTM3U\n#EXT-X-TARGETDURATION:4.5\n", "line 2: invalid target duration"},
+		{"invalid media sequence", "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:-1\n", "line 2: invalid media sequence"},
+		{"media sequence after segment", "#EXTM3U\n#EXTINF:4,\na.ts\n#EXT-X-MEDIA-SEQUENCE:3\n", "line 4: EXT-X-MEDIA-SEQUENCE after first segment"},
+		{"invalid discontinuity sequence", "#EXTM3U\n#EXT-X-DISCONTINUITY-SEQUENCE:x\n", "line 2: invalid discontinuity sequence"},
+		{"invalid duration", "#EXTM3U\n#EXTINF:abc,\na.ts\n", "line 2: invalid segment duration"},
+		{"negative duration", "#EXTM3U\n#EXTINF:-1,\na.ts\n", "line 2: invalid segment duration"},
+		{"URI without tag", "#EXTM3U\n#EXT-X-TARGETDURATION:4\na.ts\n", "line 3: URI without #EXTINF or #EXT-X-STREAM-INF"},
+		{"EXTINF without URI", "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\n", "EXTINF without URI"},
+		{"variant without bandwidth", "#EXTM3U\n#EXT-X-STREAM-INF:RESOLUTION=1280x720\nv.m3u8\n", "line 2: EXT-X-STREAM-INF without valid BANDWIDTH"},
+		{"variant without URI", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\n", "EXT-X-STREAM-INF without URI"},
+		{"mixed master and media", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nv.m3u8\n#EXT-X-TARGETDURATION:4\n", "playlist mixes master and media tags"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.playlist))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Parse() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
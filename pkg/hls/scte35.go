@@ -0,0 +1,286 @@
+package hls
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Команды splice_info_section (SCTE 35)
+const (
+	SpliceInsertCommand = 0x05
+	TimeSignalCommand   = 0x06
+
+	scte35TableID = 0xFC
+	// minSectionLength - заголовок до splice_command_type (14 байт),
+	// descriptor_loop_length и CRC_32 при пустой команде
+	minSectionLength = 14 + 2 + 4
+	// segmentationDescriptorTag - segmentation_descriptor с идентификатором CUEI
+	segmentationDescriptorTag = 0x02
+	cueIdentifier             = 0x43554549
+)
+
+// Типы segmentation_descriptor, начинающие и завершающие рекламную паузу:
+// break, provider/distributor advertisement, placement opportunity
+var (
+	segmentationBreakStart = map[byte]bool{0x22: true, 0x30: true, 0x32: true, 0x34: true, 0x36: true}
+	segmentationBreakEnd   = map[byte]bool{0x23: true, 0x31: true, 0x33: true, 0x35: true, 0x37: true}
+)
+
+// SpliceInfo - рекламная метка из splice_insert или time_signal
+type SpliceInfo struct {
+	Command      byte
+	EventID      uint32
+	Cancel       bool
+	OutOfNetwork bool          // начало паузы (cue-out); false - возврат в эфир (cue-in)
+	Duration     time.Duration // длительность паузы, 0 - неизвестна
+}
+
+// ErrNotSplice - секция не описывает начало или конец рекламной паузы
+var ErrNotSplice = errors.New("SCTE-35 section is not an ad break signal")
+
+// SectionLength - полная длина splice_info_section по ее заголовку
+// или 0, если заголовок еще не прочитан
+func SectionLength(header []byte) int {
+	if len(header) < 3 {
+		return 0
+	}
+	return 3 + (int(header[1]&0x0F)<<8 | int(header[2]))
+}
+
+// ParseSCTE35 разбирает splice_info_section. Поддерживаются splice_insert
+// и time_signal с segmentation_descriptor; остальные команды дают ErrNotSplice.
+func ParseSCTE35(section []byte) (SpliceInfo, error) {
+	if len(section) < 3 || section[0] != scte35TableID {
+		return SpliceInfo{}, errors.New("not a SCTE-35 splice_info_section")
+	}
+	// Длину проверяем по section_length: данные после секции (выравнивание) не в счет
+	length := SectionLength(section)
+	if length > len(section) {
+		return SpliceInfo{}, errors.New("truncated SCTE-35 section")
+	}
+	if length < minSectionLength {
+		return SpliceInfo{}, errors.New("SCTE-35 section is too short")
+	}
+	section = section[:length]
+	if crc32MPEG(section) != 0 {
+		return SpliceInfo{}, errors.New("SCTE-35 CRC mismatch")
+	}
+	if section[4]&0x80 != 0 {
+		return SpliceInfo{}, errors.New("encrypted SCTE-35 sections are not supported")
+	}
+
+	commandLength := int(section[11]&0x0F)<<8 | int(section[12])
+	info := SpliceInfo{Command: section[13]}
+	r := &bitReader{data: section[14 : length-4]}
+
+	switch info.Command {
+	case SpliceInsertCommand:
+		if err := parseSpliceInsert(r, &info); err != nil {
+			return SpliceInfo{}, err
+		}
+		return info, nil
+
+	case TimeSignalCommand:
+		r.spliceTime()
+		// 0xFFF - длина команды не указана (старые энкодеры), берем разобранную
+		if commandLength != 0xFFF {
+			r.pos = commandLength
+		}
+		loopLength := int(r.uint(16))
+		if r.err != nil || r.pos+loopLength > len(r.data) {
+			return SpliceInfo{}, errors.New("truncated SCTE-35 descriptors")
+		}
+		return parseSegmentationDescriptors(r.data[r.pos:r.pos+loopLength], info)
+	}
+	return SpliceInfo{}, ErrNotSplice
+}
+
+func parseSpliceInsert(r *bitReader, info *SpliceInfo) error {
+	info.EventID = uint32(r.uint(32))
+	info.Cancel = r.uint(1) == 1
+	r.uint(7)
+	if info.Cancel {
+		return r.err
+	}
+
+	info.OutOfNetwork = r.uint(1) == 1
+	programSplice := r.uint(1) == 1
+	hasDuration := r.uint(1) == 1
+	immediate := r.uint(1) == 1
+	r.uint(4)
+
+	if programSplice && !immediate {
+		r.spliceTime()
+	}
+	if !programSplice {
+		components := int(r.uint(8))
+		for i := 0; i < components; i++ {
+			r.uint(8)
+			if !immediate {
+				r.spliceTime()
+			}
+		}
+	}
+	if hasDuration {
+		r.uint(1) // auto_return
+		r.uint(6)
+		info.Duration = ptsDuration(r.uint(33))
+	}
+	if r.err != nil {
+		return errors.New("truncated SCTE-35 splice_insert")
+	}
+	return nil
+}
+
+// parseSegmentationDescriptors ищет первый segmentation_descriptor паузы
+func parseSegmentationDescriptors(loop []byte, info SpliceInfo) (SpliceInfo, error) {
+	for len(loop) >= 2 {
+		tag, length := loop[0], int(loop[1])
+		if 2+length > len(loop) {
+			break
+		}
+		body := loop[2 : 2+length]
+		loop = loop[2+length:]
+		if tag != segmentationDescriptorTag || length < 9 || binary.BigEndian.Uint32(body) != cueIdentifier {
+			continue
+		}
+
+		r := &bitReader{data: body[4:]}
+		info.EventID = uint32(r.uint(32))
+		info.Cancel = r.uint(1) == 1
+		r.uint(7)
+		if info.Cancel {
+			return info, r.err
+		}
+		programSegmentation := r.uint(1) == 1
+		hasDuration := r.uint(1) == 1
+		r.uint(6)
+		if !programSegmentation {
+			components := int(r.uint(8))
+			for i := 0; i < components; i++ {
+				r.uint(48)
+			}
+		}
+		if hasDuration {
+			info.Duration = ptsDuration(r.uint(40))
+		}
+		r.uint(8) // segmentation_upid_type
+		r.skip(int(r.uint(8)))
+		segmentationType := byte(r.uint(8))
+		if r.err != nil {
+			return SpliceInfo{}, errors.New("truncated SCTE-35 segmentation_descriptor")
+		}
+
+		switch {
+		case segmentationBreakStart[segmentationType]:
+			info.OutOfNetwork = true
+			return info, nil
+		case segmentationBreakEnd[segmentationType]:
+			info.OutOfNetwork = false
+			info.Duration = 0
+			return info, nil
+		}
+	}
+	return SpliceInfo{}, ErrNotSplice
+}
+
+// SpliceInsert формирует splice_info_section с немедленным splice_insert:
+// out - начало паузы длительностью duration (0 - без break_duration), иначе возврат в эфир
+func SpliceInsert(eventID uint32, out bool, duration time.Duration) []byte {
+	command := binary.BigEndian.AppendUint32(nil, eventID)
+	command = append(command, 0x7F) // splice_event_cancel_indicator=0
+
+	flags := byte(0x40 | 0x10 | 0x0F) // program_splice, splice_immediate
+	if out {
+		flags |= 0x80
+	}
+	if out && duration > 0 {
+		flags |= 0x20
+	}
+	command = append(command, flags)
+	if out && duration > 0 {
+		ticks := uint64(duration.Seconds()*90000) & (1<<33 - 1)
+		command = append(command, 0xFE|byte(ticks>>32)) // auto_return=1
+		command = binary.BigEndian.AppendUint32(command, uint32(ticks))
+	}
+	command = append(command, 0, 0, 0, 0) // unique_program_id, avail_num, avails_expected
+
+	// section_length: заголовок после него (11 байт), команда, descriptor_loop_length и CRC
+	sectionLength := 11 + len(command) + 2 + 4
+	section := []byte{
+		scte35TableID,
+		0x30 | byte(sectionLength>>8), byte(sectionLength), // sap_type=3 (не указан)
+		0,             // protocol_version
+		0, 0, 0, 0, 0, // encrypted_packet=0, pts_adjustment=0
+		0,                                                      // cw_index
+		0xFF, 0xF0 | byte(len(command)>>8), byte(len(command)), // tier=0xFFF, splice_command_length
+		SpliceInsertCommand,
+	}
+	section = append(section, command...)
+	section = append(section, 0, 0) // descriptor_loop_length
+	return binary.BigEndian.AppendUint32(section, crc32MPEG(section))
+}
+
+// ptsDuration переводит тики 90 кГц в длительность (без переполнения для 40 бит)
+func ptsDuration(ticks uint64) time.Duration {
+	return time.Duration(ticks/90000)*time.Second + time.Duration(ticks%90000)*time.Second/90000
+}
+
+// crc32MPEG - CRC-32/MPEG-2 секций MPEG-TS; для секции вместе с ее CRC равен нулю
+func crc32MPEG(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// bitReader читает поля секции старшими битами вперед; при выходе
+// за границы данных запоминает ошибку и возвращает нули
+type bitReader struct {
+	data []byte
+	pos  int // байт
+	bit  int // бит внутри байта
+	err  error
+}
+
+func (r *bitReader) uint(bits int) uint64 {
+	var v uint64
+	for ; bits > 0; bits-- {
+		if r.pos >= len(r.data) {
+			r.err = fmt.Errorf("unexpected end of data")
+			return 0
+		}
+		v = v<<1 | uint64(r.data[r.pos]>>(7-r.bit)&1)
+		if r.bit++; r.bit == 8 {
+			r.pos, r.bit = r.pos+1, 0
+		}
+	}
+	return v
+}
+
+func (r *bitReader) skip(bytes int) {
+	r.pos += bytes
+	if r.pos > len(r.data) {
+		r.err = fmt.Errorf("unexpected end of data")
+	}
+}
+
+// spliceTime пропускает splice_time(): 5 байт с PTS или 1 байт без него
+func (r *bitReader) spliceTime() {
+	if r.uint(1) == 1 {
+		r.uint(6)
+		r.uint(33)
+		return
+	}
+	r.uint(7)
+}
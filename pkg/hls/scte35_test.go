@@ -0,0 +1,245 @@
+package hls
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// buildSection собирает splice_info_section с командой body и циклом дескрипторов
+func buildSection(command byte, body, descriptors []byte) []byte {
+	sectionLength := 11 + len(body) + 2 + len(descriptors) + 4
+	section := []byte{
+		scte35TableID,
+		0x30 | byte(sectionLength>>8), byte(sectionLength),
+		0,
+		0, 0, 0, 0, 0,
+		0,
+		0xFF, 0xF0 | byte(len(body)>>8), byte(len(body)),
+		command,
+	}
+	section = append(section, body...)
+	section = binary.BigEndian.AppendUint16(section, uint16(len(descriptors)))
+	section = append(section, descriptors...)
+	return binary.BigEndian.AppendUint32(section, crc32MPEG(section))
+}
+
+// segmentationDescriptor - segmentation_descriptor программы целиком без UPID
+func segmentationDescriptor(eventID uint32, segmentationType byte, duration time.Duration) []byte {
+	body := binary.BigEndian.AppendUint32(nil, cueIdentifier)
+	body = binary.BigEndian.AppendUint32(body, eventID)
+	body = append(body, 0x7F) // segmentation_event_cancel_indicator=0
+	if duration > 0 {
+		body = append(body, 0xC0|0x3F) // program_segmentation, segmentation_duration
+		ticks := uint64(duration.Seconds() * 90000)
+		body = append(body, byte(ticks>>32))
+		body = binary.BigEndian.AppendUint32(body, uint32(ticks))
+	} else {
+		body = append(body, 0x80|0x3F)
+	}
+	body = append(body, 0, 0, segmentationType, 0, 0) // upid_type, upid_length, type, segment_num, segments_expected
+	return append([]byte{segmentationDescriptorTag, byte(len(body))}, body...)
+}
+
+// timeSignal - time_signal без PTS (splice_time с time_specified_flag=0)
+func timeSignal(descriptors []byte) []byte {
+	return buildSection(TimeSignalCommand, []byte{0x7F}, descriptors)
+}
+
+// withCRC дописывает CRC_32 к началу секции
+func withCRC(head []byte) []byte {
+	return binary.BigEndian.AppendUint32(append([]byte(nil), head...), crc32MPEG(head))
+}
+
+func TestParseSCTE35(t *testing.T) {
+	// splice_event_cancel_indicator=1
+	cancelInsert := buildSection(SpliceInsertCommand, append(binary.BigEndian.AppendUint32(nil, 7), 0xFF), nil)
+
+	badCRC := SpliceInsert(1, true, 0)
+	badCRC[len(badCRC)-1] ^= 0xFF
+
+	encrypted := SpliceInsert(1, true, 0)
+	encrypted[4] |= 0x80
+	encrypted = withCRC(encrypted[:len(encrypted)-4])
+
+	// section_length=7: CRC сходится, но секция короче заголовка; после нее выравнивание до 17 байт
+	short := withCRC([]byte{scte35TableID, 0x30, 0x07, 0, 0, 0})
+	short = append(short, make([]byte, 7)...)
+
+	undeclaredLength := timeSignal(segmentationDescriptor(11, 0x34, 0))
+	undeclaredLength[11] |= 0x0F
+	undeclaredLength[12] = 0xFF
+	undeclaredLength = withCRC(undeclaredLength[:len(undeclaredLength)-4])
+
+	tests := []struct {
+		name    string
+		section []byte
+		want    SpliceInfo
+		wantErr error // nil - без ошибки; errAny - любая ошибка, кроме ErrNotSplice
+	}{
+		{
+			name:    "splice_insert cue-out with duration",
+			section: SpliceInsert(42, true, 30*time.Second),
+			want:    SpliceInfo{Command: SpliceInsertCommand, EventID: 42, OutOfNetwork: true, Duration: 30 * time.Second},
+		},
+		{
+			name:    "splice_insert cue-out without duration",
+			section: SpliceInsert(43, true, 0),
+			want:    SpliceInfo{Command: SpliceInsertCommand, EventID: 43, OutOfNetwork: true},
+		},
+		{
+			name:    "splice_insert cue-in",
+			section: SpliceInsert(44, false, 0),
+			want:    SpliceInfo{Command: SpliceInsertCommand, EventID: 44},
+		},
+		{
+			name:    "splice_insert cancel",
+			section: cancelInsert,
+			want:    SpliceInfo{Command: SpliceInsertCommand, EventID: 7, Cancel: true},
+		},
+		{
+			name:    "trailing bytes after section",
+			section: append(SpliceInsert(45, true, 0), 0xFF, 0xFF, 0xFF),
+			want:    SpliceInfo{Command: SpliceInsertCommand, EventID: 45, OutOfNetwork: true},
+		},
+		{
+			name:    "time_signal break start",
+			section: timeSignal(segmentationDescriptor(9, 0x34, time.Minute)),
+			want:    SpliceInfo{Command: TimeSignalCommand, EventID: 9, OutOfNetwork: true, Duration: time.Minute},
+		},
+		{
+			name:    "time_signal break end",
+			section: timeSignal(segmentationDescriptor(9, 0x35, 0)),
+			want:    SpliceInfo{Command: TimeSignalCommand, EventID: 9},
+		},
+		{
+			name:    "time_signal with undeclared command length",
+			section: undeclaredLength,
+			want:    SpliceInfo{Command: TimeSignalCommand, EventID: 11, OutOfNetwork: true},
+		},
+		{
+			name:    "time_signal program start is not an ad break",
+			section: timeSignal(segmentationDescriptor(9, 0x10, 0)),
+			wantErr: ErrNotSplice,
+		},
+		{
+			name:    "time_signal without descriptors",
+			section: timeSignal(nil),
+			wantErr: ErrNotSplice,
+		},
+		{
+			name:    "splice_null",
+			section: buildSection(0x00, nil, nil),
+			wantErr: ErrNotSplice,
+		},
+		{name: "empty", section: nil, wantErr: errAny},
+		{name: "wrong table_id", section: append([]byte{0x00}, SpliceInsert(1, true, 0)[1:]...), wantErr: errAny},
+		{name: "crc mismatch", section: badCRC, wantErr: errAny},
+		{name: "encrypted", section: encrypted, wantErr: errAny},
+		{name: "truncated", section: SpliceInsert(1, true, 0)[:20], wantErr: errAny},
+		{name: "declared length shorter than header", section: short, wantErr: errAny},
+		{name: "header only", section: []byte{scte35TableID, 0x30, 0x00}, wantErr: errAny},
+		{
+			name:    "truncated splice_insert",
+			section: buildSection(SpliceInsertCommand, []byte{0, 0, 0, 1}, nil),
+			wantErr: errAny,
+		},
+		{
+			name: "descriptor loop longer than section",
+			section: func() []byte {
+				section := timeSignal(segmentationDescriptor(9, 0x34, 0))
+				section[15] = 0xFF // descriptor_loop_length
+				return withCRC(section[:len(section)-4])
+			}(),
+			wantErr: errAny,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSCTE35(tt.section)
+			switch {
+			case tt.wantErr == errAny:
+				if err == nil || errors.Is(err, ErrNotSplice) {
+					t.Fatalf("ParseSCTE35() error = %v, want parse error", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseSCTE35() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("ParseSCTE35() error = %v", err)
+			case got != tt.want:
+				t.Fatalf("ParseSCTE35() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// errAny - в таблице ожидается ошибка разбора
+var errAny = errors.New("any parse error")
+
+func TestSectionLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   int
+	}{
+		{"empty", nil, 0},
+		{"two bytes", []byte{scte35TableID, 0x30}, 0},
+		{"splice_insert", SpliceInsert(1, true, time.Second), len(SpliceInsert(1, true, time.Second))},
+		{"reserved bits ignored", []byte{scte35TableID, 0xF0, 0x11}, 20},
+		{"maximum", []byte{scte35TableID, 0x3F, 0xFF}, 3 + 0xFFF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SectionLength(tt.header); got != tt.want {
+				t.Fatalf("SectionLength() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpliceInsertRoundTrip(t *testing.T) {
+	for _, duration := range []time.Duration{0, time.Second, 90 * time.Second, 2 * time.Hour} {
+		section := SpliceInsert(100, true, duration)
+		if crc32MPEG(section) != 0 {
+			t.Fatalf("SpliceInsert(%s): CRC mismatch", duration)
+		}
+		info, err := ParseSCTE35(section)
+		if err != nil {
+			t.Fatalf("SpliceInsert(%s): %v", duration, err)
+		}
+		if info.Duration != duration || !info.OutOfNetwork || info.EventID != 100 {
+			t.Fatalf("SpliceInsert(%s) parsed as %+v", duration, info)
+		}
+	}
+}
+
+func FuzzParseSCTE35(f *testing.F) {
+	f.Add(SpliceInsert(1, true, 30*time.Second))
+	f.Add(SpliceInsert(2, false, 0))
+	f.Add(timeSignal(segmentationDescriptor(3, 0x34, time.Minute)))
+	f.Add(timeSignal(segmentationDescriptor(3, 0x35, 0)))
+	f.Add(append(withCRC([]byte{scte35TableID, 0x30, 0x07, 0, 0, 0}), make([]byte, 7)...))
+
+	f.Fuzz(func(t *testing.T, section []byte) {
+		info, err := ParseSCTE35(section)
+		if err == nil && info.Command != SpliceInsertCommand && info.Command != TimeSignalCommand {
+			t.Fatalf("unexpected command %#x without error", info.Command)
+		}
+	})
+}
+
+func FuzzSectionLength(f *testing.F) {
+	f.Add([]byte{scte35TableID, 0x30, 0x11})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, header []byte) {
+		got := SectionLength(header)
+		if len(header) < 3 && got != 0 || len(header) >= 3 && (got < 3 || got > 3+0xFFF) {
+			t.Fatalf("SectionLength(%x) = %d", header, got)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package hls
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stickySegmentTags - теги, действующие на все последующие сегменты: при удалении
+// сегмента, в блоке которого они стоят, последний из них переносится на первый оставшийся
+var stickySegmentTags = []string{"#EXT-X-MAP", "#EXT-X-KEY"}
+
+// playlistBlock - сегмент медиа-плейлиста вместе с предшествующими ему тегами
+type playlistBlock struct {
+	lines    []string // теги и URI
+	uri      string
+	duration float64
+	pdt      *time.Time
+	disc     bool
+}
+
+func (b *playlistBlock) has(tag string) bool {
+	for _, line := range b.lines {
+		if t, _, _ := strings.Cut(line, ":"); t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimLeadingSegments убирает из начала медиа-плейлиста сегменты, для URI которых
+// drop возвращает true, и сдвигает EXT-X-MEDIA-SEQUENCE и EXT-X-DISCONTINUITY-SEQUENCE,
+// чтобы номера оставшихся сегментов не изменились. EXT-X-MAP и EXT-X-KEY удаленных
+// сегментов переносятся на первый оставшийся, ему же при необходимости добавляется
+// EXT-X-PROGRAM-DATE-TIME. Последний сегмент не удаляется. Возвращает плейлист
+// и число удаленных сегментов; без удаления плейлист возвращается как есть.
+func TrimLeadingSegments(playlist string, drop func(uri string) bool) (string, int, error) {
+	lines := strings.Split(strings.TrimRight(playlist, "\n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(strings.TrimPrefix(lines[0], "\ufeff")) != "#EXTM3U" {
+		return "", 0, fmt.Errorf("missing #EXTM3U header")
+	}
+
+	var header, footer []string
+	var blocks []*playlistBlock
+	current := &playlistBlock{}
+	inSegments := false
+
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		tag, value, _ := strings.Cut(line, ":")
+		switch {
+		case !inSegments && (line == "" || playlistHeaderTags[tag]):
+			header = append(header, line)
+			continue
+		case line == "":
+			continue
+		}
+		inSegments = true
+		current.lines = append(current.lines, line)
+
+		switch {
+		case tag == "#EXTINF":
+			durationStr, _, _ := strings.Cut(value, ",")
+			d, err := strconv.ParseFloat(strings.TrimSpace(durationStr), 64)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid segment duration %q", durationStr)
+			}
+			current.duration = d
+		case tag == "#EXT-X-PROGRAM-DATE-TIME":
+			if t, ok := parseDateTime(value); ok {
+				current.pdt = &t
+			}
+		case tag == "#EXT-X-DISCONTINUITY":
+			current.disc = true
+		case !strings.HasPrefix(line, "#"):
+			current.uri = line
+			blocks = append(blocks, current)
+			current = &playlistBlock{}
+		}
+	}
+	// Теги после последнего URI (EXT-X-ENDLIST и т.п.)
+	footer = current.lines
+
+	n := 0
+	for n < len(blocks)-1 && drop(blocks[n].uri) {
+		n++
+	}
+	if n == 0 {
+		return playlist, 0, nil
+	}
+
+	// Состояние, которое удаленные сегменты передают первому оставшемуся
+	sticky := make(map[string]string)
+	discontinuities := 0
+	var nextPDT *time.Time
+	for _, b := range blocks[:n] {
+		for _, line := range b.lines {
+			tag, _, _ := strings.Cut(line, ":")
+			for _, st := range stickySegmentTags {
+				if tag == st {
+					sticky[st] = line
+				}
+			}
+		}
+		if b.disc {
+			discontinuities++
+		}
+		if b.pdt != nil {
+			t := *b.pdt
+			nextPDT = &t
+		}
+		if nextPDT != nil {
+			t := nextPDT.Add(time.Duration(b.duration * float64(time.Second)))
+			nextPDT = &t
+		}
+	}
+
+	first := blocks[n]
+	var prefix []string
+	for _, st := range stickySegmentTags {
+		if line, ok := sticky[st]; ok && !first.has(st) {
+			prefix = append(prefix, line)
+		}
+	}
+	// Разрыв перед первым сегментом учитывается в EXT-X-DISCONTINUITY-SEQUENCE
+	if first.disc {
+		discontinuities++
+		kept := first.lines[:0:0]
+		for _, line := range first.lines {
+			if line != "#EXT-X-DISCONTINUITY" {
+				kept = append(kept, line)
+			}
+		}
+		first.lines = kept
+	}
+	if first.pdt == nil && nextPDT != nil {
+		prefix = append(prefix, "#EXT-X-PROGRAM-DATE-TIME:"+nextPDT.Format("2006-01-02T15:04:05.000Z07:00"))
+	}
+	first.lines = append(prefix, first.lines...)
+
+	var out strings.Builder
+	hasMediaSequence, hasDiscontinuitySequence := false, false
+	for _, line := range header {
+		tag, value, _ := strings.Cut(line, ":")
+		switch tag {
+		case "#EXT-X-MEDIA-SEQUENCE":
+			seq, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid media sequence %q", value)
+			}
+			line = fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d", seq+uint64(n))
+			hasMediaSequence = true
+		case "#EXT-X-DISCONTINUITY-SEQUENCE":
+			seq, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid discontinuity sequence %q", value)
+			}
+			line = fmt.Sprintf("#EXT-X-DISCONTINUITY-SEQUENCE:%d", seq+uint64(discontinuities))
+			hasDiscontinuitySequence = true
+		}
+		if line != "" {
+			out.WriteString(line + "\n")
+		}
+	}
+	// Отсутствующие теги означают 0
+	if !hasMediaSequence {
+		fmt.Fprintf(&out, "#EXT-X-MEDIA-SEQUENCE:%d\n", n)
+	}
+	if !hasDiscontinuitySequence && discontinuities > 0 {
+		fmt.Fprintf(&out, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", discontinuities)
+	}
+	for _, b := range blocks[n:] {
+		for _, line := range b.lines {
+			out.WriteString(line + "\n")
+		}
+	}
+	for _, line := range footer {
+		out.WriteString(line + "\n")
+	}
+	return out.String(), n, nil
+}
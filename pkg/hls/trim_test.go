@@ -0,0 +1,200 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrimLeadingSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		drop     []string
+		want     string
+		wantN    int
+	}{
+		{
+			name: "drops leading segments and shifts media sequence",
+			playlist: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:00.000Z
+#EXTINF:4.000,
+segment_10.ts
+#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:04.000Z
+#EXTINF:4.000,
+segment_11.ts
+#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:08.000Z
+#EXTINF:4.000,
+segment_12.ts
+`,
+			drop: []string{"segment_10.ts", "segment_11.ts"},
+			want: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:12
+#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:08.000Z
+#EXTINF:4.000,
+segment_12.ts
+`,
+			wantN: 2,
+		},
+		{
+			name: "stops at first kept segment",
+			playlist: `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:0
+#EXTINF:4.000,
+a.ts
+#EXTINF:4.000,
+b.ts
+#EXTINF:4.000,
+c.ts
+`,
+			drop: []string{"a.ts", "c.ts"},
+			want: `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:1
+#EXTINF:4.000,
+b.ts
+#EXTINF:4.000,
+c.ts
+`,
+			wantN: 1,
+		},
+		{
+			name: "keeps last segment",
+			playlist: `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:5
+#EXTINF:4.000,
+a.ts
+#EXTINF:4.000,
+b.ts
+`,
+			drop: []string{"a.ts", "b.ts"},
+			want: `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:6
+#EXTINF:4.000,
+b.ts
+`,
+			wantN: 1,
+		},
+		{
+			name: "carries map and program date time, counts discontinuities",
+			playlist: `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:1
+#EXT-X-MAP:URI="init_0.m4s"
+#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:00.000Z
+#EXTINF:4.000,
+chunk_0_00001.m4s
+#EXT-X-DISCONTINUITY
+#EXTINF:2.000,
+chunk_0_00002.m4s
+#EXT-X-DISCONTINUITY
+#EXTINF:4.000,
+chunk_0_00003.m4s
+#EXTINF:4.000,
+chunk_0_00004.m4s
+`,
+			drop: []string{"chunk_0_00001.m4s", "chunk_0_00002.m4s"},
+			want: `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:3
+#EXT-X-DISCONTINUITY-SEQUENCE:2
+#EXT-X-MAP:URI="init_0.m4s"
+#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:06.000Z
+#EXTINF:4.000,
+chunk_0_00003.m4s
+#EXTINF:4.000,
+chunk_0_00004.m4s
+`,
+			wantN: 2,
+		},
+		{
+			name: "shifts existing discontinuity sequence and keeps endlist",
+			playlist: `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-DISCONTINUITY-SEQUENCE:3
+#EXTINF:4.000,
+a.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:4.000,
+b.ts
+#EXTINF:4.000,
+c.ts
+#EXT-X-ENDLIST
+`,
+			drop: []string{"a.ts", "b.ts"},
+			want: `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:9
+#EXT-X-DISCONTINUITY-SEQUENCE:4
+#EXTINF:4.000,
+c.ts
+#EXT-X-ENDLIST
+`,
+			wantN: 2,
+		},
+		{
+			name: "nothing to drop",
+			playlist: `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.000,
+a.ts
+`,
+			drop: []string{"b.ts"},
+			want: `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.000,
+a.ts
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drop := make(map[string]bool)
+			for _, uri := range tt.drop {
+				drop[uri] = true
+			}
+			got, n, err := TrimLeadingSegments(tt.playlist, func(uri string) bool { return drop[uri] })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || n != tt.wantN {
+				t.Fatalf("TrimLeadingSegments() = %d segments\n%s\nwant %d\n%s", n, got, tt.wantN, tt.want)
+			}
+
+			// Номера и разрывы оставшихся сегментов не меняются
+			before, err := Parse(strings.NewReader(tt.playlist))
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := Parse(strings.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, seg := range after.Media.Segments {
+				orig := before.Media.Segments[i+n]
+				if seg.URI != orig.URI || seg.Sequence != orig.Sequence {
+					t.Fatalf("segment %s has sequence %d, want %d", seg.URI, seg.Sequence, orig.Sequence)
+				}
+			}
+		})
+	}
+}
+
+func TestTrimLeadingSegmentsErrors(t *testing.T) {
+	for _, playlist := range []string{"", "segment.ts\n", "#EXTM3U\n#EXTINF:x,\na.ts\n"} {
+		if _, _, err := TrimLeadingSegments(playlist, func(string) bool { return true }); err == nil {
+			t.Errorf("TrimLeadingSegments(%q) succeeded, want error", playlist)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package hls
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Коды проблем плейлиста
+const (
+	IssueMissingTargetDuration  = "missing_target_duration"  // нет EXT-X-TARGETDURATION
+	IssueTargetDurationExceeded = "target_duration_exceeded" // сегмент длиннее target duration
+	IssueMissingSegment         = "missing_segment"          // сегмента из плейлиста нет на диске
+	IssueSequenceReset          = "sequence_reset"           // media sequence пошел назад
+	IssueStalled                = "stalled"                  // новых сегментов нет дольше StallAfter
+	IssueEndList                = "endlist"                  // живой плейлист закрыт EXT-X-ENDLIST
+)
+
+// Issue - проблема, найденная в плейлисте
+type Issue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	URI     string `json:"uri,omitempty"`
+}
+
+// Validate проверяет медиа-плейлист без учета истории: каждый EXTINF, округленный
+// до целого, не должен превышать EXT-X-TARGETDURATION (RFC 8216, 4.3.3.1)
+func Validate(m *MediaPlaylist) []Issue {
+	var issues []Issue
+	if m.TargetDuration <= 0 {
+		issues = append(issues, Issue{Code: IssueMissingTargetDuration, Message: "EXT-X-TARGETDURATION is missing"})
+		return issues
+	}
+	for _, seg := range m.Segments {
+		if RoundedDuration(seg.Duration) > m.TargetDuration {
+			issues = append(issues, Issue{
+				Code:    IssueTargetDurationExceeded,
+				Message: fmt.Sprintf("segment %d lasts %.3fs, target duration is %ds", seg.Sequence, seg.Duration, m.TargetDuration),
+				URI:     seg.URI,
+			})
+		}
+	}
+	return issues
+}
+
+// MissingSegments возвращает сегменты (и init-сегмент EXT-X-MAP) с относительными URI,
+// которых нет в каталоге плейлиста dir. Абсолютные URL не проверяются.
+func MissingSegments(m *MediaPlaylist, dir string) []Issue {
+	uris := make([]string, 0, len(m.Segments)+1)
+	if m.MapURI != "" {
+		uris = append(uris, m.MapURI)
+	}
+	for _, seg := range m.Segments {
+		uris = append(uris, seg.URI)
+	}
+
+	var issues []Issue
+	for _, uri := range uris {
+		if strings.Contains(uri, "://") || strings.HasPrefix(uri, "/") {
+			continue
+		}
+		name, _, _ := strings.Cut(uri, "?")
+		clean := path.Clean(name)
+		if strings.HasPrefix(clean, "..") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(clean))); err != nil {
+			issues = append(issues, Issue{Code: IssueMissingSegment, Message: "segment file not found", URI: uri})
+		}
+	}
+	return issues
+}
+
+// Analysis - состояние живого медиа-плейлиста по результатам очередной проверки
+type Analysis struct {
+	CheckedAt        time.Time `json:"checked_at"`
+	TargetDuration   int       `json:"target_duration"`
+	MediaSequence    uint64    `json:"media_sequence"`
+	LastSequence     uint64    `json:"last_sequence"`
+	SegmentCount     int       `json:"segment_count"`
+	WindowSeconds    float64   `json:"window_seconds"`
+	Discontinuities  int       `json:"discontinuities"`
+	EndList          bool      `json:"endlist"`
+	LastAdvance      time.Time `json:"last_advance"`
+	Advanced         bool      `json:"advanced"` // с прошлой проверки появились новые сегменты
+	Stalled          bool      `json:"stalled"`
+	SequenceResets   int       `json:"sequence_resets"`
+	TargetViolations int       `json:"target_duration_violations"`
+	Issues           []Issue   `json:"issues"`
+}
+
+// Monitor отслеживает один живой медиа-плейлист между проверками.
+// Не потокобезопасен: вызывается из одной горутины монитора потока.
+type Monitor struct {
+	// StallFactor - сколько target duration можно ждать нового сегмента
+	StallFactor float64
+
+	prev        *MediaPlaylist
+	lastAdvance time.Time
+	resets      int
+}
+
+func NewMonitor() *Monitor {
+	return &Monitor{StallFactor: 3}
+}
+
+// Observe сравнивает плейлист с предыдущей проверкой. dir - каталог плейлиста
+// для проверки сегментов; пустой dir отключает проверку файлов.
+func (mon *Monitor) Observe(m *MediaPlaylist, dir string, now time.Time) Analysis {
+	analysis := Analysis{
+		CheckedAt:       now,
+		TargetDuration:  m.TargetDuration,
+		MediaSequence:   m.MediaSequence,
+		LastSequence:    m.LastSequence(),
+		SegmentCount:    len(m.Segments),
+		WindowSeconds:   m.Duration(),
+		Discontinuities: m.Discontinuities(),
+		EndList:         m.EndList,
+		Issues:          []Issue{},
+	}
+
+	issues := Validate(m)
+	for _, issue := range issues {
+		if issue.Code == IssueTargetDurationExceeded {
+			analysis.TargetViolations++
+		}
+	}
+	analysis.Issues = append(analysis.Issues, issues...)
+	if dir != "" {
+		analysis.Issues = append(analysis.Issues, MissingSegments(m, dir)...)
+	}
+	if m.EndList {
+		analysis.Issues = append(analysis.Issues, Issue{Code: IssueEndList, Message: "live playlist has EXT-X-ENDLIST"})
+	}
+
+	switch {
+	case mon.prev == nil:
+		// Первая проверка: плейлист считается продвинувшимся, если в нем уже есть сегменты
+		analysis.Advanced = len(m.Segments) > 0
+	case m.MediaSequence < mon.prev.MediaSequence || m.LastSequence() < mon.prev.LastSequence():
+		// Сброс нумерации: энкодер или ffmpeg перезапущен и начал плейлист заново
+		mon.resets++
+		analysis.Advanced = true
+		analysis.Issues = append(analysis.Issues, Issue{
+			Code:    IssueSequenceReset,
+			Message: fmt.Sprintf("media sequence went back from %d to %d", mon.prev.MediaSequence, m.MediaSequence),
+		})
+	default:
+		analysis.Advanced = m.LastSequence() > mon.prev.LastSequence() ||
+			(len(mon.prev.Segments) == 0 && len(m.Segments) > 0)
+	}
+	if analysis.Advanced || mon.lastAdvance.IsZero() {
+		mon.lastAdvance = now
+	}
+	mon.prev = m
+
+	analysis.LastAdvance = mon.lastAdvance
+	analysis.SequenceResets = mon.resets
+
+	stallAfter := time.Duration(mon.StallFactor * float64(max(m.TargetDuration, 1)) * float64(time.Second))
+	if !m.EndList && now.Sub(mon.lastAdvance) > stallAfter {
+		analysis.Stalled = true
+		analysis.Issues = append(analysis.Issues, Issue{
+			Code:    IssueStalled,
+			Message: fmt.Sprintf("no new segments for %s", now.Sub(mon.lastAdvance).Round(time.Second)),
+		})
+	}
+	return analysis
+}
@@ -0,0 +1,226 @@
+package hls
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// livePlaylist - живой плейлист из count сегментов по 4 секунды начиная с first
+func livePlaylist(first, count int) *MediaPlaylist {
+	m := &MediaPlaylist{TargetDuration: 4, MediaSequence: uint64(first), Segments: []Segment{}}
+	for i := 0; i < count; i++ {
+		seq := uint64(first + i)
+		m.Segments = append(m.Segments, Segment{Sequence: seq, URI: fmt.Sprintf("segment_%d.ts", seq), Duration: 4})
+	}
+	return m
+}
+
+func issueCodes(issues []Issue) []string {
+	codes := []string{}
+	for _, issue := range issues {
+		codes = append(codes, issue.Code)
+	}
+	return codes
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     []string
+		wantURIs []string
+	}{
+		{
+			name:     "valid",
+			playlist: "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.000,\na.ts\n#EXTINF:3.999,\nb.ts\n",
+			want:     []string{},
+		},
+		{
+			name:     "duration rounded down fits target",
+			playlist: "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.499,\na.ts\n",
+			want:     []string{},
+		},
+		{
+			name:     "target duration violation",
+			playlist: "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.000,\na.ts\n#EXTINF:4.500,\nb.ts\n#EXTINF:8.000,\nc.ts\n",
+			want:     []string{IssueTargetDurationExceeded, IssueTargetDurationExceeded},
+			wantURIs: []string{"b.ts", "c.ts"},
+		},
+		{
+			name:     "missing target duration",
+			playlist: "#EXTM3U\n#EXTINF:30.000,\na.ts\n",
+			want:     []string{IssueMissingTargetDuration},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := Parse(strings.NewReader(tt.playlist))
+			if err != nil {
+				t.Fatal(err)
+			}
+			issues := Validate(parsed.Media)
+			if got := issueCodes(issues); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Validate() codes = %v, want %v", got, tt.want)
+			}
+			for i, uri := range tt.wantURIs {
+				if issues[i].URI != uri {
+					t.Errorf("issue %d URI = %q, want %q", i, issues[i].URI, uri)
+				}
+			}
+		})
+	}
+}
+
+func TestMissingSegments(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"init_0.m4s", "a.ts", filepath.Join("720p", "b.ts")} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755)
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &MediaPlaylist{
+		TargetDuration: 4,
+		MapURI:         "init_1.m4s",
+		Segments: []Segment{
+			{URI: "a.ts?token=1"},
+			{URI: "720p/b.ts"},
+			{URI: "gone.ts"},
+			{URI: "https://cdn.example.com/remote.ts"},
+			{URI: "/absolute.ts"},
+			{URI: "../outside.ts"},
+		},
+	}
+	issues := MissingSegments(m, dir)
+	var uris []string
+	for _, issue := range issues {
+		if issue.Code != IssueMissingSegment {
+			t.Fatalf("unexpected issue %+v", issue)
+		}
+		uris = append(uris, issue.URI)
+	}
+	if want := []string{"init_1.m4s", "gone.ts"}; !reflect.DeepEqual(uris, want) {
+		t.Fatalf("MissingSegments() URIs = %v, want %v", uris, want)
+	}
+}
+
+func TestMonitorObserve(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Шаги проверяются по порядку одним монитором
+	type step struct {
+		at       time.Duration
+		playlist *MediaPlaylist
+		dir      bool // проверять файлы сегментов
+
+		advanced bool
+		stalled  bool
+		resets   int
+		codes    []string
+	}
+	endList := livePlaylist(20, 2)
+	endList.EndList = true
+	violation := livePlaylist(21, 3)
+	violation.Segments[2].Duration = 6
+
+	tests := []struct {
+		name  string
+		files []int // номера сегментов на диске
+		steps []step
+	}{
+		{
+			name: "advancing playlist",
+			steps: []step{
+				{at: 0, playlist: livePlaylist(10, 3), advanced: true, codes: []string{}},
+				{at: 4 * time.Second, playlist: livePlaylist(11, 3), advanced: true, codes: []string{}},
+				{at: 6 * time.Second, playlist: livePlaylist(11, 3), codes: []string{}},
+			},
+		},
+		{
+			name: "stall after three target durations",
+			steps: []step{
+				{at: 0, playlist: livePlaylist(10, 3), advanced: true, codes: []string{}},
+				{at: 12 * time.Second, playlist: livePlaylist(10, 3), codes: []string{}},
+				{at: 13 * time.Second, playlist: livePlaylist(10, 3), stalled: true, codes: []string{IssueStalled}},
+				{at: 14 * time.Second, playlist: livePlaylist(11, 3), advanced: true, codes: []string{}},
+			},
+		},
+		{
+			name: "sequence reset",
+			steps: []step{
+				{at: 0, playlist: livePlaylist(100, 3), advanced: true, codes: []string{}},
+				{at: 4 * time.Second, playlist: livePlaylist(0, 1), advanced: true, resets: 1, codes: []string{IssueSequenceReset}},
+				{at: 8 * time.Second, playlist: livePlaylist(0, 2), advanced: true, resets: 1, codes: []string{}},
+			},
+		},
+		{
+			name: "endlist does not stall",
+			steps: []step{
+				{at: 0, playlist: livePlaylist(18, 3), advanced: true, codes: []string{}},
+				{at: 4 * time.Second, playlist: endList, advanced: true, codes: []string{IssueEndList}},
+				{at: time.Minute, playlist: endList, codes: []string{IssueEndList}},
+			},
+		},
+		{
+			name:  "missing segment and target duration violation",
+			files: []int{21, 23},
+			steps: []step{
+				{at: 0, playlist: violation, dir: true, advanced: true, codes: []string{IssueTargetDurationExceeded, IssueMissingSegment}},
+			},
+		},
+		{
+			name: "empty playlist is not advanced",
+			steps: []step{
+				{at: 0, playlist: livePlaylist(0, 0), codes: []string{}},
+				{at: 2 * time.Second, playlist: livePlaylist(0, 1), advanced: true, codes: []string{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, seq := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("segment_%d.ts", seq)), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mon := NewMonitor()
+			for i, st := range tt.steps {
+				checkDir := ""
+				if st.dir {
+					checkDir = dir
+				}
+				got := mon.Observe(st.playlist, checkDir, start.Add(st.at))
+				if got.Advanced != st.advanced || got.Stalled != st.stalled || got.SequenceResets != st.resets {
+					t.Fatalf("step %d: advanced=%v stalled=%v resets=%d, want %v %v %d",
+						i, got.Advanced, got.Stalled, got.SequenceResets, st.advanced, st.stalled, st.resets)
+				}
+				if codes := issueCodes(got.Issues); !reflect.DeepEqual(codes, st.codes) {
+					t.Fatalf("step %d: issue codes = %v, want %v", i, codes, st.codes)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitorObserveSummary(t *testing.T) {
+	m := livePlaylist(5, 3)
+	m.Segments[1].Discontinuity = true
+	m.Segments[2].Duration = 6
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	got := NewMonitor().Observe(m, "", now)
+	if got.MediaSequence != 5 || got.LastSequence != 7 || got.SegmentCount != 3 || got.WindowSeconds != 14 ||
+		got.Discontinuities != 1 || got.TargetViolations != 1 || !got.LastAdvance.Equal(now) || !got.CheckedAt.Equal(now) {
+		t.Fatalf("Observe() = %+v", got)
+	}
+}
@@ -0,0 +1,50 @@
+package hls
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cue - фраза субтитров на шкале WebVTT-сегмента
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// WebVTTSegment формирует сегмент субтитров HLS. X-TIMESTAMP-MAP связывает
+// локальное время local с PTS mpegts медиасегмента, поэтому время фраз
+// в разных сегментах отсчитывается от одного начала.
+func WebVTTSegment(mpegts uint64, local time.Duration, cues []Cue) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	fmt.Fprintf(&b, "X-TIMESTAMP-MAP=MPEGTS:%d,LOCAL:%s\n", mpegts, FormatVTTTime(local))
+	for _, cue := range cues {
+		fmt.Fprintf(&b, "\n%s --> %s\n%s\n", FormatVTTTime(cue.Start), FormatVTTTime(cue.End), escapeCueText(cue.Text))
+	}
+	return b.String()
+}
+
+// FormatVTTTime - время WebVTT вида 00:01:02.345
+func FormatVTTTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// escapeCueText экранирует разметку WebVTT и убирает пустые строки,
+// которые завершили бы фразу раньше времени
+func escapeCueText(text string) string {
+	text = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "-->", "--&gt;").Replace(text)
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
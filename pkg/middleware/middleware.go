@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -73,3 +75,16 @@ func RequestIDMiddleware() func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// IsAuthorized проверяет токен API в заголовке "Authorization: Bearer <token>".
+// При пустом ожидаемом токене доступ к секретам закрыт для всех.
+func IsAuthorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
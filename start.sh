@@ -18,6 +18,12 @@ echo "🌐 Запуск с IP адресом: $SERVER_IP"
 # Экспортируем переменную окружения
 export SERVER_IP=$SERVER_IP
 
+# Ключ шифрования секретов в базе обязателен, значения по умолчанию нет
+if [ -z "$SECRETS_KEY" ] && ! grep -qs '^SECRETS_KEY=.' deployments/.env; then
+    echo "❌ SECRETS_KEY не задан: задайте случайный ключ, например: export SECRETS_KEY=\$(openssl rand -hex 32)"
+    exit 1
+fi
+
 # Переходим в папку deployments
 cd deployments/
 
@@ -470,6 +470,7 @@ class StreamManager {
                                 <strong>Время начала потока:</strong> ${this.formatDate(streamData.stream_start)}
                             </div>
                             ` : ''}
+                            ${this.renderIngestStats(streamData.ingest_stats)}
                         </div>
                     `;
                 } else {
@@ -492,6 +493,23 @@ class StreamManager {
         }
     }
 
+    // Качество ingest по метрикам ffmpeg -progress
+    renderIngestStats(stats) {
+        if (!stats || !stats.latest) {
+            return '';
+        }
+        const latest = stats.latest;
+        return `
+            <div class="url-item">
+                <strong>Ingest:</strong>
+                ${latest.bitrate_kbps.toFixed(0)} кбит/с, ${latest.fps.toFixed(1)} fps,
+                скорость ${latest.speed.toFixed(2)}x,
+                потеряно кадров: ${latest.drop_frames}, дублировано: ${latest.dup_frames}
+                ${stats.stale ? ' ⚠️ нет свежих данных' : ''}
+            </div>
+        `;
+    }
+
     async copyToClipboard(text) {
         try {
             if (navigator.clipboard?.writeText) {